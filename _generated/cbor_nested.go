@@ -0,0 +1,11 @@
+package _generated
+
+//go:generate msgp -cbor
+
+// CBORNested has slices of slices, whose elements are
+// bounded by the second of their allocbounds
+type CBORNested struct {
+	_struct struct{}  `codec:",omitempty,omitemptyarray"`
+	L       [][]int64 `codec:"l,allocbound=4,3"`
+	S       [][]byte  `codec:"s,allocbound=4,3"`
+}
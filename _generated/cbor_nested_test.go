@@ -0,0 +1,23 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCBORNestedBound(t *testing.T) {
+	in := CBORNested{L: [][]int64{{1, 2, 3}, {}}, S: [][]byte{{1}, {2, 3, 4}}}
+	var out CBORNested
+	if _, err := out.UnmarshalCBOR(in.MarshalCBOR(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("decoded %v; want %v", out, in)
+	}
+
+	// past the inner bound
+	in.L[1] = []int64{1, 2, 3, 4}
+	if _, err := out.UnmarshalCBOR(in.MarshalCBOR(nil)); err == nil {
+		t.Error("decoded an inner slice longer than its allocbound")
+	}
+}
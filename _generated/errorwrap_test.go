@@ -217,43 +217,43 @@ func expectedAsTuple() []string {
 	var out []string
 	for _, s := range []string{
 		`Val`,
-		`Child/Val`,
-		`Children/0/Val`,
-		`Children/1/Val`,
-		`ComplexChild/Val1`,
-		`ComplexChild/Val2`,
-		`ComplexChild/Val3`,
-		`ComplexChild/Val4`,
-		`ComplexChild/Val5`,
+		`Child.Val`,
+		`Children[0].Val`,
+		`Children[1].Val`,
+		`ComplexChild.Val1`,
+		`ComplexChild.Val2`,
+		`ComplexChild.Val3`,
+		`ComplexChild.Val4`,
+		`ComplexChild.Val5`,
 		`Map`,
-		`Map/baz`,
+		`Map.baz`,
 		`Map`,
-		`Map/foo`,
+		`Map.foo`,
 		`Nest`,
-		`Nest/Val`,
+		`Nest.Val`,
 		`Nest`,
-		`Nest/Child/Val`,
+		`Nest.Child.Val`,
 		`Nest`,
-		`Nest/Children/0/Val`,
-		`Nest/Children/1/Val`,
+		`Nest.Children[0].Val`,
+		`Nest.Children[1].Val`,
 		`Nest`,
-		`Nest/Map`,
-		`Nest/Map/foo`,
-		`Nest/Map`,
-		`Nest/Map/baz`,
+		`Nest.Map`,
+		`Nest.Map.foo`,
+		`Nest.Map`,
+		`Nest.Map.baz`,
 		`Nest`,
-		`Nest/Nest`,
-		`Nest/Nest/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Child/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Children/0/Val`,
-		`Nest/Nest/Children/1/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Map`,
-		`Nest/Nest/Map/foo`,
-		`Nest/Nest/Map`,
-		`Nest/Nest/Map/baz`,
+		`Nest.Nest`,
+		`Nest.Nest.Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Child.Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Children[0].Val`,
+		`Nest.Nest.Children[1].Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Map`,
+		`Nest.Nest.Map.foo`,
+		`Nest.Nest.Map`,
+		`Nest.Nest.Map.baz`,
 	} {
 		if s == "" {
 			out = append(out, errPrefix)
@@ -275,58 +275,58 @@ func expectedAsMap() []string {
 		`Val`,
 		``,
 		`Child`,
-		`Child/Val`,
+		`Child.Val`,
 		``,
-		`Children/0`,
-		`Children/0/Val`,
-		`Children/1`,
-		`Children/1/Val`,
+		`Children[0]`,
+		`Children[0].Val`,
+		`Children[1]`,
+		`Children[1].Val`,
 		`ComplexChild`,
-		`ComplexChild/Val1`,
+		`ComplexChild.Val1`,
 		`ComplexChild`,
-		`ComplexChild/Val2`,
+		`ComplexChild.Val2`,
 		`ComplexChild`,
-		`ComplexChild/Val3`,
+		`ComplexChild.Val3`,
 		`ComplexChild`,
-		`ComplexChild/Val4`,
+		`ComplexChild.Val4`,
 		`ComplexChild`,
-		`ComplexChild/Val5`,
+		`ComplexChild.Val5`,
 		`Map`,
-		`Map/foo`,
+		`Map.foo`,
 		`Map`,
-		`Map/baz`,
+		`Map.baz`,
 		``,
 		`Nest`,
-		`Nest/Val`,
+		`Nest.Val`,
 		`Nest`,
-		`Nest/Child`,
-		`Nest/Child/Val`,
+		`Nest.Child`,
+		`Nest.Child.Val`,
 		`Nest`,
-		`Nest/Children/0`,
-		`Nest/Children/0/Val`,
-		`Nest/Children/1`,
-		`Nest/Children/1/Val`,
+		`Nest.Children[0]`,
+		`Nest.Children[0].Val`,
+		`Nest.Children[1]`,
+		`Nest.Children[1].Val`,
 		`Nest`,
-		`Nest/Map`,
-		`Nest/Map/foo`,
-		`Nest/Map`,
-		`Nest/Map/baz`,
+		`Nest.Map`,
+		`Nest.Map.foo`,
+		`Nest.Map`,
+		`Nest.Map.baz`,
 		`Nest`,
-		`Nest/Nest`,
-		`Nest/Nest/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Child`,
-		`Nest/Nest/Child/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Children/0`,
-		`Nest/Nest/Children/0/Val`,
-		`Nest/Nest/Children/1`,
-		`Nest/Nest/Children/1/Val`,
-		`Nest/Nest`,
-		`Nest/Nest/Map`,
-		`Nest/Nest/Map/baz`,
-		`Nest/Nest/Map`,
-		`Nest/Nest/Map/foo`,
+		`Nest.Nest`,
+		`Nest.Nest.Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Child`,
+		`Nest.Nest.Child.Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Children[0]`,
+		`Nest.Nest.Children[0].Val`,
+		`Nest.Nest.Children[1]`,
+		`Nest.Nest.Children[1].Val`,
+		`Nest.Nest`,
+		`Nest.Nest.Map`,
+		`Nest.Nest.Map.baz`,
+		`Nest.Nest.Map`,
+		`Nest.Nest.Map.foo`,
 	} {
 		if s == "" {
 			out = append(out, errPrefix)
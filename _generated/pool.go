@@ -0,0 +1,17 @@
+package _generated
+
+//go:generate msgp -reset
+
+//msgp:pool PoolLeaf
+
+type PoolLeaf struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	N int64 `codec:"n"`
+}
+
+type Pooled struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+
+	Leaves []*PoolLeaf `codec:"leaves,allocbound=8"`
+}
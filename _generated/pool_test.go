@@ -0,0 +1,34 @@
+package _generated
+
+import "testing"
+
+func TestResetPoolTruncated(t *testing.T) {
+	kept, dropped := &PoolLeaf{N: 1}, &PoolLeaf{N: 2}
+	p := Pooled{Leaves: []*PoolLeaf{kept, dropped}}
+	p.Leaves = p.Leaves[:1]
+	p.Reset()
+
+	// the caller still holds the dropped leaf, so
+	// the pool must never hand it out
+	for i := 0; i < 4; i++ {
+		if GetPoolLeaf() == dropped {
+			t.Fatal("Reset put back a leaf past the length of the slice")
+		}
+	}
+	if dropped.N != 2 {
+		t.Errorf("Reset cleared a leaf past the length of the slice: %+v", dropped)
+	}
+	if l := p.Leaves[:cap(p.Leaves)]; l[0] != nil || l[1] != nil {
+		t.Errorf("Reset kept pointers in the slice: %v", l)
+	}
+}
+
+func TestResetPoolDuplicate(t *testing.T) {
+	leaf := &PoolLeaf{N: 1}
+	p := Pooled{Leaves: []*PoolLeaf{leaf, leaf}}
+	p.Reset()
+
+	if a, b := GetPoolLeaf(), GetPoolLeaf(); a == b {
+		t.Fatal("Reset put back a leaf twice")
+	}
+}
@@ -0,0 +1,27 @@
+package _generated
+
+//go:generate msgp
+
+// Reflected has fields of the kinds that msgp.UnmarshalReflect
+// decodes, which it should decode as UnmarshalMsg does
+type Reflected struct {
+	_struct struct{}          `codec:",omitempty,omitemptyarray"`
+	Int     int64             `codec:"i"`
+	Uint    uint32            `codec:"u"`
+	Str     string            `codec:"s"`
+	Bin     []byte            `codec:"b"`
+	Float   float64           `codec:"f"`
+	Bool    bool              `codec:"t"`
+	List    []int16           `codec:"l,allocbound=16"`
+	Names   map[string]uint64 `codec:"m,allocbound=16"`
+	Arr     [3]uint8          `codec:"a"`
+	Ptr     *ReflectedInner   `codec:"p"`
+	Inner   ReflectedInner    `codec:"in"`
+	Skipped int               `codec:"-"`
+}
+
+type ReflectedInner struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       int64    `codec:"x"`
+	Y       []string `codec:"y,allocbound=4"`
+}
@@ -0,0 +1,46 @@
+package _generated
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+// reflected has no methods, so UnmarshalReflect decodes
+// it by reflection rather than by its UnmarshalMsg
+type reflected Reflected
+
+func TestUnmarshalReflectLikeGenerated(t *testing.T) {
+	full := Reflected{
+		Int:   -5,
+		Uint:  70000,
+		Str:   "str",
+		Bin:   []byte{1, 2},
+		Float: 1.5,
+		Bool:  true,
+		List:  []int16{-1, 300},
+		Names: map[string]uint64{"a": 1, "b": 1 << 40},
+		Arr:   [3]uint8{7, 8, 9},
+		Ptr:   &ReflectedInner{X: 1, Y: []string{"y"}},
+		Inner: ReflectedInner{X: 2},
+	}
+	for name, bts := range map[string][]byte{
+		"full":  full.MarshalMsg(nil),
+		"empty": (&Reflected{}).MarshalMsg(nil),
+		"nil":   msgp.AppendNil(nil),
+	} {
+		var gen, refl Reflected
+		left, err := gen.UnmarshalMsg(bts)
+		if err != nil || len(left) != 0 {
+			t.Fatalf("%s: UnmarshalMsg left %d bytes: %v", name, len(left), err)
+		}
+		left, err = msgp.UnmarshalReflect(bts, (*reflected)(&refl))
+		if err != nil || len(left) != 0 {
+			t.Fatalf("%s: UnmarshalReflect left %d bytes: %v", name, len(left), err)
+		}
+		if !reflect.DeepEqual(gen, refl) {
+			t.Errorf("%s: UnmarshalReflect decoded\n%#v\nUnmarshalMsg\n%#v", name, refl, gen)
+		}
+	}
+}
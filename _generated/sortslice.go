@@ -0,0 +1,11 @@
+package _generated
+
+//go:generate msgp -equal
+
+// SortSliced is encoded with its elements sorted, and so is
+// Equal to values with the same elements in another order
+type SortSliced struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	I       []int64  `codec:"i,sortslice,allocbound=8"`
+	S       []string `codec:"s,sortslice,allocbound=8"`
+}
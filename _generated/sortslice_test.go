@@ -0,0 +1,34 @@
+package _generated
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSortSliceEqual(t *testing.T) {
+	a := SortSliced{I: []int64{58, -73, 0}, S: []string{"b", "a"}}
+	b := SortSliced{I: []int64{-73, 0, 58}, S: []string{"a", "b"}}
+	if !bytes.Equal(a.MarshalMsg(nil), b.MarshalMsg(nil)) {
+		t.Fatal("sortslice fields encode in the order of their elements")
+	}
+	if !a.Equal(&b) || !b.Equal(&a) {
+		t.Error("values that encode the same are not Equal")
+	}
+
+	// decoded, the elements are sorted, and still Equal
+	var out SortSliced
+	if _, err := out.UnmarshalMsg(a.MarshalMsg(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if !out.Equal(&a) {
+		t.Errorf("%v is not Equal to %v", out, a)
+	}
+	if a.I[0] != 58 {
+		t.Error("Equal sorted the slice it compared")
+	}
+
+	b.I[0] = 1
+	if a.Equal(&b) {
+		t.Error("values with different elements are Equal")
+	}
+}
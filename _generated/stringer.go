@@ -0,0 +1,31 @@
+package _generated
+
+import "fmt"
+
+//go:generate msgp
+
+//msgp:text StringerID
+//msgp:stringer Stringed StringedLeaf
+
+// StringerID is encoded as its text, and has no String method
+type StringerID [4]byte
+
+func (id StringerID) MarshalText() ([]byte, error) { return []byte(fmt.Sprintf("%x", id[:])), nil }
+
+func (id *StringerID) UnmarshalText(text []byte) error {
+	_, err := fmt.Sscanf(string(text), "%x", id)
+	return err
+}
+
+type StringedLeaf struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	N       int64    `codec:"n"`
+}
+
+// Stringed has fields that its String method writes as the
+// values they refer to
+type Stringed struct {
+	_struct struct{}        `codec:",omitempty,omitemptyarray"`
+	ID      StringerID      `codec:"id"`
+	Leaves  []*StringedLeaf `codec:"l,allocbound=8"`
+}
@@ -0,0 +1,14 @@
+package _generated
+
+import "testing"
+
+func TestStringerValues(t *testing.T) {
+	s := Stringed{
+		ID:     StringerID{1, 2},
+		Leaves: []*StringedLeaf{{N: 1}, nil, {N: 2}},
+	}
+	const want = "Stringed{ID:01020000 Leaves:[StringedLeaf{N:1} <nil> StringedLeaf{N:2}]}"
+	if got := s.String(); got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,554 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func cborMarshal(w io.Writer, topics *Topics) *cborMarshalGen {
+	return &cborMarshalGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// cborMarshalGen prints MarshalCBOR methods, which encode values
+// as CBOR (RFC 8949) with the primitives in msgp/cbor. The encoding
+// has the same shape as MarshalMsg's: structs are maps keyed by
+// their codec tags (or arrays, for tuples), nil slices, maps and
+// pointers are null, and map keys are sorted.
+//
+// Only integers, bools, strings and bytes are supported, along
+// with composites of them and types with MarshalCBOR methods.
+type cborMarshalGen struct {
+	passes
+	p      printer
+	ctx    *Context
+	msgs   []string
+	topics *Topics
+}
+
+func (m *cborMarshalGen) Method() Method { return CBOR }
+
+func (m *cborMarshalGen) Execute(p Elem) ([]string, error) {
+	m.msgs = nil
+	if !m.p.ok() {
+		return m.msgs, m.p.err
+	}
+	p = m.applyall(p)
+	if p == nil {
+		return m.msgs, nil
+	}
+
+	// We might change p.Varname in methodReceiver(); make a copy
+	// to not affect other code that will use p.
+	p = p.Copy()
+
+	m.ctx = &Context{}
+
+	m.p.comment("MarshalCBOR appends the CBOR encoding of " + p.Varname() + " to b")
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		c := p.Varname()
+		methodRecv := methodReceiver(p)
+		m.p.printf("\nfunc (%s %s) MarshalCBOR(b []byte) []byte {", c, methodRecv)
+		m.p.printf("\n  return ((*(%s))(%s)).MarshalCBOR(b)", baseType, c)
+		m.p.printf("\n}")
+		m.topics.Add(methodRecv, "MarshalCBOR")
+		return m.msgs, m.p.err
+	}
+
+	c := p.Varname()
+	methodRecv := imutMethodReceiver(p)
+
+	m.p.printf("\nfunc (%s %s) MarshalCBOR(b []byte) (o []byte) {", c, methodRecv)
+	m.p.print("\no = b")
+	next(m, p)
+	m.p.nakedReturn()
+
+	m.topics.Add(methodRecv, "MarshalCBOR")
+	return m.msgs, m.p.err
+}
+
+func (m *cborMarshalGen) gStruct(s *Struct) {
+	if !m.p.ok() {
+		return
+	}
+	if s.AsTuple {
+		m.p.printf("\no = cbor.AppendArrayHeader(o, %d)", len(s.Fields))
+		for i := range s.Fields {
+			m.ctx.PushString(s.Fields[i].FieldName)
+			next(m, s.Fields[i].FieldElem)
+			m.ctx.Pop()
+		}
+		return
+	}
+
+	sortedFields := append([]StructField(nil), s.Fields...)
+	sort.Sort(byFieldTag(sortedFields))
+
+	exportedFields := 0
+	for _, sf := range sortedFields {
+		if ast.IsExported(sf.FieldName) {
+			exportedFields++
+		}
+	}
+
+	prefix := randIdent()
+	lenVar := prefix + "Len"
+	bm := bmask{
+		bitlen:  len(sortedFields),
+		varname: prefix + "Mask",
+	}
+
+	// omitempty: count and mark the fields to leave out
+	m.p.printf("\n%s := uint32(%d)", lenVar, exportedFields)
+	needBmDecl := true
+	for i, sf := range sortedFields {
+		if !ast.IsExported(sf.FieldName) {
+			continue
+		}
+		if ize := fieldOmitExpr(sf, s); ize != "" {
+			if needBmDecl {
+				m.p.printf("\n%s", bm.typeDecl())
+				needBmDecl = false
+			}
+			m.p.printf("\nif %s {", ize)
+			m.p.printf("\n%s--", lenVar)
+			m.p.printf("\n%s", bm.setStmt(i))
+			m.p.printf("\n}")
+		}
+	}
+	m.p.printf("\no = cbor.AppendMapHeader(o, %s)", lenVar)
+
+	for i, sf := range sortedFields {
+		if !ast.IsExported(sf.FieldName) {
+			continue
+		}
+		if !m.p.ok() {
+			return
+		}
+		oeField := fieldOmitExpr(sf, s) != ""
+		if oeField {
+			m.p.printf("\nif %s == 0 { // if not empty", bm.readExpr(i))
+		}
+		m.p.printf("\no = cbor.AppendString(o, %q)", sf.FieldTag)
+		m.ctx.PushString(sf.FieldName)
+		next(m, sf.FieldElem)
+		m.ctx.Pop()
+		if oeField {
+			m.p.printf("\n}")
+		}
+	}
+}
+
+// appendNilOr prints the encoding of the header of the
+// map or slice e: as null if vname is nil, unless e
+// collapses nil into empty, and otherwise as appendHeader
+func (m *cborMarshalGen) appendNilOr(e Elem, vname string, appendHeader string) {
+	if collapsesNil(e) {
+		m.p.printf("\no = %s", appendHeader)
+		return
+	}
+	m.p.printf("\nif %s == nil {", vname)
+	m.p.printf("\n  o = cbor.AppendNil(o)")
+	m.p.printf("\n} else {")
+	m.p.printf("\n  o = %s", appendHeader)
+	m.p.printf("\n}")
+}
+
+func (m *cborMarshalGen) gMap(s *Map) {
+	if !m.p.ok() {
+		return
+	}
+	vname := s.Varname()
+	m.appendNilOr(s, vname, fmt.Sprintf("cbor.Append%s(o, uint32(len(%s)))", s.header(), vname))
+
+	m.msgs = append(m.msgs, m.p.sortedKeys(s)...)
+	m.p.printf("\nfor _, %s := range %s_keys {", s.Keyidx, s.Keyidx)
+	if !s.IsSet() {
+		m.p.printf("\n%s := %s[%s]", s.Validx, vname, s.Keyidx)
+		m.p.printf("\n_ = %s", s.Validx) // we may not use the value, if it's a struct{}
+	}
+	m.ctx.PushVar(s.Keyidx)
+	next(m, s.Key)
+	if !s.IsSet() {
+		next(m, s.Value)
+	}
+	m.ctx.Pop()
+	m.p.closeblock()
+}
+
+func (m *cborMarshalGen) gSlice(s *Slice) {
+	if !m.p.ok() {
+		return
+	}
+	vname := s.Varname()
+	m.appendNilOr(s, vname, fmt.Sprintf("cbor.AppendArrayHeader(o, uint32(len(%s)))", vname))
+	if s.SortSlice {
+		m.p.rangeBlock(m.ctx, s.Index, s.Index+"_sorted", m, m.p.sortedSlice(s))
+		return
+	}
+	m.p.rangeBlock(m.ctx, s.Index, vname, m, s.Els)
+}
+
+func (m *cborMarshalGen) gArray(a *Array) {
+	if !m.p.ok() {
+		return
+	}
+	if isByte(a.Els) {
+		m.p.printf("\no = cbor.AppendBytes(o, (%s)[:])", a.Varname())
+		return
+	}
+	m.p.printf("\no = cbor.AppendArrayHeader(o, %s)", a.Size)
+	m.p.rangeBlock(m.ctx, a.Index, a.Varname(), m, a.Els)
+}
+
+func (m *cborMarshalGen) gPtr(p *Ptr) {
+	if !m.p.ok() {
+		return
+	}
+	m.p.printf("\nif %s == nil {\no = cbor.AppendNil(o)\n} else {", p.Varname())
+	next(m, p.Value)
+	m.p.closeblock()
+}
+
+func (m *cborMarshalGen) gBase(b *BaseElem) {
+	if !m.p.ok() {
+		return
+	}
+	if !cborSupported(b) {
+		m.msgs = append(m.msgs, cborUnsupported(b))
+		return
+	}
+	vname := b.Varname()
+
+	if b.Convert {
+		if b.ShimMode == Cast {
+			vname = tobaseConvert(b)
+		} else {
+			vname = randIdent()
+			m.p.printf("\nvar %s %s", vname, b.BaseType())
+			m.p.printf("\n%s = %s", vname, tobaseConvert(b))
+		}
+	}
+
+	if b.Value == IDENT {
+		m.p.printf("\no = %s.MarshalCBOR(o)", b.identExpr(vname))
+	} else {
+		m.p.printf("\no = cbor.Append%s(o, %s)", b.BaseName(), vname)
+	}
+}
+
+func cborUnmarshal(w io.Writer, topics *Topics) *cborUnmarshalGen {
+	return &cborUnmarshalGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// cborUnmarshalGen prints UnmarshalCBOR methods, which decode
+// what MarshalCBOR encodes. They enforce allocbounds as
+// UnmarshalMsg does, and the maxtotalbytes limit of the type
+// being decoded, but not that of the types it contains.
+type cborUnmarshalGen struct {
+	passes
+	p        printer
+	hasfield bool
+	ctx      *Context
+	msgs     []string
+	topics   *Topics
+	ptrvar   bool // the next struct's Varname is a pointer to it
+}
+
+func (u *cborUnmarshalGen) Method() Method { return CBOR }
+
+func (u *cborUnmarshalGen) needsField() {
+	if u.hasfield {
+		return
+	}
+	u.p.print("\nvar field []byte; _ = field")
+	u.hasfield = true
+}
+
+func (u *cborUnmarshalGen) Execute(p Elem) ([]string, error) {
+	u.msgs = nil
+	u.hasfield = false
+	if !u.p.ok() {
+		return u.msgs, u.p.err
+	}
+	p = u.applyall(p)
+	if p == nil {
+		return u.msgs, nil
+	}
+
+	// We might change p.Varname in methodReceiver(); make a copy
+	// to not affect other code that will use p.
+	p = p.Copy()
+
+	u.ctx = &Context{}
+
+	u.p.comment("UnmarshalCBOR decodes the CBOR encoding of " + p.Varname() + " from bts, and returns the remaining bytes")
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		c := p.Varname()
+		methodRecv := methodReceiver(p)
+		u.p.printf("\nfunc (%s %s) UnmarshalCBOR(bts []byte) ([]byte, error) {", c, methodRecv)
+		u.p.printf("\n  return ((*(%s))(%s)).UnmarshalCBOR(bts)", baseType, c)
+		u.p.printf("\n}")
+		u.topics.Add(methodRecv, "UnmarshalCBOR")
+		return u.msgs, u.p.err
+	}
+
+	c := p.Varname()
+	methodRecv := methodReceiver(p)
+
+	u.p.printf("\nfunc (%s %s) UnmarshalCBOR(bts []byte) (o []byte, err error) {", c, methodRecv)
+	u.p.print("\nvar budget *msgp.Budget")
+	if limit := p.MaxTotalBytes(); limit != "" && limit != "-" {
+		u.p.printf("\nbudget = budget.Limit(bts, %s)", limit)
+	}
+	next(u, p)
+	u.p.print("\nif err = budget.Spend(bts, 0); err != nil {\nreturn\n}")
+	u.p.print("\no = bts")
+	for _, callback := range p.GetCallbacks() {
+		if !callback.IsUnmarshallCallback() {
+			continue
+		}
+		u.p.printf("\nif err = %s.%s(); err != nil {", c, callback.GetName())
+		u.p.printf("\n  return")
+		u.p.printf("\n}")
+	}
+	u.p.nakedReturn()
+
+	u.topics.Add(methodRecv, "UnmarshalCBOR")
+	return u.msgs, u.p.err
+}
+
+// does assignment to the variable "name" with the type "base"
+func (u *cborUnmarshalGen) assignAndCheck(name string, isnil string, base string) {
+	if !u.p.ok() {
+		return
+	}
+	u.p.printf("\n%s, %s, bts, err = cbor.Read%sBytes(bts)", name, isnil, base)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+}
+
+func (u *cborUnmarshalGen) gStruct(s *Struct) {
+	if !u.p.ok() {
+		return
+	}
+	ptrvar := u.ptrvar
+	u.ptrvar = false
+
+	sz := randIdent()
+	u.p.declare(sz, "int")
+	if s.AsTuple {
+		u.assignAndCheck(sz, "_", arrayHeader)
+		u.p.arrayCheck(strconv.Itoa(len(s.Fields)), sz)
+		for i := range s.Fields {
+			u.ctx.PushString(s.Fields[i].FieldName)
+			next(u, s.Fields[i].FieldElem)
+			u.ctx.Pop()
+		}
+		return
+	}
+
+	u.needsField()
+	isnil := randIdent()
+	u.p.declare(isnil, "bool")
+	u.assignAndCheck(sz, isnil, mapHeader)
+	u.p.printf("\nif %s {", isnil)
+	if ptrvar {
+		u.p.printf("\n  *%s = %s{}", s.Varname(), s.TypeName())
+	} else {
+		u.p.printf("\n  %s = %s{}", s.Varname(), s.TypeName())
+	}
+	u.p.printf("\n}")
+
+	u.p.printf("\nfor %s > 0 {", sz)
+	u.p.printf("\n%s--; field, bts, err = cbor.ReadStringZC(bts)", sz)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.print("\nswitch string(field) {")
+	for i := range s.Fields {
+		if !ast.IsExported(s.Fields[i].FieldName) {
+			continue
+		}
+		if !u.p.ok() {
+			return
+		}
+		u.p.printf("\ncase %q:", s.Fields[i].FieldTag)
+		u.ctx.PushString(s.Fields[i].FieldName)
+		next(u, s.Fields[i].FieldElem)
+		u.ctx.Pop()
+	}
+	u.p.print("\ndefault:\nerr = msgp.ErrNoField(string(field))")
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.print("\n}") // close switch
+	u.p.print("\n}") // close for loop
+}
+
+// boundCheck reads the length of the string or bytes at the head
+// of bts with the header function 'header', and rejects it if it
+// exceeds the allocbound of b.
+func (u *cborUnmarshalGen) boundCheck(b *BaseElem, header string) {
+	if b.common.AllocBound() == "" {
+		return
+	}
+	sz := randIdent()
+	u.p.printf("\nvar %s int", sz)
+	u.p.printf("\n%s, err = cbor.%s(bts)", sz, header)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.printf("\nif %s > %s {", sz, b.common.AllocBound())
+	u.p.printf("\nerr = msgp.ErrOverflow(uint64(%s), uint64(%s))", sz, b.common.AllocBound())
+	u.p.printf("\nreturn")
+	u.p.printf("\n}")
+}
+
+func (u *cborUnmarshalGen) gBase(b *BaseElem) {
+	if !u.p.ok() {
+		return
+	}
+	if !cborSupported(b) {
+		u.msgs = append(u.msgs, cborUnsupported(b))
+		return
+	}
+
+	refname := b.Varname() // assigned to
+	lowered := b.Varname() // passed as argument
+	if b.Convert {
+		// begin 'tmp' block
+		refname = randIdent()
+		lowered = b.ToBase() + "(" + lowered + ")"
+		u.p.printf("\n{\nvar %s %s", refname, b.BaseType())
+	}
+
+	switch b.Value {
+	case Bytes:
+		u.boundCheck(b, "ReadBytesBytesHeader")
+		u.p.printf("\n%s, bts, err = cbor.ReadBytesBytes(bts, %s)", refname, lowered)
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\nerr = budget.Spend(bts, len(%s))", refname)
+	case String:
+		u.boundCheck(b, "ReadStringHeaderBytes")
+		u.p.printf("\n%s, bts, err = cbor.ReadStringBytes(bts)", refname)
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\nerr = budget.Spend(bts, len(%s))", refname)
+	case IDENT:
+		u.p.printf("\nbts, err = %s.UnmarshalCBOR(bts)", b.identExpr(lowered))
+	default:
+		u.p.printf("\n%s, bts, err = cbor.Read%sBytes(bts)", refname, b.BaseName())
+	}
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+
+	if b.Convert {
+		// close 'tmp' block
+		if b.ShimMode == Cast {
+			u.p.printf("\n%s = %s(%s)\n", b.Varname(), b.FromBase(), refname)
+		} else {
+			u.p.printf("\n%s, err = %s(%s)", b.Varname(), b.FromBase(), refname)
+			u.p.wrapErrCheck(convertCtx(u.ctx, b, refname))
+		}
+		u.p.printf("}")
+	}
+}
+
+func (u *cborUnmarshalGen) gArray(a *Array) {
+	if !u.p.ok() {
+		return
+	}
+	if isByte(a.Els) {
+		u.p.printf("\nbts, err = cbor.ReadExactBytes(bts, (%s)[:])", a.Varname())
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		return
+	}
+
+	sz := randIdent()
+	u.p.declare(sz, "int")
+	u.assignAndCheck(sz, "_", arrayHeader)
+	u.p.arrayCheckBound(a.Size, sz)
+
+	u.ctx.PushVar(a.Index)
+	u.p.printf("\nfor %[1]s := 0; %[1]s < %[2]s; %[1]s++ {", a.Index, sz)
+	next(u, a.Els)
+	u.p.closeblock()
+	u.ctx.Pop()
+}
+
+func (u *cborUnmarshalGen) gSlice(s *Slice) {
+	if !u.p.ok() {
+		return
+	}
+	sz := randIdent()
+	isnil := randIdent()
+	u.p.declare(sz, "int")
+	u.p.declare(isnil, "bool")
+	u.assignAndCheck(sz, isnil, arrayHeader)
+	u.p.checkAllocBound(sz, s, u.ctx.ArgsStr())
+	u.msgs = append(u.msgs, u.p.resizeSlice(sz, isnil, s, u.ctx.ArgsStr(), false)...)
+	// the elements are held to the inner bounds of the slice,
+	// as in unmarshalGen
+	els := s.Els
+	if s.Els.AllocBound() == "" && strings.Contains(s.AllocBound(), ",") {
+		els = s.Els.Copy()
+		els.SetAllocBound(s.AllocBound()[strings.Index(s.AllocBound(), ",")+1:])
+	}
+	u.p.rangeBlock(u.ctx, s.Index, s.Varname(), u, els)
+}
+
+func (u *cborUnmarshalGen) gMap(m *Map) {
+	if !u.p.ok() {
+		return
+	}
+	sz := randIdent()
+	isnil := randIdent()
+	u.p.declare(sz, "int")
+	u.p.declare(isnil, "bool")
+	u.assignAndCheck(sz, isnil, m.header())
+	u.p.checkAllocBound(sz, m, u.ctx.ArgsStr())
+	u.msgs = append(u.msgs, u.p.resizeMap(sz, isnil, m, u.ctx.ArgsStr())...)
+
+	u.p.printf("\nfor %s > 0 {", sz)
+	u.p.printf("\nvar %s %s; var %s %s; %s--", m.Keyidx, m.Key.TypeName(), m.Validx, m.Value.TypeName(), sz)
+	next(u, m.Key)
+	if !m.IsSet() {
+		u.ctx.PushVar(m.Keyidx)
+		next(u, m.Value)
+		u.ctx.Pop()
+	}
+	u.p.mapAssign(m)
+	u.p.closeblock()
+}
+
+func (u *cborUnmarshalGen) gPtr(p *Ptr) {
+	u.p.printf("\nif cbor.IsNil(bts) { bts, err = cbor.ReadNilBytes(bts); if err != nil { return }; %s = nil; } else { ", p.Varname())
+	u.p.initPtr(p)
+	_, u.ptrvar = p.Value.(*Struct)
+	next(u, p.Value)
+	u.p.closeblock()
+}
+
+// cborSupported returns whether msgp/cbor has
+// primitives for the base type of b.
+func cborSupported(b *BaseElem) bool {
+	switch b.Value {
+	case Bytes, String, Bool,
+		Uint, Uint8, Uint16, Uint32, Uint64, Byte,
+		Int, Int8, Int16, Int32, Int64:
+		return true
+	case IDENT:
+		return !b.Resolved()
+	default:
+		return false
+	}
+}
+
+func cborUnsupported(b *BaseElem) string {
+	return fmt.Sprintf("no CBOR encoding for %s of type %s", b.Varname(), b.BaseType())
+}
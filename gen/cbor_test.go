@@ -0,0 +1,109 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func cborMarshalGenerator(w *bytes.Buffer, topics *Topics) generator {
+	return cborMarshal(w, topics)
+}
+
+func cborUnmarshalGenerator(w *bytes.Buffer, topics *Topics) generator {
+	return cborUnmarshal(w, topics)
+}
+
+func cborTestStruct() *Struct {
+	str := &BaseElem{Value: String}
+	str.SetAllocBound("32")
+	sl := &Slice{Els: &BaseElem{Value: Int64}}
+	sl.SetAllocBound("16")
+	return testStruct("C", "omitempty",
+		testField("N", "n", &BaseElem{Value: Uint64}),
+		testField("S", "s,allocbound=32", str),
+		testField("L", "l,allocbound=16", sl),
+		testField("H", "h", &Array{Size: "32", Els: &BaseElem{Value: Byte}}),
+		testField("P", "p", &Ptr{Value: Ident("", "Inner")}),
+	)
+}
+
+func TestMarshalCBOR(t *testing.T) {
+	out := generateMethod(t, cborMarshalGenerator, cborTestStruct())
+
+	for _, want := range []string{
+		"func (z *C) MarshalCBOR(b []byte) (o []byte) {",
+		"o = cbor.AppendMapHeader(o, ",
+		`o = cbor.AppendString(o, "h")`,
+		"o = cbor.AppendBytes(o, ((*z).H)[:])",
+		"o = cbor.AppendUint64(o, (*z).N)",
+		"o = cbor.AppendArrayHeader(o, uint32(len((*z).L)))",
+		"o = cbor.AppendNil(o)",
+		"o = (*z).P.MarshalCBOR(o)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// fields are encoded in the order of their tags
+	if strings.Index(out, `"h"`) > strings.Index(out, `"n"`) {
+		t.Errorf("fields are not sorted:\n%s", out)
+	}
+	if strings.Contains(out, "msgp.") {
+		t.Errorf("MarshalCBOR uses msgp primitives:\n%s", out)
+	}
+}
+
+func TestUnmarshalCBOR(t *testing.T) {
+	out := generateMethod(t, cborUnmarshalGenerator, cborTestStruct())
+
+	for _, want := range []string{
+		"func (z *C) UnmarshalCBOR(bts []byte) (o []byte, err error) {",
+		"bts, err = cbor.ReadMapHeaderBytes(bts)",
+		"field, bts, err = cbor.ReadStringZC(bts)",
+		"bts, err = cbor.ReadExactBytes(bts, ((*z).H)[:])",
+		"(*z).N, bts, err = cbor.ReadUint64Bytes(bts)",
+		", err = cbor.ReadStringHeaderBytes(bts)",
+		"bts, err = cbor.ReadArrayHeaderBytes(bts)",
+		"msgp.ErrOverflow(",
+		"if cbor.IsNil(bts) {",
+		"bts, err = (*z).P.UnmarshalCBOR(bts)",
+		"err = msgp.ErrNoField(string(field))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "msgp.Read") {
+		t.Errorf("UnmarshalCBOR uses msgp primitives:\n%s", out)
+	}
+}
+
+func TestUnmarshalCBORNestedBound(t *testing.T) {
+	sl := &Slice{Els: &Slice{Els: &BaseElem{Value: Int64}}}
+	sl.SetAllocBound("4,3")
+	out := generateMethod(t, cborUnmarshalGenerator, testStruct("N", "", testField("L", "l,allocbound=4,3", sl)))
+
+	// the inner slices are held to the second bound
+	for _, want := range []string{"uint64(4))", "uint64(3))"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestCBORUnsupported(t *testing.T) {
+	st := testStruct("F", "", testField("F", "f", &BaseElem{Value: Float64}))
+	var buf bytes.Buffer
+	var topics Topics
+	for _, g := range []generator{cborMarshal(&buf, &topics), cborUnmarshal(&buf, &topics)} {
+		msgs, err := g.Execute(st)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != 1 || !strings.Contains(msgs[0], "no CBOR encoding") {
+			t.Errorf("expected a message about the float64 field; got %v", msgs)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func clones(w io.Writer, topics *Topics) *cloneGen {
+	return &cloneGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// cloneGen prints Clone methods, which return a deep copy of a
+// value. Clone copies the value itself, and then replaces each
+// slice, map and pointer in the copy, and each value of another
+// type with a Clone method, with a copy of its own, so that the
+// copy shares no storage with the original. Unexported fields
+// are not part of the encoding, so they are copied as they are,
+// as are interface{} and extension values, whose types aren't
+// known. If some fields are tagged codec:"-", which may hold
+// locks or caches, only the encoded fields are copied, and the
+// others are left zero.
+type cloneGen struct {
+	passes
+	p      printer
+	topics *Topics
+}
+
+func (c *cloneGen) Method() Method { return Clone }
+
+func (c *cloneGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (c *cloneGen) Execute(p Elem) ([]string, error) {
+	if !c.p.ok() {
+		return nil, c.p.err
+	}
+	p = c.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+
+	z := p.Varname()
+	c.p.comment("Clone returns a deep copy of " + z + ", which shares no slices, maps or pointers with it")
+
+	receiver := "*" + p.TypeName()
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		c.p.printf("\nfunc (%s %s) Clone() %s {", z, receiver, receiver)
+		c.p.printf("\n  return (%s)((*(%s))(%s).Clone())", receiver, baseType, z)
+		c.p.printf("\n}")
+		c.topics.Add(receiver, "Clone")
+		return nil, c.p.err
+	}
+
+	c.p.printf("\nfunc (%s %s) Clone() %s {", z, receiver, receiver)
+	c.p.printf("\nif %s == nil {\nreturn nil\n}", z)
+	c.p.printf("\no := new(%s)", p.TypeName())
+	if s, ok := p.(*Struct); ok && hasIgnored(s) {
+		// copying the whole value would copy the ignored fields,
+		// which may hold locks, so the others are copied one by one
+		c.copyFields(s, "(*o)", "(*"+z+")")
+	} else {
+		c.p.printf("\n*o = *%s", z)
+	}
+	c.deepen(p, "(*o)")
+	c.p.print("\nreturn o\n}\n")
+	c.topics.Add(receiver, "Clone")
+	return nil, c.p.err
+}
+
+// copyFields prints the copying of the fields of s from src
+// to dst one by one, and so of the fields of its struct fields
+// that ignore some of theirs, leaving the ignored ones out
+func (c *cloneGen) copyFields(s *Struct, dst string, src string) {
+	for i := range s.Fields {
+		path := fieldPath(s.Fields[i])
+		if st, ok := s.Fields[i].FieldElem.(*Struct); ok && hasIgnored(st) {
+			c.copyFields(st, dst+"."+path, src+"."+path)
+			continue
+		}
+		c.p.printf("\n%s.%s = %s.%s", dst, path, src, path)
+	}
+}
+
+// hasIgnored returns whether s, or a struct field of s,
+// has fields tagged codec:"-"
+func hasIgnored(s *Struct) bool {
+	if len(s.Ignored) > 0 {
+		return true
+	}
+	for i := range s.Fields {
+		if st, ok := s.Fields[i].FieldElem.(*Struct); ok && hasIgnored(st) {
+			return true
+		}
+	}
+	return false
+}
+
+// deepen prints statements that replace the storage that v, of
+// type el, shares with the value it was copied from
+func (c *cloneGen) deepen(el Elem, v string) {
+	if !c.p.ok() {
+		return
+	}
+	switch el := el.(type) {
+	case *Struct:
+		for i := range el.Fields {
+			if !ast.IsExported(el.Fields[i].FieldName) || !needsClone(el.Fields[i].FieldElem) {
+				continue
+			}
+			path := v
+			for _, pathelem := range el.Fields[i].FieldPath {
+				path += "." + pathelem
+			}
+			c.deepen(el.Fields[i].FieldElem, path+"."+el.Fields[i].FieldName)
+		}
+	case *Ptr:
+		c.p.printf("\nif %s != nil {", v)
+		if be, ok := el.Value.(*BaseElem); ok && be.Value == IDENT && be.Replacement == "" && be.TypeName() != "msgp.Raw" {
+			c.p.printf("\n%s = %s.Clone()", v, v)
+		} else {
+			ptr := randIdent()
+			c.p.printf("\n%s := new(%s)\n*%s = *%s", ptr, el.Value.TypeName(), ptr, v)
+			c.deepen(el.Value, "(*"+ptr+")")
+			c.p.printf("\n%s = %s", v, ptr)
+		}
+		c.p.closeblock()
+	case *Array:
+		if needsClone(el.Els) {
+			idx := randIdent()
+			c.p.printf("\nfor %s := range %s {", idx, v)
+			c.deepen(el.Els, v+"["+idx+"]")
+			c.p.closeblock()
+		}
+	case *Slice:
+		// a nil slice stays nil, like the other nil values,
+		// since it may not encode as an empty one does
+		s := randIdent()
+		c.p.printf("\nif %s != nil {", v)
+		c.p.printf("\n%s := make(%s, len(%s))\ncopy(%s, %s)", s, el.TypeName(), v, s, v)
+		if needsClone(el.Els) {
+			idx := randIdent()
+			c.p.printf("\nfor %s := range %s {", idx, s)
+			c.deepen(el.Els, s+"["+idx+"]")
+			c.p.closeblock()
+		}
+		c.p.printf("\n%s = %s", v, s)
+		c.p.closeblock()
+	case *Map:
+		m, key, val := randIdent(), randIdent(), randIdent()
+		c.p.printf("\nif %s != nil {", v)
+		c.p.printf("\n%s := make(%s, len(%s))", m, el.TypeName(), v)
+		c.p.printf("\nfor %s, %s := range %s {", key, val, v)
+		if needsClone(el.Value) {
+			c.deepen(el.Value, val)
+		}
+		c.p.printf("\n%s[%s] = %s", m, key, val)
+		c.p.closeblock()
+		c.p.printf("\n%s = %s", v, m)
+		c.p.closeblock()
+	case *BaseElem:
+		c.deepenBase(el, v)
+	}
+}
+
+func (c *cloneGen) deepenBase(b *BaseElem, v string) {
+	switch {
+	case b.Value == Bytes, b.Value == IDENT && b.TypeName() == "msgp.Raw":
+		// v[:0:0] is nil if v is, and keeps the type of v
+		c.p.printf("\n%s = append(%s[:0:0], %s...)", v, v, v)
+	case b.Value == IDENT && b.Replacement != "":
+		c.p.printf("\n%s = *(*%s)(%s.Clone())", v, b.TypeName(), b.identExpr(v))
+	case b.Value == IDENT:
+		c.p.printf("\n%s = *%s.Clone()", v, v)
+	case b.Value == BigInt:
+		c.p.printf("\n%s = *new(big.Int).Set(&%s)", v, v)
+	case b.Value == Iface:
+		// the concrete types aren't known here, so the value
+		// is copied by encoding it, which can't fail for a
+		// value that was just encoded
+		c.p.printf("\nif _, err := msgp.ReadIfaceBytes(msgp.AppendIface(nil, %s), &%s, nil); err != nil {", v, v)
+		c.p.print("\npanic(err)\n}")
+	}
+}
+
+// needsClone returns whether copying a value of type e
+// shares storage with the original
+func needsClone(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		switch e.Value {
+		case IDENT, Bytes, BigInt, Iface:
+			return true
+		}
+		return false
+	case *Array:
+		return needsClone(e.Els)
+	case *Struct:
+		// for the structs that are inlined
+		for i := range e.Fields {
+			if ast.IsExported(e.Fields[i].FieldName) && needsClone(e.Fields[i].FieldElem) {
+				return true
+			}
+		}
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,75 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func cloneGenerator(w *bytes.Buffer, topics *Topics) generator { return clones(w, topics) }
+
+func TestClone(t *testing.T) {
+	shape := &BaseElem{Value: Iface}
+	shape.Alias("Shape")
+	st := testStruct("C", "",
+		testField("P", "p", &Ptr{Value: Ident("", "Inner")}),
+		testField("Q", "q", &Ptr{Value: &BaseElem{Value: Int64}}),
+		testField("L", "l", &Slice{Els: &BaseElem{Value: Int64}}),
+		testField("I", "i", &Slice{Els: Ident("", "Inner")}),
+		testField("M", "m", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Bytes}}),
+		testField("B", "b", &BaseElem{Value: Bytes}),
+		testField("H", "h", &Array{Size: "32", Els: &BaseElem{Value: Byte}}),
+		testField("V", "v", &BaseElem{Value: BigInt}),
+		testField("S", "s", shape),
+		testField("N", "n", &BaseElem{Value: Uint64}),
+	)
+	out := generateMethod(t, cloneGenerator, st)
+
+	for _, want := range []string{
+		"func (z *C) Clone() *C {",
+		"o := new(C)\n*o = *z",
+		"(*o).P = (*o).P.Clone()",
+		":= new(int64)",
+		":= make([]int64, len((*o).L))",
+		":= make([]Inner, len((*o).I))",
+		"] = *", // the elements of I
+		":= make(map[string][]byte, len((*o).M))",
+		"(*o).B = append((*o).B[:0:0], (*o).B...)",
+		"(*o).V = *new(big.Int).Set(&(*o).V)",
+		"msgp.ReadIfaceBytes(msgp.AppendIface(nil, (*o).S), &(*o).S, nil)",
+		"return o",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	for _, shared := range []string{"(*o).H", "(*o).N"} {
+		if strings.Contains(out, shared) {
+			t.Errorf("%s is copied twice:\n%s", shared, out)
+		}
+	}
+}
+
+func TestCloneIgnored(t *testing.T) {
+	st := testStruct("G", "", testField("N", "n", &BaseElem{Value: Int64}))
+	st.Ignored = []string{"Mu"}
+	out := generateMethod(t, cloneGenerator, st)
+	// a whole-value copy would copy the ignored lock
+	if strings.Contains(out, "*o = *z") {
+		t.Errorf("G is copied whole:\n%s", out)
+	}
+	if !strings.Contains(out, "(*o).N = (*z).N") {
+		t.Errorf("N is not copied:\n%s", out)
+	}
+	// nor is a struct copied whole whose struct field ignores
+	// fields, which are left out of its copy
+	inner := testStruct("", "", testField("X", "x", &BaseElem{Value: Int64}))
+	inner.Ignored = []string{"Mu"}
+	out = generateMethod(t, cloneGenerator, testStruct("H", "", testField("In", "in", inner)))
+	if strings.Contains(out, "*o = *z") || strings.Contains(out, "(*o).In = (*z).In\n") {
+		t.Errorf("In is copied whole:\n%s", out)
+	}
+	if !strings.Contains(out, "(*o).In.X = (*z).In.X") {
+		t.Errorf("In.X is not copied:\n%s", out)
+	}
+}
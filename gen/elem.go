@@ -3,6 +3,7 @@ package gen
 import (
 	"fmt"
 	"go/ast"
+	"go/token"
 	"strconv"
 	"strings"
 )
@@ -96,6 +97,21 @@ const (
 	Ext      // extension
 	Error    // error
 	Duration // time.Duration
+	Addr     // netip.Addr
+	AddrPort // netip.AddrPort
+	BigInt   // big.Int
+	Text     // encoding.TextMarshaler, by the msgp:text directive
+	Iface    // interface of registered types, by the msgp:iface directive
+
+	// the database/sql Null* types
+	NullString
+	NullInt64
+	NullInt32
+	NullInt16
+	NullByte
+	NullFloat64
+	NullBool
+	NullTime
 
 	IDENT // IDENT means an unrecognized identifier
 )
@@ -128,6 +144,44 @@ var primitives = map[string]Primitive{
 	"msgp.Extension": Ext,
 	"error":          Error,
 	"time.Duration":  Duration,
+	"netip.Addr":     Addr,
+	"netip.AddrPort": AddrPort,
+	"big.Int":        BigInt,
+
+	"sql.NullString":  NullString,
+	"sql.NullInt64":   NullInt64,
+	"sql.NullInt32":   NullInt32,
+	"sql.NullInt16":   NullInt16,
+	"sql.NullByte":    NullByte,
+	"sql.NullFloat64": NullFloat64,
+	"sql.NullBool":    NullBool,
+	"sql.NullTime":    NullTime,
+}
+
+// sqlNulls are the fields that hold the values of the
+// database/sql Null* types, and their primitives. The
+// values are encoded as 'nil' unless they are Valid.
+var sqlNulls = map[Primitive]struct {
+	field string
+	value Primitive
+}{
+	NullString:  {"String", String},
+	NullInt64:   {"Int64", Int64},
+	NullInt32:   {"Int32", Int32},
+	NullInt16:   {"Int16", Int16},
+	NullByte:    {"Byte", Byte},
+	NullFloat64: {"Float64", Float64},
+	NullBool:    {"Bool", Bool},
+	NullTime:    {"Time", Time},
+}
+
+// nullField returns the expression for a field of x,
+// a value of one of the database/sql Null* types
+func nullField(x, field string) string {
+	if strings.HasPrefix(x, "*") {
+		x = "(" + x + ")"
+	}
+	return x + "." + field
 }
 
 // types built into the library
@@ -158,6 +212,9 @@ type common struct {
 	vname, alias  string
 	allocbound    string
 	maxtotalbytes string
+	nosizehint    bool
+	nilpolicy     string
+	recv, recvtyp string
 	callbacks     []Callback
 }
 
@@ -170,10 +227,17 @@ func (c *common) SetAllocBound(s string)    { c.allocbound = s }
 func (c *common) AllocBound() string        { return c.allocbound }
 func (c *common) SetMaxTotalBytes(s string) { c.maxtotalbytes = s }
 func (c *common) MaxTotalBytes() string     { return c.maxtotalbytes }
+func (c *common) SetNoSizeHint()            { c.nosizehint = true }
+func (c *common) NoSizeHint() bool          { return c.nosizehint }
+func (c *common) SetNilPolicy(p string)     { c.nilpolicy = p }
+func (c *common) NilPolicy() string         { return c.nilpolicy }
 func (c *common) GetCallbacks() []Callback  { return c.callbacks }
 func (c *common) AddCallback(cb Callback)   { c.callbacks = append(c.callbacks, cb) }
 func (c *common) hidden()                   {}
 
+func (c *common) SetReceiver(name, typ string) { c.recv, c.recvtyp = name, typ }
+func (c *common) Receiver() (string, string)   { return c.recv, c.recvtyp }
+
 func IsDangling(e Elem) bool {
 	if be, ok := e.(*BaseElem); ok && be.Dangling() {
 		return true
@@ -257,6 +321,29 @@ type Elem interface {
 	// decoding this type. Meaningful for slices of strings or byteslices.
 	MaxTotalBytes() string
 
+	// SetNoSizeHint stops MarshalMsg from growing its buffer to
+	// Msgsize() bytes up front, for the msgp:nosizehint directive.
+	SetNoSizeHint()
+
+	// NoSizeHint returns whether SetNoSizeHint was called.
+	NoSizeHint() bool
+
+	// SetNilPolicy sets how a nil slice, map or []byte is
+	// encoded: NilDistinguish or NilCollapse.
+	SetNilPolicy(p string)
+
+	// NilPolicy returns the value passed to SetNilPolicy.
+	NilPolicy() string
+
+	// SetReceiver sets the name of the receiver of the generated
+	// methods, and, for the msgp:receiver directive, whether the
+	// methods that don't modify it take it by "value" or by
+	// "pointer". An empty name or typ keeps the default.
+	SetReceiver(name, typ string)
+
+	// Receiver returns the values passed to SetReceiver.
+	Receiver() (name, typ string)
+
 	// AddCallback adds to the elem a Callback it should call at the end of marshaling
 	AddCallback(Callback)
 
@@ -427,10 +514,26 @@ func (m *Map) Comparable() bool {
 	return false
 }
 
+// IsSet returns whether m is a map[K]struct{}, a set, which
+// is encoded as an array of its keys rather than as a map.
+func (m *Map) IsSet() bool {
+	st, ok := m.Value.(*Struct)
+	return ok && len(st.Fields) == 0 && len(st.Ignored) == 0
+}
+
+// header returns the kind of header m is encoded with
+func (m *Map) header() string {
+	if m.IsSet() {
+		return arrayHeader
+	}
+	return mapHeader
+}
+
 type Slice struct {
 	common
-	Index string
-	Els   Elem // The type of each element
+	Index     string
+	Els       Elem // The type of each element
+	SortSlice bool // Encode the elements in sorted order
 }
 
 func (s *Slice) SetVarname(a string) {
@@ -444,6 +547,11 @@ func (s *Slice) SetVarname(a string) {
 	s.Els.SetVarname(fmt.Sprintf("%s[%s]", varName, s.Index))
 }
 
+// SetSortSlice applies the sortslice tag option, which
+// encodes a sorted copy of the slice (leaving the slice
+// itself as it is), so that its encoding is canonical.
+func (s *Slice) SetSortSlice() { s.SortSlice = true }
+
 func (s *Slice) TypeName() string {
 	if s.common.alias != "" {
 		return s.common.alias
@@ -490,8 +598,9 @@ func (s *Ptr) SetVarname(a string) {
 		return
 
 	case *BaseElem:
-		// identities have pointer receivers
-		if x.Value == IDENT {
+		// identities have pointer receivers, except
+		// that replaced ones are converted, by identExpr
+		if x.Value == IDENT && x.Replacement == "" {
 			x.SetVarname(a)
 		} else {
 			x.SetVarname("*" + a)
@@ -499,11 +608,20 @@ func (s *Ptr) SetVarname(a string) {
 		return
 
 	default:
-		s.Value.SetVarname("*" + a)
+		// parenthesized, so that the fields and elements
+		// of a **T, *[N]T or *map[K]V are the pointee's
+		s.Value.SetVarname("(*" + a + ")")
 		return
 	}
 }
 
+// SetAllocBound applies the bound to the pointed-to value,
+// since that is what gets allocated when decoding.
+func (s *Ptr) SetAllocBound(bound string) {
+	s.common.SetAllocBound(bound)
+	s.Value.SetAllocBound(bound)
+}
+
 func (s *Ptr) TypeName() string {
 	if s.common.alias != "" {
 		return s.common.alias
@@ -531,7 +649,14 @@ func (s *Ptr) Needsinit() bool {
 func (s *Ptr) ZeroExpr() string { return "nil" }
 
 // IfZeroExpr returns the expression to compare to zero/empty.
-func (s *Ptr) IfZeroExpr() string { return s.Varname() + " == nil" }
+// A **T that points to a nil *T is empty too, since it is
+// encoded as 'nil', and decoded as a nil **T.
+func (s *Ptr) IfZeroExpr() string {
+	if v, ok := s.Value.(*Ptr); ok {
+		return "(" + s.Varname() + " == nil || " + v.IfZeroExpr() + ")"
+	}
+	return s.Varname() + " == nil"
+}
 
 // Comparable returns whether this elem's type is comparable.
 func (s *Ptr) Comparable() bool {
@@ -540,10 +665,98 @@ func (s *Ptr) Comparable() bool {
 
 type Struct struct {
 	common
-	Fields  []StructField // field list
-	AsTuple bool          // write as an array instead of a map
+	Fields   []StructField // field list
+	AsTuple  bool          // write as an array instead of a map
+	Ignored  []string      // names of the fields tagged codec:"-"
+	Stringer bool          // print a String method (msgp:stringer)
+	Unknown  string        // the map[string]msgp.Raw field that keeps undeclared fields (msgp:preserveunknown)
+	Presence string        // the field that records which fields a decoded message had (msgp:presence)
+}
+
+// presenceExpr returns the expression of the field of s that
+// records which of its omitempty fields the message it was
+// decoded from had, or ""
+func (s *Struct) presenceExpr() string {
+	if s.Presence == "" || s.AsTuple {
+		return ""
+	}
+	return s.Varname() + "." + s.Presence
 }
 
+// presenceFields returns the fields of s whose presence its
+// msgp:presence field records: the exported ones that may be
+// left out of a message
+func (s *Struct) presenceFields() []StructField {
+	var out []StructField
+	for _, sf := range s.Fields {
+		if ast.IsExported(sf.FieldName) && fieldOmitExpr(sf, s) != "" {
+			out = append(out, sf)
+		}
+	}
+	return out
+}
+
+// unknownExpr returns the expression of the field of s that
+// keeps the fields of a message that s doesn't declare, or ""
+func (s *Struct) unknownExpr() string {
+	if s.Unknown == "" || s.AsTuple {
+		return ""
+	}
+	return s.Varname() + "." + s.Unknown
+}
+
+// fieldTags returns the quoted tags of the exported fields of s
+func (s *Struct) fieldTags() []string {
+	var tags []string
+	for _, sf := range s.Fields {
+		if ast.IsExported(sf.FieldName) {
+			tags = append(tags, strconv.Quote(sf.FieldTag))
+		}
+	}
+	return tags
+}
+
+// versionExpr returns the expression of the field of s that
+// holds the version of the message, the one named by the
+// msgp:since directive of sf, or "" if sf has none
+func (s *Struct) versionExpr(sf StructField) string {
+	if sf.Version == "" {
+		return ""
+	}
+	for _, v := range s.Fields {
+		if v.FieldName == sf.Version {
+			return v.FieldElem.Varname()
+		}
+	}
+	return ""
+}
+
+// absentExpr returns the expression that is true when the
+// version of the message is older than the version that sf
+// is present since, or "" if sf is present in every version
+func (s *Struct) absentExpr(sf StructField) string {
+	if v := s.versionExpr(sf); v != "" {
+		return v + " < " + sf.Since
+	}
+	return ""
+}
+
+// versionField returns the name of the field of s that holds
+// the version of the message, which msgp:since allows only one
+// of, or "" if every field of s is present in every version
+func (s *Struct) versionField() string {
+	for _, sf := range s.Fields {
+		if sf.Version != "" {
+			return sf.Version
+		}
+	}
+	return ""
+}
+
+// versioned returns whether any field of s is
+// present only since some version
+func (s *Struct) versioned() bool { return s.versionField() != "" }
+
 func (s *Struct) TypeName() string {
 	if s.common.alias != "" {
 		return s.common.alias
@@ -610,6 +823,12 @@ func (s *Struct) IfZeroExpr() string {
 			res += "(" + fieldZero + ")"
 		}
 	}
+	if uf := s.unknownExpr(); uf != "" {
+		if res != "" {
+			res += " && "
+		}
+		res += "(len(" + uf + ") == 0)"
+	}
 	return res
 }
 
@@ -668,13 +887,16 @@ func (s *Struct) HasUnderscoreStructTag() bool {
 }
 
 type StructField struct {
-	FieldTag      string   // the string inside the `codec:""` tag up to the first comma
-	FieldTagParts []string // the string inside the `codec:""` tag split by commas
-	RawTag        string   // the full struct tag
-	HasCodecTag   bool     // has a `codec:` tag
-	FieldName     string   // the name of the struct field
-	FieldElem     Elem     // the field type
-	FieldPath     []string // set of embedded struct names for accessing FieldName
+	FieldTag      string         // the string inside the `codec:""` tag up to the first comma
+	FieldTagParts []string       // the string inside the `codec:""` tag split by commas
+	RawTag        string         // the full struct tag
+	HasCodecTag   bool           // has a `codec:` tag
+	FieldName     string         // the name of the struct field
+	FieldElem     Elem           // the field type
+	FieldPath     []string       // set of embedded struct names for accessing FieldName
+	Pos           token.Position // where the field is declared, if parsed
+	Version       string         // the field holding the message's version, if the field is only present since one (msgp:since)
+	Since         string         // the version the field is present since
 }
 
 type byFieldTag []StructField
@@ -696,6 +918,20 @@ func (sf *StructField) HasTagPart(pname string) bool {
 	return false
 }
 
+// TagPartValue returns the value of a key=value
+// part of the field's tag, such as "min=1".
+func (sf *StructField) TagPartValue(key string) (string, bool) {
+	if len(sf.FieldTagParts) < 2 {
+		return "", false
+	}
+	for _, p := range sf.FieldTagParts[1:] {
+		if strings.HasPrefix(p, key+"=") {
+			return p[len(key)+1:], true
+		}
+	}
+	return "", false
+}
+
 type ShimMode int
 
 const (
@@ -714,15 +950,44 @@ type BaseElem struct {
 	Value        Primitive // Type of element
 	IdentName    string    // name, for Value == IDENT
 	Convert      bool      // should we do an explicit conversion?
+	TimeForm     string    // encoding of a time.Time, from the time= tag option
+	ComplexForm  string    // encoding of a complex number, from the complex= tag option
+	FixedInt     int       // width in bits of the fixed encoding of an integer, from the int= tag option
+	UTF8         bool      // reject a decoded string that isn't valid UTF-8, from the utf8 tag option
+	Replacement  string    // type whose methods encode an IDENT, from the msgp:replace directive
+	Enum         *Enum     // the named values of an integer, from the msgp:enum directive
+	ZeroCopy     bool      // decode a []byte as a sub-slice of the input, from the msgp:zerocopy directive
+	StringKey    bool      // a map key encoded as its String(), from the msgp:stringkey directive
 	mustinline   bool      // must inline; not printable
 	needsref     bool      // needs reference for shim
 }
 
 func (s *BaseElem) Dangling() bool { return s.mustinline }
 
+// Enum is the set of named values of an integer type named by
+// the msgp:enum directive. A value with a name is encoded as
+// the name, in a 'str', and any other value as a number, so
+// that the names of known values show in the encoding.
+type Enum struct {
+	Names    []string // the consts of the type, one for each value
+	Tolerant bool     // decode an unknown name as 0, instead of failing
+}
+
+// IsInteger returns whether p is one of the integer
+// types, which are the types that can be enums.
+func IsInteger(p Primitive) bool {
+	switch p {
+	case Uint, Uint8, Uint16, Uint32, Uint64, Byte,
+		Int, Int8, Int16, Int32, Int64:
+		return true
+	default:
+		return false
+	}
+}
+
 func (s *BaseElem) Alias(typ string) {
 	s.common.Alias(typ)
-	if s.Value != IDENT {
+	if s.Value != IDENT && s.Value != Text && s.Value != Iface {
 		s.Convert = true
 	}
 	if strings.Contains(typ, ".") {
@@ -731,10 +996,10 @@ func (s *BaseElem) Alias(typ string) {
 }
 
 func (s *BaseElem) SetVarname(a string) {
-	// extensions whose parents
-	// are not pointers need to
+	// extensions (and big.Ints and text types)
+	// whose parents are not pointers need to
 	// be explicitly referenced
-	if s.Value == Ext || s.needsref {
+	if s.Value == Ext || s.Value == BigInt || s.Value == Text || s.needsref {
 		if strings.HasPrefix(a, "*") {
 			s.common.SetVarname(a[1:])
 			return
@@ -772,23 +1037,166 @@ func (s *BaseElem) FromBase() string {
 	return s.TypeName()
 }
 
+// The policies for encoding nil slices, maps and []byte,
+// from the nil= tag option or the -nil-policy flag.
+// NilDistinguish, the default, encodes them as 'nil', and
+// empty ones as empty arrays, maps or 'bin' objects, which
+// UnmarshalMsg decodes back to nil and empty values.
+// NilCollapse encodes nil ones as empty too, so that all
+// empty values have one encoding, and UnmarshalValidateMsg
+// rejects a 'nil' in their place.
+const (
+	NilDistinguish = "distinguish"
+	NilCollapse    = "collapse"
+)
+
+// collapsesNil returns whether a nil e is encoded as if it
+// were empty
+func collapsesNil(e Elem) bool { return e.NilPolicy() == NilCollapse }
+
+// timeForms maps the values of the time= tag option
+// to the names of their msgp functions and sizes,
+// e.g. msgp.AppendUnixTime and msgp.UnixTimeSize
+var timeForms = map[string]string{
+	"unixsec":   "UnixTime",
+	"unixnano":  "UnixNanoTime",
+	"rfc3339":   "RFC3339Time",
+	"timestamp": "Timestamp",
+}
+
+// SetTimeForm sets the encoding of a time.Time to one of
+// the values of the time= tag option, and returns false
+// if s is not a time.Time or the form is unknown.
+func (s *BaseElem) SetTimeForm(form string) bool {
+	if _, ok := timeForms[form]; !ok || s.Value != Time {
+		return false
+	}
+	s.TimeForm = form
+	return true
+}
+
+// SetComplexForm sets the encoding of a complex64 or complex128
+// to "array", the only value of the complex= tag option, which
+// encodes it as an array of its real and imaginary parts, and
+// returns false if s is not a complex number or the form is
+// unknown.
+func (s *BaseElem) SetComplexForm(form string) bool {
+	if form != "array" || (s.Value != Complex64 && s.Value != Complex128) {
+		return false
+	}
+	s.ComplexForm = form
+	return true
+}
+
+// SetUTF8 makes the decoders of a string reject a value that
+// isn't valid UTF-8, as the utf8 tag option does, and returns
+// false if s is not a string.
+func (s *BaseElem) SetUTF8() bool {
+	if s.Value != String {
+		return false
+	}
+	s.UTF8 = true
+	return true
+}
+
+// intBits returns the width in bits of the integer type p,
+// which is 64 for int and uint, as msgp encodes them
+func intBits(p Primitive) int {
+	switch p {
+	case Int8, Uint8, Byte:
+		return 8
+	case Int16, Uint16:
+		return 16
+	case Int32, Uint32:
+		return 32
+	case Int, Uint, Int64, Uint64:
+		return 64
+	default:
+		return 0
+	}
+}
+
+// SetIntForm sets the encoding of an integer to one of the
+// values of the int= tag option, fixed8, fixed16, fixed32 or
+// fixed64, which encode it with msgp.AppendFixedInt32 and the
+// like in that many bits, whatever its value. It returns false
+// if s is not an integer, the form is unknown, or it is too
+// narrow for the integer. Since msgp.IsCanonical rejects the
+// fixed widths, it is an error to generate UnmarshalMsgCanonical
+// for types with such integers.
+func (s *BaseElem) SetIntForm(form string) bool {
+	bits, err := strconv.Atoi(strings.TrimPrefix(form, "fixed"))
+	if !strings.HasPrefix(form, "fixed") || err != nil || intBits(s.Value) == 0 || bits < intBits(s.Value) ||
+		(bits != 8 && bits != 16 && bits != 32 && bits != 64) {
+		return false
+	}
+	s.FixedInt = bits
+	return true
+}
+
+// fixedName returns the base name of the fixed encoding of
+// an integer, e.g. "Uint32" for msgp.AppendFixedUint32 and
+// msgp.Uint32Size, which is the size of any uint32 so encoded.
+func (s *BaseElem) fixedName() string {
+	switch s.Value {
+	case Uint, Uint8, Uint16, Uint32, Uint64, Byte:
+		return "Uint" + strconv.Itoa(s.FixedInt)
+	default:
+		return "Int" + strconv.Itoa(s.FixedInt)
+	}
+}
+
+// sizeName returns the base name of the msgp constant of the
+// size of s, e.g. "Uint32" for msgp.Uint32Size.
+func (s *BaseElem) sizeName() string {
+	if s.FixedInt != 0 {
+		return s.fixedName()
+	}
+	return s.BaseName()
+}
+
 // BaseName returns the string form of the
 // base type (e.g. Float64, Ident, etc)
 func (s *BaseElem) BaseName() string {
 	// time and duration are special cases;
 	// we strip the package prefix
 	if s.Value == Time {
+		if name, ok := timeForms[s.TimeForm]; ok {
+			return name
+		}
 		return "Time"
 	}
 	if s.Value == Duration {
 		return "Duration"
 	}
+	if s.Value == Addr {
+		return "Addr"
+	}
+	if s.Value == AddrPort {
+		return "AddrPort"
+	}
+	if s.Value == BigInt {
+		return "BigInt"
+	}
+	if s.Value == Text {
+		return "Text"
+	}
+	if s.Value == Iface {
+		return "Iface"
+	}
+	if _, ok := sqlNulls[s.Value]; ok {
+		return strings.TrimPrefix(s.Value.String(), "sql.")
+	}
+	if s.ComplexForm == "array" {
+		// e.g. msgp.AppendComplex64Array
+		return s.Value.String() + "Array"
+	}
 	return s.Value.String()
 }
 
 func (s *BaseElem) BaseType() string {
 	switch s.Value {
-	case IDENT:
+	case IDENT, Text, Iface:
 		return s.TypeName()
 
 	// exceptions to the naming/capitalization
@@ -801,8 +1209,17 @@ func (s *BaseElem) BaseType() string {
 		return "time.Time"
 	case Duration:
 		return "time.Duration"
+	case Addr:
+		return "netip.Addr"
+	case AddrPort:
+		return "netip.AddrPort"
+	case BigInt:
+		return "big.Int"
 	case Ext:
 		return "msgp.Extension"
+	case NullString, NullInt64, NullInt32, NullInt16,
+		NullByte, NullFloat64, NullBool, NullTime:
+		return s.Value.String()
 
 	// everything else is base.String() with
 	// the first letter as lowercase
@@ -830,6 +1247,40 @@ func (s *BaseElem) Complexity() int {
 	return 1
 }
 
+// identExpr returns the expression on which the methods of an
+// IDENT are called for the value x: x itself, or, if its type
+// was replaced, x converted to a pointer to the replacement.
+func (s *BaseElem) identExpr(x string) string {
+	if s.Replacement == "" {
+		return x
+	}
+	if strings.HasPrefix(x, "*") {
+		return "(*" + s.Replacement + ")(" + x[1:] + ")"
+	}
+	return "(*" + s.Replacement + ")(&" + x + ")"
+}
+
+// identPtr returns a pointer to x, for passing an IDENT
+// to the functions of msgp that take its methods
+func (s *BaseElem) identPtr(x string) string {
+	switch {
+	case s.Replacement != "":
+		return s.identExpr(x)
+	case strings.HasPrefix(x, "*"):
+		return x[1:]
+	}
+	return "&" + x
+}
+
+// identType returns the name of the type whose methods
+// encode an IDENT.
+func (s *BaseElem) identType() string {
+	if s.Replacement != "" {
+		return s.Replacement
+	}
+	return s.TypeName()
+}
+
 // Resolved returns whether or not
 // the type of the element is
 // a primitive or a builtin provided
@@ -872,6 +1323,19 @@ func (s *BaseElem) ZeroExpr() string {
 
 	case Time:
 		return "(time.Time{})"
+	case Addr:
+		return "(netip.Addr{})"
+	case AddrPort:
+		return "(netip.AddrPort{})"
+	case Text:
+		// text types may be based on
+		// anything, so have no literal
+		return "*new(" + s.TypeName() + ")"
+	case Intf, Iface:
+		return "nil"
+	case NullString, NullInt64, NullInt32, NullInt16,
+		NullByte, NullFloat64, NullBool, NullTime:
+		return "(" + s.Value.String() + "{})"
 	}
 
 	return ""
@@ -879,17 +1343,35 @@ func (s *BaseElem) ZeroExpr() string {
 
 // IfZeroExpr returns the expression to compare to zero/empty.
 func (s *BaseElem) IfZeroExpr() string {
+	// a shimmed value is of any type, and is zero if
+	// the value of the base type it is encoded as is
+	if s.ShimToBase != "" {
+		base := *s
+		base.ShimToBase, base.Convert = "", false
+		base.SetVarname(tobaseConvert(s))
+		return base.IfZeroExpr()
+	}
 	// Byte slices are special: we treat both nil and empty as
 	// zero for encoding purposes.
 	if s.Value == Bytes {
 		return "len(" + s.Varname() + ") == 0"
 	}
+	if s.Value == BigInt {
+		return stripRef(s.Varname()) + ".Sign() == 0"
+	}
+	if s.Value == Text {
+		return stripRef(s.Varname()) + " == " + s.ZeroExpr()
+	}
+	if _, ok := sqlNulls[s.Value]; ok {
+		// invalid values encode as 'nil' whatever they hold
+		return "!" + nullField(stripRef(s.Varname()), "Valid")
+	}
 
 	z := s.ZeroExpr()
 	if z == "" {
 		// Assume this is an identifier from another package,
 		// and that it has generated code for MsgIsZero.
-		return s.Varname() + ".MsgIsZero()"
+		return s.identExpr(s.Varname()) + ".MsgIsZero()"
 	}
 	return s.Varname() + " == " + z
 }
@@ -899,7 +1381,8 @@ func (s *BaseElem) Comparable() bool {
 	switch s.Value {
 	case String, Float32, Float64, Complex64, Complex128,
 		Uint, Uint8, Uint16, Uint32, Uint64, Byte,
-		Int, Int8, Int16, Int32, Int64, Bool, Time:
+		Int, Int8, Int16, Int32, Int64, Bool, Time, Duration,
+		Addr, AddrPort:
 		return true
 	default:
 		return false
@@ -967,6 +1450,32 @@ func (k Primitive) String() string {
 		return "time.Time"
 	case Duration:
 		return "time.Duration"
+	case Addr:
+		return "netip.Addr"
+	case AddrPort:
+		return "netip.AddrPort"
+	case BigInt:
+		return "big.Int"
+	case Text:
+		return "Text"
+	case Iface:
+		return "Iface"
+	case NullString:
+		return "sql.NullString"
+	case NullInt64:
+		return "sql.NullInt64"
+	case NullInt32:
+		return "sql.NullInt32"
+	case NullInt16:
+		return "sql.NullInt16"
+	case NullByte:
+		return "sql.NullByte"
+	case NullFloat64:
+		return "sql.NullFloat64"
+	case NullBool:
+		return "sql.NullBool"
+	case NullTime:
+		return "sql.NullTime"
 	case Ext:
 		return "Extension"
 	case IDENT:
@@ -1007,6 +1516,66 @@ func SetSortInterface(sorttype string, sortintf string) {
 
 var lessFunctions map[string]string
 
+// isOrderedKey returns whether map keys of type e can be
+// sorted with the < operator when no msgp:sort directive
+// applies to them: true for (non-shimmed) numbers and strings.
+func isOrderedKey(e Elem) bool {
+	be, ok := e.(*BaseElem)
+	if !ok || be.ShimToBase != "" {
+		return false
+	}
+	switch be.Value {
+	case String, Float32, Float64,
+		Uint, Uint8, Uint16, Uint32, Uint64, Uintptr, Byte,
+		Int, Int8, Int16, Int32, Int64:
+		return true
+	default:
+		return false
+	}
+}
+
+// elemLess returns the expression for whether the element
+// a of type e sorts before b: the msgp:sort LessFunction if
+// there is one, < for numbers and strings, or otherwise the
+// LessThan method, which the element type has to provide.
+func elemLess(e Elem, a, b string) string {
+	switch {
+	case e.LessFunction() != "":
+		return fmt.Sprintf("%s(%s, %s)", e.LessFunction(), a, b)
+	case isOrderedKey(e):
+		return fmt.Sprintf("%s < %s", a, b)
+	default:
+		return fmt.Sprintf("%s.LessThan(%s)", a, b)
+	}
+}
+
+// isByte returns whether e is a byte, or a uint8, which
+// is the same type: a [N]byte is encoded as 'bin', rather
+// than as an array, as a []byte is. The elements of a
+// [N]MyByte, which is not a [N]byte, are converted one
+// at a time, and those of a [N]uint8 with a fixed int=
+// form are encoded in it.
+func isByte(e Elem) bool {
+	be, ok := e.(*BaseElem)
+	return ok && (be.Value == Byte || be.Value == Uint8) && !be.Convert && be.FixedInt == 0
+}
+
+// StringKeyElem returns the key of maps keyed by the named type
+// typ, which is encoded as a 'str' holding the key's String(),
+// and decoded by parse, a func(string) (typ, error). Keys are
+// sorted by their strings, as they are encoded.
+func StringKeyElem(typ string, parse string) *BaseElem {
+	be := &BaseElem{Value: String, ShimToBase: typ + ".String", ShimFromBase: parse, ShimMode: Convert, StringKey: true}
+	be.Alias(typ)
+	return be
+}
+
+// isStringKey returns whether e is a key from StringKeyElem
+func isStringKey(e Elem) bool {
+	be, ok := e.(*BaseElem)
+	return ok && be.StringKey
+}
+
 func SetLessFunction(sorttype string, lessfn string) {
 	if lessFunctions == nil {
 		lessFunctions = make(map[string]string)
@@ -1014,3 +1583,24 @@ func SetLessFunction(sorttype string, lessfn string) {
 
 	lessFunctions[sorttype] = lessfn
 }
+
+// SetPool registers types from the msgp:pool directive,
+// whose values are taken from a sync.Pool when decoding
+// through a pointer, and returned to it on Reset. Like
+// sortInterface, this is kept outside of the Elem so
+// that it applies to every pointer to the type.
+var pools map[string]bool
+
+func SetPool(typename string) {
+	if pools == nil {
+		pools = make(map[string]bool)
+	}
+
+	pools[typename] = true
+}
+
+// pooled returns whether pointers to values of type e
+// are allocated from a pool
+func pooled(e Elem) bool {
+	return pools[e.TypeName()]
+}
@@ -0,0 +1,199 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func equals(w io.Writer, topics *Topics) *equalGen {
+	return &equalGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// equalGen prints Equal methods, which report whether two
+// values encode to the same message. Unlike the other
+// generators, it walks two values at once, so it names the
+// values being compared itself rather than relying on
+// Varname.
+type equalGen struct {
+	passes
+	p      printer
+	topics *Topics
+}
+
+func (e *equalGen) Method() Method { return Equal }
+
+func (e *equalGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (e *equalGen) Execute(p Elem) ([]string, error) {
+	if !e.p.ok() {
+		return nil, e.p.err
+	}
+	p = e.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+
+	c := p.Varname()
+	e.p.comment("Equal returns whether " + c + " and o encode to the same message")
+
+	receiver := "*" + p.TypeName()
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		e.p.printf("\nfunc (%s %s) Equal(o %s) bool {", c, receiver, receiver)
+		e.p.printf("\n  return ((*(%[1]s))(%[2]s)).Equal((*(%[1]s))(o))", baseType, c)
+		e.p.printf("\n}")
+		e.topics.Add(receiver, "Equal")
+		return nil, e.p.err
+	}
+
+	e.p.printf("\nfunc (%s %s) Equal(o %s) bool {", c, receiver, receiver)
+	e.compare(p, "(*"+c+")", "(*o)")
+	e.p.printf("\nreturn true\n}\n")
+	e.topics.Add(receiver, "Equal")
+	return nil, e.p.err
+}
+
+// notEqual prints a return of false if cond holds
+func (e *equalGen) notEqual(cond string) {
+	e.p.printf("\nif %s {\nreturn false\n}", cond)
+}
+
+// nilEqual prints a return of false if one of a and b, of
+// type el, is nil and the other isn't, and el encodes nil
+// and empty values differently
+func (e *equalGen) nilEqual(el Elem, a string, b string) {
+	if !collapsesNil(el) {
+		e.notEqual("(" + a + " == nil) != (" + b + " == nil)")
+	}
+}
+
+// nilable returns whether el is a slice, map or []byte, which
+// the nil policy applies to
+func nilable(el Elem) bool {
+	switch el := el.(type) {
+	case *Slice, *Map:
+		return true
+	case *BaseElem:
+		return el.Value == Bytes
+	}
+	return false
+}
+
+// compare prints statements that return false
+// if the values a and b of type el differ.
+func (e *equalGen) compare(el Elem, a string, b string) {
+	if !e.p.ok() {
+		return
+	}
+	switch el := el.(type) {
+	case *Struct:
+		for i := range el.Fields {
+			if !ast.IsExported(el.Fields[i].FieldName) {
+				continue
+			}
+			path := "." + fieldPath(el.Fields[i])
+			fe := el.Fields[i].FieldElem
+			if nilable(fe) && isFieldOmitEmpty(el.Fields[i], el) && !el.AsTuple {
+				// nil and empty values are both left out
+				e.p.printf("\nif len(%s) != 0 || len(%s) != 0 {", a+path, b+path)
+				e.compare(fe, a+path, b+path)
+				e.p.closeblock()
+				continue
+			}
+			e.compare(fe, a+path, b+path)
+		}
+	case *Ptr:
+		e.notEqual("(" + a + " == nil) != (" + b + " == nil)")
+		e.p.printf("\nif %s != nil {", a)
+		e.compare(el.Value, "(*"+a+")", "(*"+b+")")
+		e.p.closeblock()
+	case *Array:
+		idx := randIdent()
+		e.p.printf("\nfor %s := range %s {", idx, a)
+		e.compare(el.Els, a+"["+idx+"]", b+"["+idx+"]")
+		e.p.closeblock()
+	case *Slice:
+		e.nilEqual(el, a, b)
+		e.notEqual("len(" + a + ") != len(" + b + ")")
+		if el.SortSlice {
+			// the elements are encoded in sorted order,
+			// whatever their order in the slice
+			as, bs := randIdent(), randIdent()
+			e.p.sortedCopy(el, as, a)
+			e.p.sortedCopy(el, bs, b)
+			a, b = as, bs
+		}
+		idx := randIdent()
+		e.p.printf("\nfor %s := range %s {", idx, a)
+		e.compare(el.Els, a+"["+idx+"]", b+"["+idx+"]")
+		e.p.closeblock()
+	case *Map:
+		e.nilEqual(el, a, b)
+		e.notEqual("len(" + a + ") != len(" + b + ")")
+		if el.IsSet() {
+			// only the keys of a set are compared
+			key := randIdent()
+			e.p.printf("\nfor %s := range %s {", key, a)
+			e.notEqual("_, ok := " + b + "[" + key + "]; !ok")
+			e.p.closeblock()
+			return
+		}
+		key, av, bv, ok := randIdent(), randIdent(), randIdent(), randIdent()
+		e.p.printf("\nfor %s, %s := range %s {", key, av, a)
+		e.p.printf("\n%s, %s := %s[%s]", bv, ok, b, key)
+		e.notEqual("!" + ok)
+		e.compare(el.Value, av, bv)
+		e.p.closeblock()
+	case *BaseElem:
+		e.compareBase(el, a, b)
+	}
+}
+
+func (e *equalGen) compareBase(b *BaseElem, x string, y string) {
+	if b.Convert {
+		x = b.ToBase() + "(" + x + ")"
+		y = b.ToBase() + "(" + y + ")"
+	}
+	if null, ok := sqlNulls[b.Value]; ok {
+		// invalid values are equal whatever they hold
+		e.notEqual(nullField(x, "Valid") + " != " + nullField(y, "Valid"))
+		e.p.printf("\nif %s {", nullField(x, "Valid"))
+		e.compareBase(&BaseElem{Value: null.value}, nullField(x, null.field), nullField(y, null.field))
+		e.p.closeblock()
+		return
+	}
+	switch b.Value {
+	case IDENT:
+		if b.TypeName() == "msgp.Raw" {
+			e.notEqual("!bytes.Equal(" + x + ", " + y + ")")
+			return
+		}
+		if b.Replacement != "" {
+			e.notEqual("!" + b.identExpr(x) + ".Equal(" + b.identExpr(y) + ")")
+			return
+		}
+		e.notEqual("!" + x + ".Equal(&" + y + ")")
+	case Bytes:
+		e.nilEqual(b, x, y)
+		e.notEqual("!bytes.Equal(" + x + ", " + y + ")")
+	case Time:
+		e.notEqual("!" + x + ".Equal(" + y + ")")
+	case BigInt:
+		e.notEqual("(&" + x + ").Cmp(&" + y + ") != 0")
+	case Float32:
+		// compare bit patterns, so that NaNs (which encode
+		// identically) are equal but 0 and -0 are not
+		e.notEqual("math.Float32bits(" + x + ") != math.Float32bits(" + y + ")")
+	case Float64:
+		e.notEqual("math.Float64bits(" + x + ") != math.Float64bits(" + y + ")")
+	case Intf, Ext, Iface:
+		e.notEqual("!reflect.DeepEqual(" + x + ", " + y + ")")
+	default:
+		e.notEqual(x + " != " + y)
+	}
+}
@@ -0,0 +1,76 @@
+package gen
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func equalGenerator(w *bytes.Buffer, topics *Topics) generator { return equals(w, topics) }
+
+func TestEqual(t *testing.T) {
+	st := testStruct("E", "",
+		testField("P", "p", &Ptr{Value: Ident("", "Inner")}),
+		testField("L", "l", &Slice{Els: &BaseElem{Value: Int64}}),
+		testField("M", "m", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Bytes}}),
+		testField("T", "t", &BaseElem{Value: Time}),
+		testField("F", "f", &BaseElem{Value: Float64}),
+	)
+	out := generateMethod(t, equalGenerator, st)
+
+	for _, want := range []string{
+		"func (z *E) Equal(o *E) bool {",
+		"if ((*z).P == nil) != ((*o).P == nil) {",
+		"if !(*(*z).P).Equal(&(*(*o).P)) {",
+		"if len((*z).L) != len((*o).L) {",
+		"if !bytes.Equal(",
+		"if !(*z).T.Equal((*o).T) {",
+		"if math.Float64bits((*z).F) != math.Float64bits((*o).F) {",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestEqualSet(t *testing.T) {
+	st := testStruct("S", "",
+		testField("K", "k", &Map{Key: &BaseElem{Value: String}, Value: &Struct{}}),
+	)
+	out := generateMethod(t, equalGenerator, st)
+
+	// there are no values to compare, only keys
+	for _, want := range []string{
+		"if len((*z).K) != len((*o).K) {",
+		"if _, ok := (*o).K[",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if regexp.MustCompile(`for za\d+, za\d+ := range \(\*z\)\.K`).MatchString(out) {
+		t.Errorf("the values of a set are compared:\n%s", out)
+	}
+}
+
+func TestEqualSortSlice(t *testing.T) {
+	s := &Slice{Els: &BaseElem{Value: Int64}, SortSlice: true}
+	s.SetAllocBound("8")
+	out := generateMethod(t, equalGenerator, testStruct("Sorted", "", testField("U", "u", s)))
+
+	// values that encode the same, in sorted order, are equal
+	// whatever the order of their elements
+	for _, want := range []string{
+		`(za\d+) := make\(\[\]int64, len\(\(\*z\)\.U\)\)\s+copy\(za\d+, \(\*z\)\.U\)\s+sort\.Slice\(za\d+, `,
+		`(za\d+) := make\(\[\]int64, len\(\(\*o\)\.U\)\)\s+copy\(za\d+, \(\*o\)\.U\)\s+sort\.Slice\(za\d+, `,
+		`if za\d+\[za\d+\] != za\d+\[za\d+\] {`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "(*z).U[") {
+		t.Errorf("unsorted elements compared:\n%s", out)
+	}
+}
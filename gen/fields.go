@@ -0,0 +1,99 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func unmarshalFields(w io.Writer, topics *Topics) *unmarshalFieldsGen {
+	return &unmarshalFieldsGen{
+		u:      unmarshal(w, topics),
+		topics: topics,
+	}
+}
+
+// unmarshalFieldsGen prints UnmarshalMsgFields methods, which
+// decode only the fields of a struct whose keys they are given,
+// and skip the others, so that the values of those fields are
+// never allocated. The fields are decoded as in UnmarshalMsg,
+// by the cases of its switch on the key.
+type unmarshalFieldsGen struct {
+	passes
+	u      *unmarshalGen
+	topics *Topics
+}
+
+func (f *unmarshalFieldsGen) Method() Method { return Fields }
+
+func (f *unmarshalFieldsGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (f *unmarshalFieldsGen) Execute(p Elem) ([]string, error) {
+	u := f.u
+	u.msgs = nil
+	u.hasfield = false
+	if !u.p.ok() {
+		return nil, u.p.err
+	}
+	p = f.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+	// only structs encoded as maps have keys to select
+	s, ok := p.(*Struct)
+	if !ok || s.AsTuple {
+		return nil, nil
+	}
+	p = p.Copy()
+	s = p.(*Struct)
+	u.ctx = &Context{}
+
+	c := p.Varname()
+	methodRecv := methodReceiver(p)
+	sz := randIdent()
+
+	u.p.comment("UnmarshalMsgFields is like UnmarshalMsg, but only decodes the fields with the given keys, and")
+	u.p.comment("skips the others, which are left zero")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgFields(bts []byte, fields ...string) (o []byte, err error) {", c, methodRecv)
+	// the decoding of the fields refers to these, as it does
+	// in unmarshalMsg, and is held to the same maxtotalbytes
+	u.p.print("\nconst validate = false\nvar budget *msgp.Budget")
+	if limit := p.MaxTotalBytes(); limit != "" && limit != "-" {
+		u.p.printf("\nbudget = budget.Limit(bts, %s)", limit)
+	}
+	u.p.print("\n_ = budget")
+	u.p.printf("\n%s = %s{}", s.Varname(), s.TypeName())
+	u.needsField()
+	u.p.declare(sz, "int")
+	u.assignAndCheck(sz, "_", mapHeader)
+	u.p.printf("\nfor %s > 0 {", sz)
+	u.p.printf("\n%s--; field, bts, err = msgp.ReadMapKeyZC(bts)", sz)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.print("\nif !msgp.HasField(fields, field) {\nbts, err = msgp.SkipBudget(budget, bts)")
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.print("\ncontinue\n}")
+	u.p.print("\nswitch string(field) {")
+	for i := range s.Fields {
+		if !ast.IsExported(s.Fields[i].FieldName) {
+			continue
+		}
+		if !u.p.ok() {
+			return nil, u.p.err
+		}
+		u.p.printf("\ncase \"%s\":", s.Fields[i].FieldTag)
+		u.ctx.PushString(s.Fields[i].FieldName)
+		next(u, s.Fields[i].FieldElem)
+		u.ctx.Pop()
+	}
+	u.p.print("\ndefault:\nerr = msgp.ErrNoField(string(field))")
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.print("\n}") // close switch
+	u.p.print("\n}") // close for loop
+	u.p.print("\nif err = budget.Spend(bts, 0); err != nil {\nreturn\n}")
+	u.p.print("\no = bts")
+	u.p.nakedReturn()
+
+	f.topics.Add(methodRecv, "UnmarshalMsgFields")
+	return u.msgs, u.p.err
+}
@@ -0,0 +1,50 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func unmarshalFieldsGenerator(w *bytes.Buffer, topics *Topics) generator {
+	return unmarshalFields(w, topics)
+}
+
+func TestUnmarshalFields(t *testing.T) {
+	l := &Slice{Els: &BaseElem{Value: Int64}}
+	l.SetAllocBound("16")
+	st := testStruct("F", "",
+		testField("N", "n", &BaseElem{Value: Int64}),
+		testField("L", "l", l),
+		testField("In", "in", Ident("", "Inner")),
+	)
+	out := generateMethod(t, unmarshalFieldsGenerator, st)
+
+	for _, want := range []string{
+		"func (z *F) UnmarshalMsgFields(bts []byte, fields ...string) (o []byte, err error) {",
+		// the fields that aren't decoded are left zero
+		"(*z) = F{}",
+		"if !msgp.HasField(fields, field) {\nbts, err = msgp.SkipBudget(budget, bts)",
+		"case \"n\":\n(*z).N, bts, err = msgp.ReadInt64Bytes(bts)",
+		"case \"l\":",
+		"case \"in\":\nbts, err = msgp.UnmarshalWithBudget(&(*z).In, bts, budget)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// the maxtotalbytes of the type limits the fields decoded,
+	// and the ones skipped
+	st.SetMaxTotalBytes("1000")
+	if out := generateMethod(t, unmarshalFieldsGenerator, st); !strings.Contains(out, "var budget *msgp.Budget\nbudget = budget.Limit(bts, 1000)") {
+		t.Errorf("missing the budget of maxtotalbytes in generated code:\n%s", out)
+	}
+
+	// tuples have no keys to select fields by
+	tuple := testStruct("T", "", testField("N", "n", &BaseElem{Value: Int64}))
+	tuple.AsTuple = true
+	if out := generateMethod(t, unmarshalFieldsGenerator, tuple); out != "" {
+		t.Errorf("UnmarshalMsgFields for a tuple:\n%s", out)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go/ast"
 	"io"
+	"math"
 	"sort"
 	"strings"
 
@@ -17,6 +18,12 @@ func marshal(w io.Writer, topics *Topics) *marshalGen {
 	}
 }
 
+// marshalGen prints MarshalMsg methods. These grow the buffer to
+// Msgsize() bytes up front, so that marshaling into a buffer with
+// that much spare capacity doesn't allocate, except as described
+// by marshalAllocates, and marshaling into an empty one allocates
+// once. The msgp:nosizehint directive turns this off for types
+// whose Msgsize() is much larger than their typical encoding.
 type marshalGen struct {
 	passes
 	p      printer
@@ -24,6 +31,7 @@ type marshalGen struct {
 	ctx    *Context
 	msgs   []string
 	topics *Topics
+	framed bool // also print MarshalFramed
 }
 
 func (m *marshalGen) Method() Method { return Marshal }
@@ -65,6 +73,7 @@ func (m *marshalGen) Execute(p Elem) ([]string, error) {
 
 		m.topics.Add(methodRecv, "MarshalMsg")
 		m.topics.Add(methodRecv, "CanMarshalMsg")
+		m.printFramed(c, methodRecv)
 
 		return m.msgs, m.p.err
 	}
@@ -76,7 +85,11 @@ func (m *marshalGen) Execute(p Elem) ([]string, error) {
 	methodRecv := imutMethodReceiver(p)
 
 	m.p.printf("\nfunc (%s %s) MarshalMsg(b []byte) (o []byte) {", c, methodRecv)
-	m.p.printf("\no = msgp.Require(b, %s.Msgsize())", c)
+	if p.NoSizeHint() {
+		m.p.print("\no = b")
+	} else {
+		m.p.printf("\no = msgp.Require(b, %s.Msgsize())", c)
+	}
 	next(m, p)
 	m.p.nakedReturn()
 
@@ -95,10 +108,26 @@ func (m *marshalGen) Execute(p Elem) ([]string, error) {
 
 	m.topics.Add(methodRecv, "MarshalMsg")
 	m.topics.Add(methodRecv, "CanMarshalMsg")
+	m.printFramed(c, methodRecv)
 
 	return m.msgs, m.p.err
 }
 
+// printFramed prints MarshalFramed, which appends a frame, as
+// msgp.AppendFrame does, holding the encoding of the value, if
+// enabled. It is encoded in place, after room for the header.
+func (m *marshalGen) printFramed(c string, methodRecv string) {
+	if !m.framed {
+		return
+	}
+	m.p.comment("MarshalFramed appends a frame holding the encoding of " + c + " to b, as msgp.AppendFrame does")
+	m.p.printf("\nfunc (%s %s) MarshalFramed(b []byte) []byte {", c, methodRecv)
+	m.p.printf("\n  start := len(b)")
+	m.p.printf("\n  return msgp.FinishFrame(%s.MarshalMsg(msgp.ReserveFrame(b)), start)", c)
+	m.p.printf("\n}")
+	m.topics.Add(methodRecv, "MarshalFramed")
+}
+
 func (m *marshalGen) rawAppend(typ string, argfmt string, arg interface{}) {
 	m.p.printf("\no = msgp.Append%s(o, %s)", typ, fmt.Sprintf(argfmt, arg))
 }
@@ -132,6 +161,10 @@ func (m *marshalGen) gStruct(s *Struct) {
 }
 
 func (m *marshalGen) tuple(s *Struct) {
+	if s.versioned() {
+		m.versionedTuple(s)
+		return
+	}
 	data := make([]byte, 0, 5)
 	data = msgp.AppendArrayHeader(data, uint32(len(s.Fields)))
 	m.p.printf("\n// array header, size %d", len(s.Fields))
@@ -149,6 +182,66 @@ func (m *marshalGen) tuple(s *Struct) {
 	}
 }
 
+// versionedTuple prints a tuple whose array leaves out the
+// fields that aren't present in the version of the message,
+// which the decoder reads first, since it precedes them
+func (m *marshalGen) versionedTuple(s *Struct) {
+	m.fuseHook()
+	sz := randIdent()
+	m.p.printf("\n%s := uint32(%d)", sz, len(s.Fields))
+	for _, sf := range s.Fields {
+		if absent := s.absentExpr(sf); absent != "" {
+			m.p.printf("\nif %s {\n%s--\n}", absent, sz)
+		}
+	}
+	m.p.printf("\n// array header, size %s", sz)
+	m.p.printf("\no = msgp.AppendArrayHeader(o, %s)", sz)
+	for _, sf := range s.Fields {
+		if !m.p.ok() {
+			return
+		}
+		absent := s.absentExpr(sf)
+		if absent != "" {
+			m.fuseHook()
+			m.p.printf("\nif !(%s) {", absent)
+		}
+		m.ctx.PushString(sf.FieldName)
+		next(m, sf.FieldElem)
+		m.ctx.Pop()
+		if absent != "" {
+			m.fuseHook()
+			m.p.closeblock()
+		}
+	}
+}
+
+// duplicateKeys returns a message for each key that more than one
+// of the exported fields, sorted by tag, would be encoded under. Since
+// the fields of embedded structs are flattened into the struct that
+// embeds them, this includes keys that an embedded struct shares with
+// its parent, or with another embedded struct.
+func duplicateKeys(s *Struct, sorted []StructField) []string {
+	var msgs []string
+	var prev *StructField
+	for i := range sorted {
+		sf := &sorted[i]
+		if !ast.IsExported(sf.FieldName) {
+			continue
+		}
+		if prev != nil && prev.FieldTag == sf.FieldTag {
+			msgs = append(msgs, fmt.Sprintf("Duplicate key %q in struct %s: fields %s and %s", sf.FieldTag, s.TypeName(), fieldPath(*prev), fieldPath(*sf)))
+		}
+		prev = sf
+	}
+	return msgs
+}
+
+// fieldPath returns the selector of a field, through
+// any embedded structs it was promoted from.
+func fieldPath(sf StructField) string {
+	return strings.Join(append(append([]string(nil), sf.FieldPath...), sf.FieldName), ".")
+}
+
 func isFieldOmitEmpty(sf StructField, s *Struct) bool {
 	tagName := "omitempty"
 
@@ -162,6 +255,51 @@ func isFieldOmitEmpty(sf StructField, s *Struct) bool {
 	return sf.HasTagPart(tagName) || s.UnderscoreStructHasTagPart(tagName)
 }
 
+// isFieldOmitZero returns whether the field should be omitted
+// when it is equal to its zero value.  Unlike omitempty, an empty
+// but non-nil slice or map is not considered zero.
+func isFieldOmitZero(sf StructField, s *Struct) bool {
+	return sf.HasTagPart("omitzero") || s.UnderscoreStructHasTagPart("omitzero")
+}
+
+// fieldOmitExpr returns the expression that is true when the field
+// should be omitted from the encoding, or "" if it is always encoded.
+// A field of a map is omitted in the versions that it isn't present in,
+// as well as when it's empty.
+func fieldOmitExpr(sf StructField, s *Struct) string {
+	omit := ""
+	if isFieldOmitEmpty(sf, s) {
+		omit = sf.FieldElem.IfZeroExpr()
+	}
+	if omit == "" && isFieldOmitZero(sf, s) {
+		omit = zeroValueExpr(sf.FieldElem)
+	}
+	if absent := s.absentExpr(sf); absent != "" && !s.AsTuple {
+		if omit == "" {
+			return absent
+		}
+		return absent + " || " + omit
+	}
+	return omit
+}
+
+// zeroValueExpr returns the expression to compare e to
+// its Go zero value, or "" if not supported.
+func zeroValueExpr(e Elem) string {
+	switch e := e.(type) {
+	case *Slice, *Map, *Ptr:
+		return e.Varname() + " == nil"
+	case *BaseElem:
+		switch {
+		case e.Value == Bytes:
+			return e.Varname() + " == nil"
+		case e.Value == IDENT:
+			return e.identExpr(e.Varname()) + ".MsgIsZero()"
+		}
+	}
+	return e.IfZeroExpr()
+}
+
 func (m *marshalGen) mapstruct(s *Struct) {
 
 	// Every struct must have a _struct annotation with a codec: tag.
@@ -175,6 +313,10 @@ func (m *marshalGen) mapstruct(s *Struct) {
 
 	sortedFields := append([]StructField(nil), s.Fields...)
 	sort.Sort(byFieldTag(sortedFields))
+	if msgs := duplicateKeys(s, sortedFields); len(msgs) > 0 {
+		m.msgs = append(m.msgs, msgs...)
+		return
+	}
 
 	oeIdentPrefix := randIdent()
 
@@ -193,7 +335,19 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		exportedFields++
 	}
 
-	omitempty := s.AnyHasTagPart("omitempty")
+	// the fields that s doesn't declare are merged into the
+	// declared ones in order of their keys, as they are sorted
+	uf := s.unknownExpr()
+	var ukeys string
+	maxFields := exportedFields
+	if uf != "" {
+		ukeys = oeIdentPrefix + "Unknown"
+		m.fuseHook()
+		m.p.printf("\n%s := msgp.UnknownKeys(%s, %s)", ukeys, uf, strings.Join(s.fieldTags(), ", "))
+		maxFields = math.MaxInt32
+	}
+
+	omitempty := s.AnyHasTagPart("omitempty") || s.AnyHasTagPart("omitzero") || s.versioned()
 	var fieldNVar string
 	needCloseBrace := false
 	needBmDecl := true
@@ -212,8 +366,7 @@ func (m *marshalGen) mapstruct(s *Struct) {
 				continue
 			}
 
-			fieldOmitEmpty := isFieldOmitEmpty(sf, s)
-			if ize := sf.FieldElem.IfZeroExpr(); ize != "" && fieldOmitEmpty {
+			if ize := fieldOmitExpr(sf, s); ize != "" {
 				if needBmDecl {
 					m.p.printf("\n%s", bm.typeDecl())
 					needBmDecl = false
@@ -226,8 +379,11 @@ func (m *marshalGen) mapstruct(s *Struct) {
 			}
 		}
 
+		if uf != "" {
+			m.p.printf("\n%s += uint32(len(%s))", fieldNVar, ukeys)
+		}
 		m.p.printf("\n// variable map header, size %s", fieldNVar)
-		m.p.varAppendMapHeader("o", fieldNVar, exportedFields)
+		m.p.varAppendMapHeader("o", fieldNVar, maxFields)
 		if !m.p.ok() {
 			return
 		}
@@ -238,6 +394,9 @@ func (m *marshalGen) mapstruct(s *Struct) {
 			needCloseBrace = true
 		}
 
+	} else if uf != "" {
+		m.p.printf("\n// map header, size %d and the unknown fields", exportedFields)
+		m.p.printf("\no = msgp.AppendMapHeader(o, uint32(%d+len(%s)))", exportedFields, ukeys)
 	} else {
 
 		// non-omitempty version
@@ -260,10 +419,13 @@ func (m *marshalGen) mapstruct(s *Struct) {
 			return
 		}
 
-		fieldOmitEmpty := isFieldOmitEmpty(sf, s)
+		if uf != "" {
+			m.fuseHook()
+			m.p.printf("\no, %s = msgp.AppendUnknownBefore(o, %s, %s, %q)", ukeys, uf, ukeys, sf.FieldTag)
+		}
 
 		// if field is omitempty, wrap with if statement based on the emptymask
-		oeField := fieldOmitEmpty && sf.FieldElem.IfZeroExpr() != ""
+		oeField := fieldOmitExpr(sf, s) != ""
 		if oeField {
 			m.p.printf("\nif %s == 0 { // if not empty", bm.readExpr(i))
 		}
@@ -283,6 +445,10 @@ func (m *marshalGen) mapstruct(s *Struct) {
 		}
 
 	}
+	if uf != "" {
+		m.fuseHook()
+		m.p.printf("\no = msgp.AppendUnknown(o, %s, %s)", uf, ukeys)
+	}
 
 	if needCloseBrace {
 		m.p.printf("\n}")
@@ -304,25 +470,28 @@ func (m *marshalGen) gMap(s *Map) {
 	}
 	m.fuseHook()
 	vname := s.Varname()
-	m.p.printf("\nif %s == nil {", vname)
-	m.p.printf("\n  o = msgp.AppendNil(o)")
-	m.p.printf("\n} else {")
-	m.rawAppend(mapHeader, lenAsUint32, vname)
-	m.p.printf("\n}")
-
-	m.p.printf("\n%s_keys := make([]%s, 0, len(%s))", s.Keyidx, s.Key.TypeName(), vname)
-	m.p.printf("\nfor %s := range %s {", s.Keyidx, vname)
-	m.p.printf("\n%s_keys = append(%s_keys, %s)", s.Keyidx, s.Keyidx, s.Keyidx)
-	m.p.closeblock()
-
-	m.p.printf("\nsort.Sort(%s(%s_keys))", s.Key.SortInterface(), s.Keyidx)
+	if collapsesNil(s) {
+		m.rawAppend(s.header(), lenAsUint32, vname)
+	} else {
+		m.p.printf("\nif %s == nil {", vname)
+		m.p.printf("\n  o = msgp.AppendNil(o)")
+		m.p.printf("\n} else {")
+		m.rawAppend(s.header(), lenAsUint32, vname)
+		m.p.printf("\n}")
+	}
 
+	// a set is the array of its sorted keys
+	m.msgs = append(m.msgs, m.p.sortedKeys(s)...)
 	m.p.printf("\nfor _, %s := range %s_keys {", s.Keyidx, s.Keyidx)
-	m.p.printf("\n%s := %s[%s]", s.Validx, vname, s.Keyidx)
-	m.p.printf("\n_ = %s", s.Validx) // we may not use the value, if it's a struct{}
+	if !s.IsSet() {
+		m.p.printf("\n%s := %s[%s]", s.Validx, vname, s.Keyidx)
+		m.p.printf("\n_ = %s", s.Validx) // we may not use the value, if it's a struct{}
+	}
 	m.ctx.PushVar(s.Keyidx)
 	next(m, s.Key)
-	next(m, s.Value)
+	if !s.IsSet() {
+		next(m, s.Value)
+	}
 	m.ctx.Pop()
 	m.p.closeblock()
 }
@@ -333,11 +502,19 @@ func (m *marshalGen) gSlice(s *Slice) {
 	}
 	m.fuseHook()
 	vname := s.Varname()
-	m.p.printf("\nif %s == nil {", vname)
-	m.p.printf("\n  o = msgp.AppendNil(o)")
-	m.p.printf("\n} else {")
-	m.rawAppend(arrayHeader, lenAsUint32, vname)
-	m.p.printf("\n}")
+	if collapsesNil(s) {
+		m.rawAppend(arrayHeader, lenAsUint32, vname)
+	} else {
+		m.p.printf("\nif %s == nil {", vname)
+		m.p.printf("\n  o = msgp.AppendNil(o)")
+		m.p.printf("\n} else {")
+		m.rawAppend(arrayHeader, lenAsUint32, vname)
+		m.p.printf("\n}")
+	}
+	if s.SortSlice {
+		m.p.rangeBlock(m.ctx, s.Index, s.Index+"_sorted", m, m.p.sortedSlice(s))
+		return
+	}
 	m.p.rangeBlock(m.ctx, s.Index, vname, m, s.Els)
 }
 
@@ -346,7 +523,7 @@ func (m *marshalGen) gArray(a *Array) {
 		return
 	}
 	m.fuseHook()
-	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+	if isByte(a.Els) {
 		m.rawAppend("Bytes", "(%s)[:]", a.Varname())
 		return
 	}
@@ -372,6 +549,17 @@ func (m *marshalGen) gBase(b *BaseElem) {
 	m.fuseHook()
 	vname := b.Varname()
 
+	if b.Enum != nil {
+		// values without a name fall through
+		// to the encoding of the integer
+		m.p.printf("\nswitch %s {", vname)
+		for _, name := range b.Enum.Names {
+			m.p.printf("\ncase %s:\no = msgp.AppendString(o, %q)", name, name)
+		}
+		m.p.print("\ndefault:")
+		defer m.p.closeblock()
+	}
+
 	if b.Convert {
 		if b.ShimMode == Cast {
 			vname = tobaseConvert(b)
@@ -384,10 +572,60 @@ func (m *marshalGen) gBase(b *BaseElem) {
 
 	switch b.Value {
 	case IDENT:
-		m.p.printf("\no = %s.MarshalMsg(o)", vname)
-	case Intf, Ext:
+		m.p.printf("\no = %s.MarshalMsg(o)", b.identExpr(vname))
+	case Intf, Ext, BigInt, Text, Iface:
 		m.p.printf("\no = msgp.Append%s(o, %s)", b.BaseName(), vname)
+	case Bytes:
+		if collapsesNil(b) {
+			// AppendBytes encodes a nil slice as 'nil'
+			m.p.printf("\nif %s == nil {\no = msgp.AppendBytes(o, []byte{})\n} else {", vname)
+			m.rawAppend(b.BaseName(), literalFmt, vname)
+			m.p.closeblock()
+		} else {
+			m.rawAppend(b.BaseName(), literalFmt, vname)
+		}
+	default:
+		if b.FixedInt != 0 {
+			if typ := strings.ToLower(b.fixedName()); typ != b.BaseType() {
+				vname = typ + "(" + vname + ")"
+			}
+			m.rawAppend("Fixed"+b.fixedName(), literalFmt, vname)
+		} else {
+			m.rawAppend(b.BaseName(), literalFmt, vname)
+		}
+	}
+}
+
+// marshalAllocates returns whether MarshalMsg may allocate for a value
+// of type e even when the buffer has enough capacity. This is the case
+// for maps (whose keys are collected into a temporary slice for sorting),
+// sortslice slices (which are copied to be sorted), interfaces and
+// extensions (which are encoded through an interface), text types, and
+// shimmed types (whose conversion functions may allocate). Values of
+// other named types are assumed to allocate, since their definitions
+// aren't known here.
+func marshalAllocates(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		for i := range e.Fields {
+			if ast.IsExported(e.Fields[i].FieldName) && marshalAllocates(e.Fields[i].FieldElem) {
+				return true
+			}
+		}
+		return false
+	case *Ptr:
+		return marshalAllocates(e.Value)
+	case *Array:
+		return marshalAllocates(e.Els)
+	case *Slice:
+		return e.SortSlice || marshalAllocates(e.Els)
+	case *BaseElem:
+		switch e.Value {
+		case IDENT, Intf, Ext, Text, Iface:
+			return true
+		}
+		return e.ShimToBase != ""
 	default:
-		m.rawAppend(b.BaseName(), literalFmt, vname)
+		return true
 	}
 }
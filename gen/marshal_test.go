@@ -0,0 +1,663 @@
+package gen
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// testStruct builds a named struct Elem with a _struct annotation
+// carrying the given options, followed by the given fields.
+func testStruct(name string, structOpts string, fields ...StructField) *Struct {
+	st := &Struct{Fields: []StructField{{
+		FieldTag:      "",
+		FieldTagParts: strings.Split(structOpts, ","),
+		HasCodecTag:   true,
+		FieldName:     "_struct",
+		FieldElem:     &Struct{},
+	}}}
+	for _, f := range fields {
+		f.HasCodecTag = true
+		f.FieldTag = f.FieldTagParts[0]
+		st.Fields = append(st.Fields, f)
+	}
+	st.Alias(name)
+	st.SetVarname("z")
+	return st
+}
+
+func testField(name string, tag string, e Elem) StructField {
+	return StructField{FieldName: name, FieldTagParts: strings.Split(tag, ","), FieldElem: e}
+}
+
+// generateMethod runs a single generator over e and returns its output.
+func generateMethod(t *testing.T, g func(w *bytes.Buffer, topics *Topics) generator, e Elem) string {
+	t.Helper()
+	var buf bytes.Buffer
+	var topics Topics
+	msgs, err := g(&buf, &topics).Execute(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) > 0 {
+		t.Fatalf("unexpected messages: %v", msgs)
+	}
+	return buf.String()
+}
+
+func marshalGenerator(w *bytes.Buffer, topics *Topics) generator { return marshal(w, topics) }
+
+func TestOmitZero(t *testing.T) {
+	st := testStruct("OZ", "",
+		testField("In", "in,omitzero", Ident("", "Inner")),
+		testField("L", "l,omitzero", &Slice{Els: &BaseElem{Value: Int64}}),
+		testField("E", "e,omitempty", &Slice{Els: &BaseElem{Value: Int64}}),
+		testField("N", "n", &BaseElem{Value: Int64}),
+	)
+	out := generateMethod(t, marshalGenerator, st)
+
+	for _, want := range []string{
+		"if (*z).In.MsgIsZero() {",
+		"if (*z).L == nil {",
+		"if len((*z).E) == 0 {",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "(*z).N == 0") {
+		t.Errorf("field without omitzero/omitempty is omitted:\n%s", out)
+	}
+}
+
+// TestOmitEmptyPtr checks that a nil pointer with omitempty
+// is left out of the encoding, rather than encoded as 'nil',
+// and stays nil when it is decoded (into a new value, whose
+// fields are all zero) without its key.
+func TestOmitEmptyPtr(t *testing.T) {
+	st := testStruct("O", "",
+		testField("Sub", "sub,omitempty", &Ptr{Value: Ident("", "Sub")}),
+		testField("N", "n", &BaseElem{Value: Int64}),
+	)
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+
+	for _, c := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want []string
+	}{
+		{marshalGenerator, []string{
+			"Len := uint32(2)",
+			"Mask |= 0x4",
+			"Mask&0x4) == 0 { // if not empty\n// string \"sub\"",
+		}},
+		{unmarshalGenerator, []string{
+			// the pointer is only allocated when its key is read
+			"case \"sub\":",
+			"if (*z).Sub == nil { (*z).Sub = new(Sub); }",
+		}},
+		{sizeGenerator, []string{
+			// the key is counted whether or not it is written
+			"s = 1 + 4\nif (*z).Sub == nil {\ns += msgp.NilSize\n} else {\ns += (*z).Sub.Msgsize()",
+		}},
+	} {
+		out := generateMethod(t, c.g, st)
+		for _, want := range c.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in generated code:\n%s", want, out)
+			}
+		}
+	}
+}
+
+func TestMapKeysSorted(t *testing.T) {
+	st := testStruct("M", "",
+		testField("S", "s", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Int64}}),
+		testField("U", "u", &Map{Key: &BaseElem{Value: Uint32}, Value: &BaseElem{Value: String}}),
+	)
+	out := generateMethod(t, marshalGenerator, st)
+	if !strings.Contains(out, "sort.Strings(") {
+		t.Errorf("string keys are not sorted with sort.Strings:\n%s", out)
+	}
+	if !strings.Contains(out, "sort.Slice(") {
+		t.Errorf("integer keys are not sorted with sort.Slice:\n%s", out)
+	}
+
+	st = testStruct("M", "",
+		testField("I", "i", &Map{Key: Ident("", "Key"), Value: &BaseElem{Value: Int64}}),
+	)
+	var buf bytes.Buffer
+	var topics Topics
+	msgs, err := marshal(&buf, &topics).Execute(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) == 0 {
+		t.Errorf("expected an error for map keys without a sort order")
+	}
+}
+
+func TestMarshalAllocates(t *testing.T) {
+	for _, c := range []struct {
+		e    Elem
+		want bool
+	}{
+		{&BaseElem{Value: Int64}, false},
+		{&BaseElem{Value: BigInt}, false},
+		{&Slice{Els: &BaseElem{Value: Bytes}}, false},
+		{&Ptr{Value: &Array{Els: &BaseElem{Value: Uint8}}}, false},
+		{&Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Int64}}, true},
+		{&Slice{Els: &BaseElem{Value: Intf}}, true},
+		{&Slice{Els: &BaseElem{Value: Uint64}, SortSlice: true}, true},
+		{Ident("", "Inner"), true},
+		{testStruct("S", "", testField("A", "a", &BaseElem{Value: String})), false},
+		{testStruct("S", "", testField("M", "m", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: String}})), true},
+	} {
+		if got := marshalAllocates(c.e); got != c.want {
+			t.Errorf("marshalAllocates(%s) = %v; want %v", c.e.TypeName(), got, c.want)
+		}
+	}
+}
+
+func TestMarshalSizeHint(t *testing.T) {
+	st := testStruct("H", "", testField("A", "a", &BaseElem{Value: Int64}))
+	out := generateMethod(t, marshalGenerator, st)
+	if !strings.Contains(out, "o = msgp.Require(b, z.Msgsize())") {
+		t.Errorf("MarshalMsg does not grow b to Msgsize():\n%s", out)
+	}
+
+	st.SetNoSizeHint()
+	out = generateMethod(t, marshalGenerator, st)
+	if strings.Contains(out, "msgp.Require") || !strings.Contains(out, "o = b") {
+		t.Errorf("nosizehint MarshalMsg grows b to Msgsize():\n%s", out)
+	}
+}
+
+func TestMethodReceiver(t *testing.T) {
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+
+	// by pointer by default, for the IDENT field
+	st := testStruct("H", "", testField("A", "a", Ident("", "Inner")))
+	st.SetReceiver("h", "value")
+	st.SetVarname("h")
+	for _, c := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want string
+	}{
+		{marshalGenerator, "func (h H) MarshalMsg(b []byte) (o []byte) {"},
+		{marshalGenerator, "func (_ H) CanMarshalMsg(h interface{}) bool {"},
+		{marshalGenerator, "o = h.A.MarshalMsg(o)"},
+		{sizeGenerator, "func (h H) Msgsize() (s int) {"},
+		{unmarshalGenerator, "func (h *H) UnmarshalMsg(bts []byte) (o []byte, err error) {"},
+		{unmarshalGenerator, "bts, err = msgp.UnmarshalWithBudget(&(*h).A, bts, budget)"},
+		{equalGenerator, "func (h *H) Equal(o *H) bool {"},
+		{resetGenerator, "func (h *H) Reset() {"},
+	} {
+		if out := generateMethod(t, c.g, st); !strings.Contains(out, c.want) {
+			t.Errorf("no %q in:\n%s", c.want, out)
+		}
+	}
+
+	// by value by default
+	st = testStruct("S", "", testField("A", "a", &BaseElem{Value: Int64}))
+	st.SetReceiver("", "pointer")
+	if out := generateMethod(t, marshalGenerator, st); !strings.Contains(out, "func (z *S) MarshalMsg(b []byte) (o []byte) {") {
+		t.Errorf("MarshalMsg does not have a pointer receiver:\n%s", out)
+	}
+}
+
+func TestMarshalTimeForm(t *testing.T) {
+	sec := &BaseElem{Value: Time}
+	if !sec.SetTimeForm("unixsec") {
+		t.Fatal("unixsec is not a time form")
+	}
+	if (&BaseElem{Value: Int64}).SetTimeForm("unixsec") {
+		t.Error("set a time form on an int64")
+	}
+	std := &BaseElem{Value: Time}
+	if !std.SetTimeForm("timestamp") {
+		t.Fatal("timestamp is not a time form")
+	}
+	st := testStruct("T", "",
+		testField("E", "e", &BaseElem{Value: Time}),
+		testField("S", "s", sec),
+		testField("X", "x", std),
+	)
+	out := generateMethod(t, marshalGenerator, st)
+	for _, want := range []string{
+		"o = msgp.AppendTime(o, (*z).E)",
+		"o = msgp.AppendUnixTime(o, (*z).S)",
+		"o = msgp.AppendTimestamp(o, (*z).X)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestMarshalComplexForm(t *testing.T) {
+	arr := &BaseElem{Value: Complex128}
+	if !arr.SetComplexForm("array") {
+		t.Fatal("array is not a complex form")
+	}
+	if (&BaseElem{Value: Float64}).SetComplexForm("array") || (&BaseElem{Value: Complex64}).SetComplexForm("pair") {
+		t.Error("set a complex form on a float64, or an unknown form")
+	}
+	st := testStruct("C", "",
+		testField("E", "e", &BaseElem{Value: Complex64}),
+		testField("A", "a", arr),
+	)
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+	for _, tc := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want []string
+	}{
+		{marshalGenerator, []string{"o = msgp.AppendComplex64(o, (*z).E)", "o = msgp.AppendComplex128Array(o, (*z).A)"}},
+		{unmarshalGenerator, []string{"(*z).E, bts, err = msgp.ReadComplex64Bytes(bts)", "(*z).A, bts, err = msgp.ReadComplex128ArrayBytes(bts)"}},
+		{sizeGenerator, []string{"msgp.Complex64Size", "msgp.Complex128ArraySize"}},
+	} {
+		out := generateMethod(t, tc.g, st)
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in generated code:\n%s", want, out)
+			}
+		}
+	}
+}
+
+func TestMarshalIntForm(t *testing.T) {
+	fixed := func(v Primitive, form string) *BaseElem {
+		b := &BaseElem{Value: v}
+		if !b.SetIntForm(form) {
+			t.Fatalf("%s is not an int form of %s", form, v)
+		}
+		return b
+	}
+	for _, tc := range []struct {
+		v    Primitive
+		form string
+	}{
+		{Int64, "fixed32"}, {Uint32, "fixed16"}, {Float64, "fixed64"}, {Int8, "fixed12"}, {Int8, "8"},
+	} {
+		if (&BaseElem{Value: tc.v}).SetIntForm(tc.form) {
+			t.Errorf("set int=%s on a %s", tc.form, tc.v)
+		}
+	}
+	st := testStruct("F", "",
+		testField("A", "a", fixed(Int8, "fixed32")),
+		testField("B", "b", fixed(Uint16, "fixed16")),
+		testField("C", "c", fixed(Byte, "fixed64")),
+	)
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+	for _, tc := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want []string
+	}{
+		{marshalGenerator, []string{
+			"o = msgp.AppendFixedInt32(o, int32((*z).A))",
+			"o = msgp.AppendFixedUint16(o, (*z).B)",
+			"o = msgp.AppendFixedUint64(o, uint64((*z).C))",
+		}},
+		{unmarshalGenerator, []string{"(*z).A, bts, err = msgp.ReadInt8Bytes(bts)"}},
+		{sizeGenerator, []string{"msgp.Int32Size", "msgp.Uint16Size", "msgp.Uint64Size"}},
+	} {
+		out := generateMethod(t, tc.g, st)
+		for _, want := range tc.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in generated code:\n%s", want, out)
+			}
+		}
+	}
+
+	// msgp.IsCanonical rejects the fixed widths that MarshalMsg writes
+	var buf bytes.Buffer
+	u := unmarshal(&buf, &Topics{})
+	u.canon = true
+	if _, err := u.Execute(st); err == nil || !strings.Contains(err.Error(), "int=") {
+		t.Errorf("UnmarshalMsgCanonical of fixed-width integers: got error %v", err)
+	}
+}
+
+func TestMarshalReplace(t *testing.T) {
+	replaced := func() *BaseElem {
+		be := Ident("", "pkg.X")
+		be.Replacement = "Y"
+		return be
+	}
+	st := testStruct("R", "",
+		testField("V", "v", replaced()),
+		testField("P", "p", &Ptr{Value: replaced()}),
+	)
+	out := generateMethod(t, marshalGenerator, st)
+	for _, want := range []string{
+		"o = (*Y)(&(*z).V).MarshalMsg(o)",
+		"o = (*Y)((*z).P).MarshalMsg(o)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestMarshalDuplicateKeys(t *testing.T) {
+	promoted := testField("ID", "id", &BaseElem{Value: Uint64})
+	promoted.FieldPath = []string{"Common"}
+	st := testStruct("D", "",
+		testField("ID", "id", &BaseElem{Value: Uint64}),
+		promoted,
+		testField("Name", "name", &BaseElem{Value: String}),
+	)
+	var buf bytes.Buffer
+	msgs, err := marshal(&buf, &Topics{}).Execute(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || !strings.Contains(msgs[0], `"id"`) || !strings.Contains(msgs[0], "Common.ID") {
+		t.Errorf("expected a message about the key \"id\"; got %v", msgs)
+	}
+
+	// embedded fields with keys of their own are fine
+	promoted.FieldTag, promoted.FieldTagParts = "common_id", []string{"common_id"}
+	st = testStruct("D", "",
+		testField("ID", "id", &BaseElem{Value: Uint64}),
+		promoted,
+	)
+	generateMethod(t, marshalGenerator, st)
+}
+
+func TestPtrSliceNilElems(t *testing.T) {
+	items := &Slice{Els: &Ptr{Value: Ident("", "Item")}}
+	items.SetAllocBound("maxItems")
+	st := testStruct("P", "", testField("Items", "items", items))
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+
+	for _, c := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want []string
+	}{
+		{marshalGenerator, []string{
+			"] == nil {\no = msgp.AppendNil(o)\n} else {\no = (*z).Items[",
+		}},
+		{unmarshalGenerator, []string{
+			"msgp.ReadArrayHeaderBytesMax(bts, uint64(maxItems))",
+			"if msgp.IsNil(bts) {\nbts, err = msgp.ReadNilBytes(bts)\nif err != nil {\nerr = msgp.WrapError(err, \"Items\", ",
+			"] = nil\n} else {",
+		}},
+		{sizeGenerator, []string{
+			"] == nil {\ns += msgp.NilSize\n} else {",
+		}},
+	} {
+		out := generateMethod(t, c.g, st)
+		for _, want := range c.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in generated code:\n%s", want, out)
+			}
+		}
+	}
+}
+
+func TestSQLNull(t *testing.T) {
+	bounded := Ident("", "sql.NullString")
+	bounded.SetAllocBound("16")
+	st := testStruct("N", ",omitempty",
+		testField("S", "s", bounded),
+		testField("I", "i", Ident("", "sql.NullInt64")),
+		testField("P", "p", &Ptr{Value: Ident("", "sql.NullString")}),
+	)
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+	isZeroGenerator := func(w *bytes.Buffer, topics *Topics) generator { return isZeros(w, topics) }
+	for _, c := range []struct {
+		g    func(w *bytes.Buffer, topics *Topics) generator
+		want []string
+	}{
+		{marshalGenerator, []string{
+			// invalid values are omitted, whatever they hold
+			"if !(*z).S.Valid {",
+			"o = msgp.AppendNullString(o, (*z).S)",
+			"o = msgp.AppendNullInt64(o, (*z).I)",
+			"o = msgp.AppendNullString(o, *(*z).P)",
+		}},
+		{sizeGenerator, []string{
+			"msgp.NullStringPrefixSize + len((*z).S.String)",
+			"msgp.NullInt64Size",
+			"msgp.NullStringPrefixSize + len((*(*z).P).String)",
+		}},
+		{unmarshalGenerator, []string{
+			"(*z).S, bts, err = msgp.ReadNullStringBytesMax(bts, 16)",
+			"err = budget.Spend(bts, len((*z).S.String))",
+			"(*z).I, bts, err = msgp.ReadNullInt64Bytes(bts)",
+			"*(*z).P, bts, err = msgp.ReadNullStringBytes(bts)",
+		}},
+		{isZeroGenerator, []string{"(!(*z).S.Valid) && (!(*z).I.Valid)"}},
+		{equalGenerator, []string{"if (*z).I.Valid != (*o).I.Valid {", "if (*z).I.Valid {\nif (*z).I.Int64 != (*o).I.Int64 {"}},
+	} {
+		out := generateMethod(t, c.g, st)
+		for _, want := range c.want {
+			if !strings.Contains(out, want) {
+				t.Errorf("missing %q in generated code:\n%s", want, out)
+			}
+		}
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	nilPolicyStruct := func(policy string) *Struct {
+		l := &Slice{Els: &BaseElem{Value: Int64}}
+		l.SetAllocBound("4")
+		m := &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Int64}}
+		m.SetAllocBound("4")
+		b := &BaseElem{Value: Bytes}
+		for _, e := range []Elem{l, m, b} {
+			e.SetNilPolicy(policy)
+		}
+		return testStruct("N", "", testField("L", "l", l), testField("M", "m", m), testField("B", "b", b))
+	}
+
+	out := generateMethod(t, marshalGenerator, nilPolicyStruct(NilDistinguish))
+	for _, want := range []string{
+		"if (*z).L == nil {\n  o = msgp.AppendNil(o)",
+		"if (*z).M == nil {\n  o = msgp.AppendNil(o)",
+		"o = msgp.AppendBytes(o, (*z).B)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("distinguish: missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "[]byte{}") {
+		t.Errorf("distinguish: nil []byte encoded as empty:\n%s", out)
+	}
+
+	out = generateMethod(t, marshalGenerator, nilPolicyStruct(NilCollapse))
+	if strings.Contains(out, "AppendNil") {
+		t.Errorf("collapse: nil encoded as 'nil':\n%s", out)
+	}
+	if want := "if (*z).B == nil {\no = msgp.AppendBytes(o, []byte{})"; !strings.Contains(out, want) {
+		t.Errorf("collapse: missing %q in generated code:\n%s", want, out)
+	}
+
+	// MarshalCBOR follows the policy too
+	if out := generateMethod(t, cborMarshalGenerator, nilPolicyStruct(NilDistinguish)); strings.Count(out, "o = cbor.AppendNil(o)") != 2 {
+		t.Errorf("distinguish: nil not encoded as null:\n%s", out)
+	}
+	if out := generateMethod(t, cborMarshalGenerator, nilPolicyStruct(NilCollapse)); strings.Contains(out, "AppendNil") {
+		t.Errorf("collapse: nil encoded as null:\n%s", out)
+	}
+
+	// only validation rejects a 'nil' for a collapsed value
+	nilCheck := "if validate && msgp.IsNil(bts) {\nerr = &msgp.ErrNonCanonical{}"
+	if out := generateMethod(t, unmarshalGenerator, nilPolicyStruct(NilCollapse)); !strings.Contains(out, nilCheck) || strings.Count(out, "err = &msgp.ErrNonCanonical{}") < 4 {
+		t.Errorf("collapse: 'nil' is not rejected:\n%s", out)
+	}
+	if out := generateMethod(t, unmarshalGenerator, nilPolicyStruct(NilDistinguish)); strings.Contains(out, nilCheck) {
+		t.Errorf("distinguish: 'nil' is rejected:\n%s", out)
+	}
+
+	// Equal tells nil from empty only when they encode differently
+	nilEqual := "if ((*z).L == nil) != ((*o).L == nil) {"
+	if out := generateMethod(t, equalGenerator, nilPolicyStruct(NilDistinguish)); !strings.Contains(out, nilEqual) {
+		t.Errorf("distinguish: missing %q in generated code:\n%s", nilEqual, out)
+	}
+	if out := generateMethod(t, equalGenerator, nilPolicyStruct(NilCollapse)); strings.Contains(out, nilEqual) {
+		t.Errorf("collapse: nil and empty are not equal:\n%s", out)
+	}
+	omitted := testStruct("O", "", testField("L", "l,omitempty", &Slice{Els: &BaseElem{Value: Int64}}))
+	if out := generateMethod(t, equalGenerator, omitted); !strings.Contains(out, "if len((*z).L) != 0 || len((*o).L) != 0 {") {
+		t.Errorf("omitempty: nil and empty are not equal:\n%s", out)
+	}
+}
+
+func TestMapSets(t *testing.T) {
+	strs := &Map{Key: &BaseElem{Value: String}, Value: &Struct{}}
+	strs.SetAllocBound("8")
+	uints := &Map{Key: &BaseElem{Value: Uint64}, Value: &Struct{}}
+	uints.SetAllocBound("8")
+	st := testStruct("Sets", "",
+		testField("S", "s", strs),
+		testField("U", "u", uints),
+	)
+	marshal := generateMethod(t, marshalGenerator, st)
+	unmarshal := generateMethod(t, unmarshalGenerator, st)
+	size := generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+	for _, want := range []string{
+		// the sorted keys, and nothing else, in an array
+		`o = msgp.AppendArrayHeader\(o, uint32\(len\(\(\*z\)\.S\)\)\)`,
+		`sort\.Strings\((\w+)_keys\)\s+for _, (\w+) := range (\w+)_keys {\s+o = msgp\.AppendString\(o, (\w+)\)\s+}`,
+		`sort\.Slice\((\w+)_keys, func\(i, j int\) bool { return (\w+)_keys\[i\] < (\w+)_keys\[j\] }\)\s+for _, (\w+) := range (\w+)_keys {\s+o = msgp\.AppendUint64\(o, (\w+)\)\s+}`,
+	} {
+		if !regexp.MustCompile(want).MatchString(marshal) {
+			t.Errorf("no %s in:\n%s", want, marshal)
+		}
+	}
+	if strings.Contains(marshal, "AppendMapHeader(o, uint32(len(") {
+		t.Errorf("set encoded as a map:\n%s", marshal)
+	}
+	for _, want := range []string{
+		`msgp\.ReadArrayHeaderBytesMax\(bts, uint64\(8\)\)`,
+		`(\w+), bts, err = msgp\.ReadUint64Bytes\(bts\)`,
+		`\(\*z\)\.U\[(\w+)\] = (\w+)`,
+	} {
+		if !regexp.MustCompile(want).MatchString(unmarshal) {
+			t.Errorf("no %s in:\n%s", want, unmarshal)
+		}
+	}
+	if strings.Contains(unmarshal, "ReadMapHeaderBytesMax") || strings.Contains(size, "MapHeaderSize") {
+		t.Errorf("set decoded or sized as a map:\n%s\n%s", unmarshal, size)
+	}
+}
+
+func TestSortSlice(t *testing.T) {
+	sorted := func(el Elem) *Slice {
+		s := &Slice{Els: el, SortSlice: true}
+		s.SetAllocBound("8")
+		return s
+	}
+	st := testStruct("Sorted", "",
+		testField("U", "u", sorted(&BaseElem{Value: Uint64})),
+		testField("S", "s", sorted(&BaseElem{Value: String})),
+		testField("V", "v", sorted(Ident("", "Version"))),
+	)
+	marshal := generateMethod(t, marshalGenerator, st)
+	unmarshal := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		// a sorted copy is encoded, and the field left as it is
+		`(\w+)_sorted := make\(\[\]uint64, len\(\(\*z\)\.U\)\)\s+copy\((\w+)_sorted, \(\*z\)\.U\)`,
+		`sort\.Slice\((\w+)_sorted, func\(i, j int\) bool { return (\w+)_sorted\[i\] < (\w+)_sorted\[j\] }\)\s+for (\w+) := range (\w+)_sorted {\s+o = msgp\.AppendUint64\(o, (\w+)_sorted\[(\w+)\]\)`,
+		`return (\w+)_sorted\[i\]\.LessThan\((\w+)_sorted\[j\]\)`,
+	} {
+		if !regexp.MustCompile(want).MatchString(marshal) {
+			t.Errorf("no %s in:\n%s", want, marshal)
+		}
+	}
+	if strings.Contains(marshal, "AppendUint64(o, (*z).U[") {
+		t.Errorf("unsorted slice encoded:\n%s", marshal)
+	}
+	for _, want := range []string{
+		`if validate {\s+for (\w+) := 1; (\w+) < len\(\(\*z\)\.U\); (\w+)\+\+ {\s+if \(\*z\)\.U\[(\w+)\] < \(\*z\)\.U\[(\w+)-1\] {\s+err = &msgp\.ErrNonCanonical{}`,
+		`if \(\*z\)\.S\[(\w+)\] < \(\*z\)\.S\[(\w+)-1\] {`,
+		`if \(\*z\)\.V\[(\w+)\]\.LessThan\(\(\*z\)\.V\[(\w+)-1\]\) {`,
+	} {
+		if !regexp.MustCompile(want).MatchString(unmarshal) {
+			t.Errorf("no %s in:\n%s", want, unmarshal)
+		}
+	}
+}
+
+func TestMultiLevelPtr(t *testing.T) {
+	inner := func() *Struct {
+		return testStruct("Inner", ",omitempty", testField("A", "a", &BaseElem{Value: Int64}))
+	}
+	st := testStruct("P", ",omitempty",
+		testField("PP", "pp", &Ptr{Value: &Ptr{Value: inner()}}),
+		testField("II", "ii", &Ptr{Value: &Ptr{Value: &BaseElem{Value: Int64}}}),
+		testField("A", "a", &Ptr{Value: &Array{Size: "2", Els: &BaseElem{Value: Int64}}}),
+	)
+	marshal := generateMethod(t, marshalGenerator, st)
+	unmarshal := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		// nil at either level is 'nil', and so empty
+		"if ((*z).PP == nil || (*(*z).PP) == nil) {",
+		"if (*z).PP == nil {\no = msgp.AppendNil(o)\n} else {\nif (*(*z).PP) == nil {\no = msgp.AppendNil(o)",
+		// the fields and elements are those of the pointee
+		"o = msgp.AppendInt64(o, (*(*z).PP).A)",
+		"o = msgp.AppendInt64(o, *(*(*z).II))",
+		"o = msgp.AppendInt64(o, (*(*z).A)[",
+	} {
+		if !strings.Contains(marshal, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, marshal)
+		}
+	}
+	for _, want := range []string{
+		// each level is allocated
+		"if (*z).PP == nil { (*z).PP = new(*Inner); }",
+		"if (*(*z).PP) == nil { (*(*z).PP) = new(Inner); }",
+		"(*(*z).PP).A, bts, err = msgp.ReadInt64Bytes(bts)",
+		"*(*(*z).II), bts, err = msgp.ReadInt64Bytes(bts)",
+		"(*z).PP = nil",
+	} {
+		if !strings.Contains(unmarshal, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, unmarshal)
+		}
+	}
+}
+
+func TestByteArrays(t *testing.T) {
+	named := &BaseElem{Value: Byte, Convert: true}
+	named.Alias("MyByte")
+	fixed := &BaseElem{Value: Uint8}
+	fixed.SetIntForm("fixed8")
+	st := testStruct("B", "",
+		testField("A", "a", &Array{Size: "4", Els: &BaseElem{Value: Byte}}),
+		testField("U", "u", &Array{Size: "4", Els: &BaseElem{Value: Uint8}}),
+		testField("N", "n", &Array{Size: "4", Els: named}),
+		testField("F", "f", &Array{Size: "4", Els: fixed}),
+		testField("R", "r", &Array{Size: "4", Els: &BaseElem{Value: Int32}}),
+	)
+	marshal := generateMethod(t, marshalGenerator, st)
+	unmarshal := generateMethod(t, unmarshalGenerator, st)
+	size := generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+	// a [4]uint8 is a [4]byte, and is encoded as 'bin'
+	for _, field := range []string{"A", "U"} {
+		if want := "o = msgp.AppendBytes(o, ((*z)." + field + ")[:])"; !strings.Contains(marshal, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, marshal)
+		}
+		if want := "bts, err = msgp.ReadExactBytes(bts, ((*z)." + field + ")[:])"; !strings.Contains(unmarshal, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, unmarshal)
+		}
+	}
+	if !strings.Contains(size, "s = 1 + 2 + 6 + 2 + 6 + 2 + msgp.ArrayHeaderSize") {
+		t.Errorf("[4]byte not sized as 'bin':\n%s", size)
+	}
+	// the others are arrays
+	for _, want := range []string{
+		"o = msgp.AppendByte(o, byte((*z).N[",
+		"o = msgp.AppendFixedUint8(o, (*z).F[",
+		"o = msgp.AppendInt32(o, (*z).R[",
+	} {
+		if !strings.Contains(marshal, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, marshal)
+		}
+	}
+	if strings.Contains(marshal, "((*z).N)[:]") || strings.Contains(unmarshal, "((*z).N)[:]") {
+		t.Errorf("[4]MyByte encoded as []byte:\n%s\n%s", marshal, unmarshal)
+	}
+}
@@ -145,6 +145,10 @@ func (s *maxSizeGen) gStruct(st *Struct) {
 			}
 			next(s, st.Fields[i].FieldElem)
 		}
+	} else if uf := st.unknownExpr(); uf != "" {
+		s.p.printf("\npanic(\"Unable to determine max size: the unknown fields of %s are unbounded\")", st.TypeName())
+		s.panicked = true
+		s.state = addM
 	} else {
 		data := msgp.AppendMapHeader(nil, nfields)
 		s.addConstant(strconv.Itoa(len(data)))
@@ -221,6 +225,13 @@ func (s *maxSizeGen) gArray(a *Array) {
 	}
 	s.p.comment("Calculating size of array: " + a.Varname())
 
+	// byte arrays are encoded as 'bin'
+	if isByte(a.Els) {
+		s.addConstant(binSizeExpr(a.Size))
+		s.state = addM
+		return
+	}
+
 	s.addConstant(builtinSize(arrayHeader))
 
 	if str, err := maxSizeExpr(a.Els); err == nil {
@@ -239,7 +250,7 @@ func (s *maxSizeGen) gMap(m *Map) {
 	}
 	vn := m.Varname()
 	s.state = addM
-	s.addConstant(builtinSize(mapHeader))
+	s.addConstant(builtinSize(m.header()))
 	topLevelAllocBound := m.AllocBound()
 	if topLevelAllocBound != "" && topLevelAllocBound == "-" {
 		s.p.printf("\npanic(\"Map %s is unbounded\")", m.Varname())
@@ -263,7 +274,7 @@ func (s *maxSizeGen) gMap(m *Map) {
 		next(s, m.Key)
 	}
 
-	if !s.panicked {
+	if !s.panicked && !m.IsSet() {
 		s.p.comment("Adding size of map values for " + vn)
 		s.p.printf("\ns += %s", topLevelAllocBound)
 		s.state = multM
@@ -284,15 +295,15 @@ func (s *maxSizeGen) gBase(b *BaseElem) {
 		s.state = addM
 		return
 	}
+	if b.Enum != nil {
+		s.addConstant(strconv.Itoa(enumSize(b)))
+		return
+	}
 	if b.Convert && b.ShimMode == Convert {
+		// the size of the base type doesn't depend on the value,
+		// which MaxSize has none of, and so isn't converted
 		s.state = addM
-		vname := randIdent()
-		s.p.printf("\nvar %s %s", vname, b.BaseType())
-
-		// ensure we don't get "unused variable" warnings from outer slice iterations
-		s.p.printf("\n_ = %s", b.Varname())
-
-		value, err := baseMaxSizeExpr(b.Value, vname, b.BaseName(), b.TypeName(), b.common.AllocBound())
+		value, err := baseMaxSizeExpr(b.Value, b.Varname(), b.sizeName(), b.TypeName(), b.common.AllocBound())
 		if err != nil {
 			s.p.printf("\npanic(\"Unable to determine max size: %s\")", err)
 			s.panicked = true
@@ -307,7 +318,7 @@ func (s *maxSizeGen) gBase(b *BaseElem) {
 		if b.Convert {
 			vname = tobaseConvert(b)
 		}
-		value, err := baseMaxSizeExpr(b.Value, vname, b.BaseName(), b.TypeName(), b.common.AllocBound())
+		value, err := baseMaxSizeExpr(b.Value, vname, b.sizeName(), b.identType(), b.common.AllocBound())
 		if err != nil {
 			s.p.printf("\npanic(\"Unable to determine max size: %s\")", err)
 			s.panicked = true
@@ -325,8 +336,10 @@ func baseMaxSizeExpr(value Primitive, vname, basename, typename string, allocbou
 	switch value {
 	case Ext:
 		return "", fmt.Errorf("MaxSize() not implemented for Ext type")
-	case Intf:
+	case Intf, Iface:
 		return "", fmt.Errorf("MaxSize() not implemented for Interfaces")
+	case Addr, AddrPort:
+		return "", fmt.Errorf("MaxSize() not implemented for %s (zone is unbounded)", typename)
 	case IDENT:
 		return getMaxSizeMethod(typename), nil
 	case Bytes:
@@ -339,6 +352,21 @@ func baseMaxSizeExpr(value Primitive, vname, basename, typename string, allocbou
 			return "", fmt.Errorf("String type %s is unbounded", vname)
 		}
 		return "msgp.StringPrefixSize +  " + allocbound, nil
+	case NullString:
+		if allocbound == "" || allocbound == "-" {
+			return "", fmt.Errorf("sql.NullString %s is unbounded", vname)
+		}
+		return "msgp.NullStringPrefixSize + " + allocbound, nil
+	case BigInt:
+		if allocbound == "" || allocbound == "-" {
+			return "", fmt.Errorf("big.Int %s is unbounded", vname)
+		}
+		return "msgp.BigIntPrefixSize + " + allocbound, nil
+	case Text:
+		if allocbound == "" || allocbound == "-" {
+			return "", fmt.Errorf("text type %s is unbounded", vname)
+		}
+		return "msgp.TextPrefixSize + " + allocbound, nil
 	default:
 		return builtinSize(basename), nil
 	}
@@ -350,31 +378,58 @@ func baseMaxSizeExpr(value Primitive, vname, basename, typename string, allocbou
 func maxSizeExpr(e Elem) (string, error) {
 	switch e := e.(type) {
 	case *Array:
+		if isByte(e.Els) {
+			return "(" + binSizeExpr(e.Size) + ")", nil
+		}
 		if str, err := maxSizeExpr(e.Els); err == nil {
 			return fmt.Sprintf("(%s * (%s))", e.Size, str), nil
 		} else {
 			return "", err
 		}
 	case *BaseElem:
-		if fixedSize(e.Value) {
-			return builtinSize(e.BaseName()), nil
+		if e.Enum != nil {
+			return strconv.Itoa(enumSize(e)), nil
+		} else if fixedSize(e.Value) {
+			return builtinSize(e.sizeName()), nil
 		} else if (e.TypeName()) == "msgp.Raw" {
 			return "", fmt.Errorf("Raw type is unbounded")
+		} else if (e.Value) == Addr || (e.Value) == AddrPort {
+			return "", fmt.Errorf("%s type is unbounded", e.BaseType())
 		} else if (e.Value) == String {
 			if e.AllocBound() == "" || e.AllocBound() == "-" {
 				return "", fmt.Errorf("String type is unbounded for %s", e.Varname())
 			}
 			return fmt.Sprintf("(msgp.StringPrefixSize + %s)", e.AllocBound()), nil
+		} else if (e.Value) == NullString {
+			if e.AllocBound() == "" || e.AllocBound() == "-" {
+				return "", fmt.Errorf("Inner sql.NullString type is unbounded")
+			}
+			return fmt.Sprintf("(msgp.NullStringPrefixSize + %s)", e.AllocBound()), nil
 		} else if (e.Value) == IDENT {
-			return fmt.Sprintf("(%s)", getMaxSizeMethod(e.TypeName())), nil
+			return fmt.Sprintf("(%s)", getMaxSizeMethod(e.identType())), nil
 		} else if (e.Value) == Bytes {
 			if e.AllocBound() == "" || e.AllocBound() == "-" {
 				return "", fmt.Errorf("Inner byteslice type is unbounded")
 			}
 			return fmt.Sprintf("(msgp.BytesPrefixSize + %s)", e.AllocBound()), nil
+		} else if (e.Value) == BigInt {
+			if e.AllocBound() == "" || e.AllocBound() == "-" {
+				return "", fmt.Errorf("Inner big.Int type is unbounded")
+			}
+			return fmt.Sprintf("(msgp.BigIntPrefixSize + %s)", e.AllocBound()), nil
+		} else if (e.Value) == Text {
+			if e.AllocBound() == "" || e.AllocBound() == "-" {
+				return "", fmt.Errorf("Inner text type is unbounded")
+			}
+			return fmt.Sprintf("(msgp.TextPrefixSize + %s)", e.AllocBound()), nil
+		} else if (e.Value) == Iface {
+			return "", fmt.Errorf("Inner interface type is unbounded")
 		}
 	case *Struct:
 		return fmt.Sprintf("(%s)", getMaxSizeMethod(e.TypeName())), nil
+	case *Ptr:
+		// nil is never larger than the pointed-to value
+		return maxSizeExpr(e.Value)
 	case *Slice:
 		if e.AllocBound() == "" || e.AllocBound() == "-" {
 			return "", fmt.Errorf("Slice %s is unbounded", e.Varname())
@@ -389,6 +444,12 @@ func maxSizeExpr(e Elem) (string, error) {
 }
 
 func getMaxSizeMethod(typeName string) (s string) {
+	return exportedTypeName(typeName) + "MaxSize()"
+}
+
+// exportedTypeName capitalizes typeName, after its package
+// qualifier if it has one, for naming generated functions.
+func exportedTypeName(typeName string) string {
 	var pos int
 	dotIndex := strings.Index(typeName, ".")
 	if dotIndex != -1 {
@@ -396,5 +457,135 @@ func getMaxSizeMethod(typeName string) (s string) {
 	}
 	b := []byte(typeName)
 	b[pos] = bytes.ToUpper(b)[pos]
-	return string(b) + "MaxSize()"
+	return string(b)
+}
+
+// getMaxMsgsizeConst returns the name of the constant that holds
+// the maximum encoded size of typeName, if one can be proven.
+func getMaxMsgsizeConst(typeName string) string {
+	return strings.TrimSuffix(getMaxSizeMethod(typeName), "MaxSize()") + "MaxMsgsize"
+}
+
+// maxSizeConst returns a constant expression bounding the encoded
+// size of e. Every slice, map, string and byteslice along the way
+// must carry an allocbound (or maxtotalbytes), and every named type
+// must be resolved by bounded, which reports whether that type has
+// a MaxMsgsize constant of its own.
+func maxSizeConst(e Elem, bounded func(string) error) (string, error) {
+	switch e := e.(type) {
+	case *Struct:
+		if e.unknownExpr() != "" {
+			return "", fmt.Errorf("the unknown fields of %s are unbounded", e.TypeName())
+		}
+		nfields := uint32(0)
+		for i := range e.Fields {
+			if ast.IsExported(e.Fields[i].FieldName) {
+				nfields += 1
+			}
+		}
+		var data []byte
+		if e.AsTuple {
+			data = msgp.AppendArrayHeader(nil, nfields)
+		} else {
+			data = msgp.AppendMapHeader(nil, nfields)
+		}
+		terms := []string{strconv.Itoa(len(data))}
+		for i := range e.Fields {
+			if !ast.IsExported(e.Fields[i].FieldName) {
+				continue
+			}
+			if !e.AsTuple {
+				data = msgp.AppendString(data[:0], e.Fields[i].FieldTag)
+				terms = append(terms, strconv.Itoa(len(data)))
+			}
+			str, err := maxSizeConst(e.Fields[i].FieldElem, bounded)
+			if err != nil {
+				return "", err
+			}
+			terms = append(terms, str)
+		}
+		return "(" + strings.Join(terms, " + ") + ")", nil
+	case *Ptr:
+		// nil encodes as a single byte, which is never
+		// more than the pointed-to value
+		return maxSizeConst(e.Value, bounded)
+	case *Array:
+		if isByte(e.Els) {
+			return "(" + binSizeExpr(e.Size) + ")", nil
+		}
+		str, err := maxSizeConst(e.Els, bounded)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s + ((%s) * %s))", builtinSize(arrayHeader), e.Size, str), nil
+	case *Slice:
+		if e.MaxTotalBytes() != "" && e.MaxTotalBytes() != "-" {
+			return fmt.Sprintf("(%s + %s)", builtinSize(arrayHeader), e.MaxTotalBytes()), nil
+		}
+		bound, child := e.AllocBound(), e.Els
+		if bound == "" || bound == "-" {
+			return "", fmt.Errorf("slice %s is unbounded", e.Varname())
+		}
+		if child.AllocBound() == "" && strings.Contains(bound, ",") {
+			splitIndex := strings.Index(bound, ",")
+			child = child.Copy()
+			child.SetAllocBound(bound[splitIndex+1:])
+			bound = bound[:splitIndex]
+		}
+		str, err := maxSizeConst(child, bounded)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s + ((%s) * %s))", builtinSize(arrayHeader), bound, str), nil
+	case *Map:
+		splitBounds := strings.Split(e.AllocBound(), ",")
+		if splitBounds[0] == "" || splitBounds[0] == "-" {
+			return "", fmt.Errorf("map %s is unbounded", e.Varname())
+		}
+		key, value := e.Key, e.Value
+		if len(splitBounds) > 1 {
+			key = key.Copy()
+			key.SetAllocBound(splitBounds[1])
+			if len(splitBounds) > 2 {
+				value = value.Copy()
+				value.SetAllocBound(splitBounds[2])
+			}
+		}
+		kstr, err := maxSizeConst(key, bounded)
+		if err != nil {
+			return "", err
+		}
+		if e.IsSet() {
+			return fmt.Sprintf("(%s + ((%s) * %s))", builtinSize(arrayHeader), splitBounds[0], kstr), nil
+		}
+		vstr, err := maxSizeConst(value, bounded)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("(%s + ((%s) * (%s + %s)))", builtinSize(mapHeader), splitBounds[0], kstr, vstr), nil
+	case *BaseElem:
+		if e.MaxTotalBytes() != "" && e.MaxTotalBytes() != "-" {
+			return fmt.Sprintf("(%s)", e.MaxTotalBytes()), nil
+		}
+		if e.Enum != nil {
+			return strconv.Itoa(enumSize(e)), nil
+		}
+		if fixedSize(e.Value) {
+			return builtinSize(e.sizeName()), nil
+		}
+		switch e.Value {
+		case String, Bytes, BigInt, Text, NullString:
+			if e.AllocBound() == "" || e.AllocBound() == "-" {
+				return "", fmt.Errorf("%s %s is unbounded", e.BaseType(), e.Varname())
+			}
+			return fmt.Sprintf("(%s + %s)", builtinSize(e.BaseName()+"Prefix"), e.AllocBound()), nil
+		case IDENT:
+			if err := bounded(e.identType()); err != nil {
+				return "", err
+			}
+			return getMaxMsgsizeConst(e.identType()), nil
+		}
+		return "", fmt.Errorf("%s has no maximum size", e.TypeName())
+	}
+	return "", fmt.Errorf("cannot bound the size of %s", e.TypeName())
 }
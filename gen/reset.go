@@ -0,0 +1,196 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func resets(w io.Writer, topics *Topics) *resetGen {
+	return &resetGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// resetGen prints Reset methods, which zero a value while
+// keeping the backing storage of its slices and maps, so
+// that it can be unmarshaled into again without allocating.
+type resetGen struct {
+	passes
+	p      printer
+	topics *Topics
+	stale  bool // resetting elements past the length of a slice
+}
+
+func (r *resetGen) Method() Method { return Reset }
+
+func (r *resetGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (r *resetGen) Execute(p Elem) ([]string, error) {
+	if !r.p.ok() {
+		return nil, r.p.err
+	}
+	p = r.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+
+	c := p.Varname()
+	r.p.comment("Reset sets " + c + " to its zero value, keeping the storage of its slices and maps for reuse")
+
+	receiver := "*" + p.TypeName()
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		r.p.printf("\nfunc (%s %s) Reset() {", c, receiver)
+		r.p.printf("\n  ((*(%s))(%s)).Reset()", baseType, c)
+		r.p.printf("\n}")
+		r.topics.Add(receiver, "Reset")
+		return nil, r.p.err
+	}
+
+	r.p.printf("\nfunc (%s %s) Reset() {", c, receiver)
+	r.reset(p, "(*"+c+")")
+	r.p.closeblock()
+	r.p.print("\n")
+	r.topics.Add(receiver, "Reset")
+	return nil, r.p.err
+}
+
+// reset prints statements that zero v, of type el
+func (r *resetGen) reset(el Elem, v string) {
+	if !r.p.ok() {
+		return
+	}
+	switch el := el.(type) {
+	case *Struct:
+		for i := range el.Fields {
+			if !ast.IsExported(el.Fields[i].FieldName) {
+				continue
+			}
+			path := v
+			for _, pathelem := range el.Fields[i].FieldPath {
+				path += "." + pathelem
+			}
+			r.reset(el.Fields[i].FieldElem, path+"."+el.Fields[i].FieldName)
+		}
+	case *Ptr:
+		// a nil pointer encodes differently from a pointer
+		// to a zero value, so the pointer can't be kept
+		if pooled(el.Value) && !r.stale {
+			r.p.printf("\nif %s != nil {\nPut%s(%s)\n}", v, el.Value.TypeName(), v)
+		}
+		r.p.printf("\n%s = nil", v)
+	case *Array:
+		if needsReset(el.Els) {
+			idx := randIdent()
+			r.p.printf("\nfor %s := range %s {", idx, v)
+			r.reset(el.Els, v+"["+idx+"]")
+			r.p.closeblock()
+		} else {
+			r.p.printf("\n%s = %s{}", v, el.TypeName())
+		}
+	case *Slice:
+		// the unmarshaler decodes into existing elements
+		// (up to the slice's capacity), so those have to
+		// be reset as well, and the pointers among them
+		// set to nil, or it would decode into what they
+		// point to, leaving the fields that it omits
+		if needsReset(el.Els) || reusesPointers(el.Els) {
+			idx := randIdent()
+			if p, ok := el.Els.(*Ptr); ok && pooled(p.Value) && !r.stale {
+				// a pointer may be in the slice more
+				// than once, but is put back only once
+				seen, dup := randIdent(), randIdent()
+				r.p.printf("\n%s := make(map[%s]struct{}, len(%s))", seen, p.TypeName(), v)
+				r.p.printf("\nfor %s := range %s {", idx, v)
+				r.p.printf("\nif _, %s := %s[%s[%s]]; %s[%s] != nil && !%s {", dup, seen, v, idx, v, idx, dup)
+				r.p.printf("\n%s[%s[%s]] = struct{}{}", seen, v, idx)
+				r.p.printf("\nPut%s(%s[%s])\n}", p.Value.TypeName(), v, idx)
+				r.p.printf("\n%s[%s] = nil", v, idx)
+				r.p.closeblock()
+			} else {
+				r.p.printf("\nfor %s := range %s {", idx, v)
+				r.reset(el.Els, v+"["+idx+"]")
+				r.p.closeblock()
+			}
+			// the elements past the length were dropped
+			// by the slice's owner, who may still hold
+			// them, so they are cleared but not put back
+			tail := randIdent()
+			r.p.printf("\n%s := %s[len(%s):cap(%s)]", tail, v, v, v)
+			r.p.printf("\nfor %s := range %s {", idx, tail)
+			stale := r.stale
+			r.stale = true
+			r.reset(el.Els, tail+"["+idx+"]")
+			r.stale = stale
+			r.p.closeblock()
+		}
+		r.p.printf("\n%s = %s[:0]", v, v)
+	case *Map:
+		key := randIdent()
+		r.p.printf("\nfor %s := range %s {", key, v)
+		r.p.printf("\ndelete(%s, %s)", v, key)
+		r.p.closeblock()
+	case *BaseElem:
+		r.resetBase(el, v)
+	}
+}
+
+func (r *resetGen) resetBase(b *BaseElem, v string) {
+	switch {
+	case b.Value == IDENT && b.TypeName() == "msgp.Raw":
+		r.p.printf("\n%s = %s[:0]", v, v)
+	case b.Value == IDENT:
+		r.p.printf("\n%s.Reset()", b.identExpr(v))
+	case b.Value == Bytes:
+		r.p.printf("\n%s = %s[:0]", v, v)
+	case b.Value == BigInt:
+		r.p.printf("\n%s.SetInt64(0)", v)
+	case b.Value == Text:
+		r.p.printf("\n%s = %s", v, b.ZeroExpr())
+	case b.Value == Intf || b.Value == Ext || b.Value == Iface:
+		r.p.printf("\n%s = nil", v)
+	case b.ShimToBase != "" || b.ZeroExpr() == "":
+		// the zero value of a shimmed type isn't known
+		zero := randIdent()
+		r.p.printf("\nvar %s %s", zero, b.TypeName())
+		r.p.printf("\n%s = %s", v, zero)
+	default:
+		r.p.printf("\n%s = %s", v, b.ZeroExpr())
+	}
+}
+
+// needsReset returns whether resetting a value of type e
+// involves more than assigning the zero value to it
+func needsReset(e Elem) bool {
+	switch e := e.(type) {
+	case *BaseElem:
+		switch e.Value {
+		case IDENT, Bytes, BigInt:
+			return true
+		}
+		return false
+	case *Array:
+		return needsReset(e.Els)
+	case *Ptr:
+		return pooled(e.Value)
+	default:
+		return true
+	}
+}
+
+// reusesPointers returns whether the unmarshaler decodes
+// into what a value of type e already points to, where
+// needsReset doesn't tell
+func reusesPointers(e Elem) bool {
+	switch e := e.(type) {
+	case *Ptr:
+		return true
+	case *Array:
+		return reusesPointers(e.Els)
+	default:
+		return false
+	}
+}
@@ -0,0 +1,69 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func resetGenerator(w *bytes.Buffer, topics *Topics) generator { return resets(w, topics) }
+
+func TestReset(t *testing.T) {
+	st := testStruct("R", "",
+		testField("P", "p", &Ptr{Value: Ident("", "Inner")}),
+		testField("L", "l", &Slice{Els: &BaseElem{Value: Int64}}),
+		testField("I", "i", &Slice{Els: Ident("", "Inner")}),
+		testField("Q", "q", &Slice{Els: &Ptr{Value: Ident("", "Inner")}}),
+		testField("M", "m", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Bytes}}),
+		testField("B", "b", &BaseElem{Value: Bytes}),
+		testField("N", "n", &BaseElem{Value: Uint64}),
+	)
+	out := generateMethod(t, resetGenerator, st)
+
+	for _, want := range []string{
+		"func (z *R) Reset() {",
+		"(*z).P = nil",
+		"(*z).L = (*z).L[:0]",
+		"[len((*z).I):cap((*z).I)]",
+		".Reset()",
+		"(*z).I = (*z).I[:0]",
+		// the pointers past the length are dropped too
+		"[len((*z).Q):cap((*z).Q)]",
+		"(*z).Q = (*z).Q[:0]",
+		"delete((*z).M, ",
+		"(*z).B = (*z).B[:0]",
+		"(*z).N = 0",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "cap((*z).L)") {
+		t.Errorf("elements of a primitive slice are reset:\n%s", out)
+	}
+}
+
+func TestResetPool(t *testing.T) {
+	SetPool("Item")
+	t.Cleanup(func() { delete(pools, "Item") })
+
+	st := testStruct("Batch", "",
+		testField("Items", "i", &Slice{Els: &Ptr{Value: Ident("", "Item")}}),
+	)
+	out := generateMethod(t, resetGenerator, st)
+
+	// only the pointers within the length are put back,
+	// and each of them once
+	head := out[:strings.Index(out, "[len((*z).Items):cap((*z).Items)]")]
+	for _, want := range []string{
+		"make(map[*Item]struct{}, len((*z).Items))",
+		"PutItem((*z).Items[",
+	} {
+		if !strings.Contains(head, want) {
+			t.Errorf("missing %q before the tail in generated code:\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "PutItem("); n != 1 {
+		t.Errorf("PutItem printed %d times, not once:\n%s", n, out)
+	}
+}
@@ -0,0 +1,242 @@
+package gen
+
+import (
+	"fmt"
+	"go/ast"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+func schemas(w io.Writer, topics *Topics) *schemaGen {
+	return &schemaGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// schemaGen prints {Type}MsgpSchema functions, which return a
+// msgp.Schema literal describing the encoding that marshalGen
+// prints for the type. The schema is known when the code is
+// generated, so, like validateGen, it walks the element tree
+// itself rather than printing code for each element.
+type schemaGen struct {
+	passes
+	p      printer
+	topics *Topics
+	msgs   []string
+}
+
+func (s *schemaGen) Method() Method { return Schema }
+
+func (s *schemaGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (s *schemaGen) Execute(p Elem) ([]string, error) {
+	if !s.p.ok() {
+		return nil, s.p.err
+	}
+	p = s.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+
+	fn := getSchemaFunc(p.TypeName())
+	s.p.comment(strings.TrimSuffix(fn, "()") + " returns the msgp.Schema of the encoding of " + p.TypeName())
+
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		s.p.printf("\nfunc %s msgp.Schema {", fn)
+		s.p.printf("\n  return %s", getSchemaFunc(baseType))
+		s.p.printf("\n}")
+		s.topics.Add(baseType, getSchemaFunc(baseType))
+		return nil, s.p.err
+	}
+
+	s.msgs = nil
+	s.p.printf("\nfunc %s msgp.Schema {\nreturn msgp.Schema{", fn)
+	s.schema(p)
+	s.p.print("\n}\n}\n")
+	s.topics.Add(p.TypeName(), fn)
+	return s.msgs, s.p.err
+}
+
+// schema prints the keyed elements of the msgp.Schema literal for e
+func (s *schemaGen) schema(e Elem) {
+	nullable := false
+	for {
+		p, ok := e.(*Ptr)
+		if !ok {
+			break
+		}
+		nullable = true
+		e = p.Value
+	}
+	if be, ok := e.(*BaseElem); ok {
+		if be.Value == Time && be.TimeForm == "unixnano" {
+			// the zero time is encoded as 'nil'
+			nullable = true
+		}
+		if _, ok := sqlNulls[be.Value]; ok {
+			// invalid values are encoded as 'nil'
+			nullable = true
+		}
+	}
+	if nullable {
+		s.p.print("\nNullable: true,")
+	}
+
+	switch e := e.(type) {
+	case *Struct:
+		s.gStruct(e)
+	case *Slice:
+		s.p.printf("\nType: %q,", msgp.ArrayType.String())
+		s.allocbound(e)
+		s.elem("Elem", e.Els)
+	case *Array:
+		if isByte(e.Els) {
+			s.p.printf("\nType: %q,\nSize: %q,", msgp.BinType.String(), e.Size)
+			return
+		}
+		s.p.printf("\nType: %q,\nSize: %q,", msgp.ArrayType.String(), e.Size)
+		s.elem("Elem", e.Els)
+	case *Map:
+		if e.IsSet() {
+			s.p.printf("\nType: %q,", msgp.ArrayType.String())
+			s.allocbound(e)
+			s.elem("Elem", e.Key)
+			return
+		}
+		s.p.printf("\nType: %q,", msgp.MapType.String())
+		s.allocbound(e)
+		s.elem("Key", e.Key)
+		s.elem("Elem", e.Value)
+	case *BaseElem:
+		s.gBase(e)
+	}
+}
+
+func (s *schemaGen) gStruct(st *Struct) {
+	fields := st.Fields
+	typ := msgp.ArrayType
+	if !st.AsTuple {
+		// sorted, and without unexported fields, as in marshalGen.mapstruct
+		typ = msgp.MapType
+		fields = nil
+		for _, sf := range st.Fields {
+			if ast.IsExported(sf.FieldName) {
+				fields = append(fields, sf)
+			}
+		}
+		sort.Sort(byFieldTag(fields))
+	}
+	s.p.printf("\nType: %q,\nFields: []msgp.SchemaField{", typ.String())
+	for _, sf := range fields {
+		name := sf.FieldTag
+		if st.AsTuple {
+			name = sf.FieldName
+		}
+		s.p.printf("\n{\nName: %q,", name)
+		if !st.AsTuple && fieldOmitExpr(sf, st) != "" {
+			s.p.print("\nOmitEmpty: true,")
+		}
+		s.p.print("\nSchema: msgp.Schema{")
+		s.schema(sf.FieldElem)
+		s.p.print("\n},\n},")
+	}
+	s.p.print("\n},")
+}
+
+// schemaTypes are the wire types of the primitives
+var schemaTypes = map[Primitive]msgp.Type{
+	Bytes:      msgp.BinType,
+	String:     msgp.StrType,
+	Text:       msgp.StrType,
+	Error:      msgp.StrType,
+	Float32:    msgp.Float32Type,
+	Float64:    msgp.Float64Type,
+	Bool:       msgp.BoolType,
+	Uint:       msgp.UintType,
+	Uint8:      msgp.UintType,
+	Uint16:     msgp.UintType,
+	Uint32:     msgp.UintType,
+	Uint64:     msgp.UintType,
+	Uintptr:    msgp.UintType,
+	Byte:       msgp.UintType,
+	Int:        msgp.IntType,
+	Int8:       msgp.IntType,
+	Int16:      msgp.IntType,
+	Int32:      msgp.IntType,
+	Int64:      msgp.IntType,
+	Duration:   msgp.IntType,
+	Complex64:  msgp.ExtensionType,
+	Complex128: msgp.ExtensionType,
+	Time:       msgp.ExtensionType,
+	Ext:        msgp.ExtensionType,
+	Addr:       msgp.ExtensionType,
+	AddrPort:   msgp.ExtensionType,
+	BigInt:     msgp.ExtensionType,
+}
+
+func (s *schemaGen) gBase(b *BaseElem) {
+	switch b.Value {
+	case IDENT:
+		s.p.printf("\nRef: %q,", b.identType())
+		return
+	case Intf, Iface:
+		s.p.print("\nType: \"any\",")
+		return
+	}
+
+	value := b.Value
+	if null, ok := sqlNulls[value]; ok {
+		value = null.value
+	}
+	typ, ok := schemaTypes[value]
+	if !ok {
+		s.msgs = append(s.msgs, fmt.Sprintf("no schema for %s of type %s", b.Varname(), b.BaseType()))
+		return
+	}
+	if b.Value == Time {
+		switch b.TimeForm {
+		case "unixsec", "unixnano":
+			typ = msgp.IntType
+		case "rfc3339":
+			typ = msgp.StrType
+		}
+	}
+	if b.ComplexForm == "array" {
+		typ = msgp.ArrayType
+	}
+	s.p.printf("\nType: %q,", typ.String())
+	s.allocbound(b)
+	if b.Enum != nil {
+		s.p.print("\nEnum: []string{")
+		for _, name := range b.Enum.Names {
+			s.p.printf("%q, ", name)
+		}
+		s.p.print("},")
+	}
+}
+
+// elem prints the *msgp.Schema for e as the value of key
+func (s *schemaGen) elem(key string, e Elem) {
+	s.p.printf("\n%s: &msgp.Schema{", key)
+	s.schema(e)
+	s.p.print("\n},")
+}
+
+// allocbound prints the AllocBound of e, if it has one
+func (s *schemaGen) allocbound(e Elem) {
+	if ab := e.AllocBound(); ab != "" {
+		s.p.printf("\nAllocBound: %q,", ab)
+	}
+}
+
+// getSchemaFunc returns the call of the schema function of typeName
+func getSchemaFunc(typeName string) string {
+	return exportedTypeName(typeName) + "MsgpSchema()"
+}
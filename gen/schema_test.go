@@ -0,0 +1,70 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func schemaGenerator(w *bytes.Buffer, topics *Topics) generator {
+	return schemas(w, topics)
+}
+
+func TestSchema(t *testing.T) {
+	str := &BaseElem{Value: String}
+	str.SetAllocBound("32")
+	sl := &Slice{Els: &Ptr{Value: Ident("", "Inner")}}
+	sl.SetAllocBound("16")
+	st := testStruct("S", ",omitempty",
+		testField("N", "n", &BaseElem{Value: Uint64}),
+		testField("S", "s,allocbound=32", str),
+		testField("L", "l,allocbound=16", sl),
+		testField("H", "h", &Array{Size: "32", Els: &BaseElem{Value: Byte}}),
+		testField("T", "t,time=rfc3339", &BaseElem{Value: Time, TimeForm: "rfc3339"}),
+	)
+	st.Alias("S")
+	st.SetVarname("z")
+	out := generateMethod(t, schemaGenerator, st)
+
+	for _, want := range []string{
+		"func SMsgpSchema() msgp.Schema {",
+		`Name: "n",`,
+		"OmitEmpty: true,",
+		`Type: "uint",`,
+		`AllocBound: "32",`,
+		`AllocBound: "16",`,
+		"Nullable: true,",
+		`Ref: "Inner",`,
+		`Type: "bin",`,
+		`Size: "32",`,
+		`Type: "str",`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// fields are listed in the order in which they are encoded
+	if strings.Index(out, `"h"`) > strings.Index(out, `"n"`) {
+		t.Errorf("fields are not sorted:\n%s", out)
+	}
+	if strings.Contains(out, `"_struct"`) {
+		t.Errorf("unexported field in schema:\n%s", out)
+	}
+}
+
+func TestSchemaTuple(t *testing.T) {
+	st := &Struct{AsTuple: true, Fields: []StructField{
+		testField("B", "b", &BaseElem{Value: Int64}),
+		testField("A", "a", &BaseElem{Value: Bool}),
+	}}
+	st.Alias("P")
+	st.SetVarname("z")
+	out := generateMethod(t, schemaGenerator, st)
+	if !strings.Contains(out, `Type: "array",`) || strings.Contains(out, "OmitEmpty") {
+		t.Errorf("tuple not described as an array:\n%s", out)
+	}
+	if strings.Index(out, `"B"`) > strings.Index(out, `"A"`) {
+		t.Errorf("tuple fields are out of order:\n%s", out)
+	}
+}
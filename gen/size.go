@@ -36,6 +36,15 @@ type sizeGen struct {
 	state  sizeState
 	ctx    *Context
 	topics *Topics
+
+	identities map[string]Elem
+	bounds     map[string]error
+	infos      []string
+
+	// max counts the fields that the encoding leaves out,
+	// because they are empty or absent from its version,
+	// as if they were present, for MsgsizeMax
+	max bool
 }
 
 func (s *sizeGen) Method() Method { return Size }
@@ -95,6 +104,11 @@ func (s *sizeGen) Execute(p Elem) ([]string, error) {
 		s.p.printf("\n  return ((*(%s))(%s)).Msgsize()", baseType, ptrName)
 		s.p.printf("\n}")
 		s.topics.Add(receiver, "Msgsize")
+		s.p.comment("MsgsizeMax returns an upper bound estimate of the number of bytes occupied by the serialized message, however many of its fields are empty")
+		s.p.printf("\nfunc (%s %s) MsgsizeMax() int {", ptrName, receiver)
+		s.p.printf("\n  return ((*(%s))(%s)).Msgsize()", baseType, ptrName)
+		s.p.printf("\n}")
+		s.topics.Add(receiver, "MsgsizeMax")
 		return nil, s.p.err
 	}
 
@@ -108,9 +122,58 @@ func (s *sizeGen) Execute(p Elem) ([]string, error) {
 	next(s, p)
 	s.p.nakedReturn()
 	s.topics.Add(receiver, "Msgsize")
+
+	// Msgsize leaves out the fields that MarshalMsg does,
+	// which MsgsizeMax counts without checking them
+	s.p.comment("MsgsizeMax returns an upper bound estimate of the number of bytes occupied by the serialized message, however many of its fields are empty")
+	s.p.printf("\nfunc (%s %s) MsgsizeMax() (s int) {", ptrName, receiver)
+	s.state = assign
+	s.max = true
+	next(s, p)
+	s.max = false
+	s.p.nakedReturn()
+	s.topics.Add(receiver, "MsgsizeMax")
+
+	name := getMaxMsgsizeConst(p.TypeName())
+	if bound, err := maxSizeConst(p, s.bounded); err == nil {
+		s.p.comment(name + " is the maximum number of bytes occupied by the serialized message")
+		s.p.printf("\nconst %s = %s\n", name, bound)
+	} else {
+		s.infos = append(s.infos, fmt.Sprintf("not generating %s: %s", name, err))
+	}
 	return nil, s.p.err
 }
 
+// bounded reports whether the named type gets a MaxMsgsize
+// constant of its own, returning the reason if it does not.
+func (s *sizeGen) bounded(name string) error {
+	if err, ok := s.bounds[name]; ok {
+		return err
+	}
+	e, ok := s.identities[name]
+	if !ok {
+		return fmt.Errorf("%s is not defined in this package", name)
+	}
+	if s.bounds == nil {
+		s.bounds = make(map[string]error)
+	}
+
+	// a type that refers back to itself has no bound
+	s.bounds[name] = fmt.Errorf("%s is recursive", name)
+	var err error
+	if e = s.applyall(e); e == nil {
+		err = fmt.Errorf("%s is ignored", name)
+	} else if st, ok := e.(*Struct); ok && !st.HasAnyStructTag() {
+		err = fmt.Errorf("%s is not generated", name)
+	} else if IsDangling(e) {
+		err = fmt.Errorf("%s is defined in another package", name)
+	} else {
+		_, err = maxSizeConst(e, s.bounded)
+	}
+	s.bounds[name] = err
+	return err
+}
+
 func (s *sizeGen) gStruct(st *Struct) {
 	if !s.p.ok() {
 		return
@@ -134,11 +197,16 @@ func (s *sizeGen) gStruct(st *Struct) {
 			if !s.p.ok() {
 				return
 			}
-			next(s, st.Fields[i].FieldElem)
+			s.field(st.Fields[i], st, func() {})
 		}
 	} else {
 		data := msgp.AppendMapHeader(nil, nfields)
-		s.addConstant(strconv.Itoa(len(data)))
+		if uf := st.unknownExpr(); uf != "" {
+			s.addConstant(builtinSize(mapHeader))
+			s.addConstant("msgp.UnknownSize(" + uf + ")")
+		} else {
+			s.addConstant(strconv.Itoa(len(data)))
+		}
 		for i := range st.Fields {
 			if !ast.IsExported(st.Fields[i].FieldName) {
 				continue
@@ -146,12 +214,105 @@ func (s *sizeGen) gStruct(st *Struct) {
 
 			data = data[:0]
 			data = msgp.AppendString(data, st.Fields[i].FieldTag)
-			s.addConstant(strconv.Itoa(len(data)))
-			next(s, st.Fields[i].FieldElem)
+			s.field(st.Fields[i], st, func() { s.addConstant(strconv.Itoa(len(data))) })
 		}
 	}
 }
 
+// field adds the size of sf, with that of its key, which
+// key adds, unless it is left out, as MarshalMsg leaves it
+// out when it is empty or absent from the version
+func (s *sizeGen) field(sf StructField, st *Struct, key func()) {
+	omit := ""
+	if !s.max {
+		if st.AsTuple {
+			omit = st.absentExpr(sf)
+		} else {
+			omit = fieldOmitExpr(sf, st)
+		}
+	}
+	if omit == "" {
+		key()
+		s.fieldElem(sf)
+		return
+	}
+	s.state = add
+	s.p.printf("\nif !(%s) {", omit)
+	key()
+	s.fieldElem(sf)
+	s.p.closeblock()
+	s.state = add
+}
+
+// fieldElem adds the size of the value of sf, which for
+// Msgsize is that of the widest integer in the range of its
+// min and max tags, when it is in that range
+func (s *sizeGen) fieldElem(sf StructField) {
+	n, in, ok := rangeSize(sf)
+	if !ok || s.max {
+		next(s, sf.FieldElem)
+		return
+	}
+	// MarshalMsg encodes values out of the range too,
+	// in as many bytes as their type takes
+	s.state = add
+	s.p.printf("\nif %s {", in)
+	s.addConstant(strconv.Itoa(n))
+	s.p.print("\n} else {")
+	s.state = add
+	next(s, sf.FieldElem)
+	s.p.closeblock()
+	s.state = add
+}
+
+// rangeSize returns the largest encoded size of the integers
+// from the min to the max tag of sf, and the condition of its
+// value being among them, if it is an integer with numbers for
+// tags that narrow it. The bound of a signed integer without a
+// min tag is that of its type, which is as wide as any, so only
+// a max tag narrows unsigned integers.
+func rangeSize(sf StructField) (int, string, bool) {
+	b, ok := sf.FieldElem.(*BaseElem)
+	bits := 0
+	if ok {
+		bits = intBits(b.Value)
+	}
+	if bits == 0 || b.Enum != nil || b.FixedInt != 0 || b.ShimToBase != "" {
+		return 0, "", false
+	}
+	max, ok := sf.TagPartValue("max")
+	if !ok {
+		return 0, "", false
+	}
+	v := b.Varname()
+	switch b.Value {
+	case Uint, Uint8, Uint16, Uint32, Uint64, Byte:
+		hi, err := strconv.ParseUint(max, 0, bits)
+		if err != nil {
+			return 0, "", false
+		}
+		return len(msgp.AppendUint64(nil, hi)), fmt.Sprintf("%s <= %d", v, hi), true
+	}
+	min, ok := sf.TagPartValue("min")
+	if !ok {
+		return 0, "", false
+	}
+	lo, err := strconv.ParseInt(min, 0, bits)
+	if err != nil {
+		return 0, "", false
+	}
+	hi, err := strconv.ParseInt(max, 0, bits)
+	if err != nil || hi < lo {
+		return 0, "", false
+	}
+	// the size grows away from zero
+	n := len(msgp.AppendInt64(nil, lo))
+	if l := len(msgp.AppendInt64(nil, hi)); l > n {
+		n = l
+	}
+	return n, fmt.Sprintf("%s >= %d && %s <= %d", v, lo, v, hi), true
+}
+
 func (s *sizeGen) gPtr(p *Ptr) {
 	s.state = add // inner must use add
 	s.p.printf("\nif %s == nil {\ns += msgp.NilSize\n} else {", p.Varname())
@@ -186,6 +347,12 @@ func (s *sizeGen) gArray(a *Array) {
 		return
 	}
 
+	// byte arrays are encoded as 'bin'
+	if isByte(a.Els) {
+		s.addConstant(binSizeExpr(a.Size))
+		return
+	}
+
 	s.addConstant(builtinSize(arrayHeader))
 
 	// if the array's children are a fixed
@@ -202,7 +369,7 @@ func (s *sizeGen) gArray(a *Array) {
 }
 
 func (s *sizeGen) gMap(m *Map) {
-	s.addConstant(builtinSize(mapHeader))
+	s.addConstant(builtinSize(m.header()))
 	vn := m.Varname()
 	s.p.printf("\nif %s != nil {", vn)
 	s.p.printf("\nfor %s, %s := range %s {", m.Keyidx, m.Validx, vn)
@@ -212,7 +379,9 @@ func (s *sizeGen) gMap(m *Map) {
 	s.state = expr
 	s.ctx.PushVar(m.Keyidx)
 	next(s, m.Key)
-	next(s, m.Value)
+	if !m.IsSet() {
+		next(s, m.Value)
+	}
 	s.ctx.Pop()
 	s.p.closeblock()
 	s.p.closeblock()
@@ -223,24 +392,17 @@ func (s *sizeGen) gBase(b *BaseElem) {
 	if !s.p.ok() {
 		return
 	}
-	if b.Convert && b.ShimMode == Convert {
-		s.state = add
-		vname := randIdent()
-		s.p.printf("\nvar %s %s", vname, b.BaseType())
-
-		// ensure we don't get "unused variable" warnings from outer slice iterations
-		s.p.printf("\n_ = %s", b.Varname())
-
-		s.p.printf("\ns += %s", basesizeExpr(b.Value, vname, b.BaseName()))
-		s.state = expr
-
-	} else {
-		vname := b.Varname()
-		if b.Convert {
-			vname = tobaseConvert(b)
-		}
-		s.addConstant(basesizeExpr(b.Value, vname, b.BaseName()))
+	if b.Enum != nil {
+		s.addConstant(strconv.Itoa(enumSize(b)))
+		return
 	}
+	// the size is of the converted value, which MarshalMsg
+	// converts to in either shim mode
+	vname := b.identExpr(b.Varname())
+	if b.Convert {
+		vname = tobaseConvert(b)
+	}
+	s.addConstant(basesizeExpr(b.Value, vname, b.sizeName()))
 }
 
 // returns "len(slice)"
@@ -248,11 +410,48 @@ func lenExpr(sl *Slice) string {
 	return "len(" + sl.Varname() + ")"
 }
 
+// binSizeExpr returns the encoded size of a 'bin'
+// of size bytes: exact if size is a number, and
+// otherwise with the largest header
+func binSizeExpr(size string) string {
+	if n, err := strconv.Atoi(size); err == nil {
+		return strconv.Itoa(len(msgp.AppendBytes(nil, make([]byte, n))))
+	}
+	return builtinSize("BytesPrefix") + " + " + size
+}
+
+// enumSize returns the largest encoded size of a value of
+// the enum b, which is either the name of a value, or a
+// number of b's integer type
+func enumSize(b *BaseElem) int {
+	bits := intBits(b.Value)
+	if b.FixedInt != 0 {
+		bits = b.FixedInt
+	}
+	var n int
+	switch bits {
+	case 8:
+		n = msgp.Uint8Size
+	case 16:
+		n = msgp.Uint16Size
+	case 32:
+		n = msgp.Uint32Size
+	default:
+		n = msgp.Uint64Size
+	}
+	for _, name := range b.Enum.Names {
+		if l := len(msgp.AppendString(nil, name)); l > n {
+			n = l
+		}
+	}
+	return n
+}
+
 // is a given primitive always the same (max)
 // size on the wire?
 func fixedSize(p Primitive) bool {
 	switch p {
-	case Intf, Ext, IDENT, Bytes, String:
+	case Intf, Ext, IDENT, Bytes, String, Addr, AddrPort, BigInt, Text, Iface, NullString:
 		return false
 	default:
 		return true
@@ -278,7 +477,7 @@ func fixedsizeExpr(e Elem) (string, bool) {
 		}
 	case *BaseElem:
 		if fixedSize(e.Value) {
-			return builtinSize(e.BaseName()), true
+			return builtinSize(e.sizeName()), true
 		}
 	case *Struct:
 		var str string
@@ -319,6 +518,18 @@ func basesizeExpr(value Primitive, vname, basename string) string {
 		return "msgp.BytesPrefixSize + len(" + vname + ")"
 	case String:
 		return "msgp.StringPrefixSize + len(" + vname + ")"
+	case Addr:
+		return "msgp.AddrPrefixSize + len(" + vname + ".Zone())"
+	case AddrPort:
+		return "msgp.AddrPortPrefixSize + len(" + vname + ".Addr().Zone())"
+	case BigInt:
+		return "msgp.BigIntSize(" + vname + ")"
+	case Text:
+		return "msgp.TextSize(" + vname + ")"
+	case Iface:
+		return "msgp.IfaceSize(" + vname + ")"
+	case NullString:
+		return "msgp.NullStringPrefixSize + len(" + nullField(stripRef(vname), "String") + ")"
 	default:
 		return builtinSize(basename)
 	}
@@ -0,0 +1,174 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMaxMsgsizeConst(t *testing.T) {
+	name := &BaseElem{Value: String}
+	name.SetAllocBound("64")
+	ids := &Slice{Els: &BaseElem{Value: Uint64}}
+	ids.SetAllocBound("maxIDs")
+	bounded := testStruct("Bounded", "omitempty",
+		testField("A", "a", &BaseElem{Value: Int64}),
+		testField("Name", "name", name),
+		testField("IDs", "ids", ids),
+		testField("Inner", "inner", Ident("", "Inner")),
+	)
+	unbounded := testStruct("Unbounded", "omitempty",
+		testField("Name", "name", &BaseElem{Value: String}),
+	)
+	inner := testStruct("Inner", "omitempty",
+		testField("B", "b", &BaseElem{Value: Bool}),
+	)
+
+	generate := func(e Elem) string {
+		var buf bytes.Buffer
+		var topics Topics
+		g := sizes(&buf, &topics)
+		g.identities = map[string]Elem{"Bounded": bounded, "Unbounded": unbounded, "Inner": inner}
+		if _, err := g.Execute(e); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	out := generate(bounded)
+	want := "const BoundedMaxMsgsize = (1 + 2 + msgp.Int64Size + 5 + (msgp.StringPrefixSize + 64) + " +
+		"4 + (msgp.ArrayHeaderSize + ((maxIDs) * msgp.Uint64Size)) + 6 + InnerMaxMsgsize)"
+	if !strings.Contains(out, want) {
+		t.Errorf("missing %q in generated code:\n%s", want, out)
+	}
+
+	out = generate(unbounded)
+	if strings.Contains(out, "MaxMsgsize") {
+		t.Errorf("unbounded type has a MaxMsgsize constant:\n%s", out)
+	}
+
+	// a bounded struct that refers to an unbounded one is unbounded too
+	outer := testStruct("Outer", "omitempty",
+		testField("U", "u", Ident("", "Unbounded")),
+	)
+	out = generate(outer)
+	if strings.Contains(out, "MaxMsgsize") {
+		t.Errorf("struct with an unbounded field has a MaxMsgsize constant:\n%s", out)
+	}
+}
+
+func TestMsgsizeByteArray(t *testing.T) {
+	st := testStruct("Hashes", "",
+		testField("H", "h", &Array{Size: "32", Els: &BaseElem{Value: Byte}}),
+		testField("L", "l", &Array{Size: "300", Els: &BaseElem{Value: Byte}}),
+		testField("N", "n", &Array{Size: "hashLen", Els: &BaseElem{Value: Byte}}),
+	)
+	out := generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+
+	want := "s = 1 + 2 + 34 + 2 + 303 + 2 + msgp.BytesPrefixSize + hashLen"
+	if !strings.Contains(out, want) {
+		t.Errorf("missing %q in generated code:\n%s", want, out)
+	}
+	want = "const HashesMaxMsgsize = (1 + 2 + (34) + 2 + (303) + 2 + (msgp.BytesPrefixSize + hashLen))"
+	if !strings.Contains(out, want) {
+		t.Errorf("missing %q in generated code:\n%s", want, out)
+	}
+	if strings.Contains(out, "msgp.ByteSize") {
+		t.Errorf("byte array sized per element:\n%s", out)
+	}
+}
+
+func TestMsgsizeTuple(t *testing.T) {
+	sizeGenerator := func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }
+	build := func() *Struct {
+		return testStruct("T", "",
+			testField("A", "a", &BaseElem{Value: Int64}),
+			testField("B", "bb", &Array{Size: "8", Els: &BaseElem{Value: Byte}}),
+		)
+	}
+	asMap := generateMethod(t, sizeGenerator, build())
+
+	// as the tuple directive leaves it, without the _struct annotation
+	tuple := build()
+	tuple.Fields = tuple.Fields[1:]
+	tuple.AsTuple = true
+	asTuple := generateMethod(t, sizeGenerator, tuple)
+
+	for out, want := range map[string]string{
+		asMap:   "const TMaxMsgsize = (1 + 2 + msgp.Int64Size + 3 + (10))",
+		asTuple: "const TMaxMsgsize = (1 + msgp.Int64Size + (10))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestMsgsizeOmitEmpty(t *testing.T) {
+	st := testStruct("Opt", ",omitempty",
+		testField("A", "a", &BaseElem{Value: Int64}),
+		testField("B", "b", &BaseElem{Value: String}),
+		testField("C", "c", &Slice{Els: &BaseElem{Value: Uint64}}),
+	)
+	out := generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+
+	// Msgsize counts the fields that MarshalMsg encodes, and
+	// MsgsizeMax all of them
+	for _, want := range []string{
+		"func (z *Opt) Msgsize() (s int) {\ns = 1\nif !((*z).A == 0) {\ns += 2 + msgp.Int64Size\n}",
+		"if !((*z).B == \"\") {\ns += 2 + msgp.StringPrefixSize + len((*z).B)\n}",
+		"if !(len((*z).C) == 0) {\ns += 2 + msgp.ArrayHeaderSize + (len((*z).C) * (msgp.Uint64Size))\n}",
+		"func (z *Opt) MsgsizeMax() (s int) {\ns = 1 + 2 + msgp.Int64Size + 2 + msgp.StringPrefixSize + len((*z).B) + 2 + msgp.ArrayHeaderSize + (len((*z).C) * (msgp.Uint64Size))\nreturn\n}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// without omitempty, they're the same
+	st = testStruct("All", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+	)
+	out = generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+	if strings.Count(out, "s = 1 + 2 + msgp.Int64Size\n") != 2 {
+		t.Errorf("Msgsize and MsgsizeMax differ:\n%s", out)
+	}
+}
+
+func TestMsgsizeIntRange(t *testing.T) {
+	st := testStruct("Counters", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+		testField("B", "b,min=0,max=255", &BaseElem{Value: Int64}),
+		testField("C", "c,max=255", &BaseElem{Value: Uint64}),
+		testField("D", "d,min=-100,max=100", &BaseElem{Value: Int32}),
+		testField("E", "e,max=100", &BaseElem{Value: Uint8}),
+		// a signed integer without a min is not narrowed
+		testField("F", "f,max=255", &BaseElem{Value: Int64}),
+		// nor is a max that isn't a number
+		testField("G", "g,max=maxG", &BaseElem{Value: Uint64}),
+	)
+	out := generateMethod(t, func(w *bytes.Buffer, topics *Topics) generator { return sizes(w, topics) }, st)
+
+	// 255 is a 'uint 8', -100 an 'int 8' and 100 a 'positive fixint',
+	// and the values out of their range take the bytes of their type
+	for _, want := range []string{
+		"if (*z).B >= 0 && (*z).B <= 255 {\ns += 2\n} else {\ns += msgp.Int64Size\n}",
+		"if (*z).C <= 255 {\ns += 2\n} else {\ns += msgp.Uint64Size\n}",
+		"if (*z).D >= -100 && (*z).D <= 100 {\ns += 2\n} else {\ns += msgp.Int32Size\n}",
+		"if (*z).E <= 100 {\ns += 1\n} else {\ns += msgp.Uint8Size\n}",
+		"s += 2 + msgp.Int64Size + 2 + msgp.Uint64Size\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	// MsgsizeMax doesn't rely on the tags, which MarshalMsg
+	// doesn't enforce, nor does the MaxMsgsize bound, since
+	// UnmarshalMsg doesn't check them
+	if !strings.Contains(out, "MsgsizeMax() (s int) {\ns = 1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size + 2 + msgp.Uint64Size + 2 + msgp.Int32Size + 2 + msgp.Uint8Size") {
+		t.Errorf("MsgsizeMax narrowed by the tags:\n%s", out)
+	}
+	if !strings.Contains(out, "const CountersMaxMsgsize = (1 + 2 + msgp.Int64Size + 2 + msgp.Int64Size") {
+		t.Errorf("MaxMsgsize narrowed by the tags:\n%s", out)
+	}
+}
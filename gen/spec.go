@@ -3,7 +3,11 @@ package gen
 import (
 	"bytes"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
+	"sort"
 	"strings"
 )
 
@@ -21,7 +25,7 @@ const (
 
 // Method is a bitfield representing something that the
 // generator knows how to print.
-type Method uint8
+type Method uint32
 
 // are the bits in 'f' set in 'm'?
 func (m Method) isset(f Method) bool { return (m&f == f) }
@@ -41,11 +45,37 @@ func (m Method) String() string {
 		return "iszero"
 	case MaxSize:
 		return "maxsize"
+	case UnmarshalExact:
+		return "exact"
+	case Equal:
+		return "equal"
+	case Reset:
+		return "reset"
+	case Validate:
+		return "validate"
+	case CBOR:
+		return "cbor"
+	case Schema:
+		return "schema"
 	case Test:
 		return "test"
+	case Bench:
+		return "bench"
+	case Clone:
+		return "clone"
+	case Fields:
+		return "fields"
+	case Canonical:
+		return "canonical"
+	case Stringer:
+		return "stringer"
+	case Arena:
+		return "arena"
+	case Framed:
+		return "framed"
 	default:
 		// return e.g. "marshal+unmarshal+test"
-		modes := [...]Method{Marshal, Unmarshal, Size, IsZero, MaxSize, Test}
+		modes := [...]Method{Marshal, Unmarshal, Size, IsZero, MaxSize, UnmarshalExact, Equal, Reset, Validate, CBOR, Schema, Test, Bench, Clone, Fields, Canonical, Stringer, Arena, Framed}
 		any := false
 		nm := ""
 		for _, mm := range modes {
@@ -75,38 +105,88 @@ func strtoMeth(s string) Method {
 		return IsZero
 	case "maxsize":
 		return MaxSize
+	case "exact":
+		return UnmarshalExact
+	case "equal":
+		return Equal
+	case "reset":
+		return Reset
+	case "validate":
+		return Validate
+	case "cbor":
+		return CBOR
+	case "schema":
+		return Schema
 	case "test":
 		return Test
+	case "bench":
+		return Bench
+	case "clone":
+		return Clone
+	case "fields":
+		return Fields
+	case "canonical":
+		return Canonical
+	case "stringer":
+		return Stringer
+	case "arena":
+		return Arena
+	case "framed":
+		return Framed
 	default:
 		return 0
 	}
 }
 
 const (
-	Marshal     Method                       = 1 << iota // msgp.Marshaler
-	Unmarshal                                            // msgp.Unmarshaler
-	Size                                                 // msgp.Sizer
-	IsZero                                               // implement MsgIsZero()
-	Test                                                 // generate tests
-	MaxSize                                              // msgp.MaxSize
-	invalidmeth                                          // this isn't a method
-	marshaltest = Marshal | Unmarshal | Test             // tests for Marshaler and Unmarshaler
+	Marshal        Method                       = 1 << iota // msgp.Marshaler
+	Unmarshal                                               // msgp.Unmarshaler
+	Size                                                    // msgp.Sizer
+	IsZero                                                  // implement MsgIsZero()
+	Test                                                    // generate tests
+	MaxSize                                                 // msgp.MaxSize
+	UnmarshalExact                                          // implement UnmarshalMsgExact()
+	Equal                                                   // implement Equal()
+	Reset                                                   // implement Reset()
+	Validate                                                // implement Validate()
+	CBOR                                                    // implement MarshalCBOR() and UnmarshalCBOR()
+	Schema                                                  // implement {Type}MsgpSchema()
+	Bench                                                   // generate benchmarks on random values
+	Clone                                                   // implement Clone()
+	Fields                                                  // implement UnmarshalMsgFields()
+	Canonical                                               // implement UnmarshalMsgCanonical()
+	Stringer                                                // implement String() for msgp:stringer types
+	Arena                                                   // implement UnmarshalMsgArena()
+	Framed                                                  // implement MarshalFramed() and UnmarshalFramed()
+	invalidmeth                                             // this isn't a method
+	marshaltest    = Marshal | Unmarshal | Test             // tests for Marshaler and Unmarshaler
 )
 
 type Printer struct {
 	gens []generator
+	code bytes.Buffer // a copy of everything printed to out
 }
 
 func NewPrinter(m Method, topics *Topics, out io.Writer, tests io.Writer) *Printer {
-	if m.isset(Test) && tests == nil {
+	if (m.isset(Test) || m.isset(Bench)) && tests == nil {
 		panic("cannot print tests with 'nil' tests argument!")
 	}
+	p := &Printer{}
+	out = io.MultiWriter(out, &p.code)
 	gens := make([]generator, 0, 7)
 	if m.isset(Marshal) {
-		gens = append(gens, marshal(out, topics))
+		mg := marshal(out, topics)
+		mg.framed = m.isset(Framed)
+		gens = append(gens, mg)
 	}
 	if m.isset(Unmarshal) {
-		gens = append(gens, unmarshal(out, topics))
+		u := unmarshal(out, topics)
+		u.exact = m.isset(UnmarshalExact)
+		u.canon = m.isset(Canonical)
+		u.reset = m.isset(Reset)
+		u.arena = m.isset(Arena)
+		u.framed = m.isset(Framed)
+		gens = append(gens, u)
 	}
 	if m.isset(Size) {
 		gens = append(gens, sizes(out, topics))
@@ -117,13 +197,77 @@ func NewPrinter(m Method, topics *Topics, out io.Writer, tests io.Writer) *Print
 	if m.isset(MaxSize) {
 		gens = append(gens, maxSizes(out, topics))
 	}
+	if m.isset(Equal) {
+		gens = append(gens, equals(out, topics))
+	}
+	if m.isset(Reset) {
+		gens = append(gens, resets(out, topics))
+	}
+	if m.isset(Validate) {
+		gens = append(gens, validates(out, topics))
+	}
+	if m.isset(CBOR) {
+		gens = append(gens, cborMarshal(out, topics), cborUnmarshal(out, topics))
+	}
+	if m.isset(Schema) {
+		gens = append(gens, schemas(out, topics))
+	}
+	if m.isset(Clone) {
+		gens = append(gens, clones(out, topics))
+	}
+	if m.isset(Fields) {
+		gens = append(gens, unmarshalFields(out, topics))
+	}
+	if m.isset(Stringer) {
+		gens = append(gens, stringers(out, topics))
+	}
 	if m.isset(marshaltest) {
-		gens = append(gens, mtest(tests))
+		t := mtest(tests)
+		t.equal = m.isset(Equal)
+		t.reset = m.isset(Reset)
+		t.cbor = m.isset(CBOR)
+		t.clone = m.isset(Clone)
+		t.arena = m.isset(Arena)
+		t.framed = m.isset(Framed)
+		gens = append(gens, t)
+	}
+	if m.isset(Marshal | Unmarshal | Bench) {
+		gens = append(gens, mbench(tests))
 	}
 	if len(gens) == 0 {
 		panic("NewPrinter called with invalid method flags")
 	}
-	return &Printer{gens: gens}
+	p.gens = gens
+	return p
+}
+
+// UsedImports returns the sorted names of the packages that
+// the code printed so far refers to, which are the only ones
+// that the generated file needs to import. It returns nil if
+// the code cannot be parsed.
+func (p *Printer) UsedImports() []string {
+	src := append([]byte("package p\n"), p.code.Bytes()...)
+	file, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	if err != nil {
+		return nil
+	}
+	used := make(map[string]bool)
+	ast.Inspect(file, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			// identifiers declared in the code, such as
+			// receivers and variables, are resolved
+			if id, ok := sel.X.(*ast.Ident); ok && id.Obj == nil {
+				used[id.Name] = true
+			}
+		}
+		return true
+	})
+	names := []string{}
+	for name := range used {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
 }
 
 // TransformPass is a pass that transforms individual
@@ -152,11 +296,49 @@ func (p *Printer) ApplyDirective(pass Method, t TransformPass) {
 	}
 }
 
+// SetIdentities tells the printer about all of the named
+// types being generated, so that references between them can
+// be resolved.
+func (p *Printer) SetIdentities(ids map[string]Elem) {
+	for _, g := range p.gens {
+		switch g := g.(type) {
+		case *sizeGen:
+			g.identities = ids
+			g.bounds = nil
+		case *unmarshalGen:
+			g.identities = ids
+		case *unmarshalFieldsGen:
+			g.u.identities = ids
+		}
+	}
+}
+
+// Infos returns the informational messages produced since
+// the last call to Infos.
+func (p *Printer) Infos() []string {
+	var infos []string
+	for _, g := range p.gens {
+		if s, ok := g.(*sizeGen); ok {
+			infos = append(infos, s.infos...)
+			s.infos = nil
+		}
+	}
+	return infos
+}
+
+// SkipReason returns the reason that Print generates
+// no methods for e, or the empty string if it does.
+func SkipReason(e Elem) string {
+	// If the elem is a struct and has no codec: tags, skip it.
+	if es, ok := e.(*Struct); ok && !es.HasAnyStructTag() {
+		return "no codec tags"
+	}
+	return ""
+}
+
 // Print prints an Elem.
 func (p *Printer) Print(e Elem) ([]string, error) {
-	// If the elem is a struct and has no _struct annotations, skip it.
-	es, ok := e.(*Struct)
-	if ok && !es.HasAnyStructTag() {
+	if SkipReason(e) != "" {
 		return nil, nil
 	}
 
@@ -279,6 +461,13 @@ func next(t traversal, e Elem) {
 
 // possibly-immutable method receiver
 func imutMethodReceiver(p Elem) string {
+	switch _, typ := p.Receiver(); typ {
+	case "value":
+		return p.TypeName()
+	case "pointer":
+		return methodReceiver(p)
+	}
+
 	switch e := p.(type) {
 	case *Struct:
 		// TODO(HACK): actually do real math here.
@@ -325,6 +514,21 @@ func (p *printer) declare(name string, typ string) {
 	p.printf("\nvar %s %s", name, typ)
 }
 
+// checkAllocBound prints the check that size is within the first
+// allocbound of e, for decoders that read the size of e without
+// bounding it, as msgp.ReadArrayHeaderBytesMax does
+func (p *printer) checkAllocBound(size string, e Elem, ctx string) {
+	allocbound := strings.Split(e.AllocBound(), ",")[0]
+	if allocbound == "" || allocbound == "-" {
+		return
+	}
+	p.printf("\nif %s > %s {", size, allocbound)
+	p.printf("\nerr = msgp.ErrOverflow(uint64(%s), uint64(%s))", size, allocbound)
+	p.printf("\nerr = msgp.WrapError(err, %s)", ctx)
+	p.printf("\nreturn")
+	p.printf("\n}")
+}
+
 // does:
 //
 // if m == nil {
@@ -344,13 +548,6 @@ func (p *printer) resizeMap(size string, isnil string, m *Map, ctx string) []str
 		return []string{fmt.Sprintf("Missing allocbound on map %v", m)}
 	}
 	allocbound = strings.Split(allocbound, ",")[0]
-	if allocbound != "-" {
-		p.printf("\nif %s > %s {", size, allocbound)
-		p.printf("\nerr = msgp.ErrOverflow(uint64(%s), uint64(%s))", size, allocbound)
-		p.printf("\nerr = msgp.WrapError(err, %s)", ctx)
-		p.printf("\nreturn")
-		p.printf("\n}")
-	}
 
 	// go-codec compat: nil clears map, but if a map already exists
 	// (e.g., because we are decoding the same key twice), then keep
@@ -360,6 +557,8 @@ func (p *printer) resizeMap(size string, isnil string, m *Map, ctx string) []str
 	p.printf("\n  %s = nil", vn)
 	p.printf("\n} else if %s == nil {", vn)
 	p.printf("\n  %s = make(%s, %s)", vn, m.TypeName(), size)
+	p.printf("\n  err = msgp.SpendMap(budget, bts, %s, %s)", vn, size)
+	p.wrapErrCheck(ctx)
 	p.closeblock()
 
 	return nil
@@ -373,11 +572,102 @@ func (p *printer) mapAssign(m *Map) {
 	p.printf("\n%s[%s] = %s", m.Varname(), m.Keyidx, m.Validx)
 }
 
+// does:
+//
+// {{key}}_keys := make([]{{keytype}}, 0, len(m))
+// for {{key}} := range m { {{key}}_keys = append({{key}}_keys, {{key}}) }
+// sort.Sort({{sortinterface}}({{key}}_keys))
+//
+// so that the map can be encoded in canonical order
+func (p *printer) sortedKeys(m *Map) []string {
+	vn := m.Varname()
+	p.printf("\n%s_keys := make([]%s, 0, len(%s))", m.Keyidx, m.Key.TypeName(), vn)
+	p.printf("\nfor %s := range %s {", m.Keyidx, vn)
+	p.printf("\n%s_keys = append(%s_keys, %s)", m.Keyidx, m.Keyidx, m.Keyidx)
+	p.closeblock()
+
+	switch {
+	case m.Key.SortInterface() != "":
+		p.printf("\nsort.Sort(%s(%s_keys))", m.Key.SortInterface(), m.Keyidx)
+	case isStringKey(m.Key):
+		p.printf("\nsort.Slice(%[1]s_keys, func(i, j int) bool { return %[1]s_keys[i].String() < %[1]s_keys[j].String() })", m.Keyidx)
+	case isOrderedKey(m.Key):
+		if be := m.Key.(*BaseElem); be.Value == String && !be.Convert {
+			p.printf("\nsort.Strings(%s_keys)", m.Keyidx)
+		} else {
+			p.printf("\nsort.Slice(%[1]s_keys, func(i, j int) bool { return %[1]s_keys[i] < %[1]s_keys[j] })", m.Keyidx)
+		}
+	default:
+		return []string{fmt.Sprintf("no ordering for map keys of type %s in %s; add a msgp:sort directive", m.Key.TypeName(), vn)}
+	}
+	return nil
+}
+
+// sortedSlice prints a sorted copy of the sortslice s:
+//
+// {{index}}_sorted := make([]{{elemtype}}, len(s))
+// copy({{index}}_sorted, s)
+// sort.Slice({{index}}_sorted, func(i, j int) bool { return {{less}} })
+//
+// and returns the elements of the copy, to encode in
+// place of those of s; s itself is left as it is.
+func (p *printer) sortedSlice(s *Slice) Elem {
+	sorted := s.Index + "_sorted"
+	p.sortedCopy(s, sorted, s.Varname())
+	els := s.Els.Copy()
+	els.SetVarname(fmt.Sprintf("%s[%s]", sorted, s.Index))
+	return els
+}
+
+// sortedCopy prints the declaration of sorted, a copy of
+// src, a value of the sortslice s, in the order its elements
+// are encoded in
+func (p *printer) sortedCopy(s *Slice, sorted string, src string) {
+	p.printf("\n%s := make([]%s, len(%s))", sorted, s.Els.TypeName(), src)
+	p.printf("\ncopy(%s, %s)", sorted, src)
+	if s.Els.SortInterface() != "" {
+		p.printf("\nsort.Sort(%s(%s))", s.Els.SortInterface(), sorted)
+	} else {
+		p.printf("\nsort.Slice(%s, func(i, j int) bool { return %s })", sorted, elemLess(s.Els, sorted+"[i]", sorted+"[j]"))
+	}
+}
+
+// checkSorted prints the check, when validating, that the
+// elements of the sortslice s were encoded in sorted order
+func (p *printer) checkSorted(s *Slice) {
+	vn := s.Varname()
+	if vn[0] == '*' {
+		vn = "(" + vn + ")"
+	}
+	p.printf("\nif validate {")
+	p.printf("\nfor %[1]s := 1; %[1]s < len(%[2]s); %[1]s++ {", s.Index, vn)
+	p.printf("\nif %s {", elemLess(s.Els, fmt.Sprintf("%s[%s]", vn, s.Index), fmt.Sprintf("%s[%s-1]", vn, s.Index)))
+	p.printf("\nerr = &msgp.ErrNonCanonical{}")
+	p.printf("\nreturn")
+	p.printf("\n}")
+	p.closeblock()
+	p.closeblock()
+}
+
 // clear map keys
 func (p *printer) clearMap(name string) {
 	p.printf("\nfor key := range %[1]s { delete(%[1]s, key) }", name)
 }
 
+// convertCtx is the context of an error converting the
+// base value decoded into refname back to b; the string of
+// a map key that doesn't parse is part of its context
+func convertCtx(ctx *Context, b *BaseElem, refname string) string {
+	args := ctx.ArgsStr()
+	if !b.StringKey {
+		return args
+	}
+	if args != "" {
+		args += ", "
+	}
+	return args + refname
+}
+
 func (p *printer) wrapErrCheck(ctx string) {
 	p.print("\nif err != nil {")
 	p.printf("\nerr = msgp.WrapError(err, %s)", ctx)
@@ -385,18 +675,17 @@ func (p *printer) wrapErrCheck(ctx string) {
 	p.print("\n}")
 }
 
-func (p *printer) resizeSlice(size string, isnil string, s *Slice, ctx string) []string {
+// resizeSlice prints the resizing of s to size elements; if arena is set,
+// a new slice is made from the Arena of the budget, if it has one
+func (p *printer) resizeSlice(size string, isnil string, s *Slice, ctx string, arena bool) []string {
 	allocbound := s.AllocBound()
 	if allocbound == "" {
 		return []string{fmt.Sprintf("Missing allocbound on slice %v", s)}
 	}
-	allocbound = strings.Split(allocbound, ",")[0]
-	if allocbound != "-" {
-		p.printf("\nif %s > %s {", size, allocbound)
-		p.printf("\nerr = msgp.ErrOverflow(uint64(%s), uint64(%s))", size, allocbound)
-		p.printf("\nerr = msgp.WrapError(err, %s)", ctx)
-		p.printf("\nreturn")
-		p.printf("\n}")
+	bounds := strings.Split(allocbound, ",")
+	allocbound = bounds[0]
+	if len(bounds) > 1 {
+		p.comment(fmt.Sprintf("allocbound %s applies to %s, and %s to its elements", allocbound, s.Varname(), strings.Join(bounds[1:], ",")))
 	}
 
 	p.printf("\nif %s {", isnil)
@@ -404,7 +693,13 @@ func (p *printer) resizeSlice(size string, isnil string, s *Slice, ctx string) [
 	p.printf("\n} else if %[1]s != nil && cap(%[1]s) >= %[2]s {", s.Varname(), size)
 	p.printf("\n  %[1]s = (%[1]s)[:%[2]s]", s.Varname(), size)
 	p.printf("\n} else {")
-	p.printf("\n  %[1]s = make(%[3]s, %[2]s)", s.Varname(), size, s.TypeName())
+	if arena {
+		p.printf("\n  %[1]s = msgp.MakeSlice[%[3]s](budget, %[2]s)", s.Varname(), size, s.Els.TypeName())
+	} else {
+		p.printf("\n  %[1]s = make(%[3]s, %[2]s)", s.Varname(), size, s.TypeName())
+	}
+	p.printf("\n  err = msgp.SpendSlice(budget, bts, %s)", s.Varname())
+	p.wrapErrCheck(ctx)
 	p.printf("\n}")
 
 	return nil
@@ -459,7 +754,11 @@ func (p *printer) print(format string) {
 func (p *printer) initPtr(pt *Ptr) {
 	if pt.Needsinit() {
 		vname := pt.Varname()
-		p.printf("\nif %s == nil { %s = new(%s); }", vname, vname, pt.Value.TypeName())
+		if pooled(pt.Value) {
+			p.printf("\nif %s == nil { %s = Get%s(); }", vname, vname, pt.Value.TypeName())
+		} else {
+			p.printf("\nif %s == nil { %s = new(%s); }", vname, vname, pt.Value.TypeName())
+		}
 	}
 }
 
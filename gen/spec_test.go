@@ -0,0 +1,24 @@
+package gen
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestUsedImports(t *testing.T) {
+	st := testStruct("U", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+		testField("E", "e", &BaseElem{Value: Intf}),
+	)
+	var code bytes.Buffer
+	p := NewPrinter(Marshal|Equal, &Topics{}, &code, nil)
+	if _, err := p.Print(st); err != nil {
+		t.Fatal(err)
+	}
+	// the receiver z isn't a package
+	want := []string{"msgp", "reflect"}
+	if got := p.UsedImports(); !reflect.DeepEqual(got, want) {
+		t.Errorf("used imports %v; want %v in:\n%s", got, want, code.String())
+	}
+}
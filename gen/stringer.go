@@ -0,0 +1,99 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+)
+
+func stringers(w io.Writer, topics *Topics) *stringerGen {
+	return &stringerGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// stringerGen prints String methods for the structs named by
+// the msgp:stringer directive. The string lists the encoded
+// fields by name, as in T{A:1 B:0a0b}, and leaves out those
+// that MarshalMsg would omit, so that it shows what is in
+// the encoding. The values are written by msgp.AppendDebug,
+// which writes binary data as a short hex prefix, calls the
+// String methods of nested values that have one, and writes
+// pointers as what they point to. String
+// takes its receiver by value, so that fmt finds it for
+// values as well as pointers, unless the msgp:receiver
+// directive says otherwise.
+type stringerGen struct {
+	passes
+	p      printer
+	topics *Topics
+}
+
+func (s *stringerGen) Method() Method { return Stringer }
+
+func (s *stringerGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (s *stringerGen) Execute(p Elem) ([]string, error) {
+	if !s.p.ok() {
+		return nil, s.p.err
+	}
+	p = s.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+	st, ok := p.(*Struct)
+	if !ok || !st.Stringer {
+		return nil, nil
+	}
+	p = p.Copy()
+	st = p.(*Struct)
+
+	// save the receiver name before methodReceiver changes it
+	z := p.Varname()
+	receiver := p.TypeName()
+	if _, typ := p.Receiver(); typ == "pointer" {
+		receiver = methodReceiver(p)
+	}
+
+	s.p.comment("String returns a compact, field-labeled form of " + z + ", for debugging")
+	s.p.printf("\nfunc (%s %s) String() string {", z, receiver)
+	s.p.printf("\nb := append(make([]byte, 0, 64), \"%s{\"...)", p.TypeName())
+	for i := range st.Fields {
+		sf := st.Fields[i]
+		if !ast.IsExported(sf.FieldName) {
+			continue
+		}
+		omit := fieldOmitExpr(sf, st)
+		if omit != "" {
+			s.p.printf("\nif !(%s) {", omit)
+		}
+		s.p.printf("\nb = msgp.AppendDebugField(b, \"%s\", %s)", sf.FieldName, debugValue(sf.FieldElem))
+		if omit != "" {
+			s.p.closeblock()
+		}
+	}
+	s.p.print("\nb = append(b, '}')\nreturn string(b)\n}\n")
+	s.topics.Add(receiver, "String")
+	return nil, s.p.err
+}
+
+// debugValue returns the value to pass to msgp.AppendDebug for
+// e, which is binary data as a []byte, so that it is written
+// in hex. Text types and the like are passed by the address
+// they are referred to by, which AppendDebug writes as the
+// value it points to, unless the pointer has a String method.
+func debugValue(e Elem) string {
+	switch e := e.(type) {
+	case *BaseElem:
+		if e.Value == Bytes && e.TypeName() != "[]byte" {
+			return "[]byte(" + e.Varname() + ")"
+		}
+	case *Array:
+		if isByte(e.Els) {
+			return e.Varname() + "[:]"
+		}
+	}
+	return e.Varname()
+}
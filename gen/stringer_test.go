@@ -0,0 +1,53 @@
+package gen
+
+import (
+	"bytes"
+	"go/format"
+	"strings"
+	"testing"
+)
+
+func stringerGenerator(w *bytes.Buffer, topics *Topics) generator { return stringers(w, topics) }
+
+func TestStringer(t *testing.T) {
+	digest := &BaseElem{Value: Bytes}
+	digest.Alias("Digest")
+	st := testStruct("S", "",
+		testField("N", "n", &BaseElem{Value: Int64}),
+		testField("B", "b,omitempty", &BaseElem{Value: Bytes}),
+		testField("D", "d", digest),
+		testField("H", "h", &Array{Size: "32", Els: &BaseElem{Value: Byte}}),
+		testField("In", "in", Ident("", "Inner")),
+	)
+	if out := generateMethod(t, stringerGenerator, st); out != "" {
+		t.Errorf("String without the msgp:stringer directive:\n%s", out)
+	}
+
+	st.Stringer = true
+	out, err := format.Source([]byte(generateMethod(t, stringerGenerator, st)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const golden = `// String returns a compact, field-labeled form of z, for debugging
+func (z S) String() string {
+	b := append(make([]byte, 0, 64), "S{"...)
+	b = msgp.AppendDebugField(b, "N", z.N)
+	if !(len(z.B) == 0) {
+		b = msgp.AppendDebugField(b, "B", z.B)
+	}
+	b = msgp.AppendDebugField(b, "D", []byte(z.D))
+	b = msgp.AppendDebugField(b, "H", z.H[:])
+	b = msgp.AppendDebugField(b, "In", z.In)
+	b = append(b, '}')
+	return string(b)
+}
+`
+	if strings.TrimSpace(string(out)) != strings.TrimSpace(golden) {
+		t.Errorf("generated:\n%s\nwant:\n%s", out, golden)
+	}
+
+	st.SetReceiver("", "pointer")
+	if out := generateMethod(t, stringerGenerator, st); !strings.Contains(out, "func (z *S) String() string {") {
+		t.Errorf("msgp:receiver pointer is ignored:\n%s", out)
+	}
+}
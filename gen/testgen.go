@@ -7,6 +7,16 @@ import (
 
 var (
 	marshalTestTempl = template.New("MarshalTest")
+	appendTestTempl  = template.New("AppendTest")
+	equalTestTempl   = template.New("EqualTest")
+	resetTestTempl   = template.New("ResetTest")
+	allocTestTempl   = template.New("AllocTest")
+	poolTestTempl    = template.New("PoolTest")
+	cborTestTempl    = template.New("CBORTest")
+	cloneTestTempl   = template.New("CloneTest")
+	arenaTestTempl   = template.New("ArenaTest")
+	framedTestTempl  = template.New("FramedTest")
+	benchTempl       = template.New("Bench")
 )
 
 // TODO(philhofer):
@@ -22,7 +32,13 @@ func mtest(w io.Writer) *mtestGen {
 
 type mtestGen struct {
 	passes
-	w io.Writer
+	w      io.Writer
+	equal  bool // also test Equal
+	reset  bool // also test Reset
+	cbor   bool // also test MarshalCBOR and UnmarshalCBOR
+	clone  bool // also test Clone
+	arena  bool // also test UnmarshalMsgArena
+	framed bool // also test MarshalFramed and UnmarshalFramed
 }
 
 func (m *mtestGen) Execute(p Elem) ([]string, error) {
@@ -30,7 +46,50 @@ func (m *mtestGen) Execute(p Elem) ([]string, error) {
 	if p != nil && !IsDangling(p) {
 		switch p.(type) {
 		case *Struct, *Array, *Slice, *Map:
-			return nil, marshalTestTempl.Execute(m.w, p)
+			if err := marshalTestTempl.Execute(m.w, p); err != nil {
+				return nil, err
+			}
+			if err := appendTestTempl.Execute(m.w, p); err != nil {
+				return nil, err
+			}
+			if m.equal {
+				if err := equalTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if !marshalAllocates(p) {
+				if err := allocTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if pooled(p) {
+				if err := poolTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if m.cbor {
+				if err := cborTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if m.clone {
+				if err := cloneTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if m.arena {
+				if err := arenaTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if m.framed {
+				if err := framedTestTempl.Execute(m.w, p); err != nil {
+					return nil, err
+				}
+			}
+			if m.reset {
+				return nil, resetTestTempl.Execute(m.w, p)
+			}
 		}
 	}
 	return nil, nil
@@ -38,6 +97,31 @@ func (m *mtestGen) Execute(p Elem) ([]string, error) {
 
 func (m *mtestGen) Method() Method { return marshaltest }
 
+func mbench(w io.Writer) *mbenchGen {
+	return &mbenchGen{w: w}
+}
+
+// mbenchGen prints benchmarks of MarshalMsg and UnmarshalMsg
+// on random values, which, unlike the zero values used by the
+// benchmarks that mtestGen prints, exercise every field.
+type mbenchGen struct {
+	passes
+	w io.Writer
+}
+
+func (m *mbenchGen) Execute(p Elem) ([]string, error) {
+	p = m.applyall(p)
+	if p != nil && !IsDangling(p) {
+		switch p.(type) {
+		case *Struct, *Array, *Slice, *Map:
+			return nil, benchTempl.Execute(m.w, p)
+		}
+	}
+	return nil, nil
+}
+
+func (m *mbenchGen) Method() Method { return Marshal | Unmarshal | Bench }
+
 func init() {
 	template.Must(marshalTestTempl.Parse(`func TestMarshalUnmarshal{{.TypeName}}(t *testing.T) {
 	partitiontest.PartitionTest(t)
@@ -101,4 +185,399 @@ func BenchmarkUnmarshal{{.TypeName}}(b *testing.B) {
 
 `))
 
+	template.Must(appendTestTempl.Parse(`// TestMarshalAppend{{.TypeName}} checks that MarshalMsg appends
+// the same bytes whatever buffer it is given, as many as Msgsize
+// bounds, and that they decode to a value that encodes to them again.
+func TestMarshalAppend{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := r.(*{{.TypeName}})
+		bts := v.MarshalMsg(nil)
+		if len(bts) > v.Msgsize() || v.Msgsize() > v.MsgsizeMax() {
+			t.Fatalf("%d bytes are not within Msgsize() %d and MsgsizeMax() %d", len(bts), v.Msgsize(), v.MsgsizeMax())
+		}
+		if sized := v.MarshalMsg(make([]byte, 0, v.Msgsize())); string(sized) != string(bts) {
+			t.Fatalf("MarshalMsg into a buffer of Msgsize() bytes gives different bytes than into nil")
+		}
+		prefix := append(make([]byte, 0, len(bts)+8), "prefix"...)
+		app := v.MarshalMsg(prefix)
+		if string(app[:len(prefix)]) != "prefix" || string(app[len(prefix):]) != string(bts) {
+			t.Fatalf("MarshalMsg after other bytes gives different bytes than into nil")
+		}
+		var w {{.TypeName}}
+		left, err := w.UnmarshalMsg(app[len(prefix):])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after UnmarshalMsg(): %q", len(left), left)
+		}
+		if string(w.MarshalMsg(nil)) != string(bts) {
+			t.Errorf("decoding and re-encoding gives different bytes")
+		}
+	}
+}
+
+`))
+
+	template.Must(equalTestTempl.Parse(`func TestEqual{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := r.(*{{.TypeName}})
+		bts := v.MarshalMsg(nil)
+		var w {{.TypeName}}
+		if _, err := w.UnmarshalMsg(bts); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.MarshalMsg(nil)) == string(bts) && !v.Equal(&w) {
+			t.Errorf("%v and %v encode identically but are not Equal", v, &w)
+		}
+	}
+}
+
+`))
+
+	template.Must(cloneTestTempl.Parse(`func TestClone{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v := r.(*{{.TypeName}})
+		bts := v.MarshalMsg(nil)
+		w := v.Clone()
+		if string(w.MarshalMsg(nil)) != string(bts) {
+			t.Fatalf("clone of %v encodes differently", v)
+		}
+
+		// decoding another value into v reuses its storage,
+		// which must not be shared with w
+		r, err = protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := v.UnmarshalMsg(r.(*{{.TypeName}}).MarshalMsg(nil)); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.MarshalMsg(nil)) != string(bts) {
+			t.Errorf("clone changed when the original was decoded into")
+		}
+	}
+}
+
+`))
+
+	template.Must(framedTestTempl.Parse(`func TestFramed{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	// frames are written back to back, and read in turn
+	var vs [3]{{.TypeName}}
+	var bts []byte
+	for i := range vs {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		vs[i] = *r.(*{{.TypeName}})
+		bts = vs[i].MarshalFramed(bts)
+	}
+	for i := range vs {
+		var w {{.TypeName}}
+		var err error
+		if bts, err = w.UnmarshalFramed(bts); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.MarshalMsg(nil)) != string(vs[i].MarshalMsg(nil)) {
+			t.Errorf("frame %d re-encodes differently", i)
+		}
+	}
+	if len(bts) != 0 {
+		t.Errorf("%d bytes left after the frames", len(bts))
+	}
+}
+
+`))
+
+	template.Must(arenaTestTempl.Parse(`func TestUnmarshalArena{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	var a msgp.Arena
+	var w {{.TypeName}}
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts := r.(*{{.TypeName}}).MarshalMsg(nil)
+		var v {{.TypeName}}
+		if _, err := v.UnmarshalMsg(bts); err != nil {
+			t.Fatal(err)
+		}
+		a.Reset()
+		if _, err := w.UnmarshalMsgArena(bts, &a); err != nil {
+			t.Fatal(err)
+		}
+		if string(w.MarshalMsg(nil)) != string(v.MarshalMsg(nil)) {
+			t.Errorf("decoding from an Arena re-encodes differently than UnmarshalMsg")
+		}
+	}
+}
+
+// benchmarkUnmarshalArena{{.TypeName}} decodes into a zero value
+// either way, as UnmarshalMsgArena does.
+func benchmarkUnmarshalArena{{.TypeName}}(b *testing.B, arena bool) {
+	r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	bts := r.(*{{.TypeName}}).MarshalMsg(nil)
+	var a msgp.Arena
+	var v {{.TypeName}}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bts)))
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		if arena {
+			a.Reset()
+			_, err = v.UnmarshalMsgArena(bts, &a)
+		} else {
+			v = {{.TypeName}}{}
+			_, err = v.UnmarshalMsg(bts)
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalArena{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalArena{{.TypeName}}(b, true)
+}
+
+func BenchmarkUnmarshalNoArena{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalArena{{.TypeName}}(b, false)
+}
+
+`))
+
+	template.Must(allocTestTempl.Parse(`func TestMarshalMsgAllocs{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := r.(*{{.TypeName}})
+	bts := make([]byte, 0, v.Msgsize())
+	if n := testing.AllocsPerRun(10, func() { v.MarshalMsg(bts[:0]) }); n != 0 {
+		t.Errorf("MarshalMsg allocated %v times into a buffer of Msgsize() bytes", n)
+	}
+{{- if not .NoSizeHint}}
+	if n := testing.AllocsPerRun(10, func() { v.MarshalMsg(nil) }); n != 1 {
+		t.Errorf("MarshalMsg allocated %v times into an empty buffer", n)
+	}
+{{- end}}
+}
+
+`))
+
+	template.Must(resetTestTempl.Parse(`func TestReset{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	zero := (&{{.TypeName}}{}).MarshalMsg(nil)
+	var w {{.TypeName}}
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		// a message decoded into a reset value, after a
+		// random one, is decoded as into a new value
+		for _, bts := range [][]byte{r.(*{{.TypeName}}).MarshalMsg(nil), zero} {
+			var fresh {{.TypeName}}
+			if _, err := fresh.UnmarshalMsg(bts); err != nil {
+				t.Fatal(err)
+			}
+			w.Reset()
+			if _, err := w.UnmarshalMsg(bts); err != nil {
+				t.Fatal(err)
+			}
+			if string(w.MarshalMsg(nil)) != string(fresh.MarshalMsg(nil)) {
+				t.Errorf("decoding into a reset value differs from decoding into a new value")
+			}
+		}
+	}
+}
+
+func benchmarkUnmarshalReuse{{.TypeName}}(b *testing.B, reuse bool) {
+	r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	bts := r.(*{{.TypeName}}).MarshalMsg(nil)
+	var v {{.TypeName}}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bts)))
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		if reuse {
+			v.Reset()
+		} else {
+			v = {{.TypeName}}{}
+		}
+		_, err := v.UnmarshalMsg(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalReused{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalReuse{{.TypeName}}(b, true)
+}
+
+func BenchmarkUnmarshalFresh{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalReuse{{.TypeName}}(b, false)
+}
+
+`))
+
+	template.Must(poolTestTempl.Parse(`// benchmarkUnmarshalPool{{.TypeName}} decodes 10000 *{{.TypeName}}
+// values the way a []*{{.TypeName}} is decoded, with or without the pool.
+func benchmarkUnmarshalPool{{.TypeName}}(b *testing.B, pool bool) {
+	r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	one := r.(*{{.TypeName}}).MarshalMsg(nil)
+	zs := make([]*{{.TypeName}}, 10000)
+	bts := msgp.AppendArrayHeader(nil, uint32(len(zs)))
+	for range zs {
+		bts = append(bts, one...)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bts)))
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		_, _, o, err := msgp.ReadArrayHeaderBytes(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := range zs {
+			if pool {
+				zs[j] = Get{{.TypeName}}()
+			} else {
+				zs[j] = new({{.TypeName}})
+			}
+			o, err = zs[j].UnmarshalMsg(o)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+		if pool {
+			for j := range zs {
+				Put{{.TypeName}}(zs[j])
+			}
+		}
+	}
+}
+
+func BenchmarkUnmarshalPooled{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalPool{{.TypeName}}(b, true)
+}
+
+func BenchmarkUnmarshalUnpooled{{.TypeName}}(b *testing.B) {
+	benchmarkUnmarshalPool{{.TypeName}}(b, false)
+}
+
+`))
+
+	template.Must(benchTempl.Parse(`func benchmarkValue{{.TypeName}}(b *testing.B) *{{.TypeName}} {
+	r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return r.(*{{.TypeName}})
+}
+
+func Benchmark{{.TypeName}}Marshal(b *testing.B) {
+	v := benchmarkValue{{.TypeName}}(b)
+	bts := v.MarshalMsg(make([]byte, 0, v.Msgsize()))
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		bts = v.MarshalMsg(bts[0:0])
+	}
+}
+
+func Benchmark{{.TypeName}}Unmarshal(b *testing.B) {
+	bts := benchmarkValue{{.TypeName}}(b).MarshalMsg(nil)
+	var v {{.TypeName}}
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		_, err := v.UnmarshalMsg(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+`))
+
+	template.Must(cborTestTempl.Parse(`func TestMarshalUnmarshalCBOR{{.TypeName}}(t *testing.T) {
+	partitiontest.PartitionTest(t)
+	for i := 0; i < 100; i++ {
+		r, err := protocol.RandomizeObject(&{{.TypeName}}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		bts := r.(*{{.TypeName}}).MarshalCBOR(nil)
+		var w {{.TypeName}}
+		left, err := w.UnmarshalCBOR(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after UnmarshalCBOR(): %q", len(left), left)
+		}
+		if string(w.MarshalCBOR(nil)) != string(bts) {
+			t.Errorf("decoding CBOR and re-encoding it gives different bytes")
+		}
+	}
+}
+
+func BenchmarkMarshalCBOR{{.TypeName}}(b *testing.B) {
+	v := {{.TypeName}}{}
+	bts := v.MarshalCBOR(nil)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		bts = v.MarshalCBOR(bts[0:0])
+	}
+}
+
+func BenchmarkUnmarshalCBOR{{.TypeName}}(b *testing.B) {
+	v := {{.TypeName}}{}
+	bts := v.MarshalCBOR(nil)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(bts)))
+	b.ResetTimer()
+	for i:=0; i<b.N; i++ {
+		_, err := v.UnmarshalCBOR(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+`))
 }
@@ -0,0 +1,88 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTestgen(t *testing.T) {
+	st := testStruct("T", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+	)
+	var buf bytes.Buffer
+	g := mtest(&buf)
+	g.equal = true
+	g.reset = true
+	if _, err := g.Execute(st); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"func TestMarshalUnmarshalT(t *testing.T) {",
+		"func TestMarshalAppendT(t *testing.T) {",
+		"app := v.MarshalMsg(prefix)",
+		"func TestEqualT(t *testing.T) {",
+		"func TestResetT(t *testing.T) {",
+		"func BenchmarkUnmarshalReusedT(b *testing.B) {",
+		"func TestMarshalMsgAllocsT(t *testing.T) {",
+		"v.MarshalMsg(nil) }); n != 1 {",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated tests:\n%s", want, out)
+		}
+	}
+
+	// without a size hint, marshaling from nil may regrow the buffer
+	st.SetNoSizeHint()
+	buf.Reset()
+	if _, err := g.Execute(st); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "MarshalMsg(nil) });") {
+		t.Errorf("single-allocation test generated for a nosizehint type:\n%s", buf.String())
+	}
+
+	// maps sort their keys in a temporary slice
+	m := testStruct("M", "",
+		testField("M", "m", &Map{Key: &BaseElem{Value: String}, Value: &BaseElem{Value: Int64}}),
+	)
+	buf.Reset()
+	if _, err := g.Execute(m); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "TestMarshalMsgAllocsM") {
+		t.Errorf("allocation test generated for a type that allocates:\n%s", buf.String())
+	}
+}
+
+func TestBenchgen(t *testing.T) {
+	st := testStruct("T", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+	)
+	var buf bytes.Buffer
+	if _, err := mbench(&buf).Execute(st); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"func BenchmarkTMarshal(b *testing.B) {",
+		"func BenchmarkTUnmarshal(b *testing.B) {",
+		"protocol.RandomizeObject(&T{})",
+		"b.SetBytes(int64(len(bts)))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated benchmarks:\n%s", want, out)
+		}
+	}
+
+	// benchmarks are written with the tests
+	var code, tests bytes.Buffer
+	p := NewPrinter(Marshal|Unmarshal|Size|Bench, &Topics{}, &code, &tests)
+	if _, err := p.Print(st); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(tests.String(), "func BenchmarkTMarshal(") || strings.Contains(tests.String(), "func TestMarshalUnmarshalT(") {
+		t.Errorf("unexpected tests for the Bench method:\n%s", tests.String())
+	}
+}
@@ -1,6 +1,7 @@
 package gen
 
 import (
+	"fmt"
 	"go/ast"
 	"io"
 	"strconv"
@@ -21,10 +22,27 @@ type unmarshalGen struct {
 	ctx      *Context
 	msgs     []string
 	topics   *Topics
+	exact    bool // also print UnmarshalMsgExact
+	canon    bool // also print UnmarshalMsgCanonical
+	reset    bool // Reset methods are printed too
+	arena    bool // also print UnmarshalMsgArena
+	framed   bool // also print UnmarshalFramed
+	ptrvar   bool // the next struct's Varname is a pointer to it
+
+	// the named types whose methods are generated along
+	// with these, which have UnmarshalMsgWithBudget
+	identities map[string]Elem
 }
 
 func (u *unmarshalGen) Method() Method { return Unmarshal }
 
+// generates returns whether the methods of the named type
+// are generated along with those that u prints
+func (u *unmarshalGen) generates(name string) bool {
+	e, ok := u.identities[name]
+	return ok && SkipReason(e) == "" && !IsDangling(e)
+}
+
 func (u *unmarshalGen) needsField() {
 	if u.hasfield {
 		return
@@ -43,6 +61,9 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 	if p == nil {
 		return u.msgs, nil
 	}
+	if u.canon && hasFixedInt(p) {
+		return nil, fmt.Errorf("%s: UnmarshalMsgCanonical can't decode the integers of its int= tag options, since msgp.IsCanonical rejects their fixed width", p.TypeName())
+	}
 
 	// We might change p.Varname in methodReceiver(); make a copy
 	// to not affect other code that will use p.
@@ -50,6 +71,10 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 
 	u.ctx = &Context{}
 
+	if pooled(p) {
+		u.printPool(p.TypeName())
+	}
+
 	u.p.comment("UnmarshalMsg implements msgp.Unmarshaler")
 
 	if IsDangling(p) {
@@ -64,6 +89,10 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 		u.p.printf("\n  return ((*(%s))(%s)).UnmarshalValidateMsg(bts)", baseType, c)
 		u.p.printf("\n}")
 
+		u.p.printf("\nfunc (%s %s) UnmarshalMsgWithBudget(bts []byte, budget *msgp.Budget) ([]byte, error) {", c, methodRecv)
+		u.p.printf("\n  return ((*(%s))(%s)).UnmarshalMsgWithBudget(bts, budget)", baseType, c)
+		u.p.printf("\n}")
+
 		u.p.printf("\nfunc (_ %[2]s) CanUnmarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
 		u.p.printf("\n  _, ok := (%s).(%s)", c, methodRecv)
 		u.p.printf("\n  return ok")
@@ -71,7 +100,12 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 
 		u.topics.Add(methodRecv, "UnmarshalMsg")
 		u.topics.Add(methodRecv, "UnmarshalValidateMsg")
+		u.topics.Add(methodRecv, "UnmarshalMsgWithBudget")
 		u.topics.Add(methodRecv, "CanUnmarshalMsg")
+		u.printExact(c, methodRecv)
+		u.printCanonical(c, methodRecv)
+		u.printArena(c, methodRecv, p.TypeName())
+		u.printFramed(c, methodRecv, p)
 
 		return u.msgs, u.p.err
 	}
@@ -80,8 +114,12 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 	c := p.Varname()
 	methodRecv := methodReceiver(p)
 
-	u.p.printf("\nfunc (%s %s) unmarshalMsg(bts []byte, validate bool) (o []byte, err error) {", c, methodRecv)
+	u.p.printf("\nfunc (%s %s) unmarshalMsg(bts []byte, validate bool, budget *msgp.Budget) (o []byte, err error) {", c, methodRecv)
+	if limit := p.MaxTotalBytes(); limit != "" && limit != "-" {
+		u.p.printf("\nbudget = budget.Limit(bts, %s)", limit)
+	}
 	next(u, p)
+	u.p.print("\nif err = budget.Spend(bts, 0); err != nil {\nreturn\n}")
 	u.p.print("\no = bts")
 
 	// right before the return: attempt to inspect well formed:
@@ -97,11 +135,16 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 	u.p.nakedReturn()
 
 	u.p.printf("\nfunc (%s %s) UnmarshalMsg(bts []byte) (o []byte, err error) {", c, methodRecv)
-	u.p.printf("\n return %s.unmarshalMsg(bts, false)", c)
+	u.p.printf("\n return %s.unmarshalMsg(bts, false, nil)", c)
 	u.p.printf("\n}")
 
 	u.p.printf("\nfunc (%s %s) UnmarshalValidateMsg(bts []byte) (o []byte, err error) {", c, methodRecv)
-	u.p.printf("\n return %s.unmarshalMsg(bts, true)", c)
+	u.p.printf("\n return %s.unmarshalMsg(bts, true, nil)", c)
+	u.p.printf("\n}")
+
+	u.p.comment("UnmarshalMsgWithBudget is like UnmarshalMsg, but counts the bytes it consumes and allocates against budget")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgWithBudget(bts []byte, budget *msgp.Budget) (o []byte, err error) {", c, methodRecv)
+	u.p.printf("\n return %s.unmarshalMsg(bts, false, budget)", c)
 	u.p.printf("\n}")
 
 	u.p.printf("\nfunc (_ %[2]s) CanUnmarshalMsg(%[1]s interface{}) bool {", c, methodRecv)
@@ -111,11 +154,178 @@ func (u *unmarshalGen) Execute(p Elem) ([]string, error) {
 
 	u.topics.Add(methodRecv, "UnmarshalMsg")
 	u.topics.Add(methodRecv, "UnmarshalValidateMsg")
+	u.topics.Add(methodRecv, "UnmarshalMsgWithBudget")
 	u.topics.Add(methodRecv, "CanUnmarshalMsg")
+	u.printExact(c, methodRecv)
+	u.printCanonical(c, methodRecv)
+	u.printArena(c, methodRecv, p.TypeName())
+	u.printFramed(c, methodRecv, p)
+	if st, ok := p.(*Struct); ok && st.presenceExpr() != "" {
+		u.printPresence(c, methodRecv, st)
+	}
 
 	return u.msgs, u.p.err
 }
 
+// printPresence prints the struct of bools that the
+// msgp:presence field of st is, and WhichPresent.
+func (u *unmarshalGen) printPresence(c string, methodRecv string, st *Struct) {
+	name := st.TypeName()
+	u.p.comment(fmt.Sprintf("%[1]sPresent records which of the omitempty fields of %[1]s the message it was decoded from had", name))
+	u.p.printf("\ntype %sPresent struct {", name)
+	for _, sf := range st.presenceFields() {
+		u.p.printf("\n%s bool", sf.FieldName)
+	}
+	u.p.printf("\n}\n")
+	u.p.comment(fmt.Sprintf("WhichPresent returns which of the omitempty fields of %s the message it was last decoded from had,", c))
+	u.p.comment("telling a field that was absent from one that was present with its zero value")
+	u.p.printf("\nfunc (%s %s) WhichPresent() %sPresent {", c, methodRecv, name)
+	u.p.printf("\n  return %s.%s", c, st.Presence)
+	u.p.printf("\n}")
+	u.topics.Add(methodRecv, "WhichPresent")
+}
+
+// present records that sf of s was decoded, if s has
+// a msgp:presence field that records it
+func (u *unmarshalGen) present(s *Struct, sf StructField) {
+	pe := s.presenceExpr()
+	if pe == "" {
+		return
+	}
+	for _, f := range s.presenceFields() {
+		if f.FieldName == sf.FieldName {
+			u.p.printf("\n%s.%s = true", pe, sf.FieldName)
+		}
+	}
+}
+
+// printPool prints the pool of a msgp:pool type, from
+// which pointers to it are allocated when unmarshaling,
+// and the functions that get and put values.
+func (u *unmarshalGen) printPool(name string) {
+	u.p.printf("\nvar pool%[1]s = sync.Pool{New: func() interface{} { return new(%[1]s) }}\n", name)
+
+	u.p.comment(fmt.Sprintf("Get%[1]s returns a *%[1]s from the pool of %[1]s, which UnmarshalMsg uses for nil *%[1]s", name))
+	u.p.comment(fmt.Sprintf("values, and Reset returns them to. Get%[1]s and Put%[1]s are safe for concurrent use.", name))
+	u.p.printf("\nfunc Get%[1]s() *%[1]s {", name)
+	u.p.printf("\n  return pool%s.Get().(*%s)", name, name)
+	u.p.printf("\n}\n")
+
+	u.p.comment(fmt.Sprintf("Put%[1]s returns z to the pool of %[1]s. After Put%[1]s, or the Reset of a value holding", name))
+	u.p.comment("z, nothing may use z, or keep a reference to any slice or map within it.")
+	u.p.printf("\nfunc Put%[1]s(z *%[1]s) {", name)
+	if u.reset {
+		u.p.printf("\n  z.Reset()")
+	} else {
+		u.p.printf("\n  *z = %s{}", name)
+	}
+	u.p.printf("\n  pool%s.Put(z)", name)
+	u.p.printf("\n}\n")
+
+	u.topics.Add(name, "Get"+name)
+	u.topics.Add(name, "Put"+name)
+}
+
+// printExact prints UnmarshalMsgExact, which rejects
+// any bytes left over after the message, if enabled.
+func (u *unmarshalGen) printExact(c string, methodRecv string) {
+	if !u.exact {
+		return
+	}
+	u.p.comment("UnmarshalMsgExact is like UnmarshalMsg, but returns an error if the message does not occupy all of bts")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgExact(bts []byte) error {", c, methodRecv)
+	u.p.printf("\n  o, err := %s.UnmarshalMsg(bts)", c)
+	u.p.printf("\n  if err != nil {\n  return err\n  }")
+	u.p.printf("\n  if len(o) > 0 {\n  return &msgp.ErrTrailingBytes{Count: len(o)}\n  }")
+	u.p.printf("\n  return nil")
+	u.p.printf("\n}")
+	u.topics.Add(methodRecv, "UnmarshalMsgExact")
+}
+
+// printArena prints UnmarshalMsgArena, which decodes slices
+// and []byte values into storage from an Arena, if enabled.
+func (u *unmarshalGen) printArena(c string, methodRecv string, typ string) {
+	if !u.arena {
+		return
+	}
+	u.p.comment("UnmarshalMsgArena is like UnmarshalMsg, but makes the slices and []byte values of z from a, and first")
+	u.p.comment("zeroes z, whose storage may be from an Arena that has since been Reset")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgArena(bts []byte, a *msgp.Arena) (o []byte, err error) {", c, methodRecv)
+	u.p.printf("\n  var zero %s", typ)
+	u.p.printf("\n  *%s = zero", c)
+	u.p.printf("\n  return %s.UnmarshalMsgWithBudget(bts, a.Budget())", c)
+	u.p.printf("\n}")
+	u.topics.Add(methodRecv, "UnmarshalMsgArena")
+}
+
+// printFramed prints UnmarshalFramed, which decodes the
+// payload of a frame that MarshalFramed writes, if enabled.
+// The frame is rejected before decoding if it is longer than
+// the maxtotalbytes limit of the type.
+func (u *unmarshalGen) printFramed(c string, methodRecv string, p Elem) {
+	if !u.framed {
+		return
+	}
+	limit := p.MaxTotalBytes()
+	if limit == "" || limit == "-" {
+		limit = "len(bts)"
+	}
+	u.p.comment("UnmarshalFramed decodes " + c + " from the payload of the frame at the start of bts, as written by")
+	u.p.comment("MarshalFramed, and returns the bytes after the frame")
+	u.p.printf("\nfunc (%s %s) UnmarshalFramed(bts []byte) (o []byte, err error) {", c, methodRecv)
+	u.p.printf("\n  var data []byte")
+	u.p.printf("\n  data, o, err = msgp.ReadFrameBytes(bts, %s)", limit)
+	u.p.printf("\n  if err != nil {\n  return\n  }")
+	u.p.printf("\n  if data, err = %s.UnmarshalMsg(data); err != nil {\n  return bts, err\n  }", c)
+	u.p.printf("\n  if len(data) > 0 {\n  return bts, &msgp.ErrTrailingBytes{Count: len(data)}\n  }")
+	u.p.printf("\n  return")
+	u.p.printf("\n}")
+	u.topics.Add(methodRecv, "UnmarshalFramed")
+}
+
+// hasFixedInt returns whether e has an integer that is
+// encoded in a fixed width
+func hasFixedInt(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		for i := range e.Fields {
+			if hasFixedInt(e.Fields[i].FieldElem) {
+				return true
+			}
+		}
+	case *Ptr:
+		return hasFixedInt(e.Value)
+	case *Array:
+		return hasFixedInt(e.Els)
+	case *Slice:
+		return hasFixedInt(e.Els)
+	case *Map:
+		return hasFixedInt(e.Key) || hasFixedInt(e.Value)
+	case *BaseElem:
+		return e.FixedInt != 0
+	}
+	return false
+}
+
+// printCanonical prints UnmarshalMsgCanonical, which rejects
+// messages that aren't in canonical form, if enabled.
+func (u *unmarshalGen) printCanonical(c string, methodRecv string) {
+	if !u.canon {
+		return
+	}
+	u.p.comment("UnmarshalMsgCanonical is like UnmarshalValidateMsg, but also returns an error if the message is not in")
+	u.p.comment("the canonical form that MarshalMsg writes, as checked by msgp.IsCanonical")
+	u.p.printf("\nfunc (%s %s) UnmarshalMsgCanonical(bts []byte) (o []byte, err error) {", c, methodRecv)
+	u.p.printf("\n  o, err = %s.UnmarshalValidateMsg(bts)", c)
+	u.p.printf("\n  if err != nil {\n  return\n  }")
+	u.p.printf("\n  if ok, err := msgp.IsCanonical(bts[:len(bts)-len(o)]); !ok {")
+	u.p.printf("\n  if err == nil {\n  err = &msgp.ErrNonCanonical{}\n  }")
+	u.p.printf("\n  return bts, err\n  }")
+	u.p.printf("\n  return")
+	u.p.printf("\n}")
+	u.topics.Add(methodRecv, "UnmarshalMsgCanonical")
+}
+
 // does assignment to the variable "name" with the type "base"
 func (u *unmarshalGen) assignAndCheck(name string, isnil string, base string) {
 	if !u.p.ok() {
@@ -125,14 +335,45 @@ func (u *unmarshalGen) assignAndCheck(name string, isnil string, base string) {
 	u.p.wrapErrCheck(u.ctx.ArgsStr())
 }
 
+// assignAndCheckMax is like assignAndCheck, but the size is
+// bounded by the first allocbound of e, if it has one, with
+// msgp.ReadArrayHeaderBytesMax or msgp.ReadMapHeaderBytesMax
+func (u *unmarshalGen) assignAndCheckMax(name string, isnil string, base string, e Elem) {
+	allocbound := strings.Split(e.AllocBound(), ",")[0]
+	if allocbound == "" || allocbound == "-" {
+		u.assignAndCheck(name, isnil, base)
+		return
+	}
+	if !u.p.ok() {
+		return
+	}
+	u.p.printf("\n%s, %s, bts, err = msgp.Read%sBytesMax(bts, uint64(%s))", name, isnil, base, allocbound)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+}
+
+// rejectNil prints a check that, when validating, rejects
+// a 'nil' in place of e if it collapses nil values, which
+// are never encoded as 'nil'
+func (u *unmarshalGen) rejectNil(e Elem, isnil string) {
+	if !collapsesNil(e) {
+		return
+	}
+	u.p.printf("\nif validate && %s {", isnil)
+	u.p.print("\nerr = &msgp.ErrNonCanonical{}")
+	u.p.print("\nreturn")
+	u.p.print("\n}")
+}
+
 func (u *unmarshalGen) gStruct(s *Struct) {
 	if !u.p.ok() {
 		return
 	}
+	ptrvar := u.ptrvar
+	u.ptrvar = false
 	if s.AsTuple {
 		u.tuple(s)
 	} else {
-		u.mapstruct(s)
+		u.mapstruct(s, ptrvar)
 	}
 	return
 }
@@ -143,6 +384,10 @@ func (u *unmarshalGen) tuple(s *Struct) {
 	sz := randIdent()
 	u.p.declare(sz, "int")
 	u.assignAndCheck(sz, "_", arrayHeader)
+	if s.versioned() {
+		u.versionedTuple(s, sz)
+		return
+	}
 	u.p.arrayCheck(strconv.Itoa(len(s.Fields)), sz)
 	for i := range s.Fields {
 		if !u.p.ok() {
@@ -154,7 +399,48 @@ func (u *unmarshalGen) tuple(s *Struct) {
 	}
 }
 
-func (u *unmarshalGen) mapstruct(s *Struct) {
+// versionedTuple prints the decoding of a tuple of sz elements
+// with fields that are present only since some version: the
+// fields up to the version, which precedes them, are always
+// present, and the size is checked against the version once
+// it is read.
+func (u *unmarshalGen) versionedTuple(s *Struct, sz string) {
+	var absent []string
+	for _, sf := range s.Fields {
+		if a := s.absentExpr(sf); a != "" {
+			absent = append(absent, a)
+		}
+	}
+	max := len(s.Fields)
+	u.p.printf("\nif %[1]s < %[2]d || %[1]s > %[3]d { err = msgp.ArrayError{Wanted: %[3]d, Got: %[1]s}; return }", sz, max-len(absent), max)
+	checked := false
+	for _, sf := range s.Fields {
+		if !u.p.ok() {
+			return
+		}
+		a := s.absentExpr(sf)
+		if a != "" {
+			u.p.printf("\nif !(%s) {", a)
+		}
+		u.ctx.PushString(sf.FieldName)
+		next(u, sf.FieldElem)
+		u.ctx.Pop()
+		if a != "" {
+			u.p.closeblock()
+		}
+		if !checked && sf.FieldName == s.versionField() {
+			checked = true
+			want := randIdent()
+			u.p.printf("\n%s := %d", want, max)
+			for _, a := range absent {
+				u.p.printf("\nif %s {\n%s--\n}", a, want)
+			}
+			u.p.arrayCheck(want, sz)
+		}
+	}
+}
+
+func (u *unmarshalGen) mapstruct(s *Struct, ptrvar bool) {
 	u.needsField()
 	sz := randIdent()
 	isnil := randIdent()
@@ -165,6 +451,9 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.p.declare(lastIsSet, "bool")
 	u.p.declare(isnil, "bool")
 	u.p.printf("\n_=%s;\n_=%s", last, lastIsSet) // we might not use these for empty structs
+	if pe := s.presenceExpr(); pe != "" {
+		u.p.printf("\n%s = %sPresent{}", pe, s.TypeName())
+	}
 
 	// go-codec compat: decode an array as sequential elements from this struct,
 	// in the order they are defined in the Go type (as opposed to canonical
@@ -185,11 +474,16 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 			continue
 		}
 
-		u.p.printf("\nif %s > 0 {", sz)
+		if a := s.absentExpr(s.Fields[i]); a != "" {
+			u.p.printf("\nif %s > 0 && !(%s) {", sz, a)
+		} else {
+			u.p.printf("\nif %s > 0 {", sz)
+		}
 		u.p.printf("\n%s--", sz)
 		u.ctx.PushString(s.Fields[i].FieldName)
 		next(u, s.Fields[i].FieldElem)
 		u.ctx.Pop()
+		u.present(s, s.Fields[i])
 		u.p.printf("\n}")
 	}
 
@@ -203,9 +497,24 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 	u.p.wrapErrCheck(u.ctx.ArgsStr())
 
 	u.p.printf("\nif %s {", isnil)
-	u.p.printf("\n  %s = %s{}", s.Varname(), s.TypeName())
+	if ptrvar {
+		u.p.printf("\n  *%s = %s{}", s.Varname(), s.TypeName())
+	} else {
+		u.p.printf("\n  %s = %s{}", s.Varname(), s.TypeName())
+	}
 	u.p.printf("\n}")
 
+	// the fields present only since some version are checked
+	// against it once the map is read, since its key may sort
+	// after theirs
+	seen := make(map[string]string)
+	for _, sf := range s.Fields {
+		if ast.IsExported(sf.FieldName) && sf.Version != "" {
+			seen[sf.FieldName] = randIdent()
+			u.p.declare(seen[sf.FieldName], "bool")
+		}
+	}
+
 	u.p.printf("\nfor %s > 0 {", sz)
 	u.p.printf("\n%s--; field, bts, err = msgp.ReadMapKeyZC(bts)", sz)
 	u.p.wrapErrCheck(u.ctx.ArgsStr())
@@ -227,12 +536,34 @@ func (u *unmarshalGen) mapstruct(s *Struct) {
 		next(u, s.Fields[i].FieldElem)
 		u.ctx.Pop()
 		u.p.printf("\n%s = \"%s\"", last, s.Fields[i].FieldTag)
+		u.present(s, s.Fields[i])
+		if v, ok := seen[s.Fields[i].FieldName]; ok {
+			u.p.printf("\n%s = true", v)
+		}
+	}
+	if uf := s.unknownExpr(); uf != "" {
+		u.p.printf("\ndefault:\nif validate && %s && string(field) < %s {", lastIsSet, last)
+		u.p.print("\nerr = &msgp.ErrNonCanonical{}")
+		u.p.printf("\nreturn")
+		u.p.print("\n}")
+		u.p.printf("\nbts, err = msgp.ReadUnknownBytes(bts, field, &%s, budget)", uf)
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\n%s = string(field)", last)
+	} else {
+		u.p.print("\ndefault:\nerr = msgp.ErrNoField(string(field))")
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
 	}
-	u.p.print("\ndefault:\nerr = msgp.ErrNoField(string(field))")
-	u.p.wrapErrCheck(u.ctx.ArgsStr())
 	u.p.print("\n}") // close switch
 	u.p.printf("\n%s = true", lastIsSet)
 	u.p.print("\n}") // close for loop
+	for _, sf := range s.Fields {
+		if v, ok := seen[sf.FieldName]; ok {
+			u.p.printf("\nif %s && %s {", v, s.absentExpr(sf))
+			u.p.printf("\nerr = msgp.ErrVersionField(%q, %s, %s)", sf.FieldTag, s.versionExpr(sf), sf.Since)
+			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			u.p.print("\n}")
+		}
+	}
 	u.p.print("\n}") // close else statement for array decode
 }
 
@@ -240,6 +571,10 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 	if !u.p.ok() {
 		return
 	}
+	if b.Enum != nil {
+		u.gEnum(b)
+		return
+	}
 
 	refname := b.Varname() // assigned to
 	lowered := b.Varname() // passed as argument
@@ -252,6 +587,7 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 
 	switch b.Value {
 	case Bytes:
+		u.rejectNil(b, "msgp.IsNil(bts)")
 		if b.common.AllocBound() != "" {
 			sz := randIdent()
 			u.p.printf("\nvar %s int", sz)
@@ -262,11 +598,60 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 			u.p.printf("\nreturn")
 			u.p.printf("\n}")
 		}
-		u.p.printf("\n%s, bts, err = msgp.ReadBytesBytes(bts, %s)", refname, lowered)
+		if b.ZeroCopy {
+			// nothing is allocated, so only the
+			// bytes consumed count against the budget
+			u.p.printf("\n%s, bts, err = msgp.ReadBytesZC(bts)", refname)
+			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			u.p.print("\nerr = budget.Spend(bts, 0)")
+			break
+		}
+		if u.arena {
+			u.p.printf("\n%s, bts, err = msgp.ReadBytesArena(bts, %s, budget)", refname, lowered)
+		} else {
+			u.p.printf("\n%s, bts, err = msgp.ReadBytesBytes(bts, %s)", refname, lowered)
+		}
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\nerr = budget.Spend(bts, len(%s))", refname)
+	case NullString:
+		if b.common.AllocBound() != "" {
+			u.p.printf("\n%s, bts, err = msgp.ReadNullStringBytesMax(bts, %s)", refname, b.common.AllocBound())
+		} else {
+			u.p.printf("\n%s, bts, err = msgp.ReadNullStringBytes(bts)", refname)
+		}
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\nerr = budget.Spend(bts, len(%s))", nullField(refname, "String"))
 	case Ext:
 		u.p.printf("\nbts, err = msgp.ReadExtensionBytes(bts, %s)", lowered)
+	case BigInt:
+		if b.common.AllocBound() != "" {
+			u.p.printf("\nbts, err = msgp.ReadBigIntBytesMax(bts, %s, %s)", lowered, b.common.AllocBound())
+		} else {
+			u.p.printf("\nbts, err = msgp.ReadBigIntBytes(bts, %s)", lowered)
+		}
+	case Text:
+		if b.common.AllocBound() != "" {
+			u.p.printf("\nbts, err = msgp.ReadTextBytesMax(bts, %s, %s)", lowered, b.common.AllocBound())
+		} else {
+			u.p.printf("\nbts, err = msgp.ReadTextBytes(bts, %s)", lowered)
+		}
+	case Iface:
+		u.p.printf("\nbts, err = msgp.ReadIfaceBytes(bts, &%s, budget)", lowered)
 	case IDENT:
-		u.p.printf("\nbts, err = %s.UnmarshalMsg(bts)", lowered)
+		if b.TypeName() == "msgp.Raw" {
+			// the copy counts against the budget, as a []byte does
+			u.p.printf("\n%s, bts, err = msgp.ReadRawBytes(bts, %s)", lowered, lowered)
+			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			u.p.printf("\nerr = budget.Spend(bts, len(%s))", lowered)
+		} else if b.Resolved() {
+			u.p.printf("\nbts, err = %s.UnmarshalMsg(bts)", lowered)
+		} else if u.generates(b.identType()) {
+			u.p.printf("\nbts, err = %s.UnmarshalMsgWithBudget(bts, budget)", b.identExpr(lowered))
+		} else {
+			// the type may have methods of its own, or of
+			// an older msgp, without UnmarshalMsgWithBudget
+			u.p.printf("\nbts, err = msgp.UnmarshalWithBudget(%s, bts, budget)", b.identPtr(lowered))
+		}
 	case String:
 		if b.common.AllocBound() != "" {
 			sz := randIdent()
@@ -278,7 +663,13 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 			u.p.printf("\nreturn")
 			u.p.printf("\n}")
 		}
-		u.p.printf("\n%s, bts, err = msgp.ReadStringBytes(bts)", refname)
+		if b.UTF8 {
+			u.p.printf("\n%s, bts, err = msgp.ReadUTF8StringBytes(bts)", refname)
+		} else {
+			u.p.printf("\n%s, bts, err = msgp.ReadStringBytes(bts)", refname)
+		}
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+		u.p.printf("\nerr = budget.Spend(bts, len(%s))", refname)
 	default:
 		u.p.printf("\n%s, bts, err = msgp.Read%sBytes(bts)", refname, b.BaseName())
 	}
@@ -290,12 +681,42 @@ func (u *unmarshalGen) gBase(b *BaseElem) {
 			u.p.printf("\n%s = %s(%s)\n", b.Varname(), b.FromBase(), refname)
 		} else {
 			u.p.printf("\n%s, err = %s(%s)", b.Varname(), b.FromBase(), refname)
-			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			u.p.wrapErrCheck(convertCtx(u.ctx, b, refname))
 		}
 		u.p.printf("}")
 	}
 }
 
+// gEnum decodes the enum b from the name of one of its values,
+// or from a number; UnmarshalValidateMsg rejects the numbers
+// of values that have names, which MarshalMsg doesn't write
+func (u *unmarshalGen) gEnum(b *BaseElem) {
+	name := randIdent()
+	u.p.print("\nif msgp.NextType(bts) == msgp.StrType {")
+	u.p.printf("\nvar %s []byte", name)
+	u.p.printf("\n%s, bts, err = msgp.ReadStringZC(bts)", name)
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.printf("\nswitch string(%s) {", name)
+	for _, n := range b.Enum.Names {
+		u.p.printf("\ncase %q:\n%s = %s", n, b.Varname(), n)
+	}
+	u.p.print("\ndefault:")
+	if b.Enum.Tolerant {
+		u.p.print("\nif validate {\nerr = &msgp.ErrNonCanonical{}\nreturn\n}")
+		u.p.printf("\n%s = 0", b.Varname())
+	} else {
+		u.p.printf("\nerr = &msgp.ErrUnknownEnum{Type: %q, Name: string(%s)}", b.TypeName(), name)
+		u.p.wrapErrCheck(u.ctx.ArgsStr())
+	}
+	u.p.print("\n}\n} else {")
+	num := *b
+	num.Enum = nil
+	u.gBase(&num)
+	u.p.printf("\nif validate {\nswitch %s {\ncase %s:", b.Varname(), strings.Join(b.Enum.Names, ", "))
+	u.p.print("\nerr = &msgp.ErrNonCanonical{}\nreturn\n}\n}")
+	u.p.closeblock()
+}
+
 func (u *unmarshalGen) gArray(a *Array) {
 	if !u.p.ok() {
 		return
@@ -303,7 +724,7 @@ func (u *unmarshalGen) gArray(a *Array) {
 
 	// special case for [const]byte objects
 	// see decode.go for symmetry
-	if be, ok := a.Els.(*BaseElem); ok && be.Value == Byte {
+	if isByte(a.Els) {
 		u.p.printf("\nbts, err = msgp.ReadExactBytes(bts, (%s)[:])", a.Varname())
 		u.p.wrapErrCheck(u.ctx.ArgsStr())
 		return
@@ -329,15 +750,32 @@ func (u *unmarshalGen) gSlice(s *Slice) {
 	isnil := randIdent()
 	u.p.declare(sz, "int")
 	u.p.declare(isnil, "bool")
-	u.assignAndCheck(sz, isnil, arrayHeader)
-	resizemsgs := u.p.resizeSlice(sz, isnil, s, u.ctx.ArgsStr())
+	u.assignAndCheckMax(sz, isnil, arrayHeader, s)
+	u.rejectNil(s, isnil)
+	resizemsgs := u.p.resizeSlice(sz, isnil, s, u.ctx.ArgsStr(), u.arena)
 	u.msgs = append(u.msgs, resizemsgs...)
 	childElement := s.Els
 	if s.Els.AllocBound() == "" && len(strings.Split(s.AllocBound(), ",")) > 1 {
 		childElement = s.Els.Copy()
 		childElement.SetAllocBound(s.AllocBound()[strings.Index(s.AllocBound(), ",")+1:])
 	}
+
+	// slices of plain fixed-width numbers are read in one call
+	if be, ok := childElement.(*BaseElem); ok && !be.Convert {
+		switch be.Value {
+		case Int64, Uint64, Float64:
+			u.p.printf("\nbts, err = msgp.Read%sSliceBytes(bts, %s)", be.BaseName(), s.Varname())
+			u.p.wrapErrCheck(u.ctx.ArgsStr())
+			if s.SortSlice {
+				u.p.checkSorted(s)
+			}
+			return
+		}
+	}
 	u.p.rangeBlock(u.ctx, s.Index, s.Varname(), u, childElement)
+	if s.SortSlice {
+		u.p.checkSorted(s)
+	}
 }
 
 func (u *unmarshalGen) gMap(m *Map) {
@@ -348,7 +786,8 @@ func (u *unmarshalGen) gMap(m *Map) {
 	isnil := randIdent()
 	u.p.declare(sz, "int")
 	u.p.declare(isnil, "bool")
-	u.assignAndCheck(sz, isnil, mapHeader)
+	u.assignAndCheckMax(sz, isnil, m.header(), m)
+	u.rejectNil(m, isnil)
 
 	// allocate or clear map
 	resizemsgs := u.p.resizeMap(sz, isnil, m, u.ctx.ArgsStr())
@@ -369,6 +808,16 @@ func (u *unmarshalGen) gMap(m *Map) {
 		u.p.printf("\nerr = &msgp.ErrNonCanonical{}")
 		u.p.printf("\nreturn")
 		u.p.printf("\n}")
+	} else if isStringKey(m.Key) {
+		u.p.printf("\nif %s && %s.String() < %s.String() {", lastSet, m.Keyidx, last)
+		u.p.printf("\nerr = &msgp.ErrNonCanonical{}")
+		u.p.printf("\nreturn")
+		u.p.printf("\n}")
+	} else if isOrderedKey(m.Key) {
+		u.p.printf("\nif %s && %s < %s {", lastSet, m.Keyidx, last)
+		u.p.printf("\nerr = &msgp.ErrNonCanonical{}")
+		u.p.printf("\nreturn")
+		u.p.printf("\n}")
 	} else {
 		u.p.printf("\nerr = &msgp.ErrMissingLessFn{}")
 		u.p.printf("\nreturn")
@@ -376,16 +825,21 @@ func (u *unmarshalGen) gMap(m *Map) {
 	u.p.printf("\n}") // close if validate block
 	u.p.printf("\n%s=%s", last, m.Keyidx)
 	u.p.printf("\n%s=true", lastSet)
-	u.ctx.PushVar(m.Keyidx)
-	next(u, m.Value)
-	u.ctx.Pop()
+	if !m.IsSet() {
+		u.ctx.PushVar(m.Keyidx)
+		next(u, m.Value)
+		u.ctx.Pop()
+	}
 	u.p.mapAssign(m)
 	u.p.closeblock()
 }
 
 func (u *unmarshalGen) gPtr(p *Ptr) {
-	u.p.printf("\nif msgp.IsNil(bts) { bts, err = msgp.ReadNilBytes(bts); if err != nil { return }; %s = nil; } else { ", p.Varname())
+	u.p.print("\nif msgp.IsNil(bts) {\nbts, err = msgp.ReadNilBytes(bts)")
+	u.p.wrapErrCheck(u.ctx.ArgsStr())
+	u.p.printf("\n%s = nil\n} else {", p.Varname())
 	u.p.initPtr(p)
+	_, u.ptrvar = p.Value.(*Struct)
 	next(u, p.Value)
 	u.p.closeblock()
 }
@@ -0,0 +1,466 @@
+package gen
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func unmarshalGenerator(w *bytes.Buffer, topics *Topics) generator { return unmarshal(w, topics) }
+
+func TestUnmarshalBigInt(t *testing.T) {
+	bounded := &Ptr{Value: Ident("", "big.Int")}
+	bounded.SetAllocBound("32")
+	st := testStruct("BI", "",
+		testField("V", "v", Ident("", "big.Int")),
+		testField("P", "p", bounded),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+
+	for _, want := range []string{
+		"bts, err = msgp.ReadBigIntBytes(bts, &(*z).V)",
+		"(*z).P = new(big.Int)",
+		"bts, err = msgp.ReadBigIntBytesMax(bts, (*z).P, 32)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnmarshalMsgExact(t *testing.T) {
+	st := testStruct("E", "", testField("A", "a", &BaseElem{Value: Int64}))
+
+	out := generateMethod(t, unmarshalGenerator, st)
+	if strings.Contains(out, "UnmarshalMsgExact") {
+		t.Errorf("UnmarshalMsgExact generated without being requested:\n%s", out)
+	}
+
+	exact := func(w *bytes.Buffer, topics *Topics) generator {
+		u := unmarshal(w, topics)
+		u.exact = true
+		return u
+	}
+	out = generateMethod(t, exact, st)
+	for _, want := range []string{
+		"func (z *E) UnmarshalMsgExact(bts []byte) error {",
+		"return &msgp.ErrTrailingBytes{Count: len(o)}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnmarshalMsgCanonical(t *testing.T) {
+	st := testStruct("C", "", testField("A", "a", &BaseElem{Value: Int64}))
+
+	out := generateMethod(t, unmarshalGenerator, st)
+	if strings.Contains(out, "UnmarshalMsgCanonical") {
+		t.Errorf("UnmarshalMsgCanonical generated without being requested:\n%s", out)
+	}
+
+	canon := func(w *bytes.Buffer, topics *Topics) generator {
+		u := unmarshal(w, topics)
+		u.canon = true
+		return u
+	}
+	out = generateMethod(t, canon, st)
+	for _, want := range []string{
+		"func (z *C) UnmarshalMsgCanonical(bts []byte) (o []byte, err error) {",
+		"o, err = z.UnmarshalValidateMsg(bts)",
+		// only the bytes of the message are checked
+		"msgp.IsCanonical(bts[:len(bts)-len(o)])",
+		"err = &msgp.ErrNonCanonical{}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnmarshalMsgArena(t *testing.T) {
+	items := &Slice{Els: &BaseElem{Value: String}}
+	items.SetAllocBound("8")
+	data := &BaseElem{Value: Bytes}
+	st := testStruct("A", "",
+		testField("Items", "i", items),
+		testField("Data", "d", data),
+	)
+
+	out := generateMethod(t, unmarshalGenerator, st)
+	if strings.Contains(out, "Arena") {
+		t.Errorf("arena decoding generated without being requested:\n%s", out)
+	}
+
+	arena := func(w *bytes.Buffer, topics *Topics) generator {
+		u := unmarshal(w, topics)
+		u.arena = true
+		return u
+	}
+	out = generateMethod(t, arena, st)
+	for _, want := range []string{
+		"func (z *A) UnmarshalMsgArena(bts []byte, a *msgp.Arena) (o []byte, err error) {",
+		"return z.UnmarshalMsgWithBudget(bts, a.Budget())",
+		"(*z).Items = msgp.MakeSlice[string](budget, ",
+		"(*z).Data, bts, err = msgp.ReadBytesArena(bts, (*z).Data, budget)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestFramed(t *testing.T) {
+	st := testStruct("F", "", testField("A", "a", &BaseElem{Value: Int64}))
+
+	out := generateMethod(t, marshalGenerator, st) + generateMethod(t, unmarshalGenerator, st)
+	if strings.Contains(out, "Framed") {
+		t.Errorf("framed methods generated without being requested:\n%s", out)
+	}
+
+	framedMarshal := func(w *bytes.Buffer, topics *Topics) generator {
+		m := marshal(w, topics)
+		m.framed = true
+		return m
+	}
+	framedUnmarshal := func(w *bytes.Buffer, topics *Topics) generator {
+		u := unmarshal(w, topics)
+		u.framed = true
+		return u
+	}
+	out = generateMethod(t, framedMarshal, st) + generateMethod(t, framedUnmarshal, st)
+	for _, want := range []string{
+		"func (z *F) MarshalFramed(b []byte) []byte {",
+		"return msgp.FinishFrame(z.MarshalMsg(msgp.ReserveFrame(b)), start)",
+		"func (z *F) UnmarshalFramed(bts []byte) (o []byte, err error) {",
+		"data, o, err = msgp.ReadFrameBytes(bts, len(bts))",
+		"return bts, &msgp.ErrTrailingBytes{Count: len(data)}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// the frame is checked against the maxtotalbytes of the type
+	st.SetMaxTotalBytes("maxF")
+	out = generateMethod(t, framedUnmarshal, st)
+	if want := "data, o, err = msgp.ReadFrameBytes(bts, maxF)"; !strings.Contains(out, want) {
+		t.Errorf("missing %q in generated code:\n%s", want, out)
+	}
+}
+
+// Unknown keys are always rejected, rather than skipped, so
+// that only messages matching the schema are accepted.
+func TestUnmarshalRejectsUnknownKeys(t *testing.T) {
+	st := testStruct("S", "", testField("A", "a", &BaseElem{Value: Int64}))
+	out := generateMethod(t, unmarshalGenerator, st)
+	if !strings.Contains(out, "err = msgp.ErrNoField(string(field))") {
+		t.Errorf("unknown keys are not rejected:\n%s", out)
+	}
+	if strings.Contains(out, "msgp.Skip(") {
+		t.Errorf("unknown keys are skipped:\n%s", out)
+	}
+}
+
+func TestUnmarshalNumericSlice(t *testing.T) {
+	ints := &Slice{Els: &BaseElem{Value: Int64}}
+	ints.SetAllocBound("8")
+	strs := &Slice{Els: &BaseElem{Value: String}}
+	strs.SetAllocBound("8")
+	st := testStruct("S", "",
+		testField("I", "i", ints),
+		testField("S", "s", strs),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	if !strings.Contains(out, "bts, err = msgp.ReadInt64SliceBytes(bts, (*z).I)") {
+		t.Errorf("int64 slice is not read in bulk:\n%s", out)
+	}
+	if strings.Contains(out, "SliceBytes(bts, (*z).S)") {
+		t.Errorf("string slice is read in bulk:\n%s", out)
+	}
+}
+
+func TestUnmarshalIntegerMapKeys(t *testing.T) {
+	inner := &Struct{Fields: []StructField{
+		{FieldTag: "a", FieldTagParts: []string{"a"}, HasCodecTag: true, FieldName: "A", FieldElem: &BaseElem{Value: Int64}},
+	}}
+	ints := &Map{Key: &BaseElem{Value: Int64}, Value: &BaseElem{Value: String}}
+	ints.SetAllocBound("8")
+	structs := &Map{Key: &BaseElem{Value: Uint32}, Value: inner}
+	structs.SetAllocBound("8")
+	st := testStruct("M", "",
+		testField("I", "i", ints),
+		testField("U", "u", structs),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		"msgp.ReadInt64Bytes(bts)",
+		"msgp.ReadUint32Bytes(bts)",
+		"msgp.ReadStringBytes(bts)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	// keys are validated in numeric order, not by their encoding
+	for _, read := range []string{"ReadInt64Bytes", "ReadUint32Bytes"} {
+		key := regexp.MustCompile(`(za\d+), bts, err = msgp\.` + read).FindStringSubmatch(out)
+		if key == nil || !strings.Contains(out, "&& "+key[1]+" < ") {
+			t.Errorf("%s map keys are not checked for canonical order:\n%s", read, out)
+		}
+	}
+}
+
+func TestUnmarshalText(t *testing.T) {
+	text := &BaseElem{Value: Text}
+	text.Alias("uuid.UUID")
+	bounded := text.Copy()
+	bounded.SetAllocBound("36")
+	st := testStruct("T", "",
+		testField("A", "a", text),
+		testField("B", "b", bounded),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		"bts, err = msgp.ReadTextBytes(bts, &(*z).A)",
+		"bts, err = msgp.ReadTextBytesMax(bts, &(*z).B, 36)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+func TestUnmarshalUTF8(t *testing.T) {
+	name := &BaseElem{Value: String}
+	name.SetUTF8()
+	st := testStruct("N", "",
+		testField("Name", "n", name),
+		testField("Raw", "r", &BaseElem{Value: String}),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		"(*z).Name, bts, err = msgp.ReadUTF8StringBytes(bts)",
+		"(*z).Raw, bts, err = msgp.ReadStringBytes(bts)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if (&BaseElem{Value: Bytes}).SetUTF8() {
+		t.Error("utf8 set on []byte")
+	}
+}
+
+func TestUnmarshalRaw(t *testing.T) {
+	st := testStruct("R", "",
+		testField("Body", "b", Ident("", "msgp.Raw")),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		"(*z).Body, bts, err = msgp.ReadRawBytes(bts, (*z).Body)",
+		"err = budget.Spend(bts, len((*z).Body))",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
+
+// TestUnmarshalSliceReuse checks that slices of every kind of
+// element are resized within their capacity, and only made when
+// it is too small, and that each []byte element is read into
+// the one it replaces.
+func TestUnmarshalSliceReuse(t *testing.T) {
+	slice := func(e Elem) Elem {
+		s := &Slice{Els: e}
+		s.SetAllocBound("8")
+		return s
+	}
+	st := testStruct("S", "",
+		testField("I", "i", slice(&BaseElem{Value: Int64})),
+		testField("B", "b", slice(&BaseElem{Value: Bytes})),
+		testField("P", "p", slice(&Ptr{Value: Ident("", "T")})),
+		testField("T", "t", slice(Ident("", "T"))),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, f := range []string{"I", "B", "P", "T"} {
+		want := fmt.Sprintf(`} else if \(\*z\)\.%[1]s != nil && cap\(\(\*z\)\.%[1]s\) >= (\w+) {\s+\(\*z\)\.%[1]s = \(\(\*z\)\.%[1]s\)\[:(\w+)\]\s+} else {\s+\(\*z\)\.%[1]s = make\(`, f)
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("%s not resized within its capacity:\n%s", f, out)
+		}
+	}
+	if !regexp.MustCompile(`\(\*z\)\.B\[(\w+)\], bts, err = msgp\.ReadBytesBytes\(bts, \(\*z\)\.B\[(\w+)\]\)`).MatchString(out) {
+		t.Errorf("[]byte elements not read into themselves:\n%s", out)
+	}
+}
+
+func TestUnmarshalMaxTotalBytes(t *testing.T) {
+	branches := &Slice{Els: Ident("", "Branch")}
+	branches.SetAllocBound("8")
+	st := testStruct("Tree", "",
+		testField("Branches", "b", branches),
+	)
+	st.SetMaxTotalBytes("1000")
+	// Branch is generated along with Tree
+	withBranch := func(w *bytes.Buffer, topics *Topics) generator {
+		u := unmarshal(w, topics)
+		u.identities = map[string]Elem{"Branch": testStruct("Branch", "", testField("X", "x", &BaseElem{Value: Int64}))}
+		return u
+	}
+	out := generateMethod(t, withBranch, st)
+	for _, want := range []string{
+		"func (z *Tree) unmarshalMsg(bts []byte, validate bool, budget *msgp.Budget) (o []byte, err error) {",
+		"budget = budget.Limit(bts, 1000)",
+		"err = msgp.SpendSlice(budget, bts, (*z).Branches)",
+		".UnmarshalMsgWithBudget(bts, budget)",
+		"if err = budget.Spend(bts, 0); err != nil {",
+		"return z.unmarshalMsg(bts, false, budget)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	// without the directive, the budget is passed down but not limited
+	st.SetMaxTotalBytes("")
+	out = generateMethod(t, unmarshalGenerator, st)
+	if strings.Contains(out, "budget.Limit") {
+		t.Errorf("unlimited type limits its budget:\n%s", out)
+	}
+
+	// a type that may not have UnmarshalMsgWithBudget, such as
+	// one with methods of its own, is decoded through msgp
+	out = generateMethod(t, unmarshalGenerator, st)
+	if want := "bts, err = msgp.UnmarshalWithBudget(&(*z).Branches["; !strings.Contains(out, want) {
+		t.Errorf("missing %q in generated code:\n%s", want, out)
+	}
+}
+
+func TestUnmarshalPool(t *testing.T) {
+	SetPool("Item")
+	t.Cleanup(func() { delete(pools, "Item") })
+
+	item := testStruct("Item", "",
+		testField("A", "a", &BaseElem{Value: Int64}),
+	)
+	items := &Slice{Els: &Ptr{Value: Ident("", "Item")}}
+	items.SetAllocBound("10000")
+	batch := testStruct("Batch", "",
+		testField("Items", "i", items),
+	)
+
+	out := generateMethod(t, unmarshalGenerator, item)
+	for _, want := range []string{
+		"var poolItem = sync.Pool{New: func() interface{} { return new(Item) }}",
+		"func GetItem() *Item {",
+		"func PutItem(z *Item) {",
+		"*z = Item{}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+
+	out = generateMethod(t, unmarshalGenerator, batch)
+	if !strings.Contains(out, "= GetItem()") {
+		t.Errorf("pooled pointer not allocated from the pool:\n%s", out)
+	}
+	if strings.Contains(out, "sync.Pool") {
+		t.Errorf("pool printed for an unpooled type:\n%s", out)
+	}
+
+	out = generateMethod(t, resetGenerator, batch)
+	if !strings.Contains(out, "PutItem(") {
+		t.Errorf("pooled pointer not returned to the pool on Reset:\n%s", out)
+	}
+}
+
+func TestMapStructValues(t *testing.T) {
+	// an inlined struct with an unexported field
+	small := testStruct("Small", "",
+		testField("X", "x", &BaseElem{Value: Int64}),
+		testField("y", "y", &BaseElem{Value: Int64}),
+	)
+	field := func(name string, v Elem) StructField {
+		m := &Map{Key: &BaseElem{Value: String}, Value: v}
+		m.SetAllocBound("16")
+		return testField(name, strings.ToLower(name), m)
+	}
+	st := testStruct("Holder", "",
+		field("V", Ident("", "BigStruct")),
+		field("P", &Ptr{Value: Ident("", "BigStruct")}),
+		field("S", small),
+	)
+
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		// a nil map is allocated
+		`\} else if \(\*z\)\.V == nil \{\s+\(\*z\)\.V = make\(map\[string\]BigStruct, `,
+		`\} else if \(\*z\)\.P == nil \{\s+\(\*z\)\.P = make\(map\[string\]\*BigStruct, `,
+		`\} else if \(\*z\)\.S == nil \{\s+\(\*z\)\.S = make\(map\[string\]Small, `,
+		// each value is decoded into a fresh variable by
+		// address, and then assigned to the map
+		`var za\d+ BigStruct;(?s:.*)bts, err = msgp\.UnmarshalWithBudget\(&za\d+, bts, budget\)(?s:.*)\(\*z\)\.V\[za\d+\] = za\d+\n`,
+		`var za\d+ \*BigStruct;(?s:.*)za\d+ = new\(BigStruct\)(?s:.*)\(\*z\)\.P\[za\d+\] = za\d+\n`,
+		`var za\d+ Small;(?s:.*)za\d+\.X, bts, err = msgp\.ReadInt64Bytes\(bts\)(?s:.*)\(\*z\)\.S\[za\d+\] = za\d+\n`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no match for %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, ".y") {
+		t.Errorf("unexported field decoded:\n%s", out)
+	}
+
+	out = generateMethod(t, marshalGenerator, st)
+	for _, want := range []string{
+		// values are copied out of the map before they're marshaled
+		`za\d+ := \(\*z\)\.V\[za\d+\]`,
+		`za\d+ := \(\*z\)\.P\[za\d+\]`,
+		`za\d+ := \(\*z\)\.S\[za\d+\]`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no match for %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, ".y") {
+		t.Errorf("unexported field encoded:\n%s", out)
+	}
+}
+
+func TestUnmarshalIface(t *testing.T) {
+	shape := &BaseElem{Value: Iface}
+	shape.Alias("Shape")
+	shapes := &Slice{Els: shape.Copy()}
+	shapes.SetAllocBound("8")
+	st := testStruct("I", "",
+		testField("S", "s", shape),
+		testField("L", "l", shapes),
+		testField("A", "a", &Array{Size: "2", Els: shape.Copy()}),
+	)
+	out := generateMethod(t, unmarshalGenerator, st)
+	for _, want := range []string{
+		"bts, err = msgp.ReadIfaceBytes(bts, &(*z).S, budget)",
+		"bts, err = msgp.ReadIfaceBytes(bts, &(*z).L[",
+		"bts, err = msgp.ReadIfaceBytes(bts, &(*z).A[",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	out = generateMethod(t, marshalGenerator, st)
+	for _, want := range []string{
+		"o = msgp.AppendIface(o, (*z).S)",
+		// each element is tagged with its own type
+		"o = msgp.AppendIface(o, (*z).L[",
+		"o = msgp.AppendIface(o, (*z).A[",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package gen
+
+import (
+	"go/ast"
+	"io"
+	"strings"
+)
+
+func validates(w io.Writer, topics *Topics) *validateGen {
+	return &validateGen{
+		p:      printer{w: w},
+		topics: topics,
+	}
+}
+
+// validateGen prints Validate methods, which check a value
+// against the allocbounds that UnmarshalMsg enforces, and
+// against the min and max tags of numeric fields, so that
+// oversized values can be rejected before they are encoded.
+// Like equalGen, it names the values it checks itself, and
+// it keeps the path to the current value for error context.
+type validateGen struct {
+	passes
+	p      printer
+	topics *Topics
+	path   []string // WrapError context of the current value
+}
+
+func (v *validateGen) Method() Method { return Validate }
+
+func (v *validateGen) Apply(dirs []string) error {
+	return nil
+}
+
+func (v *validateGen) Execute(p Elem) ([]string, error) {
+	if !v.p.ok() {
+		return nil, v.p.err
+	}
+	p = v.applyall(p)
+	if p == nil {
+		return nil, nil
+	}
+
+	c := p.Varname()
+	v.p.comment("Validate returns an error if " + c + " exceeds an allocbound or is outside the range of a min or max tag")
+
+	receiver := "*" + p.TypeName()
+	if IsDangling(p) {
+		baseType := p.(*BaseElem).IdentName
+		v.p.printf("\nfunc (%s %s) Validate() error {", c, receiver)
+		v.p.printf("\n  return ((*(%s))(%s)).Validate()", baseType, c)
+		v.p.printf("\n}")
+		v.topics.Add(receiver, "Validate")
+		return nil, v.p.err
+	}
+
+	v.path = nil
+	v.p.printf("\nfunc (%s %s) Validate() error {", c, receiver)
+	v.validate(p, "(*"+c+")")
+	v.p.printf("\nreturn nil\n}\n")
+	v.topics.Add(receiver, "Validate")
+	return nil, v.p.err
+}
+
+// fail prints a return of err, wrapped with the current path, if cond holds
+func (v *validateGen) fail(cond string, err string) {
+	if len(v.path) > 0 {
+		err = "msgp.WrapError(" + err + ", " + strings.Join(v.path, ", ") + ")"
+	}
+	v.p.printf("\nif %s {\nreturn %s\n}", cond, err)
+}
+
+// overflow prints a check that length does not exceed bound
+func (v *validateGen) overflow(length string, bound string) {
+	v.fail(length+" > "+bound, "msgp.ErrOverflow(uint64("+length+"), uint64("+bound+"))")
+}
+
+func (v *validateGen) push(ctx string) { v.path = append(v.path, ctx) }
+func (v *validateGen) pop()            { v.path = v.path[:len(v.path)-1] }
+
+// validate prints checks of the value x of type el
+func (v *validateGen) validate(el Elem, x string) {
+	if !v.p.ok() {
+		return
+	}
+	switch el := el.(type) {
+	case *Struct:
+		for i := range el.Fields {
+			sf := &el.Fields[i]
+			if !ast.IsExported(sf.FieldName) {
+				continue
+			}
+			path := x
+			for _, pathelem := range sf.FieldPath {
+				path += "." + pathelem
+			}
+			path += "." + sf.FieldName
+			v.push(`"` + sf.FieldName + `"`)
+			v.validate(sf.FieldElem, path)
+			if min, ok := sf.TagPartValue("min"); ok {
+				v.fail(path+" < "+min, "msgp.ErrBelowMin("+path+", "+min+")")
+			}
+			if max, ok := sf.TagPartValue("max"); ok {
+				v.fail(path+" > "+max, "msgp.ErrAboveMax("+path+", "+max+")")
+			}
+			v.pop()
+		}
+	case *Ptr:
+		if needsValidate(el.Value) {
+			v.p.printf("\nif %s != nil {", x)
+			v.validate(el.Value, "(*"+x+")")
+			v.p.closeblock()
+		}
+	case *Array:
+		if needsValidate(el.Els) {
+			idx := randIdent()
+			v.p.printf("\nfor %s := range %s {", idx, x)
+			v.push(idx)
+			v.validate(el.Els, x+"["+idx+"]")
+			v.pop()
+			v.p.closeblock()
+		}
+	case *Slice:
+		if bound := firstBound(el.AllocBound()); bound != "" {
+			v.overflow("len("+x+")", bound)
+		}
+		if els := sliceElem(el); needsValidate(els) {
+			idx := randIdent()
+			v.p.printf("\nfor %s := range %s {", idx, x)
+			v.push(idx)
+			v.validate(els, x+"["+idx+"]")
+			v.pop()
+			v.p.closeblock()
+		}
+	case *Map:
+		if bound := firstBound(el.AllocBound()); bound != "" {
+			v.overflow("len("+x+")", bound)
+		}
+		if needsValidate(el.Value) {
+			key, val := randIdent(), randIdent()
+			v.p.printf("\nfor %s, %s := range %s {", key, val, x)
+			v.push(key)
+			v.validate(el.Value, val)
+			v.pop()
+			v.p.closeblock()
+		}
+	case *BaseElem:
+		v.validateBase(el, x)
+	}
+}
+
+func (v *validateGen) validateBase(b *BaseElem, x string) {
+	bound := firstBound(b.AllocBound())
+	switch b.Value {
+	case IDENT:
+		if b.Resolved() {
+			return
+		}
+		err := randIdent()
+		v.p.printf("\nif %s := %s.Validate(); %s != nil {", err, b.identExpr(x), err)
+		if len(v.path) > 0 {
+			v.p.printf("\nreturn msgp.WrapError(%s, %s)", err, strings.Join(v.path, ", "))
+		} else {
+			v.p.printf("\nreturn %s", err)
+		}
+		v.p.closeblock()
+	case String, Bytes:
+		if bound != "" {
+			v.overflow("len("+x+")", bound)
+		}
+	case NullString:
+		if bound != "" {
+			v.overflow("len("+nullField(x, "String")+")", bound)
+		}
+	case BigInt:
+		if bound != "" {
+			v.overflow("msgp.BigIntSize(&"+x+")-msgp.BigIntPrefixSize", bound)
+		}
+	case Text:
+		if bound != "" {
+			v.overflow("msgp.TextSize(&"+x+")-msgp.TextPrefixSize", bound)
+		}
+	}
+}
+
+// firstBound returns the allocbound that applies to
+// a value itself (rather than its elements), or ""
+// if the value is unbounded
+func firstBound(allocbound string) string {
+	bound := strings.Split(allocbound, ",")[0]
+	if bound == "-" {
+		return ""
+	}
+	return bound
+}
+
+// sliceElem returns the element of s, with the
+// remaining allocbounds of s applied to it if
+// it has none of its own
+func sliceElem(s *Slice) Elem {
+	if s.Els.AllocBound() == "" && strings.Contains(s.AllocBound(), ",") {
+		els := s.Els.Copy()
+		els.SetAllocBound(s.AllocBound()[strings.Index(s.AllocBound(), ",")+1:])
+		return els
+	}
+	return s.Els
+}
+
+// needsValidate returns whether values of type e have anything to check
+func needsValidate(e Elem) bool {
+	switch e := e.(type) {
+	case *Struct:
+		for i := range e.Fields {
+			sf := &e.Fields[i]
+			if !ast.IsExported(sf.FieldName) {
+				continue
+			}
+			if needsValidate(sf.FieldElem) {
+				return true
+			}
+			if _, ok := sf.TagPartValue("min"); ok {
+				return true
+			}
+			if _, ok := sf.TagPartValue("max"); ok {
+				return true
+			}
+		}
+		return false
+	case *Ptr:
+		return needsValidate(e.Value)
+	case *Array:
+		return needsValidate(e.Els)
+	case *Slice:
+		return firstBound(e.AllocBound()) != "" || needsValidate(sliceElem(e))
+	case *Map:
+		return firstBound(e.AllocBound()) != "" || needsValidate(e.Value)
+	case *BaseElem:
+		switch e.Value {
+		case IDENT:
+			return !e.Resolved()
+		case String, Bytes, BigInt, Text, NullString:
+			return firstBound(e.AllocBound()) != ""
+		}
+		return false
+	default:
+		return false
+	}
+}
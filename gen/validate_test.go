@@ -0,0 +1,41 @@
+package gen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func validateGenerator(w *bytes.Buffer, topics *Topics) generator { return validates(w, topics) }
+
+func TestValidate(t *testing.T) {
+	str := &BaseElem{Value: String}
+	str.SetAllocBound("32")
+	nested := &Slice{Els: &Slice{Els: &BaseElem{Value: Byte}}}
+	nested.SetAllocBound("16,8")
+	st := testStruct("V", "",
+		testField("N", "n,min=1,max=maxN", &BaseElem{Value: Uint64}),
+		testField("S", "s,allocbound=32", str),
+		testField("L", "l,allocbound=16,8", nested),
+		testField("P", "p", &Ptr{Value: Ident("", "Inner")}),
+		testField("U", "u", &Slice{Els: &BaseElem{Value: Int64}}),
+	)
+	out := generateMethod(t, validateGenerator, st)
+
+	for _, want := range []string{
+		"func (z *V) Validate() error {",
+		`return msgp.WrapError(msgp.ErrBelowMin((*z).N, 1), "N")`,
+		`return msgp.WrapError(msgp.ErrAboveMax((*z).N, maxN), "N")`,
+		`return msgp.WrapError(msgp.ErrOverflow(uint64(len((*z).S)), uint64(32)), "S")`,
+		"if len((*z).L) > 16 {",
+		"uint64(8)), \"L\", ",
+		":= (*(*z).P).Validate();",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in generated code:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "(*z).U") {
+		t.Errorf("unbounded slice of numbers is checked:\n%s", out)
+	}
+}
@@ -152,7 +152,8 @@ func loadVars(tpl *template.Template, tplData interface{}) (vars extractedVars,
 		fmt.Println(tempDir)
 	}
 	tfile := filepath.Join(tempDir, "msg.go")
-	genFile := newFilename(tfile, "")
+	base, suffix := newFilename(tfile, "")
+	genFile := base + suffix
 
 	if err = goGenerateTpl(tempDir, tfile, tpl, tplData); err != nil {
 		err = fmt.Errorf("could not generate code: %v", err)
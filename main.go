@@ -12,11 +12,32 @@
 // the generator to execute without any command-line flags. However, the
 // following options are supported, if you need them:
 //
-//  -o = output file name (default is {input}_gen.go)
+//  -o = output file name (default is {input}{suffix})
+//  -suffix = suffix of the output file name, in place of the .go of the input; tests are written to the same name, ending in _test.go instead (default is _gen.go)
 //  -file = input file name (or directory; default is $GOFILE, which is set by the `go generate` command)
 //  -io = satisfy the `msgp.Decodable` and `msgp.Encodable` interfaces (default is true)
 //  -marshal = satisfy the `msgp.Marshaler` and `msgp.Unmarshaler` interfaces (default is true)
 //  -tests = generate tests and benchmarks (default is true)
+//  -unexported = also process unexported types (default is true)
+//  -exact = also generate UnmarshalMsgExact, which rejects trailing bytes (default is false)
+//  -canonical = also generate UnmarshalMsgCanonical, which rejects messages not in canonical form; not for types with int=fixed fields (default is false)
+//  -equal = also generate Equal methods (default is false)
+//  -reset = also generate Reset methods, for reusing values when unmarshaling (default is false)
+//  -validate = also generate Validate methods, which check allocbounds and min/max tags (default is false)
+//  -cbor = also generate MarshalCBOR and UnmarshalCBOR methods, using msgp/cbor (default is false)
+//  -schema = also generate {Type}MsgpSchema functions, describing the encoding of each type (default is false)
+//  -clone = also generate Clone methods, which return deep copies (default is false)
+//  -arena = also generate UnmarshalMsgArena methods, which decode slices and []byte values into a reusable msgp.Arena (default is false)
+//  -framed = also generate MarshalFramed and UnmarshalFramed methods, which encode and decode values in length-prefixed frames, as msgp.AppendFrame writes them (default is false)
+//  -fields = also generate UnmarshalMsgFields methods, which only decode the named fields (default is false)
+//  -bench = also generate benchmarks of MarshalMsg and UnmarshalMsg on random values (default is false)
+//  -nil-policy = how nil slices, maps and []byte are encoded: "distinguish" them from empty ones, as 'nil', or "collapse" them into empty ones; the nil= codec tag option overrides it for a field (default is distinguish)
+//  -include-build-tags = comma-separated build tags; files are only parsed if they build under these tags (default is none)
+//  -goos, -goarch = the GOOS and GOARCH that files must build under (default is that of go build)
+//  -lint = report the slices, maps and strings in msgp:securetype types that have no allocbound, without writing any files, and fail if there are any (default is false)
+//  -types = comma-separated names of the types to generate methods for, along with the types they use; no methods are generated for the others (default is all types)
+//  -package = name of another package to generate the methods in, on types declared there as those of the input, as in "type T orig.T"; the types and the fields they encode must be exported, and -o must name a file of that package (default is the input's package)
+//  -dry-run = report which types would be generated, and why others are skipped, without writing any files (default is false)
 //
 // For more information, please read README.md, and the wiki at github.com/tinylib/msgp
 //
@@ -37,12 +58,33 @@ import (
 
 var (
 	out         = flag.String("o", "", "output file")
+	suffix      = flag.String("suffix", printer.DefaultSuffix, "suffix of the output file, in place of the input's .go")
 	file        = flag.String("file", "", "input file")
 	marshal     = flag.Bool("marshal", true, "create Marshal and Unmarshal methods")
 	tests       = flag.Bool("tests", true, "create tests and benchmarks")
+	exact       = flag.Bool("exact", false, "also create UnmarshalMsgExact methods, which reject trailing bytes")
+	canonical   = flag.Bool("canonical", false, "also create UnmarshalMsgCanonical methods, which reject non-canonical messages")
+	equal       = flag.Bool("equal", false, "also create Equal methods")
+	reset       = flag.Bool("reset", false, "also create Reset methods")
+	validate    = flag.Bool("validate", false, "also create Validate methods")
+	cbor        = flag.Bool("cbor", false, "also create MarshalCBOR and UnmarshalCBOR methods")
+	schema      = flag.Bool("schema", false, "also create MsgpSchema functions")
+	bench       = flag.Bool("bench", false, "also create benchmarks on random values")
+	clone       = flag.Bool("clone", false, "also create Clone methods")
+	fields      = flag.Bool("fields", false, "also create UnmarshalMsgFields methods")
+	arena       = flag.Bool("arena", false, "also create UnmarshalMsgArena methods")
+	framed      = flag.Bool("framed", false, "also create MarshalFramed and UnmarshalFramed methods")
 	unexported  = flag.Bool("unexported", true, "also process unexported types")
 	skipFormat  = flag.Bool("skip-format", false, "skip formatting the generated code (for debug)")
+	dryRun      = flag.Bool("dry-run", false, "report which types would be generated, without writing any files")
+	lint        = flag.Bool("lint", false, "report the fields of msgp:securetype types without an allocbound, and fail if there are any")
 	warnPkgMask = flag.String("warnmask", "", "skip generating warnings on datatypes outside given package")
+	buildTags   = flag.String("include-build-tags", "", "comma-separated build tags to parse files under")
+	goos        = flag.String("goos", "", "GOOS to parse files under")
+	goarch      = flag.String("goarch", "", "GOARCH to parse files under")
+	nilPolicy   = flag.String("nil-policy", gen.NilDistinguish, "encode nil slices, maps and []byte as 'nil' (distinguish) or as empty (collapse)")
+	onlyTypes   = flag.String("types", "", "comma-separated types to generate, along with the types they use")
+	pkgName     = flag.String("package", "", "package to generate the methods in, on types declared as the input's")
 )
 
 func main() {
@@ -59,11 +101,47 @@ func main() {
 
 	var mode gen.Method
 	if *marshal {
-		mode |= (gen.Marshal | gen.Unmarshal | gen.Size | gen.IsZero | gen.MaxSize)
+		mode |= (gen.Marshal | gen.Unmarshal | gen.Size | gen.IsZero | gen.MaxSize | gen.Stringer)
+	}
+	if *marshal && *exact {
+		mode |= gen.UnmarshalExact
+	}
+	if *marshal && *canonical {
+		mode |= gen.Canonical
+	}
+	if *marshal && *equal {
+		mode |= gen.Equal
+	}
+	if *marshal && *reset {
+		mode |= gen.Reset
+	}
+	if *marshal && *validate {
+		mode |= gen.Validate
+	}
+	if *marshal && *cbor {
+		mode |= gen.CBOR
+	}
+	if *marshal && *schema {
+		mode |= gen.Schema
+	}
+	if *marshal && *clone {
+		mode |= gen.Clone
+	}
+	if *marshal && *fields {
+		mode |= gen.Fields
+	}
+	if *marshal && *arena {
+		mode |= gen.Arena
+	}
+	if *marshal && *framed {
+		mode |= gen.Framed
 	}
 	if *tests {
 		mode |= gen.Test
 	}
+	if *marshal && *bench {
+		mode |= gen.Bench
+	}
 
 	if mode&^gen.Test == 0 {
 		fmt.Println(chalk.Red.Color("No methods to generate; -marshal=false"))
@@ -86,32 +164,66 @@ func Run(gofile string, mode gen.Method, unexported bool, warnPkgMask string) er
 	}
 	fmt.Println(chalk.Magenta.Color("======== MessagePack Code Generator ======="))
 	fmt.Printf(chalk.Magenta.Color(">>> Input: \"%s\"\n"), gofile)
-	fs, err := parse.File(gofile, unexported, warnPkgMask)
+	b := parse.Build{GOOS: *goos, GOARCH: *goarch}
+	if *buildTags != "" {
+		b.Tags = strings.Split(*buildTags, ",")
+	}
+	fs, err := parse.BuildFile(gofile, unexported, warnPkgMask, b)
 	if err != nil {
 		return err
 	}
+	if err := fs.SetNilPolicy(*nilPolicy); err != nil {
+		return err
+	}
+	if *onlyTypes != "" {
+		if err := fs.Only(strings.Split(*onlyTypes, ",")); err != nil {
+			return err
+		}
+	}
+	if *pkgName != "" {
+		if *out == "" {
+			return fmt.Errorf("-package %s needs -o, the file to write in it", *pkgName)
+		}
+		if err := fs.MoveTo(*pkgName); err != nil {
+			return err
+		}
+	}
+
+	if *dryRun {
+		printer.PrintPlan(os.Stderr, fs)
+		return nil
+	}
+
+	if *lint {
+		if n := printer.PrintLint(os.Stderr, fs); n > 0 {
+			return fmt.Errorf("%d values in msgp:securetype types have no allocbound", n)
+		}
+		return nil
+	}
 
 	if len(fs.Identities) == 0 {
 		fmt.Println(chalk.Magenta.Color("No types requiring code generation were found!"))
 		return nil
 	}
 
-	return printer.PrintFile(newFilename(gofile, fs.Package), fs, mode, *skipFormat)
+	base, sfx := newFilename(gofile, fs.Package)
+	return printer.PrintFile(base, sfx, fs, mode, *skipFormat)
 }
 
-// picks a new file name based on input flags and input filename(s).
-func newFilename(old string, pkg string) string {
+// picks a new file name based on input flags and input filename(s),
+// as a base name and the suffix that follows it.
+func newFilename(old string, pkg string) (string, string) {
 	if *out != "" {
 		if pre := strings.TrimPrefix(*out, old); len(pre) > 0 &&
 			!strings.HasSuffix(*out, ".go") {
-			return filepath.Join(old, *out)
+			return filepath.Join(old, *out), ".go"
 		}
-		return *out
+		return strings.TrimSuffix(*out, ".go"), ".go"
 	}
 
 	if fi, err := os.Stat(old); err == nil && fi.IsDir() {
 		old = filepath.Join(old, pkg)
 	}
-	// new file name is old file name + _gen.go
-	return strings.TrimSuffix(old, ".go") + "_gen.go"
+	// new file name is old file name + the suffix, _gen.go by default
+	return strings.TrimSuffix(old, ".go"), *suffix
 }
@@ -0,0 +1,151 @@
+package msgp
+
+import "math"
+
+// Arena is scratch storage for decoding messages with
+// the generated UnmarshalMsgArena methods, which carve
+// the []byte values and the slices they decode out of
+// the Arena's buffers rather than allocating each one.
+// The []byte values share one contiguous buffer, and
+// the slices of each element type share another, so
+// that decoding a message allocates a few large buffers
+// at first, and nothing once the buffers are big enough.
+//
+// Reset reuses the buffers for the next message, so it
+// invalidates every value decoded from the Arena before
+// it: nothing may use those values, or keep a reference
+// to any slice within them, after Reset. Maps, strings
+// and pointers are allocated as by UnmarshalMsg, and
+// outlive the Arena. An Arena must not be used by more
+// than one goroutine at a time.
+//
+// The zero Arena is empty and ready to use.
+type Arena struct {
+	root   Budget
+	bytes  []byte
+	off    int
+	slices map[interface{}]arenaSlices
+}
+
+// arenaMinBytes is the smallest buffer of []byte
+// values, and arenaMinLen the fewest elements in
+// a buffer of slices, that an Arena allocates
+const (
+	arenaMinBytes = 4096
+	arenaMinLen   = 32
+)
+
+// arenaSlices is the buffer of slices of one element type
+type arenaSlices interface {
+	reset()
+}
+
+// arenaKey keys the buffer of slices of T
+type arenaKey[T any] struct{}
+
+type arenaBuf[T any] struct {
+	buf []T
+	off int
+}
+
+func (a *arenaBuf[T]) reset() { a.off = 0 }
+
+// Reset makes all of the Arena's storage available to
+// the values decoded next, which overwrite the values
+// decoded from it so far.
+func (a *Arena) Reset() {
+	a.off = 0
+	for _, s := range a.slices {
+		s.reset()
+	}
+}
+
+// Budget returns an unlimited Budget that allocates from
+// the Arena, for the generated decoders to pass to the
+// decoders of nested values.
+func (a *Arena) Budget() *Budget {
+	a.root = Budget{max: math.MaxInt, arena: a}
+	return &a.root
+}
+
+// Arena returns the Arena that 'b' allocates from, if any.
+func (b *Budget) Arena() *Arena {
+	if b == nil {
+		return nil
+	}
+	return b.arena
+}
+
+// arenaGrow returns the length of the buffer that
+// replaces one of length n when it can't hold want
+// more elements, which is at least min
+func arenaGrow(n int, want int, min int) int {
+	if n *= 2; n < min {
+		n = min
+	}
+	if n < want {
+		n = want
+	}
+	return n
+}
+
+// alloc returns n bytes from the Arena, which
+// are not zeroed
+func (a *Arena) alloc(n int) []byte {
+	if len(a.bytes)-a.off < n {
+		a.bytes = make([]byte, arenaGrow(len(a.bytes), n, arenaMinBytes))
+		a.off = 0
+	}
+	b := a.bytes[a.off : a.off+n : a.off+n]
+	a.off += n
+	return b
+}
+
+// MakeSlice returns a new slice of n zero T, like make,
+// but from the Arena of 'b', if it has one. A slice from
+// an Arena has a capacity of n, so appending to it never
+// overwrites another.
+func MakeSlice[T any](b *Budget, n int) []T {
+	a := b.Arena()
+	if a == nil {
+		return make([]T, n)
+	}
+	if a.slices == nil {
+		a.slices = make(map[interface{}]arenaSlices)
+	}
+	s, ok := a.slices[arenaKey[T]{}].(*arenaBuf[T])
+	if !ok {
+		s = new(arenaBuf[T])
+		a.slices[arenaKey[T]{}] = s
+	}
+	if len(s.buf)-s.off < n {
+		s.buf = make([]T, arenaGrow(len(s.buf), n, arenaMinLen))
+		s.off = 0
+	}
+	v := s.buf[s.off : s.off+n : s.off+n]
+	s.off += n
+	// a buffer that has been Reset holds old values
+	var zero T
+	for i := range v {
+		v[i] = zero
+	}
+	return v
+}
+
+// ReadBytesArena is like ReadBytesBytes, but if 'scratch'
+// is too small to hold the bytes of the 'bin' object, they
+// are copied to storage from the Arena of 'budget', if it
+// has one, rather than to a new slice.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not a 'bin' object)
+func ReadBytesArena(b []byte, scratch []byte, budget *Budget) (v []byte, o []byte, err error) {
+	if a := budget.Arena(); a != nil {
+		// an array of bytes, which has no header that
+		// ReadBytesBytesHeader reads, is read as usual
+		if sz, err := ReadBytesBytesHeader(b); err == nil && sz > cap(scratch) && sz <= len(b) {
+			scratch = a.alloc(sz)[:0]
+		}
+	}
+	return ReadBytesBytes(b, scratch)
+}
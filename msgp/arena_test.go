@@ -0,0 +1,88 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestArena(t *testing.T) {
+	var a Arena
+	budget := a.Budget()
+	if b := budget.Limit(nil, 10); b.Arena() != &a {
+		t.Error("Limit dropped the Arena")
+	}
+	if (*Budget)(nil).Arena() != nil || MakeSlice[int](nil, 3) == nil {
+		t.Error("nil Budget")
+	}
+
+	s := MakeSlice[int](budget, 3)
+	s[0] = 7
+	u := MakeSlice[int](budget, 2)
+	if len(s) != 3 || cap(s) != 3 || len(u) != 2 {
+		t.Fatalf("len %d cap %d, len %d", len(s), cap(s), len(u))
+	}
+	if buf := a.slices[arenaKey[int]{}].(*arenaBuf[int]).buf; &buf[0] != &s[0] || &buf[3] != &u[0] {
+		t.Error("slices of a type not carved from one buffer")
+	}
+	big := MakeSlice[int](budget, 2*arenaMinLen)
+	if len(big) != 2*arenaMinLen || s[0] != 7 {
+		t.Error("growing the buffer changed an earlier slice")
+	}
+	strs := MakeSlice[string](budget, 1)
+	strs[0] = "x"
+
+	a.Reset()
+	if s = MakeSlice[int](budget, 4); &s[0] != &big[0] || s[0] != 0 {
+		t.Error("Reset didn't reuse the last buffer, zeroed")
+	}
+	if strs = MakeSlice[string](budget, 1); strs[0] != "" {
+		t.Error("Reset didn't zero the strings")
+	}
+}
+
+func TestReadBytesArena(t *testing.T) {
+	var a Arena
+	msg := AppendBytes(AppendBytes(nil, []byte("hello")), []byte("world!"))
+	v, o, err := ReadBytesArena(msg, nil, a.Budget())
+	if err != nil || string(v) != "hello" || cap(v) != 5 {
+		t.Fatalf("%q (cap %d), %v", v, cap(v), err)
+	}
+	w, _, err := ReadBytesArena(o, nil, a.Budget())
+	if err != nil || string(w) != "world!" || &a.bytes[5] != &w[0] {
+		t.Errorf("%q not carved after %q: %v", w, v, err)
+	}
+
+	// scratch is used if it's big enough, as by ReadBytesBytes
+	scratch := make([]byte, 0, 8)
+	if v, _, _ = ReadBytesArena(msg, scratch, a.Budget()); &v[0] != &scratch[:1][0] {
+		t.Error("scratch not used")
+	}
+	var none *Budget
+	if v, _, _ = ReadBytesArena(msg, nil, none); string(v) != "hello" {
+		t.Errorf("no Arena: %q", v)
+	}
+
+	// an array of bytes, a nil, and a short object
+	arr := AppendByte(AppendByte(AppendArrayHeader(nil, 2), 1), 2)
+	if v, _, err = ReadBytesArena(arr, nil, a.Budget()); err != nil || !bytes.Equal(v, []byte{1, 2}) {
+		t.Errorf("array: %x, %v", v, err)
+	}
+	if v, _, err = ReadBytesArena(AppendNil(nil), nil, a.Budget()); err != nil || v != nil {
+		t.Errorf("nil: %x, %v", v, err)
+	}
+	off := a.off
+	if _, _, err = ReadBytesArena(msg[:3], nil, a.Budget()); err != ErrShortBytes || a.off != off {
+		t.Errorf("short: %v, allocated %d bytes", err, a.off-off)
+	}
+}
+
+func BenchmarkMakeSlice(b *testing.B) {
+	var a Arena
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%100 == 0 {
+			a.Reset()
+		}
+		MakeSlice[[2]int64](a.Budget(), 16)
+	}
+}
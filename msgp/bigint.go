@@ -0,0 +1,111 @@
+package msgp
+
+// math/big is renamed to avoid clashing
+// with the package-level binary.BigEndian
+import bigint "math/big"
+
+// BigIntExtension is the extension number used for math/big.Int
+const BigIntExtension = 8
+
+func init() {
+	RegisterExtension(BigIntExtension, func() Extension { return &bigIntExt{z: new(bigint.Int), max: -1} })
+}
+
+// bigIntExt adapts a *bigint.Int to the Extension interface.
+// The body is a sign byte (0 for non-negative values and 1 for
+// negative values) followed by the big-endian magnitude, without
+// leading zeros. Zero is encoded as the single byte 0.
+// When max is non-negative, UnmarshalBinary rejects magnitudes
+// longer than max bytes.
+type bigIntExt struct {
+	z   *bigint.Int
+	max int
+}
+
+func (e *bigIntExt) ExtensionType() int8 { return BigIntExtension }
+
+func (e *bigIntExt) Len() int { return 1 + bigIntMagLen(e.z) }
+
+func (e *bigIntExt) MarshalBinaryTo(b []byte) error {
+	if e.z == nil {
+		b[0] = 0
+		return nil
+	}
+	if e.z.Sign() < 0 {
+		b[0] = 1
+	} else {
+		b[0] = 0
+	}
+	e.z.FillBytes(b[1:e.Len()])
+	return nil
+}
+
+func (e *bigIntExt) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		return ErrShortBytes
+	}
+	mag := b[1:]
+	if e.max >= 0 && len(mag) > e.max {
+		return ErrOverflow(uint64(len(mag)), uint64(e.max))
+	}
+	if b[0] > 1 || (len(mag) > 0 && mag[0] == 0) || (b[0] == 1 && len(mag) == 0) {
+		return errBigIntEncoding{}
+	}
+	e.z.SetBytes(mag)
+	if b[0] == 1 {
+		e.z.Neg(e.z)
+	}
+	return nil
+}
+
+func bigIntMagLen(z *bigint.Int) int {
+	if z == nil {
+		return 0
+	}
+	return (z.BitLen() + 7) / 8
+}
+
+// BigIntSize returns the number of bytes
+// occupied by the encoding of 'z'.
+func BigIntSize(z *bigint.Int) int {
+	return BigIntPrefixSize + bigIntMagLen(z)
+}
+
+// errBigIntEncoding is returned when an
+// encoded big.Int is not in canonical form
+type errBigIntEncoding struct{}
+
+func (e errBigIntEncoding) Error() string {
+	return "msgp: malformed big.Int encoding"
+}
+
+func (e errBigIntEncoding) Resumable() bool { return true }
+
+// AppendBigInt appends a *bigint.Int to the slice as a MessagePack extension.
+// A nil *bigint.Int is encoded as zero.
+func AppendBigInt(b []byte, z *bigint.Int) []byte {
+	// not AppendExtension, so that the bigIntExt doesn't escape
+	e := bigIntExt{z: z}
+	o, n := appendExtensionHeader(b, BigIntExtension, e.Len())
+	e.MarshalBinaryTo(o[n:])
+	return o
+}
+
+// ReadBigIntBytes reads a big.Int extension
+// object from 'b' into 'z' and returns the
+// remaining bytes.
+// Possible errors:
+// - ErrShortBytes (not enough bytes in 'b')
+// - TypeError{} (object not an extension)
+// - ExtensionTypeError{} (object an extension, but not a big.Int)
+func ReadBigIntBytes(b []byte, z *bigint.Int) (o []byte, err error) {
+	return ReadBigIntBytesMax(b, z, -1)
+}
+
+// ReadBigIntBytesMax is like ReadBigIntBytes, but returns
+// ErrOverflow, before allocating, if the encoded magnitude
+// is longer than maxBytes bytes. A negative maxBytes means
+// no limit.
+func ReadBigIntBytesMax(b []byte, z *bigint.Int, maxBytes int) (o []byte, err error) {
+	return ReadExtensionBytes(b, &bigIntExt{z: z, max: maxBytes})
+}
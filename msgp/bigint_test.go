@@ -0,0 +1,101 @@
+package msgp
+
+import (
+	"math/rand"
+	"testing"
+
+	bigint "math/big"
+)
+
+func TestAppendReadBigInt(t *testing.T) {
+	large := new(bigint.Int).SetBytes(RandBytes(2048))
+	zs := []*bigint.Int{
+		bigint.NewInt(0),
+		bigint.NewInt(1),
+		bigint.NewInt(-1),
+		bigint.NewInt(255),
+		bigint.NewInt(-256),
+		large,
+		new(bigint.Int).Neg(large),
+	}
+	for _, z := range zs {
+		bts := AppendBigInt(nil, z)
+		if len(bts) > BigIntSize(z) {
+			t.Errorf("%v encoded to %d bytes; more than BigIntSize", z, len(bts))
+		}
+		out := new(bigint.Int)
+		left, err := ReadBigIntBytes(bts, out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after ReadBigIntBytes()", len(left))
+		}
+		if out.Cmp(z) != 0 {
+			t.Errorf("wanted %v; got %v", z, out)
+		}
+	}
+
+	// nil encodes as zero
+	out := bigint.NewInt(rand.Int63())
+	if _, err := ReadBigIntBytes(AppendBigInt(nil, nil), out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Sign() != 0 {
+		t.Errorf("wanted 0; got %v", out)
+	}
+}
+
+func TestAppendBigIntNoAlloc(t *testing.T) {
+	z := new(bigint.Int).SetBytes(RandBytes(100))
+	b := make([]byte, 0, BigIntSize(z))
+	if n := testing.AllocsPerRun(10, func() { AppendBigInt(b, z) }); n != 0 {
+		t.Errorf("AppendBigInt allocated %v times into a buffer of BigIntSize() bytes", n)
+	}
+}
+
+func TestReadBigIntBytesMax(t *testing.T) {
+	z := new(bigint.Int).Lsh(bigint.NewInt(1), 8*100)
+	bts := AppendBigInt(nil, z)
+
+	out := new(bigint.Int)
+	if _, err := ReadBigIntBytesMax(bts, out, 101); err != nil {
+		t.Fatal(err)
+	}
+	if out.Cmp(z) != 0 {
+		t.Errorf("wanted %v; got %v", z, out)
+	}
+
+	_, err := ReadBigIntBytesMax(bts, out, 100)
+	if _, ok := err.(errOverflow); !ok {
+		t.Errorf("expected overflow error; got %v", err)
+	}
+}
+
+func TestReadBigIntNonCanonical(t *testing.T) {
+	for _, body := range [][]byte{
+		{},        // missing sign
+		{2, 1},    // bad sign
+		{0, 0, 1}, // leading zero
+		{1},       // negative zero
+	} {
+		bts, _ := AppendExtension(nil, &RawExtension{Type: BigIntExtension, Data: body})
+		if _, err := ReadBigIntBytes(bts, new(bigint.Int)); err == nil {
+			t.Errorf("body %v: expected an error", body)
+		}
+	}
+}
+
+func TestBigIntRegistered(t *testing.T) {
+	f, ok := extensionReg[BigIntExtension]
+	if !ok {
+		t.Fatal("big.Int extension is not registered")
+	}
+	e := f()
+	if _, err := ReadExtensionBytes(AppendBigInt(nil, bigint.NewInt(-42)), e); err != nil {
+		t.Fatal(err)
+	}
+	if got := e.(*bigIntExt).z.Int64(); got != -42 {
+		t.Errorf("wanted -42; got %d", got)
+	}
+}
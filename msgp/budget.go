@@ -0,0 +1,101 @@
+package msgp
+
+import (
+	"math"
+	"unsafe"
+)
+
+// ErrMaxBytesExceeded is returned when decoding a
+// message would consume and allocate more bytes
+// in total than its maxtotalbytes limit allows,
+// by SkipLimit for objects longer than its limit,
+// and by the readers of NewReaderLimit past theirs.
+var ErrMaxBytesExceeded error = errMaxBytesExceeded{}
+
+type errMaxBytesExceeded struct{}
+
+func (e errMaxBytesExceeded) Error() string   { return "msgp: message exceeds its maxtotalbytes limit" }
+func (e errMaxBytesExceeded) Resumable() bool { return false }
+
+// Budget counts the bytes consumed and allocated
+// while decoding a message with a maxtotalbytes
+// limit. Generated decoders pass it down to the
+// decoders of nested values, so a message whose
+// fields are each within their allocbounds is still
+// rejected once they add up to more than the limit.
+//
+// A nil *Budget is unlimited. A Budget from an Arena
+// also allocates from it, as do the Budgets that Limit
+// returns for it.
+type Budget struct {
+	parent    *Budget
+	start     int // len(bts) when decoding began
+	max       int
+	allocated int
+	arena     *Arena // see Arena.Budget
+}
+
+// Limit returns a Budget of max bytes for decoding
+// 'bts', which also counts against 'b', if any.
+func (b *Budget) Limit(bts []byte, max int) *Budget {
+	return &Budget{parent: b, start: len(bts), max: max, arena: b.Arena()}
+}
+
+// Spend charges n allocated bytes to 'b', and returns
+// ErrMaxBytesExceeded if those, plus the bytes consumed
+// so far (as measured by the remaining bytes 'bts'),
+// exceed the limit of 'b' or of any Budget containing it.
+func (b *Budget) Spend(bts []byte, n int) error {
+	for ; b != nil; b = b.parent {
+		b.allocated += n
+		if b.start-len(bts)+b.allocated > b.max {
+			return ErrMaxBytesExceeded
+		}
+	}
+	return nil
+}
+
+// Remaining returns how many more bytes may be consumed
+// and allocated, past the remaining bytes 'bts', within
+// the limits of 'b' and of any Budget containing it.
+// A nil Budget has math.MaxInt64 remaining.
+func (b *Budget) Remaining(bts []byte) int64 {
+	rem := int64(math.MaxInt64)
+	for ; b != nil; b = b.parent {
+		if r := int64(b.max - (b.start - len(bts)) - b.allocated); r < rem {
+			rem = r
+		}
+	}
+	return rem
+}
+
+// SkipDepth is how deeply the maps and arrays of the
+// objects that decoders skip may be nested.
+const SkipDepth = 512
+
+// SkipBudget skips the next object in 'bts' with SkipLimit,
+// failing if its maps and arrays are nested more than
+// SkipDepth deep, or if it is longer than 'b' has remaining.
+func SkipBudget(b *Budget, bts []byte) ([]byte, error) {
+	return SkipLimit(bts, SkipDepth, b.Remaining(bts))
+}
+
+// SpendSlice charges the memory backing 's' to 'b'.
+func SpendSlice[T any](b *Budget, bts []byte, s []T) error {
+	if b == nil {
+		return nil
+	}
+	var z T
+	return b.Spend(bts, cap(s)*int(unsafe.Sizeof(z)))
+}
+
+// SpendMap charges the memory for n entries of 'm' to 'b'.
+// It doesn't count the overhead of the map itself.
+func SpendMap[K comparable, V any](b *Budget, bts []byte, m map[K]V, n int) error {
+	if b == nil {
+		return nil
+	}
+	var k K
+	var v V
+	return b.Spend(bts, n*int(unsafe.Sizeof(k)+unsafe.Sizeof(v)))
+}
@@ -0,0 +1,125 @@
+package msgp
+
+import (
+	"math"
+	"testing"
+)
+
+// appendTree appends an array of width arrays, nested
+// depth times, whose leaves are 'bin' objects of 60 bytes
+func appendTree(b []byte, depth int, width int) []byte {
+	if depth == 0 {
+		return AppendBytes(b, make([]byte, 60))
+	}
+	b = AppendArrayHeader(b, uint32(width))
+	for i := 0; i < width; i++ {
+		b = appendTree(b, depth-1, width)
+	}
+	return b
+}
+
+// readTree reads the output of appendTree the way generated
+// code does, with an allocbound of 8 on every array and of
+// 64 on every leaf
+func readTree(bts []byte, depth int, budget *Budget) ([]byte, error) {
+	if depth == 0 {
+		sz, err := ReadBytesBytesHeader(bts)
+		if err != nil {
+			return bts, err
+		}
+		if sz > 64 {
+			return bts, ErrOverflow(uint64(sz), 64)
+		}
+		var leaf []byte
+		leaf, bts, err = ReadBytesBytes(bts, nil)
+		if err != nil {
+			return bts, err
+		}
+		return bts, budget.Spend(bts, len(leaf))
+	}
+	sz, _, bts, err := ReadArrayHeaderBytes(bts)
+	if err != nil {
+		return bts, err
+	}
+	if sz > 8 {
+		return bts, ErrOverflow(uint64(sz), 8)
+	}
+	children := make([][]byte, sz)
+	if err = SpendSlice(budget, bts, children); err != nil {
+		return bts, err
+	}
+	for i := range children {
+		bts, err = readTree(bts, depth-1, budget)
+		if err != nil {
+			return bts, WrapError(err, i)
+		}
+	}
+	return bts, budget.Spend(bts, 0)
+}
+
+func TestBudgetNested(t *testing.T) {
+	bts := appendTree(nil, 3, 8)
+
+	// every array and leaf is within its allocbound
+	if _, err := readTree(bts, 3, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readTree(bts, 3, (*Budget)(nil).Limit(bts, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	// but not the whole message
+	_, err := readTree(bts, 3, (*Budget)(nil).Limit(bts, len(bts)))
+	if Cause(err) != ErrMaxBytesExceeded {
+		t.Errorf("expected ErrMaxBytesExceeded; got %v", err)
+	}
+	_, err = readTree(bts, 3, (*Budget)(nil).Limit(bts, 1000))
+	if Cause(err) != ErrMaxBytesExceeded {
+		t.Errorf("expected ErrMaxBytesExceeded; got %v", err)
+	}
+}
+
+func TestBudgetLimit(t *testing.T) {
+	bts := make([]byte, 100)
+	outer := (*Budget)(nil).Limit(bts, 80)
+	inner := outer.Limit(bts[10:], 30)
+
+	// 20 consumed by inner (30 by outer) plus 10 allocated
+	if err := inner.Spend(bts[30:], 10); err != nil {
+		t.Fatal(err)
+	}
+	if r := inner.Remaining(bts[30:]); r != 0 {
+		t.Errorf("inner has %d remaining; want 0", r)
+	}
+	if r := outer.Remaining(bts[30:]); r != 40 {
+		t.Errorf("outer has %d remaining; want 40", r)
+	}
+	if err := inner.Spend(bts[30:], 1); err != ErrMaxBytesExceeded {
+		t.Errorf("inner limit: expected ErrMaxBytesExceeded; got %v", err)
+	}
+
+	// the 10 allocated by inner count against outer too
+	if err := outer.Spend(bts[40:], 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := outer.Spend(bts[41:], 0); err != ErrMaxBytesExceeded {
+		t.Errorf("outer limit: expected ErrMaxBytesExceeded; got %v", err)
+	}
+
+	var unlimited *Budget
+	if r := unlimited.Remaining(nil); r != math.MaxInt64 {
+		t.Errorf("nil budget has %d remaining", r)
+	}
+	if err := unlimited.Spend(nil, 1<<30); err != nil {
+		t.Errorf("nil budget: %v", err)
+	}
+	if err := SpendMap(unlimited, nil, map[int64]int64(nil), 1<<30); err != nil {
+		t.Errorf("nil budget: %v", err)
+	}
+	if err := SpendMap((*Budget)(nil).Limit(nil, 160), nil, map[int64]int64(nil), 10); err != nil {
+		t.Errorf("10 entries of 16 bytes: %v", err)
+	}
+	if err := SpendMap((*Budget)(nil).Limit(nil, 159), nil, map[int64]int64(nil), 10); err != ErrMaxBytesExceeded {
+		t.Errorf("10 entries of 16 bytes: expected ErrMaxBytesExceeded; got %v", err)
+	}
+}
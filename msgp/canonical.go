@@ -0,0 +1,245 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+)
+
+// IsCanonical returns whether 'b' holds exactly one object,
+// encoded in the canonical form that the Append functions
+// and generated MarshalMsg methods produce:
+//
+//   - integers, and the lengths of strings, binary data,
+//     maps, arrays and extensions, are encoded in their
+//     shortest form; non-negative integers are encoded
+//     as unsigned
+//   - the keys of a map are in increasing order, with no
+//     duplicates, when they are all strings (compared as
+//     bytes) or all integers (compared as numbers); other
+//     keys are not checked
+//   - there are no bytes after the object
+//
+// It returns false, with a nil error, for a well formed
+// object that is not canonical, and an error if 'b' is
+// not well formed.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - InvalidPrefixError (bad encoding)
+func IsCanonical(b []byte) (bool, error) {
+	o, ok, err := canonicalSkip(b)
+	if err != nil || !ok {
+		return false, err
+	}
+	return len(o) == 0, nil
+}
+
+// canonicalSkip skips the next object in b, and returns
+// whether it is canonical
+func canonicalSkip(b []byte) (o []byte, ok bool, err error) {
+	if len(b) == 0 {
+		return b, false, ErrShortBytes
+	}
+	lead := b[0]
+	switch sizes[lead].typ {
+	case IntType, UintType:
+		var scratch [Int64Size]byte
+		var enc []byte
+		switch lead {
+		case muint8, muint16, muint32, muint64:
+			var u uint64
+			u, o, err = ReadUint64Bytes(b)
+			enc = AppendUint64(scratch[:0], u)
+		default:
+			var i int64
+			i, o, err = ReadInt64Bytes(b)
+			enc = AppendInt64(scratch[:0], i)
+		}
+		if err != nil {
+			return b, false, err
+		}
+		return o, bytes.Equal(enc, b[:len(b)-len(o)]), nil
+	case StrType:
+		var v []byte
+		v, o, err = ReadStringZC(b)
+		if err != nil {
+			return b, false, err
+		}
+		return o, len(b)-len(o)-len(v) == strPrefixSize(len(v)), nil
+	case BinType:
+		var v []byte
+		v, o, err = ReadBytesZC(b)
+		if err != nil {
+			return b, false, err
+		}
+		return o, len(b)-len(o)-len(v) == binPrefixSize(len(v)), nil
+	case ArrayType:
+		var sz int
+		sz, _, o, err = ReadArrayHeaderBytes(b)
+		if err != nil {
+			return b, false, err
+		}
+		ok = len(b)-len(o) == headerSize(sz)
+		// every element takes at least a byte, so
+		// don't count through more than are left
+		if sz > len(o) {
+			return b, false, ErrShortBytes
+		}
+		for i := 0; i < sz; i++ {
+			var elemOK bool
+			o, elemOK, err = canonicalSkip(o)
+			if err != nil {
+				return b, false, err
+			}
+			ok = ok && elemOK
+		}
+		return o, ok, nil
+	case MapType:
+		return canonicalSkipMap(b)
+	case ExtensionType:
+		o, err = Skip(b)
+		if err != nil {
+			return b, false, err
+		}
+		var l int
+		switch lead {
+		case mfixext1:
+			l = 1
+		case mfixext2:
+			l = 2
+		case mfixext4:
+			l = 4
+		case mfixext8:
+			l = 8
+		case mfixext16:
+			l = 16
+		default:
+			l = len(b) - len(o) - int(sizes[lead].size)
+		}
+		return o, len(b)-len(o)-l == extPrefixSize(l), nil
+	default:
+		o, err = Skip(b)
+		return o, err == nil, err
+	}
+}
+
+func canonicalSkipMap(b []byte) (o []byte, ok bool, err error) {
+	var sz int
+	sz, _, o, err = ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, false, err
+	}
+	ok = len(b)-len(o) == headerSize(sz)
+	if sz > len(o)/2 {
+		return b, false, ErrShortBytes
+	}
+	var prev []byte
+	for i := 0; i < sz; i++ {
+		key := o
+		var entryOK bool
+		o, entryOK, err = canonicalSkip(o)
+		if err != nil {
+			return b, false, err
+		}
+		key = key[:len(key)-len(o)]
+		if i > 0 && entryOK {
+			entryOK = keyOrdered(prev, key)
+		}
+		prev = key
+		ok = ok && entryOK
+
+		o, entryOK, err = canonicalSkip(o)
+		if err != nil {
+			return b, false, err
+		}
+		ok = ok && entryOK
+	}
+	return o, ok, nil
+}
+
+// keyOrdered returns whether next, the canonical encoding of a map
+// key, may follow prev, the encoding of the key before it
+func keyOrdered(prev, next []byte) bool {
+	t, nt := sizes[prev[0]].typ, sizes[next[0]].typ
+	switch {
+	case t == StrType && nt == StrType:
+		p, _, _ := ReadStringZC(prev)
+		n, _, _ := ReadStringZC(next)
+		return bytes.Compare(p, n) < 0
+	case (t == IntType || t == UintType) && (nt == IntType || nt == UintType):
+		return intLess(prev, next)
+	}
+	return true
+}
+
+// intLess compares two canonically encoded integers, which
+// are unsigned exactly when they are non-negative
+func intLess(prev, next []byte) bool {
+	pu, pneg := canonicalInt(prev)
+	nu, nneg := canonicalInt(next)
+	switch {
+	case pneg != nneg:
+		return pneg
+	case pneg:
+		return int64(pu) < int64(nu)
+	default:
+		return pu < nu
+	}
+}
+
+func canonicalInt(b []byte) (v uint64, neg bool) {
+	if i, _, err := ReadInt64Bytes(b); err == nil && i < 0 {
+		return uint64(i), true
+	}
+	v, _, _ = ReadUint64Bytes(b)
+	return v, false
+}
+
+// the sizes of the prefixes that AppendString, AppendBytes,
+// Append{Map,Array}Header and AppendExtension write
+func strPrefixSize(l int) int {
+	switch {
+	case l <= 31:
+		return 1
+	case l <= math.MaxUint8:
+		return 2
+	case l <= math.MaxUint16:
+		return 3
+	default:
+		return 5
+	}
+}
+
+func binPrefixSize(l int) int {
+	switch {
+	case l <= math.MaxUint8:
+		return 2
+	case l <= math.MaxUint16:
+		return 3
+	default:
+		return 5
+	}
+}
+
+func headerSize(sz int) int {
+	switch {
+	case sz <= 15:
+		return 1
+	case sz <= math.MaxUint16:
+		return 3
+	default:
+		return 5
+	}
+}
+
+func extPrefixSize(l int) int {
+	switch {
+	case l == 1, l == 2, l == 4, l == 8, l == 16:
+		return 2
+	case l < math.MaxUint8:
+		return 3
+	case l < math.MaxUint16:
+		return 4
+	default:
+		return 6
+	}
+}
@@ -0,0 +1,82 @@
+package msgp
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestIsCanonical(t *testing.T) {
+	canonical := [][]byte{
+		AppendInt64(nil, 5),
+		AppendInt64(nil, -5),
+		AppendInt64(nil, -200),
+		AppendUint64(nil, math.MaxUint64),
+		AppendString(nil, "abc"),
+		AppendString(nil, string(make([]byte, 40))),
+		AppendBytes(nil, []byte{1}),
+		AppendTime(nil, time.Unix(1700000000, 0)),
+		AppendFloat32(nil, 1.5),
+		testExtension(t, 0),
+		testExtension(t, 3),
+		testExtension(t, 300),
+		testMap(AppendInt64(nil, -1), AppendInt64(nil, 0), AppendUint64(nil, 300)),
+		testMap(AppendString(nil, "a"), AppendString(nil, "ab"), AppendString(nil, "b")),
+		AppendBool(AppendNil(AppendArrayHeader(nil, 2)), true),
+		AppendIntf(nil, map[string]interface{}{"z": []interface{}{int64(1)}, "a": "x"}),
+	}
+	for _, b := range canonical {
+		if ok, err := IsCanonical(b); !ok || err != nil {
+			t.Errorf("%x: not canonical: %v", b, err)
+		}
+	}
+
+	for name, b := range map[string][]byte{
+		// a non-negative int8
+		"int8 5":           {mint8, 5},
+		"uint8 5":          {muint8, 5},
+		"uint16 200":       {muint16, 0, 200},
+		"int16 -5":         {mint16, 0xff, 0xfb},
+		"str8 abc":         {mstr8, 3, 'a', 'b', 'c'},
+		"map16 header":     {mmap16, 0, 0},
+		"array32 header":   {marray32, 0, 0, 0, 0},
+		"bin16":            {mbin16, 0, 1, 0},
+		"ext8 of 4":        {mext8, 4, 1, 0, 0, 0, 0},
+		"trailing byte":    append(AppendInt64(nil, 1), 0),
+		"nested":           append(AppendArrayHeader(nil, 1), mint8, 5),
+		"key order":        testMap(AppendString(nil, "b"), AppendString(nil, "a")),
+		"duplicate key":    testMap(AppendString(nil, "a"), AppendString(nil, "a")),
+		"int key order":    testMap(AppendInt64(nil, 1), AppendInt64(nil, -1)),
+		"noncanonical key": testMap([]byte{mint8, 5}),
+	} {
+		if ok, err := IsCanonical(b); ok || err != nil {
+			t.Errorf("%s (%x): canonical %v, error %v", name, b, ok, err)
+		}
+	}
+
+	for _, b := range [][]byte{nil, {mstr8, 3, 'a'}, AppendArrayHeader(nil, 5), {0xc1}} {
+		if _, err := IsCanonical(b); err == nil {
+			t.Errorf("%x: no error", b)
+		}
+	}
+}
+
+// testMap returns the encoding of a map with the given
+// encoded keys, in order, and 'nil' values
+func testMap(keys ...[]byte) []byte {
+	b := AppendMapHeader(nil, uint32(len(keys)))
+	for _, k := range keys {
+		b = AppendNil(append(b, k...))
+	}
+	return b
+}
+
+// testExtension returns the encoding of an l-byte extension
+func testExtension(t *testing.T, l int) []byte {
+	t.Helper()
+	b, err := AppendExtension(nil, &RawExtension{Type: 10, Data: make([]byte, l)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
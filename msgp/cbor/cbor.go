@@ -0,0 +1,138 @@
+// Package cbor provides the primitives used by
+// the MarshalCBOR and UnmarshalCBOR methods that
+// msgp generates with -cbor. They mirror the
+// AppendXxx and ReadXxxBytes functions of package
+// msgp, but encode CBOR (RFC 8949) data items.
+//
+// Only definite-length items of the major types
+// for integers, byte and text strings, arrays and
+// maps are supported, along with the simple values
+// false, true and null.
+package cbor
+
+import "fmt"
+
+// Major is the major type of a CBOR data item,
+// which sits in the top three bits of its head.
+type Major uint8
+
+const (
+	UintType    Major = 0
+	NegIntType  Major = 1
+	BytesType   Major = 2
+	StringType  Major = 3
+	ArrayType   Major = 4
+	MapType     Major = 5
+	TagType     Major = 6
+	SimpleType  Major = 7 // including floats
+	InvalidType Major = 0xff
+)
+
+// String implements fmt.Stringer
+func (m Major) String() string {
+	switch m {
+	case UintType:
+		return "uint"
+	case NegIntType:
+		return "negint"
+	case BytesType:
+		return "bytes"
+	case StringType:
+		return "text"
+	case ArrayType:
+		return "array"
+	case MapType:
+		return "map"
+	case TagType:
+		return "tag"
+	case SimpleType:
+		return "simple"
+	default:
+		return "<invalid>"
+	}
+}
+
+const (
+	// additional information, in the low five
+	// bits of the head, for arguments that
+	// follow the head
+	info8  = 24
+	info16 = 25
+	info32 = 26
+	info64 = 27
+
+	// indefinite length, which isn't supported
+	infoIndefinite = 31
+
+	cfalse = 0xf4
+	ctrue  = 0xf5
+	cnull  = 0xf6
+)
+
+// TypeError is returned when a data item
+// of one major type is read as another.
+type TypeError struct {
+	Wanted Major
+	Got    Major
+}
+
+// Error implements error
+func (t TypeError) Error() string {
+	return fmt.Sprintf("cbor: attempted to decode type %q with method for %q", t.Got, t.Wanted)
+}
+
+// Resumable returns true for TypeErrors
+func (t TypeError) Resumable() bool { return true }
+
+// ErrIndefiniteLength is returned when
+// reading an indefinite-length item.
+var ErrIndefiniteLength error = errIndefinite{}
+
+type errIndefinite struct{}
+
+func (e errIndefinite) Error() string   { return "cbor: indefinite-length items are not supported" }
+func (e errIndefinite) Resumable() bool { return false }
+
+// InvalidHeadError is returned when the head of a
+// data item has additional information reserved by
+// RFC 8949.
+type InvalidHeadError byte
+
+// Error implements error
+func (i InvalidHeadError) Error() string {
+	return fmt.Sprintf("cbor: unknown or reserved head byte 0x%x", byte(i))
+}
+
+// Resumable returns false for InvalidHeadErrors
+func (i InvalidHeadError) Resumable() bool { return false }
+
+// ErrBadSimple is returned when a simple value
+// other than the one being read is found.
+type ErrBadSimple struct {
+	Wanted string
+	Got    byte
+}
+
+// Error implements error
+func (e ErrBadSimple) Error() string {
+	return fmt.Sprintf("cbor: wanted %s; found simple value 0x%x", e.Wanted, e.Got)
+}
+
+// Resumable returns true for ErrBadSimple
+func (e ErrBadSimple) Resumable() bool { return true }
+
+// NextType returns the major type of
+// the next data item in 'b', or
+// InvalidType if 'b' is empty.
+func NextType(b []byte) Major {
+	if len(b) == 0 {
+		return InvalidType
+	}
+	return Major(b[0] >> 5)
+}
+
+// IsNil returns true if the next data
+// item in 'b' is null.
+func IsNil(b []byte) bool {
+	return len(b) > 0 && b[0] == cnull
+}
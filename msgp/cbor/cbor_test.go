@@ -0,0 +1,167 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"testing"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// examples from RFC 8949, Appendix A
+func TestAppendVectors(t *testing.T) {
+	cases := []struct {
+		enc  []byte
+		want string
+	}{
+		{AppendUint64(nil, 0), "00"},
+		{AppendUint64(nil, 1), "01"},
+		{AppendUint64(nil, 10), "0a"},
+		{AppendUint64(nil, 23), "17"},
+		{AppendUint64(nil, 24), "1818"},
+		{AppendUint64(nil, 25), "1819"},
+		{AppendUint64(nil, 100), "1864"},
+		{AppendUint64(nil, 1000), "1903e8"},
+		{AppendUint64(nil, 1000000), "1a000f4240"},
+		{AppendUint64(nil, 1000000000000), "1b000000e8d4a51000"},
+		{AppendUint64(nil, math.MaxUint64), "1bffffffffffffffff"},
+		{AppendInt64(nil, -1), "20"},
+		{AppendInt64(nil, -10), "29"},
+		{AppendInt64(nil, -100), "3863"},
+		{AppendInt64(nil, -1000), "3903e7"},
+		{AppendInt64(nil, math.MinInt64), "3b7fffffffffffffff"},
+		{AppendBool(nil, false), "f4"},
+		{AppendBool(nil, true), "f5"},
+		{AppendNil(nil), "f6"},
+		{AppendBytes(nil, nil), "40"},
+		{AppendBytes(nil, []byte{1, 2, 3, 4}), "4401020304"},
+		{AppendString(nil, ""), "60"},
+		{AppendString(nil, "a"), "6161"},
+		{AppendString(nil, "IETF"), "6449455446"},
+		{AppendString(nil, "ü"), "62c3bc"},
+		{AppendArrayHeader(nil, 0), "80"},
+		{AppendArrayHeader(nil, 25), "9819"},
+		{AppendMapHeader(nil, 0), "a0"},
+		{AppendMapHeader(nil, 2), "a2"},
+	}
+	for _, c := range cases {
+		if got := hex.EncodeToString(c.enc); got != c.want {
+			t.Errorf("expected %s; got %s", c.want, got)
+		}
+	}
+}
+
+func TestReadInts(t *testing.T) {
+	ints := []int64{0, 1, 23, 24, -1, -24, -25, 255, 256, -256, -257, math.MaxInt32, math.MinInt32, math.MaxInt64, math.MinInt64}
+	for _, i := range ints {
+		b := AppendInt64(nil, i)
+		got, o, err := ReadInt64Bytes(b)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		if got != i || len(o) != 0 {
+			t.Errorf("%d: read %d with %d bytes left", i, got, len(o))
+		}
+	}
+
+	_, _, err := ReadUint64Bytes(AppendInt64(nil, -3))
+	if e, ok := err.(msgp.UintBelowZero); !ok || e.Value != -3 {
+		t.Errorf("expected UintBelowZero{-3}; got %v", err)
+	}
+	_, _, err = ReadInt8Bytes(AppendInt64(nil, 200))
+	if _, ok := err.(msgp.IntOverflow); !ok {
+		t.Errorf("expected IntOverflow; got %v", err)
+	}
+	_, _, err = ReadUint16Bytes(AppendUint64(nil, 1<<16))
+	if _, ok := err.(msgp.UintOverflow); !ok {
+		t.Errorf("expected UintOverflow; got %v", err)
+	}
+	_, _, err = ReadInt64Bytes(AppendUint64(nil, math.MaxUint64))
+	if err == nil {
+		t.Error("expected an overflow reading MaxUint64 as an int64")
+	}
+	_, _, err = ReadInt64Bytes(AppendString(nil, "1"))
+	if e, ok := err.(TypeError); !ok || e.Got != StringType {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+	_, _, err = ReadUint32Bytes(mustHex(t, "1a000f42"))
+	if err != msgp.ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+}
+
+func TestReadStrings(t *testing.T) {
+	b := AppendString(nil, "hello")
+	b = AppendBytes(b, []byte("world"))
+	b = AppendBool(b, true)
+	s, b, err := ReadStringBytes(b)
+	if err != nil || s != "hello" {
+		t.Fatalf("read %q: %v", s, err)
+	}
+	v, b, err := ReadBytesBytes(b, nil)
+	if err != nil || string(v) != "world" {
+		t.Fatalf("read %q: %v", v, err)
+	}
+	tr, b, err := ReadBoolBytes(b)
+	if err != nil || !tr || len(b) != 0 {
+		t.Fatalf("read %v with %d bytes left: %v", tr, len(b), err)
+	}
+
+	// text and byte strings are distinct
+	if _, _, err = ReadBytesBytes(AppendString(nil, "x"), nil); err == nil {
+		t.Error("read a text string as bytes")
+	}
+	if _, _, err = ReadStringBytes(mustHex(t, "6449")); err != msgp.ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+	if _, _, err = ReadStringBytes(mustHex(t, "7f6161ff")); err != ErrIndefiniteLength {
+		t.Errorf("expected ErrIndefiniteLength; got %v", err)
+	}
+
+	var into [4]byte
+	if _, err = ReadExactBytes(AppendBytes(nil, []byte{1, 2, 3}), into[:]); err == nil {
+		t.Error("read 3 bytes into [4]byte")
+	}
+	if _, err = ReadExactBytes(AppendBytes(nil, []byte{1, 2, 3, 4}), into[:]); err != nil || into != [4]byte{1, 2, 3, 4} {
+		t.Errorf("read %v: %v", into, err)
+	}
+}
+
+func TestReadHeaders(t *testing.T) {
+	b := AppendArrayHeader(nil, 1000)
+	b = AppendMapHeader(b, 3)
+	b = AppendNil(b)
+	sz, isnil, b, err := ReadArrayHeaderBytes(b)
+	if err != nil || sz != 1000 || isnil {
+		t.Fatalf("read %d, %v: %v", sz, isnil, err)
+	}
+	sz, isnil, b, err = ReadMapHeaderBytes(b)
+	if err != nil || sz != 3 || isnil {
+		t.Fatalf("read %d, %v: %v", sz, isnil, err)
+	}
+	sz, isnil, b, err = ReadMapHeaderBytes(b)
+	if err != nil || sz != 0 || !isnil || len(b) != 0 {
+		t.Fatalf("read %d, %v with %d bytes left: %v", sz, isnil, len(b), err)
+	}
+
+	_, _, _, err = ReadMapHeaderBytes(AppendArrayHeader(nil, 1))
+	if e, ok := err.(TypeError); !ok || e.Wanted != MapType || e.Got != ArrayType {
+		t.Errorf("expected TypeError; got %v", err)
+	}
+	_, _, _, err = ReadArrayHeaderBytes(mustHex(t, "9c"))
+	if _, ok := err.(InvalidHeadError); !ok {
+		t.Errorf("expected InvalidHeadError; got %v", err)
+	}
+	if !bytes.Equal(AppendArrayHeader(nil, math.MaxUint32), mustHex(t, "9affffffff")) {
+		t.Error("bad 32-bit array header")
+	}
+}
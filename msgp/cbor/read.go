@@ -0,0 +1,412 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/algorand/msgp/msgp"
+)
+
+// readHead reads the head of a data item from 'b',
+// and returns its major type and argument.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - ErrIndefiniteLength (indefinite-length item)
+// - InvalidHeadError (reserved additional information)
+func readHead(b []byte) (m Major, u uint64, o []byte, err error) {
+	l := len(b)
+	if l < 1 {
+		return 0, 0, b, msgp.ErrShortBytes
+	}
+
+	m = Major(b[0] >> 5)
+	info := b[0] & 0x1f
+	switch {
+	case info < info8:
+		return m, uint64(info), b[1:], nil
+
+	case info == info8:
+		if l < 2 {
+			return m, 0, b, msgp.ErrShortBytes
+		}
+		return m, uint64(b[1]), b[2:], nil
+
+	case info == info16:
+		if l < 3 {
+			return m, 0, b, msgp.ErrShortBytes
+		}
+		return m, uint64(binary.BigEndian.Uint16(b[1:])), b[3:], nil
+
+	case info == info32:
+		if l < 5 {
+			return m, 0, b, msgp.ErrShortBytes
+		}
+		return m, uint64(binary.BigEndian.Uint32(b[1:])), b[5:], nil
+
+	case info == info64:
+		if l < 9 {
+			return m, 0, b, msgp.ErrShortBytes
+		}
+		return m, binary.BigEndian.Uint64(b[1:]), b[9:], nil
+
+	case info == infoIndefinite:
+		return m, 0, b, ErrIndefiniteLength
+
+	default:
+		return m, 0, b, InvalidHeadError(b[0])
+	}
+}
+
+// readLength reads the head of an item of major
+// type 'want' from 'b', and returns its length.
+func readLength(b []byte, want Major) (sz int, o []byte, err error) {
+	m, u, o, err := readHead(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if m != want {
+		return 0, b, TypeError{Wanted: want, Got: m}
+	}
+	if u > uint64(msgp.MaxInt) {
+		return 0, b, msgp.ErrOverflow(u, uint64(msgp.MaxInt))
+	}
+	return int(u), o, nil
+}
+
+// ReadNilBytes tries to read a null
+// off of 'b' and return the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - ErrBadSimple (not a null)
+func ReadNilBytes(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return b, msgp.ErrShortBytes
+	}
+	if b[0] != cnull {
+		return b, ErrBadSimple{Wanted: "null", Got: b[0]}
+	}
+	return b[1:], nil
+}
+
+// ReadBoolBytes tries to read a bool
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not a simple value)
+// - ErrBadSimple (not true or false)
+func ReadBoolBytes(b []byte) (bool, []byte, error) {
+	if len(b) < 1 {
+		return false, b, msgp.ErrShortBytes
+	}
+	switch b[0] {
+	case ctrue:
+		return true, b[1:], nil
+	case cfalse:
+		return false, b[1:], nil
+	}
+	if m := NextType(b); m != SimpleType {
+		return false, b, TypeError{Wanted: SimpleType, Got: m}
+	}
+	return false, b, ErrBadSimple{Wanted: "bool", Got: b[0]}
+}
+
+// ReadInt64Bytes tries to read an int64
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.ErrOverflow (value too large for int64)
+func ReadInt64Bytes(b []byte) (int64, []byte, error) {
+	m, u, o, err := readHead(b)
+	if err != nil {
+		return 0, b, err
+	}
+	if m != UintType && m != NegIntType {
+		return 0, b, TypeError{Wanted: UintType, Got: m}
+	}
+	if u > math.MaxInt64 {
+		return 0, b, msgp.ErrOverflow(u, math.MaxInt64)
+	}
+	if m == NegIntType {
+		return ^int64(u), o, nil
+	}
+	return int64(u), o, nil
+}
+
+// ReadInt32Bytes tries to read an int32
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.IntOverflow{} (value too large for int32)
+func ReadInt32Bytes(b []byte) (int32, []byte, error) {
+	i, o, err := ReadInt64Bytes(b)
+	if err == nil && (i > math.MaxInt32 || i < math.MinInt32) {
+		return 0, b, msgp.IntOverflow{Value: i, FailedBitsize: 32}
+	}
+	return int32(i), o, err
+}
+
+// ReadInt16Bytes tries to read an int16
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.IntOverflow{} (value too large for int16)
+func ReadInt16Bytes(b []byte) (int16, []byte, error) {
+	i, o, err := ReadInt64Bytes(b)
+	if err == nil && (i > math.MaxInt16 || i < math.MinInt16) {
+		return 0, b, msgp.IntOverflow{Value: i, FailedBitsize: 16}
+	}
+	return int16(i), o, err
+}
+
+// ReadInt8Bytes tries to read an int8
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.IntOverflow{} (value too large for int8)
+func ReadInt8Bytes(b []byte) (int8, []byte, error) {
+	i, o, err := ReadInt64Bytes(b)
+	if err == nil && (i > math.MaxInt8 || i < math.MinInt8) {
+		return 0, b, msgp.IntOverflow{Value: i, FailedBitsize: 8}
+	}
+	return int8(i), o, err
+}
+
+// ReadIntBytes tries to read an int
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.IntOverflow{} (value too large for int32 on 32-bit platforms)
+func ReadIntBytes(b []byte) (int, []byte, error) {
+	if msgp.MaxInt == math.MaxInt32 {
+		i, o, err := ReadInt32Bytes(b)
+		return int(i), o, err
+	}
+	i, o, err := ReadInt64Bytes(b)
+	return int(i), o, err
+}
+
+// ReadUint64Bytes tries to read a uint64
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.UintBelowZero{} (negative integer)
+func ReadUint64Bytes(b []byte) (uint64, []byte, error) {
+	m, u, o, err := readHead(b)
+	if err != nil {
+		return 0, b, err
+	}
+	switch m {
+	case UintType:
+		return u, o, nil
+	case NegIntType:
+		v := int64(math.MinInt64)
+		if u <= math.MaxInt64 {
+			v = ^int64(u)
+		}
+		return 0, b, msgp.UintBelowZero{Value: v}
+	default:
+		return 0, b, TypeError{Wanted: UintType, Got: m}
+	}
+}
+
+// ReadUint32Bytes tries to read a uint32
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.UintOverflow{} (value too large for uint32)
+func ReadUint32Bytes(b []byte) (uint32, []byte, error) {
+	u, o, err := ReadUint64Bytes(b)
+	if err == nil && u > math.MaxUint32 {
+		return 0, b, msgp.UintOverflow{Value: u, FailedBitsize: 32}
+	}
+	return uint32(u), o, err
+}
+
+// ReadUint16Bytes tries to read a uint16
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.UintOverflow{} (value too large for uint16)
+func ReadUint16Bytes(b []byte) (uint16, []byte, error) {
+	u, o, err := ReadUint64Bytes(b)
+	if err == nil && u > math.MaxUint16 {
+		return 0, b, msgp.UintOverflow{Value: u, FailedBitsize: 16}
+	}
+	return uint16(u), o, err
+}
+
+// ReadUint8Bytes tries to read a uint8
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.UintOverflow{} (value too large for uint8)
+func ReadUint8Bytes(b []byte) (uint8, []byte, error) {
+	u, o, err := ReadUint64Bytes(b)
+	if err == nil && u > math.MaxUint8 {
+		return 0, b, msgp.UintOverflow{Value: u, FailedBitsize: 8}
+	}
+	return uint8(u), o, err
+}
+
+// ReadByteBytes is analogous to ReadUint8Bytes
+func ReadByteBytes(b []byte) (byte, []byte, error) {
+	return ReadUint8Bytes(b)
+}
+
+// ReadUintBytes tries to read a uint
+// from 'b' and return the value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an integer)
+// - msgp.UintOverflow{} (value too large for uint32 on 32-bit platforms)
+func ReadUintBytes(b []byte) (uint, []byte, error) {
+	if msgp.MaxInt == math.MaxInt32 {
+		u, o, err := ReadUint32Bytes(b)
+		return uint(u), o, err
+	}
+	u, o, err := ReadUint64Bytes(b)
+	return uint(u), o, err
+}
+
+// ReadArrayHeaderBytes attempts to read
+// the array header size off of 'b' and return
+// the size and remaining bytes. A null is
+// read as an empty array, with isnil set.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not an array)
+func ReadArrayHeaderBytes(b []byte) (sz int, isnil bool, o []byte, err error) {
+	if IsNil(b) {
+		return 0, true, b[1:], nil
+	}
+	sz, o, err = readLength(b, ArrayType)
+	return
+}
+
+// ReadMapHeaderBytes reads a map header size
+// from 'b' and returns the remaining bytes. A
+// null is read as an empty map, with isnil set.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not a map)
+func ReadMapHeaderBytes(b []byte) (sz int, isnil bool, o []byte, err error) {
+	if IsNil(b) {
+		return 0, true, b[1:], nil
+	}
+	sz, o, err = readLength(b, MapType)
+	return
+}
+
+// ReadBytesBytesHeader reads the head of a byte
+// string from 'b' and returns its length, in bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not a byte string)
+func ReadBytesBytesHeader(b []byte) (sz int, err error) {
+	sz, _, err = readLength(b, BytesType)
+	return
+}
+
+// ReadStringHeaderBytes reads the head of a text
+// string from 'b' and returns its length, in bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (too few bytes)
+// - TypeError{} (not a text string)
+func ReadStringHeaderBytes(b []byte) (sz int, err error) {
+	sz, _, err = readLength(b, StringType)
+	return
+}
+
+// readContents reads a byte or text string of
+// major type 'want' without copying it.
+func readContents(b []byte, want Major) (v []byte, o []byte, err error) {
+	sz, o, err := readLength(b, want)
+	if err != nil {
+		return nil, b, err
+	}
+	if len(o) < sz {
+		return nil, b, msgp.ErrShortBytes
+	}
+	return o[:sz], o[sz:], nil
+}
+
+// ReadBytesZC reads a byte string from 'b'
+// without copying it. The returned []byte
+// points to the same memory as the input slice.
+// Possible errors:
+// - msgp.ErrShortBytes (b not long enough)
+// - TypeError{} (not a byte string)
+func ReadBytesZC(b []byte) (v []byte, o []byte, err error) {
+	return readContents(b, BytesType)
+}
+
+// ReadBytesBytes reads a byte string from 'b' and
+// returns its value and the remaining bytes. The value
+// is copied into 'scratch' if it is large enough.
+// As with msgp.ReadBytesBytes, an empty byte string
+// is read as a non-nil slice only if 'scratch' is
+// non-nil.
+// Possible errors:
+// - msgp.ErrShortBytes (b not long enough)
+// - TypeError{} (not a byte string)
+func ReadBytesBytes(b []byte, scratch []byte) (v []byte, o []byte, err error) {
+	zc, o, err := readContents(b, BytesType)
+	if err != nil {
+		return nil, b, err
+	}
+	if scratch != nil && cap(scratch) >= len(zc) {
+		v = scratch[0:len(zc)]
+	} else {
+		v = make([]byte, len(zc))
+	}
+	copy(v, zc)
+	return v, o, nil
+}
+
+// ReadExactBytes reads a byte string of exactly
+// len(into) bytes from 'b' into 'into', and returns
+// the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (b not long enough)
+// - TypeError{} (not a byte string)
+// - msgp.ArrayError{} (wrong length)
+func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
+	zc, o, err := readContents(b, BytesType)
+	if err != nil {
+		return b, err
+	}
+	if len(zc) != len(into) {
+		return b, msgp.ArrayError{Wanted: len(into), Got: len(zc)}
+	}
+	copy(into, zc)
+	return o, nil
+}
+
+// ReadStringZC reads a text string from 'b'
+// without copying it. The returned []byte
+// points to the same memory as the input slice.
+// Possible errors:
+// - msgp.ErrShortBytes (b not long enough)
+// - TypeError{} (not a text string)
+func ReadStringZC(b []byte) (v []byte, o []byte, err error) {
+	return readContents(b, StringType)
+}
+
+// ReadStringBytes reads a text string from 'b'
+// and returns its value and the remaining bytes.
+// Possible errors:
+// - msgp.ErrShortBytes (b not long enough)
+// - TypeError{} (not a text string)
+func ReadStringBytes(b []byte) (string, []byte, error) {
+	v, o, err := ReadStringZC(b)
+	return string(v), o, err
+}
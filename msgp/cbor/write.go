@@ -0,0 +1,96 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// appendHead appends the head of an item
+// of major type 'm' with argument 'u',
+// using the shortest encoding of 'u'.
+func appendHead(b []byte, m Major, u uint64) []byte {
+	mt := byte(m) << 5
+	switch {
+	case u < info8:
+		return append(b, mt|byte(u))
+	case u <= math.MaxUint8:
+		return append(b, mt|info8, byte(u))
+	case u <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, mt|info16), uint16(u))
+	case u <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, mt|info32), uint32(u))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, mt|info64), u)
+	}
+}
+
+// AppendNil appends a null to the slice
+func AppendNil(b []byte) []byte { return append(b, cnull) }
+
+// AppendBool appends a bool to the slice
+func AppendBool(b []byte, t bool) []byte {
+	if t {
+		return append(b, ctrue)
+	}
+	return append(b, cfalse)
+}
+
+// AppendInt64 appends an int64 to the slice
+func AppendInt64(b []byte, i int64) []byte {
+	if i >= 0 {
+		return appendHead(b, UintType, uint64(i))
+	}
+	return appendHead(b, NegIntType, ^uint64(i))
+}
+
+// AppendInt appends an int to the slice
+func AppendInt(b []byte, i int) []byte { return AppendInt64(b, int64(i)) }
+
+// AppendInt8 appends an int8 to the slice
+func AppendInt8(b []byte, i int8) []byte { return AppendInt64(b, int64(i)) }
+
+// AppendInt16 appends an int16 to the slice
+func AppendInt16(b []byte, i int16) []byte { return AppendInt64(b, int64(i)) }
+
+// AppendInt32 appends an int32 to the slice
+func AppendInt32(b []byte, i int32) []byte { return AppendInt64(b, int64(i)) }
+
+// AppendUint64 appends a uint64 to the slice
+func AppendUint64(b []byte, u uint64) []byte { return appendHead(b, UintType, u) }
+
+// AppendUint appends a uint to the slice
+func AppendUint(b []byte, u uint) []byte { return AppendUint64(b, uint64(u)) }
+
+// AppendUint8 appends a uint8 to the slice
+func AppendUint8(b []byte, u uint8) []byte { return AppendUint64(b, uint64(u)) }
+
+// AppendByte is analogous to AppendUint8
+func AppendByte(b []byte, u byte) []byte { return AppendUint8(b, u) }
+
+// AppendUint16 appends a uint16 to the slice
+func AppendUint16(b []byte, u uint16) []byte { return AppendUint64(b, uint64(u)) }
+
+// AppendUint32 appends a uint32 to the slice
+func AppendUint32(b []byte, u uint32) []byte { return AppendUint64(b, uint64(u)) }
+
+// AppendBytes appends bytes to the slice as a byte string
+func AppendBytes(b []byte, bts []byte) []byte {
+	return append(appendHead(b, BytesType, uint64(len(bts))), bts...)
+}
+
+// AppendString appends a string to the slice as a text string
+func AppendString(b []byte, s string) []byte {
+	return append(appendHead(b, StringType, uint64(len(s))), s...)
+}
+
+// AppendArrayHeader appends an array header with
+// the given size to the slice
+func AppendArrayHeader(b []byte, sz uint32) []byte {
+	return appendHead(b, ArrayType, uint64(sz))
+}
+
+// AppendMapHeader appends a map header with the
+// given size to the slice
+func AppendMapHeader(b []byte, sz uint32) []byte {
+	return appendHead(b, MapType, uint64(sz))
+}
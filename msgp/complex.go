@@ -0,0 +1,89 @@
+package msgp
+
+// The functions in this file encode a complex number
+// in the form selected by the complex=array codec tag
+// option, rather than as the extension written by
+// AppendComplex64 and AppendComplex128: an array of
+// its real and imaginary parts, as float32 parts for
+// a complex64, and float64 parts for a complex128.
+// Like ReadFloat64Bytes, the readers read 'nil' as 0,
+// and the float64 readers also accept float32 parts.
+
+// AppendComplex64Array appends a complex64 to the
+// slice as an array of its real and imaginary parts.
+func AppendComplex64Array(b []byte, c complex64) []byte {
+	b = AppendArrayHeader(b, 2)
+	b = AppendFloat32(b, real(c))
+	return AppendFloat32(b, imag(c))
+}
+
+// ReadComplex64ArrayBytes reads a complex64 encoded
+// by AppendComplex64Array from 'b' and returns the
+// value and the remaining bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an array of float32s)
+// - ArrayError{} (not 2 parts)
+func ReadComplex64ArrayBytes(b []byte) (c complex64, o []byte, err error) {
+	if IsNil(b) {
+		return 0, b[1:], nil
+	}
+	o, err = readComplexArrayHeader(b)
+	if err != nil {
+		return 0, b, err
+	}
+	var re, im float32
+	if re, o, err = ReadFloat32Bytes(o); err != nil {
+		return 0, b, WrapError(err, 0)
+	}
+	if im, o, err = ReadFloat32Bytes(o); err != nil {
+		return 0, b, WrapError(err, 1)
+	}
+	return complex(re, im), o, nil
+}
+
+// AppendComplex128Array appends a complex128 to the
+// slice as an array of its real and imaginary parts.
+func AppendComplex128Array(b []byte, c complex128) []byte {
+	b = AppendArrayHeader(b, 2)
+	b = AppendFloat64(b, real(c))
+	return AppendFloat64(b, imag(c))
+}
+
+// ReadComplex128ArrayBytes reads a complex128 encoded
+// by AppendComplex128Array from 'b' and returns the
+// value and the remaining bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an array of floats)
+// - ArrayError{} (not 2 parts)
+func ReadComplex128ArrayBytes(b []byte) (c complex128, o []byte, err error) {
+	if IsNil(b) {
+		return 0, b[1:], nil
+	}
+	o, err = readComplexArrayHeader(b)
+	if err != nil {
+		return 0, b, err
+	}
+	var re, im float64
+	if re, o, err = ReadFloat64Bytes(o); err != nil {
+		return 0, b, WrapError(err, 0)
+	}
+	if im, o, err = ReadFloat64Bytes(o); err != nil {
+		return 0, b, WrapError(err, 1)
+	}
+	return complex(re, im), o, nil
+}
+
+// readComplexArrayHeader reads the header of
+// an array of the 2 parts of a complex number
+func readComplexArrayHeader(b []byte) ([]byte, error) {
+	sz, _, o, err := readArrayHeaderBytes(b, false)
+	if err != nil {
+		return b, err
+	}
+	if sz != 2 {
+		return b, ArrayError{Wanted: 2, Got: sz}
+	}
+	return o, nil
+}
@@ -0,0 +1,75 @@
+package msgp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestAppendReadComplexArrays(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	for _, in := range []complex128{
+		0,
+		complex(1.5, -2.25),
+		complex(nan, 0),
+		complex(0, nan),
+		complex(inf, -inf),
+		complex(math.MaxFloat64, math.SmallestNonzeroFloat64),
+	} {
+		bts := AppendComplex128Array(nil, in)
+		if len(bts) != Complex128ArraySize {
+			t.Errorf("%v encoded to %d bytes; want %d", in, len(bts), Complex128ArraySize)
+		}
+		if sz, _, _, err := ReadArrayHeaderBytes(bts); sz != 2 || err != nil {
+			t.Errorf("%v: not an array of 2 parts", in)
+		}
+		out, left, err := ReadComplex128ArrayBytes(bts)
+		if err != nil || len(left) != 0 {
+			t.Fatalf("%v: %d bytes left, %v", in, len(left), err)
+		}
+		if !sameComplex(in, out) {
+			t.Errorf("%v decoded as %v", in, out)
+		}
+
+		in64 := complex64(in)
+		bts = AppendComplex64Array(nil, in64)
+		if len(bts) != Complex64ArraySize {
+			t.Errorf("%v encoded to %d bytes; want %d", in64, len(bts), Complex64ArraySize)
+		}
+		out64, left, err := ReadComplex64ArrayBytes(bts)
+		if err != nil || len(left) != 0 {
+			t.Fatalf("%v: %d bytes left, %v", in64, len(left), err)
+		}
+		if !sameComplex(complex128(in64), complex128(out64)) {
+			t.Errorf("%v decoded as %v", in64, out64)
+		}
+	}
+
+	// a peer's float32 parts of a complex128
+	bts := AppendFloat32(AppendFloat32(AppendArrayHeader(nil, 2), 1), 2)
+	if c, _, err := ReadComplex128ArrayBytes(bts); c != complex(1, 2) || err != nil {
+		t.Errorf("float32 parts: %v, %v", c, err)
+	}
+	for _, bad := range [][]byte{
+		AppendComplex128(nil, 1),
+		AppendFloat64(AppendArrayHeader(nil, 1), 1),
+		AppendString(AppendFloat64(AppendArrayHeader(nil, 2), 1), "x"),
+		AppendFloat64(AppendArrayHeader(nil, 2), 1),
+	} {
+		if _, _, err := ReadComplex128ArrayBytes(bad); err == nil {
+			t.Errorf("%x decoded as a complex128", bad)
+		}
+	}
+	if _, _, err := ReadComplex64ArrayBytes(AppendComplex128Array(nil, 1)); err == nil {
+		t.Error("float64 parts decoded as a complex64")
+	}
+}
+
+// sameComplex compares the parts of a and b, with NaN equal to NaN
+func sameComplex(a, b complex128) bool {
+	if cmplx.IsNaN(a) || cmplx.IsNaN(b) {
+		same := func(x, y float64) bool { return x == y || (math.IsNaN(x) && math.IsNaN(y)) }
+		return same(real(a), real(b)) && same(imag(a), imag(b))
+	}
+	return a == b
+}
@@ -0,0 +1,128 @@
+package msgp
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+// DebugBytes is the number of bytes of binary data
+// that AppendDebug writes before cutting it off.
+const DebugBytes = 8
+
+// AppendDebug appends a compact, readable form of 'v'
+// to the slice, for the String methods generated for
+// the types named by the msgp:stringer directive.
+// Binary data, including byte arrays, is written in hex,
+// and only its first DebugBytes bytes are written, then
+// its length.
+// Values with String or Error methods are written by
+// them. Pointers and interfaces are written as what they
+// hold, or <nil>, rather than as addresses, and so are
+// the elements of slices, arrays and maps, whose entries
+// are sorted by their keys as written. Other values are
+// formatted as by fmt's %v.
+func AppendDebug(b []byte, v interface{}) []byte {
+	if bts, ok := v.([]byte); ok {
+		return appendDebugBytes(b, bts)
+	}
+	return appendDebugValue(b, reflect.ValueOf(v))
+}
+
+func appendDebugValue(b []byte, v reflect.Value) []byte {
+	if !v.IsValid() {
+		return append(b, "<nil>"...)
+	}
+	switch x := v.Interface().(type) {
+	case fmt.Stringer, error:
+		return fmt.Append(b, x)
+	}
+	// the elements of slices are addressable, and so
+	// have the methods of pointers to them
+	if v.CanAddr() {
+		switch x := v.Addr().Interface().(type) {
+		case fmt.Stringer, error:
+			return fmt.Append(b, x)
+		}
+	}
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(b, "<nil>"...)
+		}
+		return appendDebugValue(b, v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendDebugBytes(b, v.Bytes())
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Kind() == reflect.Array && v.Type().Elem().Kind() == reflect.Uint8 {
+			bts := make([]byte, v.Len())
+			for i := range bts {
+				bts[i] = byte(v.Index(i).Uint())
+			}
+			return appendDebugBytes(b, bts)
+		}
+		b = append(b, '[')
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = appendDebugValue(b, v.Index(i))
+		}
+		return append(b, ']')
+	case reflect.Map:
+		type entry struct{ k, v []byte }
+		entries := make([]entry, 0, v.Len())
+		for it := v.MapRange(); it.Next(); {
+			entries = append(entries, entry{appendDebugValue(nil, it.Key()), appendDebugValue(nil, it.Value())})
+		}
+		sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].k, entries[j].k) < 0 })
+		b = append(b, "map["...)
+		for i, e := range entries {
+			if i > 0 {
+				b = append(b, ' ')
+			}
+			b = append(append(append(b, e.k...), ':'), e.v...)
+		}
+		return append(b, ']')
+	}
+	return fmt.Append(b, v.Interface())
+}
+
+func appendDebugBytes(b []byte, bts []byte) []byte {
+	if len(bts) == 0 {
+		return append(b, "[]"...)
+	}
+	if len(bts) <= DebugBytes {
+		return appendHex(b, bts)
+	}
+	b = appendHex(b, bts[:DebugBytes])
+	b = append(b, "...("...)
+	b = strconv.AppendInt(b, int64(len(bts)), 10)
+	return append(b, " bytes)"...)
+}
+
+func appendHex(b []byte, bts []byte) []byte {
+	const digits = "0123456789abcdef"
+	for _, c := range bts {
+		b = append(b, digits[c>>4], digits[c&0xf])
+	}
+	return b
+}
+
+// AppendDebugField appends "name:v" to the slice, with
+// 'v' written as by AppendDebug, and separated by a space
+// from the field before it, which ends with anything but
+// the '{' that opens the struct.
+func AppendDebugField(b []byte, name string, v interface{}) []byte {
+	if len(b) > 0 && b[len(b)-1] != '{' {
+		b = append(b, ' ')
+	}
+	b = append(b, name...)
+	b = append(b, ':')
+	return AppendDebug(b, v)
+}
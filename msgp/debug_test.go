@@ -0,0 +1,55 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+type debugInner struct{ N int }
+
+func (d debugInner) String() string {
+	return string(AppendDebugField(append([]byte(nil), "debugInner{"...), "N", d.N)) + "}"
+}
+
+func TestAppendDebug(t *testing.T) {
+	b := append([]byte(nil), "T{"...)
+	b = AppendDebugField(b, "A", int64(-3))
+	b = AppendDebugField(b, "S", "x")
+	b = AppendDebugField(b, "Short", []byte{0xa, 0xb})
+	b = AppendDebugField(b, "Long", bytes.Repeat([]byte{0xff}, 40))
+	b = AppendDebugField(b, "Empty", []byte(nil))
+	b = AppendDebugField(b, "In", debugInner{N: 7})
+	b = AppendDebugField(b, "Ptr", &debugInner{N: 8})
+	b = AppendDebugField(b, "L", []debugInner{{1}, {2}})
+	b = append(b, '}')
+
+	const want = "T{A:-3 S:x Short:0a0b Long:ffffffffffffffff...(40 bytes) Empty:[] " +
+		"In:debugInner{N:7} Ptr:debugInner{N:8} L:[debugInner{N:1} debugInner{N:2}]}"
+	if string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+}
+
+// debugID, like many msgp:text types, has no String method
+type debugID [4]byte
+
+type debugLeaf struct{ N int }
+
+func TestAppendDebugPointers(t *testing.T) {
+	var iface interface{} = &debugLeaf{N: 3}
+	b := append([]byte(nil), "T{"...)
+	// text fields are passed by address
+	b = AppendDebugField(b, "ID", &debugID{1, 2})
+	b = AppendDebugField(b, "Ps", []*debugLeaf{{N: 1}, nil, {N: 2}})
+	b = AppendDebugField(b, "Is", []interface{}{iface, nil, "s"})
+	b = AppendDebugField(b, "Ins", []*debugInner{{N: 4}})
+	b = AppendDebugField(b, "M", map[string]*debugLeaf{"b": {N: 6}, "a": {N: 5}})
+	b = AppendDebugField(b, "Nil", (*debugLeaf)(nil))
+	b = append(b, '}')
+
+	const want = "T{ID:01020000 Ps:[{1} <nil> {2}] Is:[{3} <nil> s] Ins:[debugInner{N:4}] " +
+		"M:map[a:{5} b:{6}] Nil:<nil>}"
+	if string(b) != want {
+		t.Errorf("got  %s\nwant %s", b, want)
+	}
+}
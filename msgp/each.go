@@ -0,0 +1,170 @@
+package msgp
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// ErrStop is returned by the function passed to DecodeEach
+// to stop decoding before the end of the array. DecodeEach
+// returns nil for it.
+var ErrStop = errors.New("msgp: stop decoding")
+
+// eachMaxDepth is how deeply the maps and arrays of
+// an element read by DecodeEach may be nested
+const eachMaxDepth = 512
+
+// DecodeEach decodes an array from 'r' one element at a
+// time, without reading the whole array into memory: it
+// reads the array header, and then reads each element,
+// decodes it with its UnmarshalMsg method, and passes it
+// to fn. A 'nil' is read as an empty array.
+//
+// If reuse is set, every element is decoded into the same
+// T, which is reset to its zero value first, so fn must
+// not keep it past the call; otherwise each element is
+// decoded into a new T. Decoding stops at the first error
+// that fn returns, which DecodeEach returns, unless it is
+// ErrStop.
+//
+// Since the elements are not framed, DecodeEach reads 'r'
+// through a bufio.Reader, and so may read 'r' past the end
+// of the array unless 'r' is a *bufio.Reader.
+// Possible errors:
+// - io.EOF, io.ErrUnexpectedEOF (the array is cut short)
+// - TypeError{} (the object is not an array)
+// - InvalidPrefixError
+// - ErrMaxBytesExceeded (an element is longer than max bytes)
+// - ErrRecursionLimit (an element is nested too deeply)
+// - errors of UnmarshalMsg, with the index of the element
+// as context
+func DecodeEach[T any, PT interface {
+	*T
+	Unmarshaler
+}](r io.Reader, max int, reuse bool, fn func(PT) error) error {
+	var v PT
+	return eachElement(r, max, func(i int, b []byte) error {
+		if v == nil || !reuse {
+			v = new(T)
+		} else {
+			var zero T
+			*v = zero
+		}
+		if _, err := v.UnmarshalMsg(b); err != nil {
+			return WrapError(err, i)
+		}
+		return fn(v)
+	})
+}
+
+// DecodeEachResilient is like DecodeEach, but an element
+// that doesn't decode doesn't stop decoding: fn is passed
+// each element, decoded into a new T, along with the error
+// of its UnmarshalMsg method, if any, with the index of the
+// element as context, and the next element is decoded
+// unless fn returns an error. Since each element is read
+// whole before it is decoded, the next one is found by the
+// MessagePack structure of the array, whatever is wrong
+// with the last one's contents; an element that is not a
+// well-formed MessagePack object, so that the next one
+// can't be found, stops decoding with an error, as it does
+// in DecodeEach, and is not passed to fn.
+func DecodeEachResilient[T any, PT interface {
+	*T
+	Unmarshaler
+}](r io.Reader, max int, fn func(PT, error) error) error {
+	return eachElement(r, max, func(i int, b []byte) error {
+		v := PT(new(T))
+		if _, err := v.UnmarshalMsg(b); err != nil {
+			return fn(v, WrapError(err, i))
+		}
+		return fn(v, nil)
+	})
+}
+
+// eachElement reads an array header from 'r', and then
+// reads each element and passes it to fn, with its index,
+// until fn returns an error, which is returned unless it
+// is ErrStop
+func eachElement(r io.Reader, max int, fn func(i int, b []byte) error) error {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	hdr, err := readObjectPrefix(br, nil)
+	if err != nil {
+		return err
+	}
+	sz, _, _, err := ReadArrayHeaderBytes(hdr)
+	if err != nil {
+		return err
+	}
+	var buf []byte
+	for i := 0; i < sz; i++ {
+		buf, err = appendObject(br, buf[:0], eachMaxDepth, max)
+		if err != nil {
+			return WrapError(noEOF(err), i)
+		}
+		if err = fn(i, buf); err != nil {
+			if err == ErrStop {
+				return nil
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readObjectPrefix reads the prefix of an object from
+// 'r', which holds its type and length, and appends it
+// to 'b'; the prefix of a scalar is the whole object
+func readObjectPrefix(r io.Reader, b []byte) ([]byte, error) {
+	start := len(b)
+	b = append(b, 0)
+	if _, err := io.ReadFull(r, b[start:]); err != nil {
+		return b, err
+	}
+	spec := &sizes[b[start]]
+	if spec.size == 0 {
+		return b, InvalidPrefixError(b[start])
+	}
+	b = append(b, make([]byte, spec.size-1)...)
+	_, err := io.ReadFull(r, b[start+1:])
+	return b, noEOF(err)
+}
+
+// appendObject reads an object from 'r' and appends it
+// to 'b', allowing depth more levels of maps and arrays,
+// as long as 'b' doesn't grow past max bytes
+func appendObject(r io.Reader, b []byte, depth int, max int) ([]byte, error) {
+	start := len(b)
+	b, err := readObjectPrefix(r, b)
+	if err != nil {
+		return b, err
+	}
+	sz, asz, err := getSize(b[start:])
+	if err != nil {
+		return b, err
+	}
+	if uint64(start)+uint64(sz) > uint64(max) {
+		return b, ErrMaxBytesExceeded
+	}
+	if n := int(sz) - len(b[start:]); n > 0 {
+		prefix := len(b)
+		b = append(b, make([]byte, n)...)
+		if _, err = io.ReadFull(r, b[prefix:]); err != nil {
+			return b, noEOF(err)
+		}
+	}
+	if asz > 0 && depth <= 0 {
+		return b, ErrRecursionLimit
+	}
+	for ; asz > 0; asz-- {
+		b, err = appendObject(r, b, depth-1, max)
+		if err != nil {
+			return b, noEOF(err)
+		}
+	}
+	return b, nil
+}
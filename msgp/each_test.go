@@ -0,0 +1,192 @@
+package msgp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// eachRecord is encoded as [id, [tags...]]
+type eachRecord struct {
+	id   int64
+	tags []string
+}
+
+func (e *eachRecord) CanUnmarshalMsg(interface{}) bool { return true }
+func (e *eachRecord) UnmarshalMsg(b []byte) (o []byte, err error) {
+	var sz int
+	if sz, _, o, err = ReadArrayHeaderBytes(b); err != nil || sz != 2 {
+		return b, ArrayError{Wanted: 2, Got: sz}
+	}
+	if e.id, o, err = ReadInt64Bytes(o); err != nil {
+		return b, err
+	}
+	if sz, _, o, err = ReadArrayHeaderBytes(o); err != nil {
+		return b, err
+	}
+	for i := 0; i < sz; i++ {
+		var s string
+		if s, o, err = ReadStringBytes(o); err != nil {
+			return b, err
+		}
+		e.tags = append(e.tags, s)
+	}
+	return o, nil
+}
+
+func appendEachRecord(b []byte, id int64, tags ...string) []byte {
+	b = AppendInt64(AppendArrayHeader(b, 2), id)
+	b = AppendArrayHeader(b, uint32(len(tags)))
+	for _, tag := range tags {
+		b = AppendString(b, tag)
+	}
+	return b
+}
+
+// countingReader counts the bytes read from it
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += n
+	return n, err
+}
+
+func TestDecodeEach(t *testing.T) {
+	const n = 100000
+	b := AppendArrayHeader(nil, n)
+	for i := 0; i < n; i++ {
+		b = appendEachRecord(b, int64(i), "a", "bc")
+	}
+
+	var seen int
+	if err := DecodeEach(bytes.NewReader(b), 64, false, func(e *eachRecord) error {
+		if e.id != int64(seen) || len(e.tags) != 2 || e.tags[1] != "bc" {
+			t.Fatalf("element %d: %+v", seen, *e)
+		}
+		seen++
+		return nil
+	}); err != nil || seen != n {
+		t.Fatalf("decoded %d elements: %v", seen, err)
+	}
+
+	// stopping early leaves the rest of the array unread
+	cr := &countingReader{r: bytes.NewReader(b)}
+	var first *eachRecord
+	seen = 0
+	if err := DecodeEach(cr, 64, true, func(e *eachRecord) error {
+		if first == nil {
+			first = e
+		} else if e != first {
+			t.Fatal("element not reused")
+		}
+		// the reused element is reset, so the tags don't pile up
+		if len(e.tags) != 2 {
+			t.Fatalf("element %d: %+v", seen, *e)
+		}
+		if seen++; seen == 10 {
+			return ErrStop
+		}
+		return nil
+	}); err != nil || seen != 10 {
+		t.Fatalf("decoded %d elements: %v", seen, err)
+	}
+	if cr.n > len(b)/100 {
+		t.Errorf("read %d of %d bytes for 10 elements", cr.n, len(b))
+	}
+
+	boom := errors.New("boom")
+	if err := DecodeEach(bytes.NewReader(b), 64, false, func(*eachRecord) error { return boom }); err != boom {
+		t.Errorf("fn error: %v", err)
+	}
+	if err := DecodeEach(bytes.NewReader(AppendNil(nil)), 64, false, func(*eachRecord) error { return boom }); err != nil {
+		t.Errorf("nil array: %v", err)
+	}
+}
+
+func TestDecodeEachErrors(t *testing.T) {
+	none := func(*eachRecord) error { return nil }
+	b := appendEachRecord(AppendArrayHeader(nil, 2), 1, "x")
+	if err := DecodeEach(bytes.NewReader(b), 64, false, none); Cause(err) != io.ErrUnexpectedEOF {
+		t.Errorf("short array: %v", err)
+	}
+	if err := DecodeEach(bytes.NewReader(b[:len(b)-1]), 64, false, none); Cause(err) != io.ErrUnexpectedEOF {
+		t.Errorf("short element: %v", err)
+	}
+	if err := DecodeEach(bytes.NewReader(b), 4, false, none); Cause(err) != ErrMaxBytesExceeded {
+		t.Errorf("long element: %v", err)
+	}
+	if err := DecodeEach(bytes.NewReader(AppendString(nil, "x")), 64, false, none); err == nil {
+		t.Error("decoded a string")
+	}
+	deep := AppendArrayHeader(nil, 1)
+	for i := 0; i <= eachMaxDepth; i++ {
+		deep = AppendArrayHeader(deep, 1)
+	}
+	deep = AppendNil(deep)
+	if err := DecodeEach(bytes.NewReader(deep), len(deep), false, none); Cause(err) != ErrRecursionLimit {
+		t.Errorf("deep element: %v", err)
+	}
+	if err := DecodeEach(bytes.NewReader(nil), 64, false, none); err != io.EOF {
+		t.Errorf("no array: %v", err)
+	}
+}
+
+func TestDecodeEachResilient(t *testing.T) {
+	// the middle element is well-formed, but its tags are
+	// an int, so it doesn't decode
+	b := appendEachRecord(AppendArrayHeader(nil, 3), 1, "a")
+	b = AppendInt64(AppendInt64(AppendArrayHeader(b, 2), 2), 3)
+	b = appendEachRecord(b, 3, "c")
+
+	var ids []int64
+	var errs []error
+	if err := DecodeEachResilient(bytes.NewReader(b), 64, func(e *eachRecord, err error) error {
+		if err != nil {
+			errs = append(errs, err)
+			return nil
+		}
+		ids = append(ids, e.id)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 3 {
+		t.Errorf("decoded %v", ids)
+	}
+	if len(errs) != 1 || !strings.HasSuffix(errs[0].Error(), "at [1]") {
+		t.Fatalf("errors %v", errs)
+	}
+	if _, ok := Cause(errs[0]).(TypeError); !ok {
+		t.Errorf("error %v", errs[0])
+	}
+
+	// fn decides whether to go on
+	boom := errors.New("boom")
+	seen := 0
+	if err := DecodeEachResilient(bytes.NewReader(b), 64, func(e *eachRecord, err error) error {
+		seen++
+		if err != nil {
+			return boom
+		}
+		return nil
+	}); err != boom || seen != 2 {
+		t.Errorf("stopped after %d elements: %v", seen, err)
+	}
+
+	// an element that isn't well-formed can't be skipped
+	bad := appendEachRecord(AppendArrayHeader(nil, 2), 1, "a")
+	bad = append(bad, 0xc1)
+	seen = 0
+	if err := DecodeEachResilient(bytes.NewReader(bad), 64, func(*eachRecord, error) error {
+		seen++
+		return nil
+	}); Cause(err) != InvalidPrefixError(0xc1) || seen != 1 {
+		t.Errorf("malformed element after %d elements: %v", seen, err)
+	}
+}
@@ -3,6 +3,7 @@ package msgp
 import (
 	"fmt"
 	"reflect"
+	"strings"
 )
 
 const resumableDefault = false
@@ -13,6 +14,22 @@ var (
 	// contain the contents of the message
 	ErrShortBytes error = errShort{}
 
+	// ErrRecursionLimit is returned by SkipLimit
+	// when maps and arrays are nested more deeply
+	// than it allows
+	ErrRecursionLimit error = errRecursion{}
+
+	// ErrInvalidUTF8 is returned by ReadUTF8StringBytes,
+	// and so by the generated decoders of the string
+	// fields with the utf8 tag option, for a string
+	// that isn't valid UTF-8
+	ErrInvalidUTF8 error = errUTF8{}
+
+	// ErrInvalidTimestamp is returned by ReadTimestampBytes,
+	// and so by ReadTimeBytes, for a timestamp extension
+	// with more than 999999999 nanoseconds
+	ErrInvalidTimestamp error = errTimestamp{}
+
 	// this error is only returned
 	// if we reach code that should
 	// be unreachable
@@ -58,8 +75,8 @@ type contextError interface {
 // with additional context.
 func Cause(e error) error {
 	out := e
-	if e, ok := e.(errWrapped); ok && e.cause != nil {
-		out = e.cause
+	if e, ok := e.(FieldError); ok && e.Err != nil {
+		out = e.Err
 	}
 	return out
 }
@@ -77,6 +94,11 @@ func Resumable(e error) bool {
 // serialized type that caused the problem to be identified. Underlying errors
 // can be retrieved using Cause()
 //
+// The context is a path from the outermost value, as in Txns[3].Sig: each
+// integer in ctx is written as an index, and anything else as a field name.
+// The errors of this package keep the path themselves; any other error is
+// returned in a FieldError.
+//
 // The input error is not modified - a new error should be returned.
 //
 // ErrShortBytes is not wrapped with any context due to backward compatibility
@@ -88,47 +110,61 @@ func WrapError(err error, ctx ...interface{}) error {
 	case contextError:
 		return e.withContext(ctxString(ctx))
 	default:
-		return errWrapped{cause: err, ctx: ctxString(ctx)}
+		return FieldError{Err: err, Path: ctxString(ctx)}
 	}
 }
 
-// ctxString converts the incoming interface{} slice into a single string.
+// ctxString converts the incoming interface{} slice into a single path.
 func ctxString(ctx []interface{}) string {
 	out := ""
-	for idx, cv := range ctx {
-		if idx > 0 {
-			out += "/"
+	for _, cv := range ctx {
+		switch cv.(type) {
+		case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+			out += fmt.Sprintf("[%d]", cv)
+		default:
+			out = addCtx(fmt.Sprintf("%v", cv), out)
 		}
-		out += fmt.Sprintf("%v", cv)
 	}
 	return out
 }
 
+// addCtx prepends the path 'add' to the path 'ctx'
 func addCtx(ctx, add string) string {
-	if ctx != "" {
-		return add + "/" + ctx
-	} else {
+	switch {
+	case ctx == "":
 		return add
+	case add == "" || strings.HasPrefix(ctx, "["):
+		return add + ctx
+	default:
+		return add + "." + ctx
 	}
 }
 
-// errWrapped allows arbitrary errors passed to WrapError to be enhanced with
-// context and unwrapped with Cause()
-type errWrapped struct {
-	cause error
-	ctx   string
+// FieldError is an error, other than one of this package's,
+// that WrapError has added the path of the value that caused
+// it to. Underlying errors can be retrieved using Cause() or
+// errors.Unwrap.
+type FieldError struct {
+	Err  error
+	Path string // as in Txns[3].Sig
 }
 
-func (e errWrapped) Error() string {
-	if e.ctx != "" {
-		return fmt.Sprintf("%s at %s", e.cause, e.ctx)
+func (e FieldError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("%s at %s", e.Err, e.Path)
 	} else {
-		return e.cause.Error()
+		return e.Err.Error()
 	}
 }
 
-func (e errWrapped) Resumable() bool {
-	if e, ok := e.cause.(Error); ok {
+// Unwrap returns the underlying error
+func (e FieldError) Unwrap() error { return e.Err }
+
+func (e FieldError) withContext(ctx string) error { e.Path = addCtx(e.Path, ctx); return e }
+
+// Resumable returns whether the underlying error is resumable
+func (e FieldError) Resumable() bool {
+	if e, ok := e.Err.(Error); ok {
 		return e.Resumable()
 	}
 	return resumableDefault
@@ -139,6 +175,21 @@ type errShort struct{}
 func (e errShort) Error() string   { return "msgp: too few bytes left to read object" }
 func (e errShort) Resumable() bool { return false }
 
+type errRecursion struct{}
+
+func (e errRecursion) Error() string   { return "msgp: objects nested too deeply to skip" }
+func (e errRecursion) Resumable() bool { return false }
+
+type errUTF8 struct{}
+
+func (e errUTF8) Error() string   { return "msgp: string is not valid UTF-8" }
+func (e errUTF8) Resumable() bool { return false }
+
+type errTimestamp struct{}
+
+func (e errTimestamp) Error() string   { return "msgp: timestamp has more than 999999999 nanoseconds" }
+func (e errTimestamp) Resumable() bool { return false }
+
 // errOverflow is returned when the message
 // being decoded has some length field that
 // exceeds the maximum allowed length.
@@ -159,6 +210,59 @@ func ErrOverflow(l uint64, bound uint64) error {
 	return errOverflow{l, bound}
 }
 
+// errRange is returned by generated Validate methods
+// for a value outside the range set by a min or max tag.
+type errRange struct {
+	v     interface{}
+	bound interface{}
+	op    string
+}
+
+func (e errRange) Error() string {
+	return fmt.Sprintf("msgp: value out of range: %v %s %v", e.v, e.op, e.bound)
+}
+
+func (e errRange) Resumable() bool {
+	return false
+}
+
+// ErrBelowMin returns an error for a value v
+// that is less than its minimum.
+func ErrBelowMin(v interface{}, min interface{}) error {
+	return errRange{v, min, "<"}
+}
+
+// ErrAboveMax returns an error for a value v
+// that is greater than its maximum.
+func ErrAboveMax(v interface{}, max interface{}) error {
+	return errRange{v, max, ">"}
+}
+
+// errVersion is returned by generated decoders for a field
+// of a message whose version doesn't have it (msgp:since).
+type errVersion struct {
+	field   string
+	version interface{}
+	since   interface{}
+}
+
+func (e errVersion) Error() string {
+	return fmt.Sprintf("msgp: field %q is present since version %v; the message is version %v", e.field, e.since, e.version)
+}
+
+// Resumable is 'true' for errVersion, since
+// the field itself was read like any other
+func (e errVersion) Resumable() bool {
+	return true
+}
+
+// ErrVersionField returns an error for the field 'field', which
+// is present since version 'since', of a message of version
+// 'version'.
+func ErrVersionField(field string, version interface{}, since interface{}) error {
+	return errVersion{field, version, since}
+}
+
 type errFatal struct {
 	ctx string
 }
@@ -265,7 +369,7 @@ func (u UintBelowZero) Error() string {
 func (u UintBelowZero) Resumable() bool { return true }
 
 func (u UintBelowZero) withContext(ctx string) error {
-	u.ctx = ctx
+	u.ctx = addCtx(u.ctx, ctx)
 	return u
 }
 
@@ -369,3 +473,75 @@ func (e *ErrMissingLessFn) Error() string {
 
 // Resumable returns false for errNonCanonical
 func (e *ErrMissingLessFn) Resumable() bool { return false }
+
+// ErrTrailingBytes is returned by the generated
+// UnmarshalMsgExact methods when the message does
+// not occupy the whole buffer.
+type ErrTrailingBytes struct {
+	Count int // number of bytes left after the message
+}
+
+// Error implements error
+func (e *ErrTrailingBytes) Error() string {
+	return fmt.Sprintf("msgp: %d trailing bytes after message", e.Count)
+}
+
+// Resumable returns true for ErrTrailingBytes
+func (e *ErrTrailingBytes) Resumable() bool { return true }
+
+// ErrUnknownIface is returned by ReadIfaceBytes when
+// the tag of a value has not been registered with
+// RegisterIface, or when the type registered under
+// it does not implement the interface decoded into.
+type ErrUnknownIface struct {
+	Tag string
+	T   reflect.Type // the type of the interface
+
+	ctx string
+}
+
+// Error implements error
+func (e *ErrUnknownIface) Error() string {
+	out := fmt.Sprintf("msgp: no type of %s is registered as %q", e.T, e.Tag)
+	if e.ctx != "" {
+		out += " at " + e.ctx
+	}
+	return out
+}
+
+// Resumable returns 'true' for ErrUnknownIface
+func (e *ErrUnknownIface) Resumable() bool { return true }
+
+func (e *ErrUnknownIface) withContext(ctx string) error {
+	o := *e
+	o.ctx = addCtx(o.ctx, ctx)
+	return &o
+}
+
+// ErrUnknownEnum is returned when a 'str' is decoded into
+// a type named by the msgp:enum directive, and isn't the
+// name of any of its values.
+type ErrUnknownEnum struct {
+	Type string // the name of the enum type
+	Name string
+
+	ctx string
+}
+
+// Error implements error
+func (e *ErrUnknownEnum) Error() string {
+	out := fmt.Sprintf("msgp: %q is not a value of %s", e.Name, e.Type)
+	if e.ctx != "" {
+		out += " at " + e.ctx
+	}
+	return out
+}
+
+// Resumable returns 'true' for ErrUnknownEnum
+func (e *ErrUnknownEnum) Resumable() bool { return true }
+
+func (e *ErrUnknownEnum) withContext(ctx string) error {
+	o := *e
+	o.ctx = addCtx(o.ctx, ctx)
+	return &o
+}
@@ -16,7 +16,7 @@ func TestWrapVanillaErrorWithNoAdditionalContext(t *testing.T) {
 	if w.Error() != err.Error() {
 		t.Fatal()
 	}
-	if w.(errWrapped).Resumable() {
+	if w.(FieldError).Resumable() {
 		t.Fatal()
 	}
 }
@@ -37,7 +37,7 @@ func TestWrapVanillaErrorWithAdditionalContext(t *testing.T) {
 		t.Fatal()
 	}
 	rest := w.Error()[len(err.Error()):]
-	if rest != " at foo/bar" {
+	if rest != " at foo.bar" {
 		t.Fatal()
 	}
 }
@@ -53,12 +53,53 @@ func TestWrapResumableError(t *testing.T) {
 func TestWrapMultiple(t *testing.T) {
 	err := &TypeError{}
 	w := WrapError(WrapError(err, "b"), "a")
-	expected := `msgp: attempted to decode type "<invalid>" with method for "<invalid>" at a/b`
+	expected := `msgp: attempted to decode type "<invalid>" with method for "<invalid>" at a.b`
 	if expected != w.Error() {
 		t.Fatal()
 	}
 }
 
+func TestWrapMultipleVanilla(t *testing.T) {
+	err := errors.New("test")
+	w := WrapError(WrapError(err, "b", 1), "a")
+	if w.Error() != "test at a.b[1]" {
+		t.Fatalf("got %q", w.Error())
+	}
+	if Cause(w) != err {
+		t.Fatal()
+	}
+}
+
+func TestWrapPath(t *testing.T) {
+	// as a decoder for Block{Txns []Txn} wraps the error
+	// of the Sig field of the fourth Txn
+	wrap := func(err error) error {
+		err = WrapError(err, "Sig")
+		err = WrapError(err, "Txns", 3)
+		return WrapError(err, "Block")
+	}
+	w := wrap(TypeError{Method: BinType, Encoded: IntType})
+	if want := `msgp: attempted to decode type "int" with method for "bin" at Block.Txns[3].Sig`; w.Error() != want {
+		t.Errorf("got %q", w.Error())
+	}
+	if _, ok := Cause(w).(TypeError); !ok {
+		t.Errorf("cause %T", Cause(w))
+	}
+
+	err := errors.New("bad signature")
+	var fe FieldError
+	if w := wrap(err); !errors.As(w, &fe) || fe.Path != "Block.Txns[3].Sig" || !errors.Is(w, err) {
+		t.Errorf("got %#v", w)
+	}
+	// map keys that are integers are indexes, too
+	if w := WrapError(WrapError(err, uint8(7)), "M", "x"); w.Error() != "bad signature at M.x[7]" {
+		t.Errorf("got %q", w.Error())
+	}
+	if w := WrapError(WrapError(UintBelowZero{Value: -1}, "A"), "B"); !strings.HasSuffix(w.Error(), " at B.A") {
+		t.Errorf("got %q", w.Error())
+	}
+}
+
 func TestCause(t *testing.T) {
 	for idx, err := range []error{
 		errors.New("test"),
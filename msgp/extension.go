@@ -16,6 +16,10 @@ const (
 	TimeExtension = 5
 )
 
+// extensions 6 and 7 (netip.Addr and netip.AddrPort)
+// are defined in netip.go, and extension 8 (big.Int)
+// is defined and registered in bigint.go
+
 // our extensions live here
 var extensionReg = make(map[int8]func() Extension)
 
@@ -24,9 +28,10 @@ var extensionReg = make(map[int8]func() Extension)
 // decode `interface{}` values. This should only
 // be called during initialization. f() should return
 // a newly-initialized zero value of the extension. Keep in
-// mind that extensions 3, 4, and 5 are reserved for
-// complex64, complex128, and time.Time, respectively,
-// and that MessagePack reserves extension types from -127 to -1.
+// mind that extensions 3, 4, 5, 6 and 7 are reserved for
+// complex64, complex128, time.Time, netip.Addr and netip.AddrPort,
+// respectively, and that MessagePack reserves extension types
+// from -127 to -1.
 //
 // For example, if you wanted to register a user-defined struct:
 //
@@ -34,10 +39,11 @@ var extensionReg = make(map[int8]func() Extension)
 //
 // RegisterExtension will panic if you call it multiple times
 // with the same 'typ' argument, or if you use a reserved
-// type (3, 4, or 5).
+// type (3 through 7). Extension 8 is registered by this
+// package for big.Int.
 func RegisterExtension(typ int8, f func() Extension) {
 	switch typ {
-	case Complex64Extension, Complex128Extension, TimeExtension:
+	case Complex64Extension, Complex128Extension, TimeExtension, AddrExtension, AddrPortExtension, timeExtension:
 		panic(fmt.Sprint("msgp: forbidden extension type:", typ))
 	}
 	if _, ok := extensionReg[typ]; ok {
@@ -46,6 +52,32 @@ func RegisterExtension(typ int8, f func() Extension) {
 	extensionReg[typ] = f
 }
 
+// timeExtension is the extension number that AppendTime
+// writes and ReadTimeBytes reads, set by RegisterTimeExt
+var timeExtension int8 = TimeExtension
+
+// RegisterTimeExt sets the extension number of the time.Time
+// values that AppendTime writes and ReadTimeBytes reads, and so
+// the ones the generated code writes and reads, to 'typ' in place
+// of TimeExtension, for a peer that uses another number for its
+// 12-byte timestamps. ReadTimeBytes then rejects those numbered
+// TimeExtension with an ExtensionTypeError. AppendTimeExt and
+// ReadTimeExtBytes read and write other numbers regardless.
+// This should only be called during initialization.
+//
+// RegisterTimeExt will panic if 'typ' is reserved for another
+// type (3, 4, 6 or 7), or registered by RegisterExtension.
+func RegisterTimeExt(typ int8) {
+	switch typ {
+	case Complex64Extension, Complex128Extension, AddrExtension, AddrPortExtension:
+		panic(fmt.Sprint("msgp: forbidden time extension type:", typ))
+	}
+	if _, ok := extensionReg[typ]; ok {
+		panic(fmt.Sprint("msgp: RegisterTimeExt() called with registered typ", typ))
+	}
+	timeExtension = typ
+}
+
 // ExtensionTypeError is an error type returned
 // when there is a mis-match between an extension type
 // and the type encoded on the wire
@@ -145,39 +177,48 @@ func peekExtension(b []byte) (int8, error) {
 // AppendExtension appends a MessagePack extension to the provided slice
 func AppendExtension(b []byte, e Extension) ([]byte, error) {
 	l := e.Len()
-	var o []byte
-	var n int
+	o, n := appendExtensionHeader(b, e.ExtensionType(), l)
+	if l == 0 {
+		return o, nil
+	}
+	return o, e.MarshalBinaryTo(o[n:])
+}
+
+// appendExtensionHeader appends the header of an extension
+// of type typ with an l-byte body, and returns the slice
+// extended by room for the body and the offset of the body.
+func appendExtensionHeader(b []byte, typ int8, l int) (o []byte, n int) {
 	switch l {
 	case 0:
 		o, n = ensure(b, 3)
 		o[n] = mext8
 		o[n+1] = 0
-		o[n+2] = byte(e.ExtensionType())
-		return o[:n+3], nil
+		o[n+2] = byte(typ)
+		n += 3
 	case 1:
 		o, n = ensure(b, 3)
 		o[n] = mfixext1
-		o[n+1] = byte(e.ExtensionType())
+		o[n+1] = byte(typ)
 		n += 2
 	case 2:
 		o, n = ensure(b, 4)
 		o[n] = mfixext2
-		o[n+1] = byte(e.ExtensionType())
+		o[n+1] = byte(typ)
 		n += 2
 	case 4:
 		o, n = ensure(b, 6)
 		o[n] = mfixext4
-		o[n+1] = byte(e.ExtensionType())
+		o[n+1] = byte(typ)
 		n += 2
 	case 8:
 		o, n = ensure(b, 10)
 		o[n] = mfixext8
-		o[n+1] = byte(e.ExtensionType())
+		o[n+1] = byte(typ)
 		n += 2
 	case 16:
 		o, n = ensure(b, 18)
 		o[n] = mfixext16
-		o[n+1] = byte(e.ExtensionType())
+		o[n+1] = byte(typ)
 		n += 2
 	default:
 		switch {
@@ -185,23 +226,23 @@ func AppendExtension(b []byte, e Extension) ([]byte, error) {
 			o, n = ensure(b, l+3)
 			o[n] = mext8
 			o[n+1] = byte(uint8(l))
-			o[n+2] = byte(e.ExtensionType())
+			o[n+2] = byte(typ)
 			n += 3
 		case l < math.MaxUint16:
 			o, n = ensure(b, l+4)
 			o[n] = mext16
 			big.PutUint16(o[n+1:], uint16(l))
-			o[n+3] = byte(e.ExtensionType())
+			o[n+3] = byte(typ)
 			n += 4
 		default:
 			o, n = ensure(b, l+6)
 			o[n] = mext32
 			big.PutUint32(o[n+1:], uint32(l))
-			o[n+5] = byte(e.ExtensionType())
+			o[n+5] = byte(typ)
 			n += 6
 		}
 	}
-	return o, e.MarshalBinaryTo(o[n:])
+	return o, n
 }
 
 // ReadExtensionBytes reads an extension from 'b' into 'e'
@@ -0,0 +1,129 @@
+package msgp
+
+import "io"
+
+// The functions in this file frame messages for
+// stream transports, which don't preserve message
+// boundaries. A frame is a 'uint' object holding
+// the length of the payload, followed by the
+// payload itself:
+//
+//	[len, payload...]
+
+// AppendFrame appends 'data' to the slice as a frame.
+func AppendFrame(b []byte, data []byte) []byte {
+	b = AppendUint64(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// ReserveFrame appends room for the header of a frame
+// to the slice, so that the payload can be appended
+// after it, and the frame finished by FinishFrame:
+//
+//	start := len(b)
+//	b = v.MarshalMsg(msgp.ReserveFrame(b))
+//	b = msgp.FinishFrame(b, start)
+func ReserveFrame(b []byte) []byte {
+	o, _ := ensure(b, Uint64Size)
+	return o
+}
+
+// FinishFrame writes the header of the frame that starts
+// at b[start:], which ReserveFrame made room for, moving
+// the payload after it to close the room it doesn't use.
+func FinishFrame(b []byte, start int) []byte {
+	payload := start + Uint64Size
+	hdr := AppendUint64(b[start:start], uint64(len(b)-payload))
+	n := copy(b[start+len(hdr):], b[payload:])
+	return b[:start+len(hdr)+n]
+}
+
+// ReadFrameBytes reads a frame from the start of 'b', and
+// returns its payload, which is a slice of 'b', and the
+// bytes after the frame. It returns an error if the
+// payload is longer than max bytes.
+// Possible errors:
+// - ErrShortBytes (a partial frame)
+// - TypeError{} (the header is not a 'uint')
+// - InvalidPrefixError
+// - ErrOverflow (the payload is longer than max bytes)
+func ReadFrameBytes(b []byte, max int) (data []byte, o []byte, err error) {
+	l, o, err := ReadUint64Bytes(b)
+	if err != nil {
+		return nil, b, err
+	}
+	if l > uint64(max) {
+		return nil, b, ErrOverflow(l, uint64(max))
+	}
+	if l > uint64(len(o)) {
+		return nil, b, ErrShortBytes
+	}
+	return o[:l], o[l:], nil
+}
+
+// WriteFrame writes 'data' to 'w' as a frame.
+func WriteFrame(w io.Writer, data []byte) error {
+	var hdr [Uint64Size]byte
+	if _, err := w.Write(AppendUint64(hdr[:0], uint64(len(data)))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// ReadFrame reads a frame written by WriteFrame from
+// 'r', and returns its payload. It returns io.EOF if
+// 'r' is at the end of its input, and returns an
+// error, without reading the payload, if the payload
+// is longer than max bytes.
+// Possible errors:
+// - io.EOF (no frame)
+// - io.ErrUnexpectedEOF (a partial frame)
+// - TypeError{} (the header is not a 'uint')
+// - InvalidPrefixError
+// - ErrOverflow (the payload is longer than max bytes)
+func ReadFrame(r io.Reader, max int) ([]byte, error) {
+	var hdr [Uint64Size]byte
+	if _, err := io.ReadFull(r, hdr[:1]); err != nil {
+		return nil, err
+	}
+	var sz int
+	switch lead := hdr[0]; {
+	case isfixint(lead):
+		sz = 1
+	case lead == muint8:
+		sz = Uint8Size
+	case lead == muint16:
+		sz = Uint16Size
+	case lead == muint32:
+		sz = Uint32Size
+	case lead == muint64:
+		sz = Uint64Size
+	default:
+		return nil, badPrefix(UintType, lead)
+	}
+	if _, err := io.ReadFull(r, hdr[1:sz]); err != nil {
+		return nil, noEOF(err)
+	}
+	l, _, err := ReadUint64Bytes(hdr[:sz])
+	if err != nil {
+		return nil, err
+	}
+	if l > uint64(max) {
+		return nil, ErrOverflow(l, uint64(max))
+	}
+	data := make([]byte, l)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, noEOF(err)
+	}
+	return data, nil
+}
+
+// noEOF reports an io.EOF after the start of
+// a frame as io.ErrUnexpectedEOF
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
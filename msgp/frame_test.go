@@ -0,0 +1,98 @@
+package msgp
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestWriteReadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	payloads := [][]byte{{}, []byte("abc"), bytes.Repeat([]byte{7}, 300), bytes.Repeat([]byte{8}, 70000)}
+	for _, p := range payloads {
+		if err := WriteFrame(&buf, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if b := AppendFrame(nil, payloads[1]); !bytes.Equal(b, buf.Bytes()[1:1+len(b)]) {
+		t.Errorf("AppendFrame wrote %x", b)
+	}
+
+	// frames are read across short reads
+	r := iotest.OneByteReader(bytes.NewReader(buf.Bytes()))
+	for _, p := range payloads {
+		got, err := ReadFrame(r, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, p) {
+			t.Errorf("read a %d-byte frame as %d bytes", len(p), len(got))
+		}
+	}
+	if _, err := ReadFrame(r, 1<<20); err != io.EOF {
+		t.Errorf("at the end: got %v; want io.EOF", err)
+	}
+}
+
+func TestReadFramePartial(t *testing.T) {
+	frame := AppendFrame(nil, bytes.Repeat([]byte{1}, 300))
+	// cut in the header and in the payload
+	for _, n := range []int{2, 10} {
+		if _, err := ReadFrame(bytes.NewReader(frame[:n]), 1<<20); err != io.ErrUnexpectedEOF {
+			t.Errorf("%d of %d bytes: got %v; want io.ErrUnexpectedEOF", n, len(frame), err)
+		}
+	}
+	if _, err := ReadFrame(bytes.NewReader(AppendString(nil, "x")), 1<<20); err == nil {
+		t.Error("read a frame with a 'str' header")
+	}
+}
+
+func TestReadFrameOversized(t *testing.T) {
+	// the payload is rejected before it is read, so the frame
+	// can claim more bytes than there are
+	hdr := AppendUint64(nil, 1<<40)
+	_, err := ReadFrame(bytes.NewReader(hdr), 1024)
+	if _, ok := err.(errOverflow); !ok {
+		t.Errorf("got %v; want an overflow error", err)
+	}
+	frame := AppendFrame(nil, make([]byte, 1024))
+	if _, err := ReadFrame(bytes.NewReader(frame), 1024); err != nil {
+		t.Errorf("exactly max bytes: %v", err)
+	}
+}
+
+func TestFinishFrame(t *testing.T) {
+	for _, n := range []int{0, 3, 200, 70000} {
+		payload := bytes.Repeat([]byte{9}, n)
+		b := []byte("prefix")
+		start := len(b)
+		b = append(ReserveFrame(b), payload...)
+		b = FinishFrame(b, start)
+		if want := AppendFrame([]byte("prefix"), payload); !bytes.Equal(b, want) {
+			t.Errorf("%d bytes: framed as %x; want %x", n, b, want)
+		}
+	}
+}
+
+func TestReadFrameBytes(t *testing.T) {
+	b := AppendFrame(nil, []byte("abc"))
+	b = AppendFrame(b, bytes.Repeat([]byte{1}, 300))
+	data, o, err := ReadFrameBytes(b, 1024)
+	if err != nil || string(data) != "abc" {
+		t.Fatalf("got %q, %v", data, err)
+	}
+	if data, o, err = ReadFrameBytes(o, 1024); err != nil || len(data) != 300 || len(o) != 0 {
+		t.Fatalf("got %d bytes, %d left, %v", len(data), len(o), err)
+	}
+
+	frame := AppendFrame(nil, bytes.Repeat([]byte{1}, 300))
+	if _, o, err := ReadFrameBytes(frame[:10], 1024); err != ErrShortBytes || len(o) != 10 {
+		t.Errorf("partial frame: got %v; want ErrShortBytes", err)
+	}
+	if _, _, err := ReadFrameBytes(frame, 299); err == nil {
+		t.Error("read a frame longer than max")
+	} else if _, ok := err.(errOverflow); !ok {
+		t.Errorf("got %v; want an overflow error", err)
+	}
+}
@@ -0,0 +1,168 @@
+package msgp
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// The functions in this file encode the values of
+// the interface types named by the msgp:iface
+// directive. A value is encoded as a 2-element
+// array of a 'str' tag, which names its concrete
+// type, and the value itself, as encoded by the
+// MarshalMsg method of that type:
+//
+//	[tag, payload]
+//
+// A nil interface is encoded as 'nil'. The concrete
+// types must be registered with RegisterIface, on
+// both ends, before values are encoded or decoded.
+
+// An IfaceValue is a concrete type that is held by
+// an interface encoded with AppendIface. Pointers to
+// types with generated methods implement it.
+type IfaceValue interface {
+	Marshaler
+	Unmarshaler
+	Sizer
+}
+
+// BudgetUnmarshaler is implemented by the generated
+// UnmarshalMsgWithBudget methods
+type BudgetUnmarshaler interface {
+	UnmarshalMsgWithBudget([]byte, *Budget) ([]byte, error)
+}
+
+// UnmarshalWithBudget decodes 'u' from 'b' with its
+// UnmarshalMsgWithBudget method, if it is a
+// BudgetUnmarshaler. Otherwise, as for types with
+// hand-written methods, or generated by an older msgp,
+// it decodes it with UnmarshalMsg, and then charges
+// the bytes it consumed to 'budget'.
+func UnmarshalWithBudget(u Unmarshaler, b []byte, budget *Budget) ([]byte, error) {
+	if bu, ok := u.(BudgetUnmarshaler); ok {
+		return bu.UnmarshalMsgWithBudget(b, budget)
+	}
+	o, err := u.UnmarshalMsg(b)
+	if err != nil {
+		return o, err
+	}
+	return o, budget.Spend(o, 0)
+}
+
+var ifaces = struct {
+	sync.RWMutex
+	types map[string]reflect.Type
+	tags  map[reflect.Type]string
+}{
+	types: make(map[string]reflect.Type),
+	tags:  make(map[reflect.Type]string),
+}
+
+// RegisterIface registers the type of v, which must
+// be a pointer, as the concrete type encoded under
+// tag. Since the tag is written into messages, it
+// should not change once the type is in use. Like
+// gob.Register, RegisterIface is meant to be called
+// from init functions, and panics if the tag or the
+// type has already been registered.
+func RegisterIface(tag string, v IfaceValue) {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("msgp: RegisterIface of non-pointer type %v", t))
+	}
+	ifaces.Lock()
+	defer ifaces.Unlock()
+	if prev, ok := ifaces.types[tag]; ok {
+		panic(fmt.Sprintf("msgp: tag %q registered for both %s and %s", tag, prev, t))
+	}
+	if prev, ok := ifaces.tags[t]; ok {
+		panic(fmt.Sprintf("msgp: type %s registered as both %q and %q", t, prev, tag))
+	}
+	ifaces.types[tag] = t
+	ifaces.tags[t] = tag
+}
+
+// ifaceTag returns the tag of the concrete type of
+// v, which must have been registered
+func ifaceTag(v interface{}) string {
+	ifaces.RLock()
+	tag, ok := ifaces.tags[reflect.TypeOf(v)]
+	ifaces.RUnlock()
+	if !ok {
+		panic(fmt.Sprintf("msgp: type %T is not registered with RegisterIface", v))
+	}
+	return tag
+}
+
+// IfaceSize returns the maximum number of bytes
+// occupied by the encoding of 'v' by AppendIface.
+func IfaceSize(v interface{}) int {
+	if v == nil {
+		return NilSize
+	}
+	return ArrayHeaderSize + StringPrefixSize + len(ifaceTag(v)) + v.(Sizer).Msgsize()
+}
+
+// AppendIface appends the value held by the
+// interface 'v' to the slice, along with the tag
+// of its concrete type. Since generated MarshalMsg
+// methods can't return errors, AppendIface panics
+// if the type of 'v' has not been registered with
+// RegisterIface.
+func AppendIface(b []byte, v interface{}) []byte {
+	if v == nil {
+		return AppendNil(b)
+	}
+	b = AppendArrayHeader(b, 2)
+	b = AppendString(b, ifaceTag(v))
+	return v.(Marshaler).MarshalMsg(b)
+}
+
+// ReadIfaceBytes reads a value encoded by AppendIface
+// from 'b' into the interface that 'dst' points to,
+// and returns the remaining bytes. The value is a new
+// value of the type registered under its tag, and is
+// decoded within the limits of 'budget'.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an array, or the tag is not a 'str')
+// - ArrayError{} (the array does not have 2 elements)
+// - *ErrUnknownIface (the tag is not registered, or its
+// type does not implement the interface)
+// - An error returned from decoding the value
+func ReadIfaceBytes(b []byte, dst interface{}, budget *Budget) (o []byte, err error) {
+	iv := reflect.ValueOf(dst).Elem()
+	if IsNil(b) {
+		iv.Set(reflect.Zero(iv.Type()))
+		return b[1:], nil
+	}
+	sz, _, o, err := ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if sz != 2 {
+		return b, ArrayError{Wanted: 2, Got: sz}
+	}
+	tag, o, err := ReadStringZC(o)
+	if err != nil {
+		return b, err
+	}
+	ifaces.RLock()
+	t, ok := ifaces.types[string(tag)]
+	ifaces.RUnlock()
+	if !ok || !t.AssignableTo(iv.Type()) {
+		return b, &ErrUnknownIface{Tag: string(tag), T: iv.Type()}
+	}
+	if err = budget.Spend(o, int(t.Elem().Size())); err != nil {
+		return b, err
+	}
+	v := reflect.New(t.Elem())
+	o, err = UnmarshalWithBudget(v.Interface().(Unmarshaler), o, budget)
+	if err != nil {
+		return b, err
+	}
+	iv.Set(v)
+	return o, nil
+}
@@ -0,0 +1,180 @@
+package msgp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// a shape is implemented by circle and square, which
+// are encoded as their radius and side
+type shape interface {
+	area() float64
+}
+
+type circle struct{ r float64 }
+
+func (c *circle) area() float64                    { return 3 * c.r * c.r }
+func (c *circle) MarshalMsg(b []byte) []byte       { return AppendFloat64(b, c.r) }
+func (c *circle) CanMarshalMsg(interface{}) bool   { return true }
+func (c *circle) CanUnmarshalMsg(interface{}) bool { return true }
+func (c *circle) Msgsize() int                     { return Float64Size }
+func (c *circle) UnmarshalMsg(b []byte) (o []byte, err error) {
+	c.r, o, err = ReadFloat64Bytes(b)
+	return
+}
+
+type square struct{ side int64 }
+
+func (s *square) area() float64                    { return float64(s.side * s.side) }
+func (s *square) MarshalMsg(b []byte) []byte       { return AppendInt64(b, s.side) }
+func (s *square) CanMarshalMsg(interface{}) bool   { return true }
+func (s *square) CanUnmarshalMsg(interface{}) bool { return true }
+func (s *square) Msgsize() int                     { return Int64Size }
+func (s *square) UnmarshalMsg(b []byte) (o []byte, err error) {
+	s.side, o, err = ReadInt64Bytes(b)
+	return
+}
+
+// sized is not implemented by either type
+type sized interface {
+	size() int
+}
+
+func init() {
+	RegisterIface("circle", &circle{})
+	RegisterIface("square", &square{})
+}
+
+func TestAppendReadIface(t *testing.T) {
+	for _, in := range []shape{&circle{r: 1.5}, &square{side: 4}, nil} {
+		bts := AppendIface(nil, in)
+		if len(bts) > IfaceSize(in) {
+			t.Errorf("%#v: %d bytes encoded; more than IfaceSize", in, len(bts))
+		}
+
+		var out shape = &square{side: 1}
+		left, err := ReadIfaceBytes(bts, &out, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over", len(left))
+		}
+		if in == nil {
+			if out != nil {
+				t.Errorf("decoded nil as %#v", out)
+			}
+			continue
+		}
+		if out == in || out.area() != in.area() {
+			t.Errorf("decoded %#v as %#v", in, out)
+		}
+	}
+}
+
+// TestAppendReadIfaceSlice encodes a []shape holding both
+// types, and a nil, element by element, as generated code does
+func TestAppendReadIfaceSlice(t *testing.T) {
+	for _, in := range [][]shape{{&circle{r: 1}, nil, &square{side: 2}, &circle{r: 3}}, {}} {
+		bts := AppendArrayHeader(nil, uint32(len(in)))
+		for _, s := range in {
+			bts = AppendIface(bts, s)
+		}
+
+		sz, _, o, err := ReadArrayHeaderBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]shape, sz)
+		for i := range out {
+			if o, err = ReadIfaceBytes(o, &out[i], nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(o) > 0 {
+			t.Errorf("%d bytes left over", len(o))
+		}
+		if len(out) != len(in) {
+			t.Fatalf("decoded %d elements as %d", len(in), len(out))
+		}
+		for i := range in {
+			if in[i] == nil {
+				if out[i] != nil {
+					t.Errorf("element %d: decoded nil as %#v", i, out[i])
+				}
+				continue
+			}
+			if reflect.TypeOf(out[i]) != reflect.TypeOf(in[i]) || out[i].area() != in[i].area() {
+				t.Errorf("element %d: decoded %#v as %#v", i, in[i], out[i])
+			}
+		}
+	}
+}
+
+func TestIfaceWireLayout(t *testing.T) {
+	bts := AppendIface(nil, &square{side: 4})
+	want := AppendArrayHeader(nil, 2)
+	want = AppendString(want, "square")
+	want = AppendInt64(want, 4)
+	if !bytes.Equal(bts, want) {
+		t.Errorf("encoded as %x; want %x", bts, want)
+	}
+}
+
+func TestReadIfaceErrors(t *testing.T) {
+	var out shape
+	unknown := AppendArrayHeader(nil, 2)
+	unknown = AppendString(unknown, "triangle")
+	unknown = AppendInt64(unknown, 4)
+	if _, err := ReadIfaceBytes(unknown, &out, nil); err == nil {
+		t.Error("decoded an unknown tag")
+	} else if _, ok := err.(*ErrUnknownIface); !ok {
+		t.Errorf("unknown tag: got %v", err)
+	}
+
+	// a registered type that doesn't implement the interface
+	var s sized
+	if _, err := ReadIfaceBytes(AppendIface(nil, &circle{}), &s, nil); err == nil {
+		t.Error("decoded a circle into an interface it doesn't implement")
+	}
+
+	short := AppendArrayHeader(nil, 1)
+	short = AppendString(short, "circle")
+	if _, err := ReadIfaceBytes(short, &out, nil); err == nil {
+		t.Error("decoded a 1-element array")
+	}
+
+	// the allocation of the value is counted
+	bts := AppendIface(nil, &circle{r: 2})
+	budget := (*Budget)(nil).Limit(bts, len(bts)-2)
+	if _, err := ReadIfaceBytes(bts, &out, budget); err != ErrMaxBytesExceeded {
+		t.Errorf("over budget: got %v; want ErrMaxBytesExceeded", err)
+	}
+}
+
+func TestAppendIfaceUnregistered(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for an unregistered type")
+		}
+	}()
+	AppendIface(nil, &Raw{})
+}
+
+func TestUnmarshalWithBudget(t *testing.T) {
+	// circle has no UnmarshalMsgWithBudget, so the
+	// bytes it consumes are charged to the budget
+	bts := AppendFloat64(nil, 2.5)
+	var c circle
+	if _, err := UnmarshalWithBudget(&c, bts, nil); err != nil || c.r != 2.5 {
+		t.Fatalf("got %v, %v; want 2.5", c.r, err)
+	}
+	var budget *Budget
+	if _, err := UnmarshalWithBudget(&c, bts, budget.Limit(bts, len(bts))); err != nil {
+		t.Errorf("within budget: %v", err)
+	}
+	if _, err := UnmarshalWithBudget(&c, bts, budget.Limit(bts, len(bts)-1)); err != ErrMaxBytesExceeded {
+		t.Errorf("over budget: got %v; want ErrMaxBytesExceeded", err)
+	}
+}
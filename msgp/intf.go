@@ -0,0 +1,298 @@
+package msgp
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The functions in this file encode interface{} values,
+// whose concrete types aren't known to the generator.
+// The built-in types are encoded as the MessagePack types
+// they correspond to, and values with a MarshalMsg method
+// are encoded by calling it. Other types can be supported
+// with RegisterIntfEncoder and RegisterIntfDecoder.
+//
+// The hooks are not guarded by a lock, so, like
+// RegisterExtension, they must be registered before any
+// value is encoded or decoded, usually from init functions.
+
+// An EncodeFunc appends the encoding of 'v' to 'b'.
+type EncodeFunc func(b []byte, v interface{}) []byte
+
+// A DecodeFunc reads a value from 'b' and returns it,
+// along with the remaining bytes.
+type DecodeFunc func(b []byte) (interface{}, []byte, error)
+
+var (
+	intfEncoders []func(reflect.Type) (EncodeFunc, bool)
+	intfDecoders []func(b []byte) (DecodeFunc, bool)
+)
+
+// RegisterIntfEncoder adds a hook that AppendIntf calls
+// for the types it doesn't support on its own. The hook
+// returns the EncodeFunc for values of type 't', and
+// false if it doesn't support 't', in which case the
+// next hook is called. Hooks are called in the order in
+// which they were registered.
+func RegisterIntfEncoder(hook func(t reflect.Type) (EncodeFunc, bool)) {
+	intfEncoders = append(intfEncoders, hook)
+}
+
+// RegisterIntfDecoder adds a hook that ReadIntfBytes
+// calls before it decodes a value. The hook is passed
+// the encoded value (and the bytes after it), and
+// returns the DecodeFunc for it, or false if the value
+// should be decoded by the next hook, or as a built-in
+// type if there are no more. Since the built-in types
+// can't be told apart from one another otherwise, a
+// custom type is usually encoded as an extension, which
+// the hook recognizes by its type (see ExtensionType).
+func RegisterIntfDecoder(hook func(b []byte) (DecodeFunc, bool)) {
+	intfDecoders = append(intfDecoders, hook)
+}
+
+func intfEncoder(t reflect.Type) (EncodeFunc, bool) {
+	for _, hook := range intfEncoders {
+		if f, ok := hook(t); ok {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// AppendIntf appends the value held by the interface
+// 'v' to the slice. Since generated MarshalMsg methods
+// can't return errors, AppendIntf panics with an
+// *ErrUnsupportedType if its type isn't supported.
+func AppendIntf(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case nil:
+		return AppendNil(b)
+	case Marshaler:
+		return v.MarshalMsg(b)
+	case bool:
+		return AppendBool(b, v)
+	case string:
+		return AppendString(b, v)
+	case []byte:
+		return AppendBytes(b, v)
+	case int:
+		return AppendInt64(b, int64(v))
+	case int8:
+		return AppendInt8(b, v)
+	case int16:
+		return AppendInt16(b, v)
+	case int32:
+		return AppendInt32(b, v)
+	case int64:
+		return AppendInt64(b, v)
+	case uint:
+		return AppendUint64(b, uint64(v))
+	case uint8:
+		return AppendUint8(b, v)
+	case uint16:
+		return AppendUint16(b, v)
+	case uint32:
+		return AppendUint32(b, v)
+	case uint64:
+		return AppendUint64(b, v)
+	case float32:
+		return AppendFloat32(b, v)
+	case float64:
+		return AppendFloat64(b, v)
+	case complex64:
+		return AppendComplex64(b, v)
+	case complex128:
+		return AppendComplex128(b, v)
+	case time.Time:
+		return AppendTime(b, v)
+	case time.Duration:
+		return AppendDuration(b, v)
+	case []interface{}:
+		// nil slices and maps are 'nil', as they are
+		// in the generated code by default
+		b = AppendArrayHeaderNil(b, v)
+		for i := range v {
+			b = AppendIntf(b, v[i])
+		}
+		return b
+	case map[string]interface{}:
+		// the keys are sorted, as in the generated code,
+		// so that the encoding is canonical
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = AppendMapHeaderNil(b, v)
+		for _, k := range keys {
+			b = AppendString(b, k)
+			b = AppendIntf(b, v[k])
+		}
+		return b
+	}
+	f, ok := intfEncoder(reflect.TypeOf(v))
+	if !ok {
+		panic(&ErrUnsupportedType{T: reflect.TypeOf(v)})
+	}
+	return f(b, v)
+}
+
+// GuessSize returns the maximum number of bytes
+// occupied by the encoding of 'v' by AppendIntf.
+// Values of the types of registered encoders are
+// encoded to find it.
+func GuessSize(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return NilSize
+	case Sizer:
+		return v.Msgsize()
+	case bool:
+		return BoolSize
+	case string:
+		return StringPrefixSize + len(v)
+	case []byte:
+		return BytesPrefixSize + len(v)
+	case int, int64, uint, uint64, time.Duration:
+		return Int64Size
+	case int8, uint8:
+		return Int8Size
+	case int16, uint16:
+		return Int16Size
+	case int32, uint32:
+		return Int32Size
+	case float32:
+		return Float32Size
+	case float64:
+		return Float64Size
+	case complex64:
+		return Complex64Size
+	case complex128:
+		return Complex128Size
+	case time.Time:
+		return TimeSize
+	case []interface{}:
+		s := ArrayHeaderSize
+		for i := range v {
+			s += GuessSize(v[i])
+		}
+		return s
+	case map[string]interface{}:
+		s := MapHeaderSize
+		for k, e := range v {
+			s += StringPrefixSize + len(k) + GuessSize(e)
+		}
+		return s
+	}
+	return len(AppendIntf(nil, v))
+}
+
+// ReadIntfBytes reads the next object from 'b' as an
+// interface{}, and returns it along with the remaining
+// bytes. Objects that aren't recognized by a hook
+// registered with RegisterIntfDecoder are decoded as
+// the built-in type that AppendIntf encodes that way:
+// 'int' and 'uint' objects are decoded as int64 and
+// uint64 (so small unsigned values, which are encoded
+// as positive 'int's, come back as int64), maps as
+// map[string]interface{}, arrays as []interface{}, and
+// the extensions registered with RegisterExtension as
+// the values returned by their functions. Other
+// extensions are decoded as a *RawExtension.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (a map key is not a 'str' or 'bin')
+// - InvalidPrefixError
+// - An error returned from a DecodeFunc or extension
+func ReadIntfBytes(b []byte) (i interface{}, o []byte, err error) {
+	if len(b) == 0 {
+		return nil, b, ErrShortBytes
+	}
+	for _, hook := range intfDecoders {
+		if f, ok := hook(b); ok {
+			return f(b)
+		}
+	}
+
+	switch NextType(b) {
+	case NilType:
+		return nil, b[1:], nil
+	case MapType:
+		var sz int
+		sz, _, o, err = ReadMapHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		// each entry takes at least 2 bytes, so larger
+		// sizes are not allocated for
+		if sz > len(o)/2 {
+			return nil, b, ErrShortBytes
+		}
+		m := make(map[string]interface{}, sz)
+		for j := 0; j < sz; j++ {
+			var key []byte
+			key, o, err = ReadMapKeyZC(o)
+			if err != nil {
+				return nil, b, err
+			}
+			m[string(key)], o, err = ReadIntfBytes(o)
+			if err != nil {
+				return nil, b, err
+			}
+		}
+		return m, o, nil
+	case ArrayType:
+		var sz int
+		sz, _, o, err = ReadArrayHeaderBytes(b)
+		if err != nil {
+			return nil, b, err
+		}
+		if sz > len(o) {
+			return nil, b, ErrShortBytes
+		}
+		s := make([]interface{}, sz)
+		for j := range s {
+			s[j], o, err = ReadIntfBytes(o)
+			if err != nil {
+				return nil, b, err
+			}
+		}
+		return s, o, nil
+	case Float32Type:
+		return ReadFloat32Bytes(b)
+	case Float64Type:
+		return ReadFloat64Bytes(b)
+	case IntType:
+		return ReadInt64Bytes(b)
+	case UintType:
+		return ReadUint64Bytes(b)
+	case BoolType:
+		return ReadBoolBytes(b)
+	case TimeType:
+		return ReadTimeBytes(b)
+	case Complex64Type:
+		return ReadComplex64Bytes(b)
+	case Complex128Type:
+		return ReadComplex128Bytes(b)
+	case ExtensionType:
+		var typ int8
+		typ, err = peekExtension(b)
+		if err != nil {
+			return nil, b, err
+		}
+		var e Extension = &RawExtension{Type: typ}
+		if f, ok := extensionReg[typ]; ok {
+			e = f()
+		}
+		o, err = ReadExtensionBytes(b, e)
+		return e, o, err
+	case StrType:
+		return ReadStringBytes(b)
+	case BinType:
+		return ReadBytesBytes(b, nil)
+	default:
+		return nil, b, InvalidPrefixError(b[0])
+	}
+}
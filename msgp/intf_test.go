@@ -0,0 +1,99 @@
+package msgp
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// cents is encoded by a registered hook, as an
+// extension holding the amount as 8 bytes
+type cents int64
+
+const centsExtension = 42
+
+func init() {
+	RegisterIntfEncoder(func(t reflect.Type) (EncodeFunc, bool) {
+		if t != reflect.TypeOf(cents(0)) {
+			return nil, false
+		}
+		return func(b []byte, v interface{}) []byte {
+			o, n := appendExtensionHeader(b, centsExtension, 8)
+			binary.BigEndian.PutUint64(o[n:], uint64(v.(cents)))
+			return o
+		}, true
+	})
+	RegisterIntfDecoder(func(b []byte) (DecodeFunc, bool) {
+		if NextType(b) != ExtensionType {
+			return nil, false
+		}
+		if typ, err := peekExtension(b); err != nil || typ != centsExtension {
+			return nil, false
+		}
+		return func(b []byte) (interface{}, []byte, error) {
+			r := RawExtension{Type: centsExtension}
+			o, err := ReadExtensionBytes(b, &r)
+			if err != nil {
+				return nil, b, err
+			}
+			if len(r.Data) != 8 {
+				return nil, b, ErrShortBytes
+			}
+			return cents(binary.BigEndian.Uint64(r.Data)), o, nil
+		}, true
+	})
+}
+
+func TestAppendReadIntf(t *testing.T) {
+	in := []interface{}{
+		nil, true, "abc", []byte{1, 2}, int64(-5), uint64(1 << 63), 1.5, float32(0.25),
+		time.Unix(1700000000, 0), // decoded in time.Local
+		cents(1234),
+		[]interface{}{cents(-1), "x"},
+		map[string]interface{}{"b": int64(1), "a": cents(2)},
+	}
+	bts := AppendIntf(nil, in)
+	if len(bts) > GuessSize(in) {
+		t.Errorf("%d bytes encoded; more than GuessSize %d", len(bts), GuessSize(in))
+	}
+	out, left, err := ReadIntfBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over", len(left))
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("decoded %#v as %#v", in, out)
+	}
+}
+
+func TestAppendIntfCanonicalMap(t *testing.T) {
+	m := map[string]interface{}{"z": int64(1), "a": int64(2), "m": int64(3)}
+	want := AppendIntf(nil, m)
+	for i := 0; i < 10; i++ {
+		if got := AppendIntf(nil, m); string(got) != string(want) {
+			t.Fatalf("map encoded as %x and %x", got, want)
+		}
+	}
+}
+
+func TestAppendIntfUnsupported(t *testing.T) {
+	defer func() {
+		if _, ok := recover().(*ErrUnsupportedType); !ok {
+			t.Error("no *ErrUnsupportedType panic for an unsupported type")
+		}
+	}()
+	AppendIntf(nil, []interface{}{struct{}{}})
+}
+
+func TestReadIntfBytesShort(t *testing.T) {
+	// an array header that claims more elements than there are bytes
+	if _, _, err := ReadIntfBytes(AppendArrayHeader(nil, 1<<20)); err == nil {
+		t.Error("no error for a truncated array")
+	}
+	if _, _, err := ReadIntfBytes(nil); err != ErrShortBytes {
+		t.Errorf("empty input: got %v; want ErrShortBytes", err)
+	}
+}
@@ -0,0 +1,32 @@
+package msgp
+
+import "io"
+
+// NewReaderLimit returns a reader of 'r' that reads at
+// most maxBytes in total, for reading a message from an
+// untrusted stream, such as a connection, with DecodeEach
+// or ReadFrame. Once it has read maxBytes, it reads
+// nothing more from 'r', and fails with ErrMaxBytesExceeded,
+// rather than io.EOF as an io.LimitedReader does, so that
+// a message cut short by the limit isn't mistaken for one
+// cut short by its sender.
+func NewReaderLimit(r io.Reader, maxBytes int64) io.Reader {
+	return &limitReader{r: r, n: maxBytes}
+}
+
+type limitReader struct {
+	r io.Reader
+	n int64 // the bytes left to read
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	if l.n <= 0 {
+		return 0, ErrMaxBytesExceeded
+	}
+	if int64(len(p)) > l.n {
+		p = p[:l.n]
+	}
+	n, err := l.r.Read(p)
+	l.n -= int64(n)
+	return n, err
+}
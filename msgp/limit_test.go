@@ -0,0 +1,38 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNewReaderLimit(t *testing.T) {
+	frame := AppendFrame(nil, bytes.Repeat([]byte{1}, 300))
+	if p, err := ReadFrame(NewReaderLimit(bytes.NewReader(frame), int64(len(frame))), 1<<20); err != nil || len(p) != 300 {
+		t.Errorf("a frame of the limit: %d bytes, %v", len(p), err)
+	}
+	if _, err := ReadFrame(NewReaderLimit(bytes.NewReader(frame), int64(len(frame)-1)), 1<<20); err != ErrMaxBytesExceeded {
+		t.Errorf("a frame over the limit: got %v; want ErrMaxBytesExceeded", err)
+	}
+
+	// an array cut off by the limit is rejected in the
+	// middle, and no more than the limit is read
+	const n = 1000
+	b := AppendArrayHeader(nil, n)
+	for i := 0; i < n; i++ {
+		b = appendEachRecord(b, int64(i), "a", "bc")
+	}
+	seen := 0
+	count := func(*eachRecord) error { seen++; return nil }
+	if err := DecodeEach(NewReaderLimit(bytes.NewReader(b), int64(len(b))), 64, true, count); err != nil || seen != n {
+		t.Fatalf("decoded %d elements under the limit: %v", seen, err)
+	}
+	seen = 0
+	cr := &countingReader{r: bytes.NewReader(b)}
+	err := DecodeEach(NewReaderLimit(cr, int64(len(b)/2)), 64, true, count)
+	if Cause(err) != ErrMaxBytesExceeded || seen == 0 || seen >= n {
+		t.Errorf("decoded %d elements over the limit: %v", seen, err)
+	}
+	if cr.n > len(b)/2 {
+		t.Errorf("read %d bytes past the limit", cr.n-len(b)/2)
+	}
+}
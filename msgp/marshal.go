@@ -0,0 +1,37 @@
+package msgp
+
+// Marshal returns the encoding of 'v' by its MarshalMsg
+// method, into a slice sized by Msgsize if 'v' is a Sizer.
+// Since MarshalMsg can't return errors, the error is the
+// *ErrUnsupportedType that it panics with when 'v' holds
+// an interface{} value that AppendIntf can't encode.
+func Marshal[T Marshaler](v T) (b []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*ErrUnsupportedType)
+			if !ok {
+				panic(r)
+			}
+			b, err = nil, e
+		}
+	}()
+	if s, ok := interface{}(v).(Sizer); ok {
+		b = make([]byte, 0, s.Msgsize())
+	}
+	return v.MarshalMsg(b), nil
+}
+
+// Unmarshal decodes a T from 'b' by its UnmarshalMsg
+// method, and returns it along with the remaining bytes:
+//
+//	v, rest, err := msgp.Unmarshal[Foo](b)
+//
+// As with DecodeEach, it is *T that has the method.
+func Unmarshal[T any, PT interface {
+	*T
+	Unmarshaler
+}](b []byte) (T, []byte, error) {
+	var v T
+	o, err := PT(&v).UnmarshalMsg(b)
+	return v, o, err
+}
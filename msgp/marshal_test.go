@@ -0,0 +1,77 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+// point has the methods that would be generated for
+// it, encoding it as [x, y, label]
+type point struct {
+	X, Y  int64
+	Label interface{}
+}
+
+func (p *point) CanMarshalMsg(interface{}) bool   { return true }
+func (p *point) CanUnmarshalMsg(interface{}) bool { return true }
+
+func (p *point) MarshalMsg(b []byte) []byte {
+	b = AppendArrayHeader(b, 3)
+	b = AppendInt64(b, p.X)
+	b = AppendInt64(b, p.Y)
+	return AppendIntf(b, p.Label)
+}
+
+func (p *point) UnmarshalMsg(b []byte) (o []byte, err error) {
+	var sz int
+	if sz, _, o, err = ReadArrayHeaderBytes(b); err != nil || sz != 3 {
+		return b, ArrayError{Wanted: 3, Got: sz}
+	}
+	if p.X, o, err = ReadInt64Bytes(o); err != nil {
+		return b, err
+	}
+	if p.Y, o, err = ReadInt64Bytes(o); err != nil {
+		return b, err
+	}
+	if p.Label, o, err = ReadIntfBytes(o); err != nil {
+		return b, err
+	}
+	return o, nil
+}
+
+func (p *point) Msgsize() int {
+	return ArrayHeaderSize + 2*Int64Size + GuessSize(p.Label)
+}
+
+func TestMarshalUnmarshal(t *testing.T) {
+	p := point{X: 1, Y: -2, Label: "origin"}
+	b, err := Marshal(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, p.MarshalMsg(nil)) {
+		t.Fatalf("Marshal: %x; want %x", b, p.MarshalMsg(nil))
+	}
+	if cap(b) != p.Msgsize() {
+		t.Errorf("Marshal: capacity %d; want Msgsize %d", cap(b), p.Msgsize())
+	}
+
+	q, rest, err := Unmarshal[point](append(b, 0xc0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q != p || !bytes.Equal(rest, []byte{0xc0}) {
+		t.Errorf("Unmarshal: %v, %x", q, rest)
+	}
+	if _, _, err := Unmarshal[point](b[:len(b)-1]); err == nil {
+		t.Error("Unmarshal: no error for short bytes")
+	}
+
+	// the panic of MarshalMsg for an unsupported type is an error
+	p.Label = struct{}{}
+	if b, err := Marshal(&p); b != nil || err == nil {
+		t.Errorf("Marshal: %x, %v", b, err)
+	} else if _, ok := err.(*ErrUnsupportedType); !ok {
+		t.Errorf("Marshal: error %T", err)
+	}
+}
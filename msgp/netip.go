@@ -0,0 +1,190 @@
+package msgp
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+const (
+	// AddrExtension is the extension number used for netip.Addr
+	AddrExtension = 6
+
+	// AddrPortExtension is the extension number used for netip.AddrPort
+	AddrPortExtension = 7
+)
+
+// address families stored in the first byte
+// of an encoded (valid) netip.Addr
+const (
+	addrKind4 = 4
+	addrKind6 = 6
+)
+
+// The encoded form of a valid netip.Addr is the
+// address family byte, the 16-byte form of the
+// address and the zone (if any). The zero Addr
+// is encoded with an empty body.
+const addrBodySize = 1 + 16
+
+// addrExt adapts a *netip.Addr to the Extension interface
+type addrExt struct{ a *netip.Addr }
+
+func (e addrExt) ExtensionType() int8 { return AddrExtension }
+
+func (e addrExt) Len() int { return addrLen(*e.a) }
+
+func (e addrExt) MarshalBinaryTo(b []byte) error {
+	putAddr(b, *e.a)
+	return nil
+}
+
+func (e addrExt) UnmarshalBinary(b []byte) (err error) {
+	*e.a, err = getAddr(b)
+	return
+}
+
+// addrPortExt adapts a *netip.AddrPort to the Extension interface.
+// The body is the 2-byte big-endian port followed by the
+// encoded address; the zero AddrPort has an empty body.
+type addrPortExt struct{ ap *netip.AddrPort }
+
+func (e addrPortExt) ExtensionType() int8 { return AddrPortExtension }
+
+func (e addrPortExt) Len() int {
+	if *e.ap == (netip.AddrPort{}) {
+		return 0
+	}
+	return 2 + addrLen(e.ap.Addr())
+}
+
+func (e addrPortExt) MarshalBinaryTo(b []byte) error {
+	if *e.ap == (netip.AddrPort{}) {
+		return nil
+	}
+	big.PutUint16(b, e.ap.Port())
+	putAddr(b[2:], e.ap.Addr())
+	return nil
+}
+
+func (e addrPortExt) UnmarshalBinary(b []byte) error {
+	if len(b) == 0 {
+		*e.ap = netip.AddrPort{}
+		return nil
+	}
+	if len(b) < 2 {
+		return ErrShortBytes
+	}
+	a, err := getAddr(b[2:])
+	if err != nil {
+		return err
+	}
+	*e.ap = netip.AddrPortFrom(a, big.Uint16(b))
+	return nil
+}
+
+func addrLen(a netip.Addr) int {
+	if !a.IsValid() {
+		return 0
+	}
+	return addrBodySize + len(a.Zone())
+}
+
+// putAddr writes 'a' into 'b', which must
+// be at least addrLen(a) bytes long
+func putAddr(b []byte, a netip.Addr) {
+	if !a.IsValid() {
+		return
+	}
+	if a.Is4() {
+		b[0] = addrKind4
+	} else {
+		b[0] = addrKind6
+	}
+	a16 := a.As16()
+	copy(b[1:], a16[:])
+	copy(b[addrBodySize:], a.Zone())
+}
+
+func getAddr(b []byte) (netip.Addr, error) {
+	if len(b) == 0 {
+		return netip.Addr{}, nil
+	}
+	if len(b) < addrBodySize {
+		return netip.Addr{}, ErrShortBytes
+	}
+	var a16 [16]byte
+	copy(a16[:], b[1:addrBodySize])
+	a := netip.AddrFrom16(a16)
+	switch b[0] {
+	case addrKind4:
+		if !a.Is4In6() || len(b) > addrBodySize {
+			return netip.Addr{}, errAddrEncoding{kind: b[0]}
+		}
+		return a.Unmap(), nil
+	case addrKind6:
+		if len(b) > addrBodySize {
+			a = a.WithZone(string(b[addrBodySize:]))
+		}
+		return a, nil
+	default:
+		return netip.Addr{}, errAddrEncoding{kind: b[0]}
+	}
+}
+
+// errAddrEncoding is returned when an
+// encoded netip.Addr is malformed
+type errAddrEncoding struct {
+	kind byte
+}
+
+func (e errAddrEncoding) Error() string {
+	return fmt.Sprintf("msgp: malformed netip.Addr encoding (family %d)", e.kind)
+}
+
+func (e errAddrEncoding) Resumable() bool { return true }
+
+// AppendAddr appends a netip.Addr to the slice as a MessagePack extension.
+// The zero (invalid) Addr is encoded as an extension with an empty body.
+func AppendAddr(b []byte, a netip.Addr) []byte {
+	o, _ := AppendExtension(b, addrExt{&a})
+	return o
+}
+
+// AppendAddrPort appends a netip.AddrPort to the slice as a MessagePack extension.
+// The zero AddrPort is encoded as an extension with an empty body.
+func AppendAddrPort(b []byte, ap netip.AddrPort) []byte {
+	o, _ := AppendExtension(b, addrPortExt{&ap})
+	return o
+}
+
+// ReadAddrBytes reads a netip.Addr
+// extension object from 'b' and returns the
+// remaining bytes.
+// Possible errors:
+// - ErrShortBytes (not enough bytes in 'b')
+// - TypeError{} (object not an extension)
+// - ExtensionTypeError{} (object an extension, but not a netip.Addr)
+func ReadAddrBytes(b []byte) (a netip.Addr, o []byte, err error) {
+	if len(b) >= 1 && b[0] == mnil {
+		o = b[1:]
+		return
+	}
+	o, err = ReadExtensionBytes(b, addrExt{&a})
+	return
+}
+
+// ReadAddrPortBytes reads a netip.AddrPort
+// extension object from 'b' and returns the
+// remaining bytes.
+// Possible errors:
+// - ErrShortBytes (not enough bytes in 'b')
+// - TypeError{} (object not an extension)
+// - ExtensionTypeError{} (object an extension, but not a netip.AddrPort)
+func ReadAddrPortBytes(b []byte) (ap netip.AddrPort, o []byte, err error) {
+	if len(b) >= 1 && b[0] == mnil {
+		o = b[1:]
+		return
+	}
+	o, err = ReadExtensionBytes(b, addrPortExt{&ap})
+	return
+}
@@ -0,0 +1,63 @@
+package msgp
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestAppendReadAddr(t *testing.T) {
+	addrs := []netip.Addr{
+		{},
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("::ffff:192.0.2.1"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("fe80::1%eth0"),
+	}
+	for _, a := range addrs {
+		bts := AppendAddr(nil, a)
+		if len(bts) > AddrPrefixSize+len(a.Zone()) {
+			t.Errorf("%v encoded to %d bytes; more than AddrPrefixSize", a, len(bts))
+		}
+		out, left, err := ReadAddrBytes(bts)
+		if err != nil {
+			t.Fatalf("%v: %s", a, err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after ReadAddrBytes()", len(left))
+		}
+		if out != a {
+			t.Errorf("wanted %v; got %v", a, out)
+		}
+	}
+}
+
+func TestAppendReadAddrPort(t *testing.T) {
+	aps := []netip.AddrPort{
+		{},
+		netip.MustParseAddrPort("192.0.2.1:80"),
+		netip.MustParseAddrPort("[::ffff:192.0.2.1]:443"),
+		netip.MustParseAddrPort("[2001:db8::1]:0"),
+		netip.MustParseAddrPort("[fe80::1%eth0]:8080"),
+	}
+	for _, ap := range aps {
+		bts := AppendAddrPort(nil, ap)
+		out, left, err := ReadAddrPortBytes(bts)
+		if err != nil {
+			t.Fatalf("%v: %s", ap, err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after ReadAddrPortBytes()", len(left))
+		}
+		if out != ap {
+			t.Errorf("wanted %v; got %v", ap, out)
+		}
+	}
+}
+
+func TestReadAddrWrongExtension(t *testing.T) {
+	bts := AppendAddrPort(nil, netip.MustParseAddrPort("192.0.2.1:80"))
+	_, _, err := ReadAddrBytes(bts)
+	if _, ok := err.(ExtensionTypeError); !ok {
+		t.Errorf("expected ExtensionTypeError; got %v", err)
+	}
+}
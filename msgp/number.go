@@ -0,0 +1,182 @@
+package msgp
+
+import (
+	"math"
+	"strconv"
+)
+
+// Number is a MessagePack number of any type: a signed or
+// unsigned integer, or a float32 or float64. Like Raw, it
+// keeps the object as it was encoded, so that a value that
+// passes through a Number is re-encoded with the same type
+// and width as it was decoded with. Its accessors convert
+// the number to a Go type, and fail rather than lose the
+// value. The zero Number encodes as the integer 0.
+type Number struct {
+	// raw holds the encoded object, and is zero past
+	// its end, so that equal encodings compare equal
+	raw [9]byte
+}
+
+// NumberMaxSize returns the maximum encoded size of a Number.
+func NumberMaxSize() int { return 9 }
+
+// Type returns the type that the number is encoded as,
+// which is one of IntType, UintType, Float32Type and
+// Float64Type.
+func (n Number) Type() Type { return getType(n.raw[0]) }
+
+// enc returns the encoded object
+func (n *Number) enc() []byte { return n.raw[:sizes[n.raw[0]].size] }
+
+// Int64 returns the number as an int64.
+// Possible errors:
+// - UintOverflow{} (an unsigned integer above math.MaxInt64)
+// - TypeError{} (the number is a float)
+func (n Number) Int64() (int64, error) {
+	switch n.Type() {
+	case UintType:
+		u, _, err := ReadUint64Bytes(n.enc())
+		if err == nil && u > math.MaxInt64 {
+			return 0, UintOverflow{Value: u, FailedBitsize: 64}
+		}
+		return int64(u), err
+	case IntType:
+		i, _, err := ReadInt64Bytes(n.enc())
+		return i, err
+	default:
+		return 0, TypeError{Method: IntType, Encoded: n.Type()}
+	}
+}
+
+// Uint64 returns the number as a uint64.
+// Possible errors:
+// - UintBelowZero{} (a negative integer)
+// - TypeError{} (the number is a float)
+func (n Number) Uint64() (uint64, error) {
+	switch n.Type() {
+	case IntType, UintType:
+		u, _, err := ReadUint64Bytes(n.enc())
+		return u, err
+	default:
+		return 0, TypeError{Method: UintType, Encoded: n.Type()}
+	}
+}
+
+// Float64 returns the number as a float64. An integer
+// is converted if a float64 holds it exactly.
+// Possible errors:
+// - IntOverflow{}, UintOverflow{} (an integer that a
+// float64 would round)
+func (n Number) Float64() (float64, error) {
+	switch n.Type() {
+	case IntType:
+		i, _, err := ReadInt64Bytes(n.enc())
+		// float64(1<<63) doesn't convert back to an int64
+		if f := float64(i); err == nil && (f >= math.MaxInt64 || int64(f) != i) {
+			return 0, IntOverflow{Value: i, FailedBitsize: 53}
+		}
+		return float64(i), err
+	case UintType:
+		u, _, err := ReadUint64Bytes(n.enc())
+		if f := float64(u); err == nil && (f >= math.MaxUint64 || uint64(f) != u) {
+			return 0, UintOverflow{Value: u, FailedBitsize: 53}
+		}
+		return float64(u), err
+	default:
+		f, _, err := ReadFloat64Bytes(n.enc())
+		return f, err
+	}
+}
+
+// String returns the number in decimal.
+func (n Number) String() string {
+	switch n.Type() {
+	case IntType:
+		i, _, _ := ReadInt64Bytes(n.enc())
+		return strconv.FormatInt(i, 10)
+	case UintType:
+		u, _, _ := ReadUint64Bytes(n.enc())
+		return strconv.FormatUint(u, 10)
+	case Float32Type:
+		f, _, _ := ReadFloat32Bytes(n.enc())
+		return strconv.FormatFloat(float64(f), 'g', -1, 32)
+	default:
+		f, _, _ := ReadFloat64Bytes(n.enc())
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
+
+// CanMarshalMsg returns true if the z interface is a Number object ( part of the Marshaler interface )
+func (Number) CanMarshalMsg(z interface{}) bool {
+	_, ok := (z).(Number)
+	if !ok {
+		_, ok = (z).(*Number)
+	}
+	return ok
+}
+
+// MarshalMsg implements msgp.Marshaler.
+// It appends the number as it was decoded.
+func (n Number) MarshalMsg(b []byte) []byte {
+	return append(b, n.enc()...)
+}
+
+// CanUnmarshalMsg returns true if the z interface is a Number object ( part of the Unmarshaler interface )
+func (*Number) CanUnmarshalMsg(z interface{}) bool {
+	_, ok := (z).(*Number)
+	return ok
+}
+
+// UnmarshalMsg implements msgp.Unmarshaler.
+// It sets the Number to the next object in
+// the provided byte slice, which must be a number.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not a number)
+func (n *Number) UnmarshalMsg(b []byte) ([]byte, error) {
+	if len(b) < 1 {
+		return b, ErrShortBytes
+	}
+	switch getType(b[0]) {
+	case IntType, UintType, Float32Type, Float64Type:
+	default:
+		return b, badPrefix(Float64Type, b[0])
+	}
+	sz := int(sizes[b[0]].size)
+	if len(b) < sz {
+		return b, ErrShortBytes
+	}
+	*n = Number{}
+	copy(n.raw[:], b[:sz])
+	return b[sz:], nil
+}
+
+// Msgsize implements msgp.Sizer
+func (n Number) Msgsize() int {
+	return int(sizes[n.raw[0]].size)
+}
+
+// MsgIsZero returns whether this is a zero value,
+// which is the Number encoded as a fixint 0
+func (n *Number) MsgIsZero() bool {
+	return *n == Number{}
+}
+
+// Equal returns whether the two numbers are
+// encoded the same; an int8 1 is not equal to
+// a fixint 1, since they are encoded differently.
+func (n *Number) Equal(m *Number) bool {
+	return *n == *m
+}
+
+// Clone returns a copy of the Number.
+func (n *Number) Clone() *Number {
+	c := *n
+	return &c
+}
+
+// Reset sets the Number to its zero value.
+func (n *Number) Reset() {
+	*n = Number{}
+}
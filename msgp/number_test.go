@@ -0,0 +1,113 @@
+package msgp
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestNumber(t *testing.T) {
+	for _, tc := range []struct {
+		enc []byte
+		typ Type
+		str string
+	}{
+		{AppendInt64(nil, 5), IntType, "5"},
+		{AppendInt64(nil, -5), IntType, "-5"},
+		{AppendInt64(nil, -1<<40), IntType, "-1099511627776"},
+		// the widths that AppendInt64 wouldn't pick
+		{[]byte{mint8, 5}, IntType, "5"},
+		{[]byte{mint64, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe}, IntType, "-2"},
+		{[]byte{muint16, 0, 7}, UintType, "7"},
+		{AppendUint64(nil, math.MaxUint64), UintType, "18446744073709551615"},
+		{AppendFloat32(nil, 1.5), Float32Type, "1.5"},
+		{AppendFloat64(nil, -0.25), Float64Type, "-0.25"},
+		{AppendFloat64(nil, 3), Float64Type, "3"},
+	} {
+		var n Number
+		o, err := n.UnmarshalMsg(append(tc.enc, 0xc0))
+		if err != nil {
+			t.Fatalf("%x: %v", tc.enc, err)
+		}
+		if len(o) != 1 {
+			t.Errorf("%x: %d bytes left; want 1", tc.enc, len(o))
+		}
+		if n.Type() != tc.typ || n.String() != tc.str {
+			t.Errorf("%x: %s %s; want %s %s", tc.enc, n.Type(), n, tc.typ, tc.str)
+		}
+		if b := n.MarshalMsg(nil); !bytes.Equal(b, tc.enc) || n.Msgsize() != len(b) {
+			t.Errorf("%x re-encoded as %x, size %d", tc.enc, b, n.Msgsize())
+		}
+		if c := n.Clone(); !c.Equal(&n) {
+			t.Errorf("%x: clone %s not equal", tc.enc, c)
+		}
+	}
+
+	var n Number
+	if b := n.MarshalMsg(nil); !bytes.Equal(b, AppendInt64(nil, 0)) || !n.MsgIsZero() {
+		t.Errorf("zero Number encoded as %x", b)
+	}
+	n.UnmarshalMsg([]byte{mint8, 0})
+	if n.MsgIsZero() || n.Equal(&Number{}) {
+		t.Error("an int8 0 is the zero Number")
+	}
+	n.Reset()
+	if !n.MsgIsZero() {
+		t.Error("not zero after Reset")
+	}
+
+	for _, b := range [][]byte{AppendString(nil, "1"), AppendNil(nil), AppendBool(nil, true)} {
+		if _, err := n.UnmarshalMsg(b); err == nil {
+			t.Errorf("%x decoded as a Number", b)
+		}
+	}
+	if _, err := n.UnmarshalMsg([]byte{mfloat64, 0, 0}); err != ErrShortBytes {
+		t.Errorf("short float64: %v", err)
+	}
+}
+
+func TestNumberAccessors(t *testing.T) {
+	number := func(b []byte) Number {
+		var n Number
+		if _, err := n.UnmarshalMsg(b); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	neg := number(AppendInt64(nil, -300))
+	if i, err := neg.Int64(); i != -300 || err != nil {
+		t.Errorf("Int64() = %d, %v", i, err)
+	}
+	if f, err := neg.Float64(); f != -300 || err != nil {
+		t.Errorf("Float64() = %g, %v", f, err)
+	}
+	if _, err := neg.Uint64(); err == nil {
+		t.Error("no error for a negative Uint64()")
+	}
+
+	big := number(AppendUint64(nil, math.MaxUint64))
+	if u, err := big.Uint64(); u != math.MaxUint64 || err != nil {
+		t.Errorf("Uint64() = %d, %v", u, err)
+	}
+	if _, err := big.Int64(); err == nil {
+		t.Error("no error for MaxUint64 as an int64")
+	}
+	if _, err := big.Float64(); err == nil {
+		t.Error("no error for MaxUint64 as a float64")
+	}
+	if _, err := number(AppendInt64(nil, 1<<53+1)).Float64(); err == nil {
+		t.Error("no error for 1<<53+1 as a float64")
+	}
+
+	fl := number(AppendFloat32(nil, 2.5))
+	if f, err := fl.Float64(); f != 2.5 || err != nil {
+		t.Errorf("Float64() = %g, %v", f, err)
+	}
+	if _, err := fl.Int64(); err == nil {
+		t.Error("no error for a float as an int64")
+	}
+	if _, err := fl.Uint64(); err == nil {
+		t.Error("no error for a float as a uint64")
+	}
+}
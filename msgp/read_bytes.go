@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"math"
 	"time"
+	"unicode/utf8"
 )
 
 var big = binary.BigEndian
@@ -18,7 +19,7 @@ func NextType(b []byte) Type {
 	}
 	spec := sizes[b[0]]
 	t := spec.typ
-	if t == ExtensionType && len(b) > int(spec.size) {
+	if t == ExtensionType && len(b) >= int(spec.size) {
 		var tp int8
 		if spec.extra == constsize {
 			tp = int8(b[1])
@@ -26,7 +27,7 @@ func NextType(b []byte) Type {
 			tp = int8(b[spec.size-1])
 		}
 		switch tp {
-		case TimeExtension:
+		case timeExtension, TimestampExtension:
 			return TimeType
 		case Complex128Extension:
 			return Complex128Type
@@ -49,6 +50,77 @@ func IsNil(b []byte) bool {
 	return false
 }
 
+// PeekType returns the type of the next object
+// in 'b', like NextType, but reports an empty
+// or invalid prefix as an error. It never
+// consumes any bytes, so a Read*Bytes call on
+// 'b' afterwards reads the object it describes.
+// Possible errors:
+// - ErrShortBytes (b is empty)
+// - InvalidPrefixError (bad encoding)
+func PeekType(b []byte) (Type, error) {
+	if len(b) == 0 {
+		return InvalidType, ErrShortBytes
+	}
+	if sizes[b[0]].size == 0 {
+		return InvalidType, InvalidPrefixError(b[0])
+	}
+	return NextType(b), nil
+}
+
+// PeekHeader describes the header of the next
+// object in 'b' without consuming it. 'hdrlen' is
+// the number of bytes before the object's contents.
+// 'sz' is the number of elements of an array, the
+// number of key-value pairs of a map, and the length
+// in bytes of a 'str', 'bin' or extension object
+// (not counting the extension type). For other
+// types, 'sz' is 0 and 'hdrlen' is the size of
+// the whole object.
+// Possible errors:
+// - ErrShortBytes (too few bytes for the header)
+// - InvalidPrefixError (bad encoding)
+func PeekHeader(b []byte) (typ Type, hdrlen int, sz int, err error) {
+	typ, err = PeekType(b)
+	if err != nil {
+		return
+	}
+	spec := sizes[b[0]]
+	hdrlen = int(spec.size)
+	if len(b) < hdrlen && spec.extra != constsize {
+		return typ, 0, 0, ErrShortBytes
+	}
+
+	switch spec.extra {
+	case constsize:
+		switch typ {
+		case StrType:
+			// fixstr
+			hdrlen, sz = 1, int(spec.size)-1
+		case ExtensionType, TimeType, Complex64Type, Complex128Type:
+			// fixext
+			hdrlen, sz = 2, int(spec.size)-2
+		}
+	case extra8:
+		sz = int(b[1])
+	case extra16:
+		sz = int(big.Uint16(b[1:]))
+	case extra32:
+		sz, err = u32int(big.Uint32(b[1:]))
+	case map16v, array16v:
+		sz = int(big.Uint16(b[1:]))
+	case map32v, array32v:
+		sz, err = u32int(big.Uint32(b[1:]))
+	default:
+		// fixmap and fixarray
+		sz = int(spec.extra)
+		if typ == MapType {
+			sz /= 2
+		}
+	}
+	return
+}
+
 // Raw is raw MessagePack.
 // Raw allows you to read and write
 // data without interpreting its contents.
@@ -87,22 +159,38 @@ func (*Raw) CanUnmarshalMsg(z interface{}) bool {
 // It sets the contents of *Raw to be the next
 // object in the provided byte slice.
 func (r *Raw) UnmarshalMsg(b []byte) ([]byte, error) {
-	l := len(b)
-	out, err := Skip(b)
+	v, out, err := ReadRawBytes(b, *r)
 	if err != nil {
 		return b, err
 	}
-	rlen := l - len(out)
+	*r = v
+	return out, nil
+}
+
+// ReadRawBytes reads the next object in 'b', whatever
+// its type, as Raw, which is copied to 'scratch' if it is
+// big enough, and returns it and the remaining bytes. A
+// 'nil' object is read as an empty Raw, which MarshalMsg
+// and AppendRaw encode as 'nil' again.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - InvalidPrefixError (an unknown type)
+func ReadRawBytes(b []byte, scratch Raw) (v Raw, o []byte, err error) {
+	o, err = Skip(b)
+	if err != nil {
+		return scratch, b, err
+	}
+	rlen := len(b) - len(o)
 	if IsNil(b[:rlen]) {
 		rlen = 0
 	}
-	if cap(*r) < rlen {
-		*r = make(Raw, rlen)
+	if cap(scratch) < rlen {
+		v = make(Raw, rlen)
 	} else {
-		*r = (*r)[0:rlen]
+		v = scratch[0:rlen]
 	}
-	copy(*r, b[:rlen])
-	return out, nil
+	copy(v, b[:rlen])
+	return v, o, nil
 }
 
 // Msgsize implements msgp.Sizer
@@ -174,8 +262,23 @@ func ReadMapHeaderBytes(b []byte) (sz int, isnil bool, o []byte, err error) {
 	}
 }
 
+// ReadMapHeaderBytesMax is like ReadMapHeaderBytes, but returns
+// 'b' and an ErrOverflow error if the size of the map is more
+// than 'max', as ReadArrayHeaderBytesMax does for arrays.
+func ReadMapHeaderBytesMax(b []byte, max uint64) (sz int, isnil bool, o []byte, err error) {
+	sz, isnil, o, err = ReadMapHeaderBytes(b)
+	if err == nil && uint64(sz) > max {
+		return 0, false, b, ErrOverflow(uint64(sz), max)
+	}
+	return
+}
+
 // ReadMapKeyZC attempts to read a map key
 // from 'b' and returns the key bytes and the remaining bytes
+// The key is not copied: it points into 'b', and is only
+// valid as long as 'b' is not modified. Generated decoders
+// use it to match struct field names, with a switch on
+// string(key) that the compiler does without allocating.
 // Possible errors:
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not a str or bin)
@@ -190,6 +293,18 @@ func ReadMapKeyZC(b []byte) ([]byte, []byte, error) {
 	return o, x, nil
 }
 
+// HasField returns whether 'field', a map key read
+// with ReadMapKeyZC, is one of 'fields'. It is used by
+// the generated UnmarshalMsgFields methods.
+func HasField(fields []string, field []byte) bool {
+	for _, f := range fields {
+		if f == string(field) {
+			return true
+		}
+	}
+	return false
+}
+
 // ReadArrayHeaderBytes attempts to read
 // the array header size off of 'b' and return
 // the size and remaining bytes.
@@ -200,6 +315,18 @@ func ReadArrayHeaderBytes(b []byte) (sz int, isnil bool, o []byte, err error) {
 	return readArrayHeaderBytes(b, true)
 }
 
+// ReadArrayHeaderBytesMax is like ReadArrayHeaderBytes, but
+// returns 'b' and an ErrOverflow error if the size of the array
+// is more than 'max', so that the caller doesn't loop over, or
+// allocate for, more elements than it can expect.
+func ReadArrayHeaderBytesMax(b []byte, max uint64) (sz int, isnil bool, o []byte, err error) {
+	sz, isnil, o, err = ReadArrayHeaderBytes(b)
+	if err == nil && uint64(sz) > max {
+		return 0, false, b, ErrOverflow(uint64(sz), max)
+	}
+	return
+}
+
 func readArrayHeaderBytes(b []byte, flattenMap bool) (sz int, isnil bool, o []byte, err error) {
 	if len(b) < 1 {
 		return 0, false, nil, ErrShortBytes
@@ -304,6 +431,10 @@ func ReadNilBytes(b []byte) ([]byte, error) {
 // - ErrShortBytes (too few bytes)
 // - TypeError{} (not a float64)
 func ReadFloat64Bytes(b []byte) (f float64, o []byte, err error) {
+	if len(b) < 1 {
+		err = ErrShortBytes
+		return
+	}
 	if len(b) < 9 {
 		if len(b) >= 5 && b[0] == mfloat32 {
 			var tf float32
@@ -737,7 +868,10 @@ func ReadBytesBytes(b []byte, scratch []byte) (v []byte, o []byte, err error) {
 	return readBytesBytes(b, scratch, false, true)
 }
 
-func readBytesBytesSlow(b []byte, flattenMap bool) (v []byte, o []byte, err error) {
+// readBytesBytesSlow reads an array of bytes into
+// 'scratch', if it is big enough, as readBytesBytes
+// does a 'bin' object
+func readBytesBytesSlow(b []byte, scratch []byte, flattenMap bool) (v []byte, o []byte, err error) {
 	var count int
 	count, _, o, err = readArrayHeaderBytes(b, flattenMap)
 	if err != nil {
@@ -749,7 +883,11 @@ func readBytesBytesSlow(b []byte, flattenMap bool) (v []byte, o []byte, err erro
 		return
 	}
 
-	v = make([]byte, count)
+	if scratch != nil && cap(scratch) >= count {
+		v = scratch[0:count]
+	} else {
+		v = make([]byte, count)
+	}
 	for idx := range v {
 		v[idx], o, err = ReadByteBytes(o)
 		if err != nil {
@@ -918,7 +1056,7 @@ func readBytesBytes(b []byte, scratch []byte, zc bool, flattenMap bool) (v []byt
 			// go-codec compat: decode into byte array/slice from
 			// explicit array encodings (including the weird case
 			// of decoding a map as a key-value interleaved array).
-			v, o, err = readBytesBytesSlow(b, flattenMap)
+			v, o, err = readBytesBytesSlow(b, scratch, flattenMap)
 			if err != nil {
 				// If that doesn't work, return the original error code.
 				err = badPrefix(BinType, lead)
@@ -934,7 +1072,7 @@ func readBytesBytes(b []byte, scratch []byte, zc bool, flattenMap bool) (v []byt
 
 	// zero-copy
 	if zc {
-		v = b[0:read]
+		v = b[0:read:read]
 		o = b[read:]
 		return
 	}
@@ -953,7 +1091,9 @@ func readBytesBytes(b []byte, scratch []byte, zc bool, flattenMap bool) (v []byt
 
 // ReadBytesZC extracts the messagepack-encoded
 // binary field without copying. The returned []byte
-// points to the same memory as the input slice.
+// points to the same memory as the input slice; its
+// capacity ends with it, so appending to it doesn't
+// overwrite the rest of the input.
 // Possible errors:
 // - ErrShortBytes (b not long enough)
 // - TypeError{} (object not 'bin')
@@ -968,7 +1108,7 @@ func readExactBytesSlow(b []byte, into []byte) (o []byte, err error) {
 		return
 	}
 
-	if count > len(into) {
+	if count != len(into) {
 		err = ArrayError{Wanted: len(into), Got: count}
 		return
 	}
@@ -983,6 +1123,15 @@ func readExactBytesSlow(b []byte, into []byte) (o []byte, err error) {
 	return
 }
 
+// ReadExactBytes reads a 'bin' object of exactly
+// len(into) bytes from 'b' into 'into', and returns
+// the remaining bytes. For go-codec compatibility,
+// 'str' objects and arrays of bytes are accepted as
+// well, and nil zeroes 'into'.
+// Possible errors:
+// - ErrShortBytes (b not long enough)
+// - ArrayError{} (object not exactly len(into) bytes)
+// - TypeError{} (object not 'bin')
 func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
 	l := len(b)
 	if l < 1 {
@@ -1070,7 +1219,7 @@ func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
 			// explicit array encodings (including the weird case
 			// of decoding a map as a key-value interleaved array).
 			o, err = readExactBytesSlow(b, into)
-			if err != nil {
+			if _, ok := err.(ArrayError); err != nil && !ok {
 				// If that doesn't work, return the original error code.
 				err = badPrefix(BinType, lead)
 			}
@@ -1078,14 +1227,12 @@ func ReadExactBytes(b []byte, into []byte) (o []byte, err error) {
 		}
 	}
 
-	// go-codec compat: allow decoding a different number of bytes than the
-	// size of the fixed array; take the min of the size of the Go type and
-	// the encoded array size.
-	//
-	// if read != len(into) {
-	// 	err = ArrayError{Wanted: uint32(len(into)), Got: uint32(read)}
-	// 	return
-	// }
+	// nil clears the array (above); anything else
+	// must have exactly as many bytes as the array
+	if lead != mnil && read != len(into) {
+		err = ArrayError{Wanted: len(into), Got: read}
+		return
+	}
 
 	if read > len(b[skip:]) {
 		err = ErrShortBytes
@@ -1181,6 +1328,25 @@ func ReadStringBytes(b []byte) (string, []byte, error) {
 	return string(v), o, err
 }
 
+// ReadUTF8StringBytes is like ReadStringBytes, but
+// returns 'b' and ErrInvalidUTF8 if the string
+// isn't valid UTF-8.
+// Possible errors:
+// - ErrShortBytes (b not long enough)
+// - TypeError{} (not 'str' type)
+// - InvalidPrefixError
+// - ErrInvalidUTF8 (not valid UTF-8)
+func ReadUTF8StringBytes(b []byte) (string, []byte, error) {
+	v, o, err := ReadStringZC(b)
+	if err != nil {
+		return "", o, err
+	}
+	if !utf8.Valid(v) {
+		return "", b, ErrInvalidUTF8
+	}
+	return string(v), o, nil
+}
+
 // ReadStringAsBytes reads a 'str' object
 // into a slice of bytes. 'v' is the value of
 // the 'str' object, which may reside in memory
@@ -1252,12 +1418,21 @@ func ReadComplex64Bytes(b []byte) (c complex64, o []byte, err error) {
 
 // ReadTimeBytes reads a time.Time
 // extension object from 'b' and returns the
-// remaining bytes.
+// remaining bytes. Its extension number is
+// TimeExtension, or the one set by RegisterTimeExt.
+// It also reads the timestamp extension of the
+// MessagePack spec, as ReadTimestampBytes does.
 // Possible errors:
 // - ErrShortBytes (not enough bytes in 'b')
 // - TypeError{} (object not a complex64)
 // - ExtensionTypeError{} (object an extension of the correct size, but not a time.Time)
 func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	return ReadTimeExtBytes(b, timeExtension)
+}
+
+// ReadTimeExtBytes is like ReadTimeBytes, but reads
+// a time.Time with the extension number 'typ'.
+func ReadTimeExtBytes(b []byte, typ int8) (t time.Time, o []byte, err error) {
 	if len(b) < 1 {
 		err = ErrShortBytes
 		return
@@ -1266,6 +1441,9 @@ func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
 		o = b[1:]
 		return
 	}
+	if typ != TimestampExtension && isTimestamp(b) {
+		return ReadTimestampBytes(b)
+	}
 	if len(b) < 15 {
 		err = ErrShortBytes
 		return
@@ -1274,8 +1452,8 @@ func ReadTimeBytes(b []byte) (t time.Time, o []byte, err error) {
 		err = badPrefix(TimeType, b[0])
 		return
 	}
-	if int8(b[2]) != TimeExtension {
-		err = errExt(int8(b[2]), TimeExtension)
+	if int8(b[2]) != typ {
+		err = errExt(int8(b[2]), typ)
 		return
 	}
 	sec, nsec := getUnix(b[3:])
@@ -1310,6 +1488,97 @@ func Skip(b []byte) ([]byte, error) {
 	return b, nil
 }
 
+// AppendNext appends the next object in 'b',
+// including all of the elements of a map or
+// array, to 'o' without decoding it, and returns
+// the extended slice and the remaining bytes of
+// 'b'. It relays a message from one buffer to
+// another without knowing its type.
+// Possible Errors:
+// - ErrShortBytes (not enough bytes in b)
+// - InvalidPrefixError (bad encoding)
+func AppendNext(o []byte, b []byte) ([]byte, []byte, error) {
+	rest, err := Skip(b)
+	if err != nil {
+		return o, b, err
+	}
+	return append(o, b[:len(b)-len(rest)]...), rest, nil
+}
+
+// DrainBytes skips the next 'remaining' objects in 'b',
+// the elements of an array left after reading the first
+// few, and returns the bytes after them: the next object
+// after the array.
+// Possible Errors:
+// - ErrShortBytes (not enough bytes in b)
+// - InvalidPrefixError (bad encoding)
+func DrainBytes(b []byte, remaining int) ([]byte, error) {
+	for ; remaining > 0; remaining-- {
+		o, err := Skip(b)
+		if err != nil {
+			return b, err
+		}
+		b = o
+	}
+	return b, nil
+}
+
+// DrainMapBytes is like DrainBytes, but it skips the
+// next 'remaining' key/value pairs, the fields of a map
+// left after reading the first few.
+func DrainMapBytes(b []byte, remaining int) ([]byte, error) {
+	return DrainBytes(b, 2*remaining)
+}
+
+// SkipLimit is like Skip, but it refuses to skip
+// objects from untrusted input that would take it
+// too deep or too far: it fails once maps and arrays
+// are nested more than maxDepth deep, and once the
+// object is found to be longer than maxBytes.
+// Possible Errors:
+// - ErrShortBytes (not enough bytes in b)
+// - InvalidPrefixError (bad encoding)
+// - ErrRecursionLimit (nested too deeply)
+// - ErrMaxBytesExceeded (object too long)
+func SkipLimit(b []byte, maxDepth int, maxBytes int64) ([]byte, error) {
+	return skipLimit(b, maxDepth, int64(len(b))-maxBytes)
+}
+
+// skipLimit skips an object at a depth that allows
+// depth more levels, without leaving fewer than
+// min bytes in b.
+func skipLimit(b []byte, depth int, min int64) ([]byte, error) {
+	sz, asz, err := getSize(b)
+	if err != nil {
+		return b, err
+	}
+	if uintptr(len(b)) < sz {
+		return b, ErrShortBytes
+	}
+	if int64(len(b))-int64(sz) < min {
+		return b, ErrMaxBytesExceeded
+	}
+	b = b[sz:]
+	if asz > 0 {
+		if depth <= 0 {
+			return b, ErrRecursionLimit
+		}
+		// every element takes at least a byte, so
+		// don't count through more than are left
+		if asz > uintptr(len(b)) {
+			return b, ErrShortBytes
+		}
+	}
+	for asz > 0 {
+		b, err = skipLimit(b, depth-1, min)
+		if err != nil {
+			return b, err
+		}
+		asz--
+	}
+	return b, nil
+}
+
 // returns (skip N bytes, skip M objects, error)
 func getSize(b []byte) (uintptr, uintptr, error) {
 	l := len(b)
@@ -1347,3 +1616,111 @@ func getSize(b []byte) (uintptr, uintptr, error) {
 		return 0, 0, fatal
 	}
 }
+
+// ReadInt64SliceBytes reads len(dst) consecutive int64
+// values from 'b' into dst and returns the remaining bytes.
+// It is meant to follow ReadArrayHeaderBytes: the caller
+// reads the header and sizes dst, and this reads the elements.
+// Since every element takes at least a byte, a 'b' too short
+// for dst is rejected before any is read, and the elements
+// that are fixints are decoded in place; the others are read
+// with ReadInt64Bytes, whose errors are returned with the
+// index of the offending element as context.
+func ReadInt64SliceBytes(b []byte, dst []int64) (o []byte, err error) {
+	if len(b) < len(dst) {
+		return b, ErrShortBytes
+	}
+	for i := range dst {
+		if len(b) > 0 && (isfixint(b[0]) || isnfixint(b[0])) {
+			dst[i] = int64(int8(b[0]))
+			b = b[1:]
+			continue
+		}
+		dst[i], b, err = ReadInt64Bytes(b)
+		if err != nil {
+			return b, WrapError(err, i)
+		}
+	}
+	return b, nil
+}
+
+// ReadUint64SliceBytes is like ReadInt64SliceBytes,
+// but for uint64 values.
+func ReadUint64SliceBytes(b []byte, dst []uint64) (o []byte, err error) {
+	if len(b) < len(dst) {
+		return b, ErrShortBytes
+	}
+	for i := range dst {
+		if len(b) > 0 && isfixint(b[0]) {
+			dst[i] = uint64(b[0])
+			b = b[1:]
+			continue
+		}
+		dst[i], b, err = ReadUint64Bytes(b)
+		if err != nil {
+			return b, WrapError(err, i)
+		}
+	}
+	return b, nil
+}
+
+// ReadFloat64SliceBytes is like ReadInt64SliceBytes, but
+// for float64 values, which MarshalMsg always writes in 9
+// bytes: if 'b' is long enough for all of dst to be, they
+// are decoded in place, until one that isn't a float64.
+func ReadFloat64SliceBytes(b []byte, dst []float64) (o []byte, err error) {
+	if len(b) < len(dst) {
+		return b, ErrShortBytes
+	}
+	i := 0
+	if len(b) >= len(dst)*9 {
+		for ; i < len(dst) && b[0] == mfloat64; i++ {
+			dst[i] = math.Float64frombits(big.Uint64(b[1:]))
+			b = b[9:]
+		}
+	}
+	for ; i < len(dst); i++ {
+		dst[i], b, err = ReadFloat64Bytes(b)
+		if err != nil {
+			return b, WrapError(err, i)
+		}
+	}
+	return b, nil
+}
+
+// ReadMapStrStrBytes reads a map[string]string, as written by
+// AppendMapStrStr, from 'b' and returns the map and the remaining
+// bytes. If 'old' is not nil, its entries are deleted and it is
+// reused. A nil map is read as an empty one.
+// Possible errors:
+// - ErrShortBytes (not enough bytes in 'b')
+// - TypeError{} (object not a map, or a key or value not a 'str')
+func ReadMapStrStrBytes(b []byte, old map[string]string) (v map[string]string, o []byte, err error) {
+	var sz int
+	sz, _, o, err = ReadMapHeaderBytes(b)
+	if err != nil {
+		return old, b, err
+	}
+	if old != nil {
+		for key := range old {
+			delete(old, key)
+		}
+		v = old
+	} else {
+		v = make(map[string]string, sz)
+	}
+	for i := 0; i < sz; i++ {
+		var key []byte
+		var val string
+		key, o, err = ReadStringZC(o)
+		if err != nil {
+			return v, o, err
+		}
+		val, o, err = ReadStringBytes(o)
+		if err != nil {
+			return v, o, WrapError(err, string(key))
+		}
+		v[string(key)] = val
+	}
+	return v, o, nil
+}
@@ -1,6 +1,8 @@
 package msgp
 
 import (
+	"bytes"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -98,3 +100,707 @@ func BenchmarkReadTimeBytes(b *testing.B) {
 		ReadTimeBytes(data)
 	}
 }
+
+func TestReadInt64SliceBytes(t *testing.T) {
+	in := []int64{0, 1, -1, 127, -33, 1 << 40, -1 << 40}
+	var bts []byte
+	for _, v := range in {
+		bts = AppendInt64(bts, v)
+	}
+	bts = AppendUint64(bts, 5) // unsigned encodings are accepted too
+	out := make([]int64, len(in)+1)
+	left, err := ReadInt64SliceBytes(bts, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over after ReadInt64SliceBytes()", len(left))
+	}
+	for i := range in {
+		if out[i] != in[i] {
+			t.Errorf("element %d: wanted %d; got %d", i, in[i], out[i])
+		}
+	}
+	if out[len(in)] != 5 {
+		t.Errorf("last element: wanted 5; got %d", out[len(in)])
+	}
+
+	if _, err = ReadInt64SliceBytes(bts[:len(bts)-1], out); err == nil {
+		t.Error("expected an error for a truncated slice")
+	}
+}
+
+func TestReadUint64AndFloat64SliceBytes(t *testing.T) {
+	us := []uint64{0, 3, 200, 1 << 63}
+	fs := []float64{0, -1.5, 3.25e100}
+	var bts []byte
+	for _, v := range us {
+		bts = AppendUint64(bts, v)
+	}
+	for _, v := range fs {
+		bts = AppendFloat64(bts, v)
+	}
+	bts = AppendFloat32(bts, 2.5) // float32 widens
+
+	uout := make([]uint64, len(us))
+	fout := make([]float64, len(fs)+1)
+	bts, err := ReadUint64SliceBytes(bts, uout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bts, err = ReadFloat64SliceBytes(bts, fout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bts) > 0 {
+		t.Errorf("%d bytes left over", len(bts))
+	}
+	for i := range us {
+		if uout[i] != us[i] {
+			t.Errorf("element %d: wanted %d; got %d", i, us[i], uout[i])
+		}
+	}
+	for i := range fs {
+		if fout[i] != fs[i] {
+			t.Errorf("element %d: wanted %g; got %g", i, fs[i], fout[i])
+		}
+	}
+	if fout[len(fs)] != 2.5 {
+		t.Errorf("last element: wanted 2.5; got %g", fout[len(fs)])
+	}
+
+	// every element takes at least a byte, and a float64 nine
+	if _, err := ReadUint64SliceBytes([]byte{1}, uout[:2]); err != ErrShortBytes {
+		t.Errorf("expected ErrShortBytes for 2 elements in a byte; got %v", err)
+	}
+	if _, err := ReadFloat64SliceBytes(AppendFloat64(nil, 1), fout[:2]); err == nil {
+		t.Error("expected an error for one float64 read as two")
+	}
+}
+
+func benchInt64Slice() ([]byte, []int64) {
+	in := make([]int64, 1024)
+	var bts []byte
+	for i := range in {
+		in[i] = int64(i * i * 31)
+		bts = AppendInt64(bts, in[i])
+	}
+	return bts, in
+}
+
+func BenchmarkReadInt64SliceBytes(b *testing.B) {
+	bts, out := benchInt64Slice()
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := ReadInt64SliceBytes(bts, out); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadInt64BytesLoop is the element-by-element
+// equivalent of BenchmarkReadInt64SliceBytes.
+func BenchmarkReadInt64BytesLoop(b *testing.B) {
+	bts, out := benchInt64Slice()
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		o := bts
+		var err error
+		for j := range out {
+			out[j], o, err = ReadInt64Bytes(o)
+			if err != nil {
+				b.Fatal(WrapError(err, j))
+			}
+		}
+	}
+}
+
+func TestReadMapStrStrBytes(t *testing.T) {
+	in := map[string]string{"a": "1", "bb": "", "": "3"}
+	bts := AppendMapStrStr(nil, in)
+
+	old := map[string]string{"stale": "x"}
+	out, left, err := ReadMapStrStrBytes(bts, old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over after ReadMapStrStrBytes()", len(left))
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("wanted %v; got %v", in, out)
+	}
+	if _, ok := old["stale"]; ok {
+		t.Error("old map was not reused")
+	}
+
+	bad := AppendString(AppendString(AppendMapHeader(nil, 1), "a"), "1")
+	bad[len(bad)-2] = mint8
+	if _, _, err := ReadMapStrStrBytes(bad, nil); err == nil {
+		t.Error("no error for a non-str value")
+	}
+}
+
+func benchMapStrStr() []byte {
+	m := make(map[string]string, 16)
+	for i := 0; i < 16; i++ {
+		m[string(rune('a'+i))+"-label"] = "some header value"
+	}
+	return AppendMapStrStr(nil, m)
+}
+
+func BenchmarkReadMapStrStrBytes(b *testing.B) {
+	bts := benchMapStrStr()
+	m := make(map[string]string, 16)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if m, _, err = ReadMapStrStrBytes(bts, m); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadMapStrStrBytesLoop is the entry-by-entry
+// equivalent of BenchmarkReadMapStrStrBytes, as generated.
+func BenchmarkReadMapStrStrBytesLoop(b *testing.B) {
+	bts := benchMapStrStr()
+	m := make(map[string]string, 16)
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sz, _, o, err := ReadMapHeaderBytes(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < sz; j++ {
+			var k, v string
+			k, o, err = ReadStringBytes(o)
+			if err != nil {
+				b.Fatal(err)
+			}
+			v, o, err = ReadStringBytes(o)
+			if err != nil {
+				b.Fatal(err)
+			}
+			m[k] = v
+		}
+	}
+}
+
+// benchStructKeys returns a map encoding of a struct
+// with four fields, like the generated code encodes it
+func benchStructKeys() []byte {
+	bts := AppendMapHeader(nil, 4)
+	for _, k := range []string{"amount", "fee", "receiver", "sender"} {
+		bts = AppendString(bts, k)
+		bts = AppendInt64(bts, 1)
+	}
+	return bts
+}
+
+// BenchmarkReadStructKeysZC decodes the keys of a struct as
+// the generated code does, without copying or allocating.
+func BenchmarkReadStructKeysZC(b *testing.B) {
+	bts := benchStructKeys()
+	b.SetBytes(int64(len(bts)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sz, _, o, err := ReadMapHeaderBytes(bts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < sz; j++ {
+			var field []byte
+			field, o, err = ReadMapKeyZC(o)
+			if err != nil {
+				b.Fatal(err)
+			}
+			switch string(field) {
+			case "amount", "fee", "receiver", "sender":
+			default:
+				b.Fatalf("unknown field %q", field)
+			}
+			if _, o, err = ReadInt64Bytes(o); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestReadExactBytes(t *testing.T) {
+	in := RandBytes(32)
+	var out [32]byte
+	left, err := ReadExactBytes(AppendBytes(nil, in), out[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over after ReadExactBytes()", len(left))
+	}
+	if !reflect.DeepEqual(out[:], in) {
+		t.Errorf("wanted %x; got %x", in, out)
+	}
+
+	// arrays of bytes are accepted too, for go-codec compatibility
+	arr := AppendArrayHeader(nil, 32)
+	for _, c := range in {
+		arr = AppendByte(arr, c)
+	}
+	out = [32]byte{}
+	if _, err := ReadExactBytes(arr, out[:]); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out[:], in) {
+		t.Errorf("wanted %x; got %x", in, out)
+	}
+
+	// nil zeroes the array
+	if _, err := ReadExactBytes(AppendNil(nil), out[:]); err != nil {
+		t.Fatal(err)
+	}
+	if out != ([32]byte{}) {
+		t.Errorf("wanted zeroes; got %x", out)
+	}
+}
+
+func TestReadBytesZC(t *testing.T) {
+	in := RandBytes(32)
+	bts := AppendBool(AppendBytes(nil, in), true)
+	out, left, err := ReadBytesZC(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) || len(left) != 1 {
+		t.Fatalf("wanted %x; got %x, with %d bytes left", in, out, len(left))
+	}
+	// the value is the input, but appending to it
+	// leaves the rest of the input alone
+	if &out[0] != &bts[2] {
+		t.Error("value doesn't share memory with the input")
+	}
+	if cap(out) != len(out) {
+		t.Errorf("capacity %d runs past the value", cap(out))
+	}
+	out = append(out, 0)
+	if left[0] != mtrue {
+		t.Errorf("append to the value overwrote the input")
+	}
+}
+
+func TestReadBytesBytesScratch(t *testing.T) {
+	in := RandBytes(20)
+	arr := AppendArrayHeader(nil, uint32(len(in)))
+	for _, c := range in {
+		arr = AppendByte(arr, c)
+	}
+	for name, bts := range map[string][]byte{
+		"bin":   AppendBytes(nil, in),
+		"str":   AppendString(nil, string(in)),
+		"array": arr,
+	} {
+		for _, c := range []int{0, len(in) - 1, len(in), 2 * len(in)} {
+			scratch := make([]byte, c)
+			for i := range scratch {
+				scratch[i] = 0xee
+			}
+			v, o, err := ReadBytesBytes(bts, scratch)
+			if err != nil || !bytes.Equal(v, in) || len(o) != 0 {
+				t.Fatalf("%s, scratch of %d: %x, %d bytes left, %v", name, c, v, len(o), err)
+			}
+			// the scratch is used whenever it can hold the value
+			if reused := c > 0 && &v[0] == &scratch[:1][0]; reused != (c >= len(in)) {
+				t.Errorf("%s, scratch of %d: reused %v", name, c, reused)
+			}
+		}
+	}
+}
+
+func BenchmarkReadBytesBytes(b *testing.B) {
+	bts := AppendBytes(nil, RandBytes(256))
+	for _, bench := range []struct {
+		name    string
+		scratch []byte
+	}{
+		{"Alloc", nil},
+		{"Reuse", make([]byte, 256)},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.SetBytes(int64(len(bts)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := ReadBytesBytes(bts, bench.scratch); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadExactBytesWrongLength(t *testing.T) {
+	for _, n := range []int{0, 31, 33} {
+		var out [32]byte
+		_, err := ReadExactBytes(AppendBytes(nil, RandBytes(n)), out[:])
+		if ae, ok := err.(ArrayError); !ok || ae.Wanted != 32 || ae.Got != n {
+			t.Errorf("%d-byte bin: expected ArrayError; got %v", n, err)
+		}
+
+		arr := AppendArrayHeader(nil, uint32(n))
+		for i := 0; i < n; i++ {
+			arr = AppendByte(arr, byte(i))
+		}
+		_, err = ReadExactBytes(arr, out[:])
+		if ae, ok := err.(ArrayError); !ok || ae.Wanted != 32 || ae.Got != n {
+			t.Errorf("%d-byte array: expected ArrayError; got %v", n, err)
+		}
+	}
+}
+
+func TestPeekHeader(t *testing.T) {
+	str := string(RandBytes(40))
+	cases := []struct {
+		b      []byte
+		typ    Type
+		hdrlen int
+		sz     int
+	}{
+		{AppendMapHeader(nil, 3), MapType, 1, 3},
+		{AppendMapHeader(nil, 300), MapType, 3, 300},
+		{AppendArrayHeader(nil, 0), ArrayType, 1, 0},
+		{AppendArrayHeader(nil, 70000), ArrayType, 5, 70000},
+		{AppendBytes(nil, RandBytes(10)), BinType, 2, 10},
+		{AppendBytes(nil, RandBytes(300)), BinType, 3, 300},
+		{AppendString(nil, "hello"), StrType, 1, 5},
+		{AppendString(nil, str), StrType, 2, 40},
+		{AppendComplex64(nil, 1), Complex64Type, 2, 8},
+		{AppendTime(nil, time.Now()), TimeType, 3, 12},
+		{AppendUint64(nil, 1<<40), UintType, 9, 0},
+		{AppendInt64(nil, -1), IntType, 1, 0},
+		{AppendNil(nil), NilType, 1, 0},
+	}
+	for _, c := range cases {
+		typ, hdrlen, sz, err := PeekHeader(c.b)
+		if err != nil {
+			t.Fatalf("%s: %v", c.typ, err)
+		}
+		if typ != c.typ || hdrlen != c.hdrlen || sz != c.sz {
+			t.Errorf("%s: expected header of %d bytes and size %d; got %s of %d bytes and size %d", c.typ, c.hdrlen, c.sz, typ, hdrlen, sz)
+		}
+	}
+
+	if _, _, _, err := PeekHeader(AppendMapHeader(nil, 300)[:2]); err != ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+	if _, err := PeekType(nil); err != ErrShortBytes {
+		t.Errorf("expected ErrShortBytes; got %v", err)
+	}
+	if _, err := PeekType([]byte{0xc1}); err != InvalidPrefixError(0xc1) {
+		t.Errorf("expected InvalidPrefixError; got %v", err)
+	}
+}
+
+func TestPeekThenRead(t *testing.T) {
+	b := AppendArrayHeader(nil, 2)
+	b = AppendString(b, "x")
+	b = AppendMapHeader(b, 1)
+	b = AppendString(b, "k")
+	b = AppendBytes(b, []byte{1, 2})
+
+	for _, want := range []Type{ArrayType, StrType, MapType, StrType, BinType} {
+		before := len(b)
+		typ, err := PeekType(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, hdrlen, sz, err := PeekHeader(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if typ != want || len(b) != before {
+			t.Fatalf("expected to peek %s without consuming it; got %s", want, typ)
+		}
+
+		var n int
+		var o []byte
+		switch typ {
+		case ArrayType:
+			n, _, o, err = ReadArrayHeaderBytes(b)
+		case MapType:
+			n, _, o, err = ReadMapHeaderBytes(b)
+		case StrType:
+			var s string
+			s, o, err = ReadStringBytes(b)
+			n = len(s)
+		case BinType:
+			var v []byte
+			v, o, err = ReadBytesBytes(b, nil)
+			n = len(v)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != sz {
+			t.Errorf("%s: peeked size %d; read %d", typ, sz, n)
+		}
+		if typ == ArrayType || typ == MapType {
+			if len(b)-len(o) != hdrlen {
+				t.Errorf("%s: peeked a %d-byte header; read %d bytes", typ, hdrlen, len(b)-len(o))
+			}
+		} else if len(b)-len(o) != hdrlen+sz {
+			t.Errorf("%s: peeked %d bytes; read %d bytes", typ, hdrlen+sz, len(b)-len(o))
+		}
+		b = o
+	}
+}
+
+func TestReadHeaderBytesMax(t *testing.T) {
+	arr := AppendArrayHeader(nil, 300)
+	if sz, _, o, err := ReadArrayHeaderBytesMax(arr, 300); err != nil || sz != 300 || len(o) != 0 {
+		t.Errorf("array of 300, max 300: size %d, %d bytes left, %v", sz, len(o), err)
+	}
+	if _, _, o, err := ReadArrayHeaderBytesMax(arr, 299); err != ErrOverflow(300, 299) || len(o) != len(arr) {
+		t.Errorf("array of 300, max 299: expected ErrOverflow and all %d bytes; got %v and %d", len(arr), err, len(o))
+	}
+	m := AppendMapHeader(nil, 70000)
+	if sz, _, _, err := ReadMapHeaderBytesMax(m, 70000); err != nil || sz != 70000 {
+		t.Errorf("map of 70000, max 70000: size %d, %v", sz, err)
+	}
+	if _, _, o, err := ReadMapHeaderBytesMax(m, 10); err != ErrOverflow(70000, 10) || len(o) != len(m) {
+		t.Errorf("map of 70000, max 10: expected ErrOverflow and all %d bytes; got %v and %d", len(m), err, len(o))
+	}
+	if _, isnil, _, err := ReadArrayHeaderBytesMax(AppendNil(nil), 0); err != nil || !isnil {
+		t.Errorf("nil array: isnil %v, %v", isnil, err)
+	}
+	if _, isnil, _, err := ReadMapHeaderBytesMax(AppendNil(nil), 0); err != nil || !isnil {
+		t.Errorf("nil map: isnil %v, %v", isnil, err)
+	}
+}
+
+func TestReadUTF8StringBytes(t *testing.T) {
+	for _, v := range []string{"", "hello", "héllo, 世界", "\U0001F600"} {
+		b := AppendString(nil, v)
+		got, o, err := ReadUTF8StringBytes(b)
+		if err != nil || got != v || len(o) != 0 {
+			t.Errorf("%q: got %q, %d bytes left, %v", v, got, len(o), err)
+		}
+	}
+	for _, v := range []string{
+		"\xff",         // never valid
+		"h\xc3",        // truncated two-byte sequence
+		"\xc0\xaf",     // overlong encoding of '/'
+		"\xed\xa0\x80", // surrogate half
+	} {
+		b := AppendString(nil, v)
+		if _, o, err := ReadUTF8StringBytes(b); err != ErrInvalidUTF8 || len(o) != len(b) {
+			t.Errorf("%q: expected ErrInvalidUTF8 and all %d bytes; got %v and %d", v, len(b), err, len(o))
+		}
+		if got, _, err := ReadStringBytes(b); err != nil || got != v {
+			t.Errorf("%q: ReadStringBytes got %q, %v", v, got, err)
+		}
+	}
+	if _, _, err := ReadUTF8StringBytes(AppendInt64(nil, 1)); err == nil {
+		t.Error("no error for an int")
+	}
+}
+
+func TestRawRoundTrip(t *testing.T) {
+	// a nested map with a 'map 16' header, which isn't the
+	// shortest encoding, and the parent that embeds it as Raw
+	nested := append([]byte{0xde, 0x00, 0x02}, AppendString(nil, "x")...)
+	nested = AppendInt64(nested, -5)
+	nested = AppendMapHeader(AppendString(nested, "y"), 1)
+	nested = AppendBool(AppendString(nested, "z"), true)
+	parent := AppendMapHeader(nil, 2)
+	parent = AppendInt64(AppendString(parent, "k"), 1)
+	parent = AppendRaw(AppendString(parent, "raw"), nested)
+
+	sz, _, o, err := ReadMapHeaderBytes(parent)
+	if err != nil || sz != 2 {
+		t.Fatalf("header: %d, %v", sz, err)
+	}
+	var raw Raw
+	for i := 0; i < sz; i++ {
+		var key []byte
+		key, o, err = ReadMapKeyZC(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(key) == "raw" {
+			raw, o, err = ReadRawBytes(o, raw)
+		} else {
+			o, err = Skip(o)
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", key, err)
+		}
+	}
+	if len(o) != 0 || !bytes.Equal(raw, nested) || raw.Msgsize() != len(nested) {
+		t.Fatalf("read %x (%d left); want %x", raw, len(o), nested)
+	}
+	if &raw[0] == &parent[len(parent)-len(nested)] {
+		t.Error("Raw not copied")
+	}
+	again := AppendMapHeader(nil, 2)
+	again = AppendInt64(AppendString(again, "k"), 1)
+	again = AppendRaw(AppendString(again, "raw"), raw)
+	if !bytes.Equal(again, parent) {
+		t.Errorf("re-encoded %x; want %x", again, parent)
+	}
+
+	// scratch is reused, and 'nil' is an empty Raw
+	scratch := make(Raw, 0, 64)
+	if v, _, _ := ReadRawBytes(nested, scratch); &v[0] != &scratch[:1][0] {
+		t.Error("scratch not used")
+	}
+	if v, _, err := ReadRawBytes(AppendNil(nil), nil); err != nil || len(v) != 0 || !bytes.Equal(AppendRaw(nil, v), AppendNil(nil)) {
+		t.Errorf("nil: %x, %v", v, err)
+	}
+	if _, o, err := ReadRawBytes(nested[:len(nested)-1], nil); err != ErrShortBytes || len(o) != len(nested)-1 {
+		t.Errorf("short: %v", err)
+	}
+}
+
+func TestDrainBytes(t *testing.T) {
+	var msg []byte
+	msg = AppendMapHeader(msg, 3)
+	msg = AppendString(msg, "a")
+	msg = AppendInt64(msg, 1)
+	msg = AppendString(msg, "b")
+	msg = AppendNil(AppendArrayHeader(AppendMapHeader(msg, 1), 0)) // a map with an array key
+	msg = AppendString(msg, "c")
+	msg = AppendArrayHeader(msg, 2)
+	msg = AppendBytes(msg, []byte("x"))
+	msg = AppendNil(msg)
+	msg = AppendUint8(msg, 7) // the next message
+
+	// read the first field, and drain the rest
+	sz, _, o, err := ReadMapHeaderBytes(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, o, err = ReadStringBytes(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, o, err = ReadInt64Bytes(o); err != nil {
+		t.Fatal(err)
+	}
+	o, err = DrainMapBytes(o, sz-1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, left, err := ReadUint8Bytes(o); err != nil || v != 7 || len(left) != 0 {
+		t.Errorf("after draining: %d, %d bytes left, %v", v, len(left), err)
+	}
+
+	// the elements of an array
+	arr := AppendUint8(AppendString(AppendBool(AppendArrayHeader(nil, 2), true), "s"), 7)
+	_, _, o, _ = ReadArrayHeaderBytes(arr)
+	if o, err = DrainBytes(o, 2); err != nil || !bytes.Equal(o, AppendUint8(nil, 7)) {
+		t.Errorf("array: %x, %v", o, err)
+	}
+	if o, err = DrainBytes(arr, 0); err != nil || len(o) != len(arr) {
+		t.Errorf("nothing: %x, %v", o, err)
+	}
+	if _, err = DrainMapBytes(msg[1:len(msg)-3], 3); err != ErrShortBytes {
+		t.Errorf("short: %v", err)
+	}
+}
+
+func TestSkipLimit(t *testing.T) {
+	var msg []byte
+	msg = AppendMapHeader(msg, 2)
+	msg = AppendString(msg, "a")
+	msg = AppendArrayHeader(msg, 2)
+	msg = AppendInt64(msg, -1)
+	msg = AppendBytes(msg, make([]byte, 40))
+	msg = AppendString(msg, "b")
+	msg = AppendMapHeader(msg, 0)
+	msg = AppendBool(msg, true) // trailing
+
+	left, err := SkipLimit(msg, 2, int64(len(msg)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 {
+		t.Errorf("%d bytes left after SkipLimit; want 1", len(left))
+	}
+	if _, err := SkipLimit(msg, 1, int64(len(msg))); err != ErrRecursionLimit {
+		t.Errorf("depth 1: got %v; want ErrRecursionLimit", err)
+	}
+	if _, err := SkipLimit(msg, 2, int64(len(msg)-2)); err != ErrMaxBytesExceeded {
+		t.Errorf("short of the length: got %v; want ErrMaxBytesExceeded", err)
+	}
+	if _, err := SkipLimit(msg[:len(msg)-4], 2, int64(len(msg))); err != ErrShortBytes {
+		t.Errorf("truncated: got %v; want ErrShortBytes", err)
+	}
+
+	// a huge count isn't counted through
+	huge := AppendArrayHeader(nil, 1<<31)
+	if _, err := SkipLimit(append(huge, 0), 1, 1<<40); err != ErrShortBytes {
+		t.Errorf("huge array: got %v; want ErrShortBytes", err)
+	}
+}
+
+func TestSkipLimitDeep(t *testing.T) {
+	const depth = 100000
+	msg := make([]byte, depth+1)
+	for i := 0; i < depth; i++ {
+		msg[i] = 0x91 // fixarray of 1
+	}
+	msg[depth] = 0xc0
+
+	o, err := SkipLimit(msg, 64, int64(len(msg)))
+	if err != ErrRecursionLimit {
+		t.Fatalf("got %v; want ErrRecursionLimit", err)
+	}
+	// rejected at the header past the limit, without
+	// reading any further
+	if n := len(msg) - len(o); n != 65 {
+		t.Errorf("read %d headers; want 65", n)
+	}
+	if _, err := SkipLimit(msg, depth, int64(len(msg))); err != nil {
+		t.Errorf("at the depth limit: %v", err)
+	}
+}
+
+func TestAppendNext(t *testing.T) {
+	var msg []byte
+	msg = AppendMapHeader(msg, 2)
+	msg = AppendString(msg, "inner")
+	msg = AppendMapHeader(msg, 1)
+	msg = AppendString(msg, "list")
+	msg = AppendArrayHeader(msg, 3)
+	msg = AppendInt64(msg, -7)
+	msg = AppendBytes(msg, []byte("payload"))
+	msg = AppendNil(msg)
+	msg = AppendString(msg, "n")
+	msg = AppendFloat64(msg, 1.5)
+	stream := AppendBool(append([]byte{}, msg...), true)
+
+	prefix := []byte{0xc3}
+	out, rest, err := AppendNext(prefix, stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out[len(prefix):], msg) {
+		t.Errorf("relayed %x; want %x", out[len(prefix):], msg)
+	}
+	if !bytes.Equal(out[:len(prefix)], prefix) {
+		t.Errorf("prefix overwritten: %x", out[:len(prefix)])
+	}
+	if len(rest) != 1 {
+		t.Errorf("%d bytes left; want 1", len(rest))
+	}
+
+	if _, _, err := AppendNext(nil, msg[:len(msg)-3]); err != ErrShortBytes {
+		t.Errorf("truncated: got %v; want ErrShortBytes", err)
+	}
+}
@@ -0,0 +1,334 @@
+package msgp
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// UnmarshalReflect decodes the object at the start of 'b'
+// into the value that 'dst' points to, and returns the
+// remaining bytes. It is a slow fallback for types without
+// generated methods, which finds the fields of a struct by
+// reflection and decodes them as the UnmarshalMsg method
+// generated for the struct would:
+//
+//   - a field is keyed by the name in its codec tag, or by
+//     its own name; fields tagged codec:"-" and unexported
+//     fields are not decoded, and the fields of embedded
+//     structs are decoded as fields of the outer struct
+//   - a struct is also decoded from an array of its fields,
+//     in the order in which they are declared
+//   - a 'nil' map resets a struct to its zero value, and a
+//     'nil' object sets a slice, map or pointer to nil
+//   - an unknown key is an error (ErrNoField), not skipped
+//   - a value that implements Unmarshaler, through a
+//     pointer to it, is decoded by its UnmarshalMsg method
+//
+// As in generated code, omitempty only affects encoding:
+// a field that is missing from the map is left as it is.
+// The time= option of a tag is honored, but allocbound is
+// not; the sizes of slices and maps are only checked
+// against the length of 'b'.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (an object doesn't match its destination)
+// - ErrNoField (a key for a field the struct doesn't have)
+// - ErrTooManyArrayFields (a struct array is too long)
+// - ArrayError{} (an array is longer than its destination)
+// - IntOverflow{}, UintOverflow{} (a number doesn't fit)
+// - *ErrUnsupportedType (dst is not a non-nil pointer, or
+// a destination can't be decoded into)
+func UnmarshalReflect(b []byte, dst interface{}) ([]byte, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.IsNil() {
+		return b, &ErrUnsupportedType{T: reflect.TypeOf(dst)}
+	}
+	return unmarshalReflect(b, v.Elem(), "")
+}
+
+var (
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	timeType        = reflect.TypeOf(time.Time{})
+)
+
+// unmarshalReflect decodes b into v; timeForm is the time=
+// option of the field that v is, or is an element of
+func unmarshalReflect(b []byte, v reflect.Value, timeForm string) (o []byte, err error) {
+	if v.CanAddr() && v.Addr().Type().Implements(unmarshalerType) {
+		return v.Addr().Interface().(Unmarshaler).UnmarshalMsg(b)
+	}
+	if v.Type() == timeType {
+		var t time.Time
+		switch timeForm {
+		case "unixsec":
+			t, o, err = ReadUnixTimeBytes(b)
+		case "unixnano":
+			t, o, err = ReadUnixNanoTimeBytes(b)
+		case "rfc3339":
+			t, o, err = ReadRFC3339TimeBytes(b)
+		default:
+			t, o, err = ReadTimeBytes(b)
+		}
+		if err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return o, err
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		var x bool
+		x, o, err = ReadBoolBytes(b)
+		v.SetBool(x)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var x int64
+		x, o, err = ReadInt64Bytes(b)
+		if err == nil && v.OverflowInt(x) {
+			return b, IntOverflow{Value: x, FailedBitsize: v.Type().Bits()}
+		}
+		v.SetInt(x)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var x uint64
+		x, o, err = ReadUint64Bytes(b)
+		if err == nil && v.OverflowUint(x) {
+			return b, UintOverflow{Value: x, FailedBitsize: v.Type().Bits()}
+		}
+		v.SetUint(x)
+	case reflect.Float32:
+		var x float32
+		x, o, err = ReadFloat32Bytes(b)
+		v.SetFloat(float64(x))
+	case reflect.Float64:
+		var x float64
+		x, o, err = ReadFloat64Bytes(b)
+		v.SetFloat(x)
+	case reflect.String:
+		var x string
+		x, o, err = ReadStringBytes(b)
+		v.SetString(x)
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return b, &ErrUnsupportedType{T: v.Type()}
+		}
+		var x interface{}
+		x, o, err = ReadIntfBytes(b)
+		if err == nil {
+			if x == nil {
+				v.Set(reflect.Zero(v.Type()))
+			} else {
+				v.Set(reflect.ValueOf(x))
+			}
+		}
+	case reflect.Pointer:
+		if IsNil(b) {
+			o, err = ReadNilBytes(b)
+			v.Set(reflect.Zero(v.Type()))
+			return o, err
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshalReflect(b, v.Elem(), timeForm)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			var x []byte
+			x, o, err = ReadBytesBytes(b, v.Bytes())
+			if err == nil {
+				v.SetBytes(x)
+			}
+			return o, err
+		}
+		return unmarshalReflectSlice(b, v, timeForm)
+	case reflect.Array:
+		return unmarshalReflectArray(b, v, timeForm)
+	case reflect.Map:
+		return unmarshalReflectMap(b, v, timeForm)
+	case reflect.Struct:
+		return unmarshalReflectStruct(b, v)
+	default:
+		return b, &ErrUnsupportedType{T: v.Type()}
+	}
+	return o, err
+}
+
+func unmarshalReflectSlice(b []byte, v reflect.Value, timeForm string) (o []byte, err error) {
+	var sz int
+	var isnil bool
+	sz, isnil, o, err = ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	// every element takes at least a byte
+	if sz > len(o) {
+		return b, ErrShortBytes
+	}
+	switch {
+	case isnil:
+		v.Set(reflect.Zero(v.Type()))
+		return o, nil
+	case !v.IsNil() && v.Cap() >= sz:
+		v.SetLen(sz)
+	default:
+		v.Set(reflect.MakeSlice(v.Type(), sz, sz))
+	}
+	for i := 0; i < sz; i++ {
+		o, err = unmarshalReflect(o, v.Index(i), timeForm)
+		if err != nil {
+			return b, WrapError(err, i)
+		}
+	}
+	return o, nil
+}
+
+func unmarshalReflectArray(b []byte, v reflect.Value, timeForm string) (o []byte, err error) {
+	if v.Type().Elem().Kind() == reflect.Uint8 {
+		return ReadExactBytes(b, v.Slice(0, v.Len()).Bytes())
+	}
+	var sz int
+	sz, _, o, err = ReadArrayHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	if sz > v.Len() {
+		return b, ArrayError{Wanted: v.Len(), Got: sz}
+	}
+	for i := 0; i < sz; i++ {
+		o, err = unmarshalReflect(o, v.Index(i), timeForm)
+		if err != nil {
+			return b, WrapError(err, i)
+		}
+	}
+	return o, nil
+}
+
+func unmarshalReflectMap(b []byte, v reflect.Value, timeForm string) (o []byte, err error) {
+	var sz int
+	var isnil bool
+	sz, isnil, o, err = ReadMapHeaderBytes(b)
+	if err != nil {
+		return b, err
+	}
+	// every entry takes at least 2 bytes
+	if sz > len(o)/2 {
+		return b, ErrShortBytes
+	}
+	// as in generated code, a map that is already
+	// allocated is added to, rather than cleared
+	if isnil {
+		v.Set(reflect.Zero(v.Type()))
+		return o, nil
+	} else if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(v.Type(), sz))
+	}
+	for i := 0; i < sz; i++ {
+		key := reflect.New(v.Type().Key()).Elem()
+		o, err = unmarshalReflect(o, key, "")
+		if err != nil {
+			return b, err
+		}
+		val := reflect.New(v.Type().Elem()).Elem()
+		o, err = unmarshalReflect(o, val, timeForm)
+		if err != nil {
+			return b, WrapError(err, key.Interface())
+		}
+		v.SetMapIndex(key, val)
+	}
+	return o, nil
+}
+
+func unmarshalReflectStruct(b []byte, v reflect.Value) (o []byte, err error) {
+	fields := reflectFields(v.Type(), nil)
+	var sz int
+	var isnil bool
+	sz, isnil, o, err = ReadMapHeaderBytes(b)
+	if _, ok := err.(TypeError); ok {
+		// go-codec compat: the fields in the
+		// order in which they are declared
+		sz, _, o, err = ReadArrayHeaderBytes(b)
+		if err != nil {
+			return b, err
+		}
+		for _, f := range fields {
+			if sz == 0 {
+				break
+			}
+			sz--
+			o, err = unmarshalReflect(o, v.FieldByIndex(f.index), f.timeForm)
+			if err != nil {
+				return b, WrapError(err, f.name)
+			}
+		}
+		if sz > 0 {
+			return b, ErrTooManyArrayFields(sz)
+		}
+		return o, nil
+	}
+	if err != nil {
+		return b, err
+	}
+	if isnil {
+		v.Set(reflect.Zero(v.Type()))
+	}
+	for ; sz > 0; sz-- {
+		var field []byte
+		field, o, err = ReadMapKeyZC(o)
+		if err != nil {
+			return b, err
+		}
+		i := 0
+		for i < len(fields) && fields[i].key != string(field) {
+			i++
+		}
+		if i == len(fields) {
+			return b, ErrNoField(string(field))
+		}
+		o, err = unmarshalReflect(o, v.FieldByIndex(fields[i].index), fields[i].timeForm)
+		if err != nil {
+			return b, WrapError(err, fields[i].name)
+		}
+	}
+	return o, nil
+}
+
+// reflectField is a field of a struct, as the generator sees it
+type reflectField struct {
+	key      string // the key in a map
+	name     string // the Go name of the field
+	index    []int  // for reflect.Value.FieldByIndex
+	timeForm string // the time= tag option
+}
+
+// reflectFields returns the fields of t that are encoded, in
+// the order in which they are declared, with the fields of
+// embedded structs in place of the struct
+func reflectFields(t reflect.Type, index []int) []reflectField {
+	var fields []reflectField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tags := strings.Split(sf.Tag.Get("codec"), ",")
+		tag := tags[0]
+		if tag == "-" {
+			continue
+		}
+		idx := append(append([]int(nil), index...), i)
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			fields = append(fields, reflectFields(sf.Type, idx)...)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if tag == "" {
+			tag = sf.Name
+		}
+		f := reflectField{key: tag, name: sf.Name, index: idx}
+		for _, opt := range tags[1:] {
+			if form, ok := strings.CutPrefix(opt, "time="); ok {
+				f.timeForm = form
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
@@ -0,0 +1,151 @@
+package msgp
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type reflectInner struct {
+	K string `codec:"k"`
+}
+
+type reflectEmbedded struct {
+	E int32 `codec:"e"`
+}
+
+type reflectOuter struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	reflectEmbedded
+	N       int64                    `codec:"n"`
+	U       uint8                    `codec:"u,omitempty"`
+	S       string                   `codec:"s"`
+	B       []byte                   `codec:"b,allocbound=16"`
+	H       [4]byte                  `codec:"h"`
+	F       float32                  `codec:"f"`
+	T       time.Time                `codec:"t"`
+	L       []reflectInner           `codec:"l,allocbound=4"`
+	M       map[string]int           `codec:"m,allocbound=4"`
+	P       *reflectInner            `codec:"p"`
+	C       *circle                  `codec:"c"`
+	I       interface{}              `codec:"i"`
+	Skipped func()                   `codec:"-"`
+	Named   int                      // keyed by its name
+	Arr     [2]reflectInner          `codec:"arr"`
+	Nested  map[string]*reflectInner `codec:"nested,allocbound=4"`
+	hidden  int
+}
+
+func appendReflectInner(b []byte, k string) []byte {
+	b = AppendMapHeader(b, 1)
+	b = AppendString(b, "k")
+	return AppendString(b, k)
+}
+
+func TestUnmarshalReflect(t *testing.T) {
+	now := time.Unix(1700000000, 5)
+	b := AppendMapHeader(nil, 16)
+	b = AppendInt32(AppendString(b, "e"), -7)
+	b = AppendInt64(AppendString(b, "n"), 1<<40)
+	b = AppendUint8(AppendString(b, "u"), 200)
+	b = AppendString(AppendString(b, "s"), "str")
+	b = AppendBytes(AppendString(b, "b"), []byte{1, 2, 3})
+	b = AppendBytes(AppendString(b, "h"), []byte{9, 8, 7, 6})
+	b = AppendFloat32(AppendString(b, "f"), 1.5)
+	b = AppendTime(AppendString(b, "t"), now)
+	b = appendReflectInner(AppendArrayHeader(AppendString(b, "l"), 2), "a")
+	b = appendReflectInner(b, "b")
+	b = AppendInt64(AppendString(AppendMapHeader(AppendString(b, "m"), 1), "one"), 1)
+	b = appendReflectInner(AppendString(b, "p"), "ptr")
+	b = (&circle{r: 2}).MarshalMsg(AppendString(b, "c"))
+	b = AppendString(AppendString(b, "i"), "any")
+	b = AppendInt64(AppendString(b, "Named"), 3)
+	b = appendReflectInner(AppendArrayHeader(AppendString(b, "arr"), 1), "first")
+	b = AppendNil(AppendString(AppendMapHeader(AppendString(b, "nested"), 1), "gone"))
+	b = append(b, 0xc3)
+
+	var got reflectOuter
+	got.hidden = 4
+	o, err := UnmarshalReflect(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(o) != 1 {
+		t.Errorf("%d bytes left; want 1", len(o))
+	}
+	want := reflectOuter{
+		reflectEmbedded: reflectEmbedded{E: -7},
+		N:               1 << 40,
+		U:               200,
+		S:               "str",
+		B:               []byte{1, 2, 3},
+		H:               [4]byte{9, 8, 7, 6},
+		F:               1.5,
+		T:               now,
+		L:               []reflectInner{{"a"}, {"b"}},
+		M:               map[string]int{"one": 1},
+		P:               &reflectInner{"ptr"},
+		C:               &circle{r: 2},
+		I:               "any",
+		Named:           3,
+		Arr:             [2]reflectInner{{"first"}, {}},
+		Nested:          map[string]*reflectInner{"gone": nil},
+		hidden:          4,
+	}
+	if !got.T.Equal(want.T) {
+		t.Errorf("time %v; want %v", got.T, want.T)
+	}
+	got.T = want.T
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	// a 'nil' map resets the whole struct, as (*z) = T{} does
+	if _, err := UnmarshalReflect(AppendNil(nil), &got); err != nil || !reflect.DeepEqual(got, reflectOuter{}) {
+		t.Errorf("after nil: %+v, %v", got, err)
+	}
+}
+
+func TestUnmarshalReflectArray(t *testing.T) {
+	// the fields in declaration order, through the embedded struct
+	b := AppendArrayHeader(nil, 3)
+	b = AppendInt32(b, 5)
+	b = AppendInt64(b, 6)
+	b = AppendUint8(b, 7)
+	var got reflectOuter
+	if _, err := UnmarshalReflect(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.E != 5 || got.N != 6 || got.U != 7 {
+		t.Errorf("got %+v", got)
+	}
+
+	var in reflectInner
+	b = AppendString(AppendString(AppendArrayHeader(nil, 2), "k"), "extra")
+	if _, err := UnmarshalReflect(b, &in); err == nil {
+		t.Error("no error for too many array fields")
+	}
+}
+
+func TestUnmarshalReflectErrors(t *testing.T) {
+	var in reflectInner
+	unknown := AppendInt64(AppendString(AppendMapHeader(nil, 1), "z"), 1)
+	if _, err := UnmarshalReflect(unknown, &in); err != ErrNoField("z") {
+		t.Errorf("unknown key: %v", err)
+	}
+	var small struct{ U uint8 }
+	big := AppendInt64(AppendString(AppendMapHeader(nil, 1), "U"), 300)
+	if _, err := UnmarshalReflect(big, &small); err == nil {
+		t.Error("300 decoded into a uint8")
+	}
+	if _, err := UnmarshalReflect(AppendArrayHeader(nil, 100), &[]int{}); err != ErrShortBytes {
+		t.Errorf("array longer than its input: %v", err)
+	}
+	if _, err := UnmarshalReflect(AppendInt64(nil, 1), in); err == nil {
+		t.Error("decoded into a non-pointer")
+	}
+	var ch chan int
+	if _, err := UnmarshalReflect(AppendInt64(nil, 1), &ch); err == nil {
+		t.Error("decoded into a channel")
+	}
+}
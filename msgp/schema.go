@@ -0,0 +1,72 @@
+package msgp
+
+import "encoding/json"
+
+// A Schema describes the MessagePack encoding of a
+// type, as returned by the {Type}MsgpSchema functions
+// that are generated for the gen.Schema method. Since
+// the schema describes the wire format, comparing the
+// schemas of two versions of a type shows whether
+// messages encoded by one can be decoded by the other.
+type Schema struct {
+	// Type is the wire type of the value, as named by
+	// Type.String, or "any" for an interface{}. It is
+	// empty for a reference to another type.
+	Type string `json:"type,omitempty"`
+
+	// Ref names the type that encodes the value with
+	// its own methods, and has a schema of its own.
+	Ref string `json:"ref,omitempty"`
+
+	// Nullable is set if the value may be encoded
+	// as 'nil', as with pointers.
+	Nullable bool `json:"nullable,omitempty"`
+
+	// AllocBound is the allocbound of a 'str', 'bin',
+	// 'array' or 'map', as written in its codec tag.
+	AllocBound string `json:"allocbound,omitempty"`
+
+	// Size is the length of a fixed-size array.
+	Size string `json:"size,omitempty"`
+
+	// Enum are the names of the values of a type named
+	// by the msgp:enum directive, which are encoded as
+	// a 'str' of the name; other values are encoded as
+	// integers of Type.
+	Enum []string `json:"enum,omitempty"`
+
+	// Fields are the fields of a struct, in the order
+	// in which they are encoded.
+	Fields []SchemaField `json:"fields,omitempty"`
+
+	// Key and Elem are the keys of a 'map', and the
+	// values of a 'map' or elements of an 'array'.
+	Key  *Schema `json:"key,omitempty"`
+	Elem *Schema `json:"elem,omitempty"`
+}
+
+// A SchemaField describes a field of a struct.
+type SchemaField struct {
+	// Name is the key of the field in a 'map',
+	// or its Go name in a tuple.
+	Name string `json:"name"`
+
+	// OmitEmpty is set if the field is left out
+	// of the 'map' when it is empty.
+	OmitEmpty bool `json:"omitempty,omitempty"`
+
+	Schema
+}
+
+// JSON returns the schema as indented JSON, which
+// is stable for a given schema, and so can be
+// compared across versions.
+func (s Schema) JSON() []byte {
+	out, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		// a Schema holds only strings, bools and
+		// other schemas, which always marshal
+		panic(err)
+	}
+	return out
+}
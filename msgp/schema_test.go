@@ -0,0 +1,28 @@
+package msgp
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaJSON(t *testing.T) {
+	s := Schema{
+		Type: "map",
+		Fields: []SchemaField{
+			{Name: "a", OmitEmpty: true, Schema: Schema{Type: "str", AllocBound: "32"}},
+			{Name: "b", Schema: Schema{Type: "array", Size: "4", Elem: &Schema{Nullable: true, Ref: "T"}}},
+		},
+	}
+	out := s.JSON()
+	if !reflect.DeepEqual(out, s.JSON()) {
+		t.Error("JSON is not stable")
+	}
+	var back Schema
+	if err := json.Unmarshal(out, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, s) {
+		t.Errorf("schema changed on the way through JSON:\n%s", out)
+	}
+}
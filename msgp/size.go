@@ -36,4 +36,43 @@ const (
 	BytesPrefixSize     = 5
 	StringPrefixSize    = 5
 	ExtensionPrefixSize = 6
+
+	// netip.Addr and netip.AddrPort
+	// are additionally followed by
+	// the zone string.
+	AddrPrefixSize     = ExtensionPrefixSize + 17
+	AddrPortPrefixSize = AddrPrefixSize + 2
+
+	// big.Int is additionally followed
+	// by its magnitude bytes.
+	BigIntPrefixSize = ExtensionPrefixSize + 1
+
+	// types encoded by their text form
+	// (see AppendText) are 'str' objects.
+	TextPrefixSize = StringPrefixSize
+
+	// the database/sql Null* types, which
+	// may instead be encoded as 'nil'
+	// (see AppendNullString).
+	NullStringPrefixSize = StringPrefixSize
+	NullInt64Size        = Int64Size
+	NullInt32Size        = Int32Size
+	NullInt16Size        = Int16Size
+	NullByteSize         = ByteSize
+	NullFloat64Size      = Float64Size
+	NullBoolSize         = BoolSize
+	NullTimeSize         = TimeSize
+
+	// alternative encodings of time.Time
+	// (see AppendUnixTime); the longest
+	// RFC 3339 form has a 12-digit year.
+	UnixTimeSize     = Int64Size
+	UnixNanoTimeSize = Int64Size
+	RFC3339TimeSize  = StringPrefixSize + len("-292277026596-12-04T15:30:07.999999999Z")
+	TimestampSize    = TimeSize // the 96-bit form
+
+	// complex numbers encoded as arrays
+	// (see AppendComplex64Array)
+	Complex64ArraySize  = 1 + 2*Float32Size
+	Complex128ArraySize = 1 + 2*Float64Size
 )
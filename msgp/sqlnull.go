@@ -0,0 +1,207 @@
+package msgp
+
+import "database/sql"
+
+// The database/sql Null* types are encoded as 'nil'
+// if they are not Valid, and otherwise as the value
+// they hold. Decoding 'nil' sets Valid to false and
+// zeroes the value; decoding anything else sets it.
+
+// AppendNullString appends 's' to the slice as a
+// 'str', or as 'nil' if it is not valid.
+func AppendNullString(b []byte, s sql.NullString) []byte {
+	if !s.Valid {
+		return AppendNil(b)
+	}
+	return AppendString(b, s.String)
+}
+
+// ReadNullStringBytes reads a 'str' or 'nil' object
+// from 'b' and returns it as a sql.NullString, along
+// with the remaining bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not a 'str' or 'nil')
+func ReadNullStringBytes(b []byte) (sql.NullString, []byte, error) {
+	return ReadNullStringBytesMax(b, -1)
+}
+
+// ReadNullStringBytesMax is like ReadNullStringBytes,
+// but returns ErrOverflow, before allocating, if the
+// string is longer than maxBytes bytes. A negative
+// maxBytes means no limit.
+func ReadNullStringBytesMax(b []byte, maxBytes int) (sql.NullString, []byte, error) {
+	if IsNil(b) {
+		return sql.NullString{}, b[1:], nil
+	}
+	v, o, err := ReadStringZC(b)
+	if err != nil {
+		return sql.NullString{}, b, err
+	}
+	if maxBytes >= 0 && len(v) > maxBytes {
+		return sql.NullString{}, b, ErrOverflow(uint64(len(v)), uint64(maxBytes))
+	}
+	return sql.NullString{String: string(v), Valid: true}, o, nil
+}
+
+// AppendNullInt64 appends 'i' to the slice as an
+// int64, or as 'nil' if it is not valid.
+func AppendNullInt64(b []byte, i sql.NullInt64) []byte {
+	if !i.Valid {
+		return AppendNil(b)
+	}
+	return AppendInt64(b, i.Int64)
+}
+
+// ReadNullInt64Bytes reads an int64 or 'nil' object
+// from 'b' and returns it as a sql.NullInt64, along
+// with the remaining bytes.
+func ReadNullInt64Bytes(b []byte) (sql.NullInt64, []byte, error) {
+	if IsNil(b) {
+		return sql.NullInt64{}, b[1:], nil
+	}
+	v, o, err := ReadInt64Bytes(b)
+	if err != nil {
+		return sql.NullInt64{}, b, err
+	}
+	return sql.NullInt64{Int64: v, Valid: true}, o, nil
+}
+
+// AppendNullInt32 appends 'i' to the slice as an
+// int32, or as 'nil' if it is not valid.
+func AppendNullInt32(b []byte, i sql.NullInt32) []byte {
+	if !i.Valid {
+		return AppendNil(b)
+	}
+	return AppendInt32(b, i.Int32)
+}
+
+// ReadNullInt32Bytes reads an int32 or 'nil' object
+// from 'b' and returns it as a sql.NullInt32, along
+// with the remaining bytes.
+func ReadNullInt32Bytes(b []byte) (sql.NullInt32, []byte, error) {
+	if IsNil(b) {
+		return sql.NullInt32{}, b[1:], nil
+	}
+	v, o, err := ReadInt32Bytes(b)
+	if err != nil {
+		return sql.NullInt32{}, b, err
+	}
+	return sql.NullInt32{Int32: v, Valid: true}, o, nil
+}
+
+// AppendNullInt16 appends 'i' to the slice as an
+// int16, or as 'nil' if it is not valid.
+func AppendNullInt16(b []byte, i sql.NullInt16) []byte {
+	if !i.Valid {
+		return AppendNil(b)
+	}
+	return AppendInt16(b, i.Int16)
+}
+
+// ReadNullInt16Bytes reads an int16 or 'nil' object
+// from 'b' and returns it as a sql.NullInt16, along
+// with the remaining bytes.
+func ReadNullInt16Bytes(b []byte) (sql.NullInt16, []byte, error) {
+	if IsNil(b) {
+		return sql.NullInt16{}, b[1:], nil
+	}
+	v, o, err := ReadInt16Bytes(b)
+	if err != nil {
+		return sql.NullInt16{}, b, err
+	}
+	return sql.NullInt16{Int16: v, Valid: true}, o, nil
+}
+
+// AppendNullByte appends 'c' to the slice as a
+// byte, or as 'nil' if it is not valid.
+func AppendNullByte(b []byte, c sql.NullByte) []byte {
+	if !c.Valid {
+		return AppendNil(b)
+	}
+	return AppendByte(b, c.Byte)
+}
+
+// ReadNullByteBytes reads a byte or 'nil' object
+// from 'b' and returns it as a sql.NullByte, along
+// with the remaining bytes.
+func ReadNullByteBytes(b []byte) (sql.NullByte, []byte, error) {
+	if IsNil(b) {
+		return sql.NullByte{}, b[1:], nil
+	}
+	v, o, err := ReadByteBytes(b)
+	if err != nil {
+		return sql.NullByte{}, b, err
+	}
+	return sql.NullByte{Byte: v, Valid: true}, o, nil
+}
+
+// AppendNullFloat64 appends 'f' to the slice as a
+// float64, or as 'nil' if it is not valid.
+func AppendNullFloat64(b []byte, f sql.NullFloat64) []byte {
+	if !f.Valid {
+		return AppendNil(b)
+	}
+	return AppendFloat64(b, f.Float64)
+}
+
+// ReadNullFloat64Bytes reads a float64 or 'nil' object
+// from 'b' and returns it as a sql.NullFloat64, along
+// with the remaining bytes.
+func ReadNullFloat64Bytes(b []byte) (sql.NullFloat64, []byte, error) {
+	if IsNil(b) {
+		return sql.NullFloat64{}, b[1:], nil
+	}
+	v, o, err := ReadFloat64Bytes(b)
+	if err != nil {
+		return sql.NullFloat64{}, b, err
+	}
+	return sql.NullFloat64{Float64: v, Valid: true}, o, nil
+}
+
+// AppendNullBool appends 't' to the slice as a
+// bool, or as 'nil' if it is not valid.
+func AppendNullBool(b []byte, t sql.NullBool) []byte {
+	if !t.Valid {
+		return AppendNil(b)
+	}
+	return AppendBool(b, t.Bool)
+}
+
+// ReadNullBoolBytes reads a bool or 'nil' object
+// from 'b' and returns it as a sql.NullBool, along
+// with the remaining bytes.
+func ReadNullBoolBytes(b []byte) (sql.NullBool, []byte, error) {
+	if IsNil(b) {
+		return sql.NullBool{}, b[1:], nil
+	}
+	v, o, err := ReadBoolBytes(b)
+	if err != nil {
+		return sql.NullBool{}, b, err
+	}
+	return sql.NullBool{Bool: v, Valid: true}, o, nil
+}
+
+// AppendNullTime appends 't' to the slice as a
+// time.Time extension (see AppendTime), or as
+// 'nil' if it is not valid.
+func AppendNullTime(b []byte, t sql.NullTime) []byte {
+	if !t.Valid {
+		return AppendNil(b)
+	}
+	return AppendTime(b, t.Time)
+}
+
+// ReadNullTimeBytes reads a time.Time extension or
+// 'nil' object from 'b' and returns it as a
+// sql.NullTime, along with the remaining bytes.
+func ReadNullTimeBytes(b []byte) (sql.NullTime, []byte, error) {
+	if IsNil(b) {
+		return sql.NullTime{}, b[1:], nil
+	}
+	v, o, err := ReadTimeBytes(b)
+	if err != nil {
+		return sql.NullTime{}, b, err
+	}
+	return sql.NullTime{Time: v, Valid: true}, o, nil
+}
@@ -0,0 +1,111 @@
+package msgp
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAppendReadNull(t *testing.T) {
+	now := time.Unix(1700000000, 5)
+	for _, c := range []struct {
+		valid, invalid interface{}
+		size           int
+		appendf        func(b []byte, v interface{}) []byte
+		read           func(b []byte) (interface{}, []byte, error)
+	}{
+		{
+			sql.NullString{String: "abc", Valid: true}, sql.NullString{String: "abc"}, NullStringPrefixSize + 3,
+			func(b []byte, v interface{}) []byte { return AppendNullString(b, v.(sql.NullString)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullStringBytes(b) },
+		},
+		{
+			sql.NullInt64{Int64: -1 << 40, Valid: true}, sql.NullInt64{Int64: 1}, NullInt64Size,
+			func(b []byte, v interface{}) []byte { return AppendNullInt64(b, v.(sql.NullInt64)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullInt64Bytes(b) },
+		},
+		{
+			sql.NullInt32{Int32: 7, Valid: true}, sql.NullInt32{Int32: 1}, NullInt32Size,
+			func(b []byte, v interface{}) []byte { return AppendNullInt32(b, v.(sql.NullInt32)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullInt32Bytes(b) },
+		},
+		{
+			sql.NullInt16{Int16: -300, Valid: true}, sql.NullInt16{Int16: 1}, NullInt16Size,
+			func(b []byte, v interface{}) []byte { return AppendNullInt16(b, v.(sql.NullInt16)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullInt16Bytes(b) },
+		},
+		{
+			sql.NullByte{Byte: 200, Valid: true}, sql.NullByte{Byte: 1}, NullByteSize,
+			func(b []byte, v interface{}) []byte { return AppendNullByte(b, v.(sql.NullByte)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullByteBytes(b) },
+		},
+		{
+			sql.NullFloat64{Float64: 0.5, Valid: true}, sql.NullFloat64{Float64: 1}, NullFloat64Size,
+			func(b []byte, v interface{}) []byte { return AppendNullFloat64(b, v.(sql.NullFloat64)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullFloat64Bytes(b) },
+		},
+		{
+			// the zero value of a valid Null* is not 'nil'
+			sql.NullBool{Valid: true}, sql.NullBool{Bool: true}, NullBoolSize,
+			func(b []byte, v interface{}) []byte { return AppendNullBool(b, v.(sql.NullBool)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullBoolBytes(b) },
+		},
+		{
+			sql.NullTime{Time: now, Valid: true}, sql.NullTime{Time: now}, NullTimeSize,
+			func(b []byte, v interface{}) []byte { return AppendNullTime(b, v.(sql.NullTime)) },
+			func(b []byte) (interface{}, []byte, error) { return ReadNullTimeBytes(b) },
+		},
+	} {
+		bts := c.appendf(nil, c.valid)
+		if len(bts) > c.size {
+			t.Errorf("%T: %d bytes encoded; more than %d", c.valid, len(bts), c.size)
+		}
+		if IsNil(bts) {
+			t.Errorf("%T: valid value encoded as nil", c.valid)
+		}
+		out, left, err := c.read(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%T: %d bytes left over", c.valid, len(left))
+		}
+		if out != c.valid {
+			t.Errorf("decoded %#v as %#v", c.valid, out)
+		}
+
+		bts = c.appendf(nil, c.invalid)
+		if !IsNil(bts) || len(bts) != NilSize {
+			t.Errorf("%T: invalid value encoded as %x", c.invalid, bts)
+		}
+		out, left, err = c.read(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%T: %d bytes left over", c.invalid, len(left))
+		}
+		// the value is zeroed along with Valid
+		if out != reflect.Zero(reflect.TypeOf(out)).Interface() {
+			t.Errorf("decoded nil as %#v", out)
+		}
+
+		if _, _, err := c.read(AppendMapHeader(nil, 0)); err == nil {
+			t.Errorf("%T: decoded a map", c.valid)
+		}
+	}
+}
+
+func TestReadNullStringBytesMax(t *testing.T) {
+	bts := AppendNullString(nil, sql.NullString{String: "abcd", Valid: true})
+	if _, _, err := ReadNullStringBytesMax(bts, 4); err != nil {
+		t.Error(err)
+	}
+	if _, _, err := ReadNullStringBytesMax(bts, 3); err == nil {
+		t.Error("no error for a string longer than maxBytes")
+	}
+	if _, _, err := ReadNullStringBytesMax(AppendNil(nil), 0); err != nil {
+		t.Errorf("nil: %v", err)
+	}
+}
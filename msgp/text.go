@@ -0,0 +1,52 @@
+package msgp
+
+import "encoding"
+
+// TextSize returns the number of bytes occupied
+// by the encoding of 't' as a 'str' object.
+func TextSize(t encoding.TextMarshaler) int {
+	txt, _ := t.MarshalText()
+	return TextPrefixSize + len(txt)
+}
+
+// AppendText appends the text form of 't'
+// to the slice as a MessagePack 'str'.
+// Since generated MarshalMsg methods can't
+// return errors, AppendText panics if
+// t.MarshalText fails.
+func AppendText(b []byte, t encoding.TextMarshaler) []byte {
+	txt, err := t.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	return AppendStringFromBytes(b, txt)
+}
+
+// ReadTextBytes reads a 'str' object from 'b',
+// passes it to t.UnmarshalText and returns the
+// remaining bytes.
+// Possible errors:
+// - ErrShortBytes (not enough bytes in 'b')
+// - TypeError{} (object not a 'str')
+// - An error returned from t.UnmarshalText
+func ReadTextBytes(b []byte, t encoding.TextUnmarshaler) (o []byte, err error) {
+	return ReadTextBytesMax(b, t, -1)
+}
+
+// ReadTextBytesMax is like ReadTextBytes, but returns
+// ErrOverflow, before calling t.UnmarshalText, if the
+// text is longer than maxBytes bytes. A negative
+// maxBytes means no limit.
+func ReadTextBytesMax(b []byte, t encoding.TextUnmarshaler, maxBytes int) (o []byte, err error) {
+	txt, o, err := ReadStringZC(b)
+	if err != nil {
+		return b, err
+	}
+	if maxBytes >= 0 && len(txt) > maxBytes {
+		return b, ErrOverflow(uint64(len(txt)), uint64(maxBytes))
+	}
+	if err = t.UnmarshalText(txt); err != nil {
+		return b, err
+	}
+	return o, nil
+}
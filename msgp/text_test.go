@@ -0,0 +1,68 @@
+package msgp
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// uuidLike is encoded by its hex text form
+type uuidLike [16]byte
+
+func (u uuidLike) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(u[:])), nil
+}
+
+func (u *uuidLike) UnmarshalText(b []byte) error {
+	if len(b) != 2*len(u) {
+		return errors.New("malformed uuid")
+	}
+	_, err := hex.Decode(u[:], b)
+	return err
+}
+
+func TestAppendReadText(t *testing.T) {
+	u := uuidLike{0xde, 0xad, 0xbe, 0xef}
+	bts := AppendText(nil, u)
+	if len(bts) > TextSize(u) {
+		t.Errorf("%d bytes encoded; more than TextSize", len(bts))
+	}
+	s, _, err := ReadStringBytes(bts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s != "deadbeef000000000000000000000000" {
+		t.Errorf("encoded as %q", s)
+	}
+
+	var out uuidLike
+	left, err := ReadTextBytes(bts, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) > 0 {
+		t.Errorf("%d bytes left over after ReadTextBytes()", len(left))
+	}
+	if out != u {
+		t.Errorf("wanted %x; got %x", u, out)
+	}
+
+	if _, err := ReadTextBytes(AppendString(nil, "nope"), &out); err == nil {
+		t.Error("no error for malformed text")
+	}
+	if _, err := ReadTextBytes(AppendInt64(nil, 1), &out); err == nil {
+		t.Error("no error for a non-str object")
+	}
+}
+
+func TestReadTextBytesMax(t *testing.T) {
+	bts := AppendText(nil, uuidLike{})
+	var out uuidLike
+	if _, err := ReadTextBytesMax(bts, &out, 32); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadTextBytesMax(bts, &out, 31)
+	if _, ok := err.(errOverflow); !ok {
+		t.Errorf("expected an overflow error; got %v", err)
+	}
+}
@@ -0,0 +1,204 @@
+package msgp
+
+import "time"
+
+// The functions in this file encode a time.Time
+// in the alternative forms selected by the time=
+// codec tag option, rather than as the extension
+// written by AppendTime:
+//
+//   - "unixsec": an int of the seconds since the
+//     Unix epoch, dropping any fraction of a second
+//   - "unixnano": an int of the nanoseconds since
+//     the Unix epoch
+//   - "rfc3339": a 'str' in time.RFC3339Nano format,
+//     in UTC
+//   - "timestamp": the timestamp extension of the
+//     MessagePack spec, numbered -1, for peers that
+//     use it, which ReadTimeBytes also reads
+//
+// Like ReadTimeBytes, the readers return times in
+// the local time zone, and read 'nil' as the zero
+// time.
+
+// AppendUnixTime appends a time.Time to the slice
+// as an int of its seconds since the Unix epoch.
+func AppendUnixTime(b []byte, t time.Time) []byte {
+	return AppendInt64(b, t.Unix())
+}
+
+// ReadUnixTimeBytes reads a time.Time encoded by
+// AppendUnixTime from 'b' and returns the value
+// and the remaining bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an int)
+func ReadUnixTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	if IsNil(b) {
+		return time.Time{}, b[1:], nil
+	}
+	sec, o, err := ReadInt64Bytes(b)
+	if err != nil {
+		return
+	}
+	return time.Unix(sec, 0).Local(), o, nil
+}
+
+// AppendUnixNanoTime appends a time.Time to the slice
+// as an int of its nanoseconds since the Unix epoch.
+// The zero time, whose UnixNano is out of range, is
+// appended as 'nil'. Other times outside of the range
+// of UnixNano (years 1678 to 2262) are not preserved.
+func AppendUnixNanoTime(b []byte, t time.Time) []byte {
+	if t.IsZero() {
+		return AppendNil(b)
+	}
+	return AppendInt64(b, t.UnixNano())
+}
+
+// ReadUnixNanoTimeBytes reads a time.Time encoded by
+// AppendUnixNanoTime from 'b' and returns the value
+// and the remaining bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not an int)
+func ReadUnixNanoTimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	if IsNil(b) {
+		return time.Time{}, b[1:], nil
+	}
+	nsec, o, err := ReadInt64Bytes(b)
+	if err != nil {
+		return
+	}
+	return time.Unix(0, nsec).Local(), o, nil
+}
+
+// AppendRFC3339Time appends a time.Time to the slice
+// as a 'str' in time.RFC3339Nano format, in UTC.
+func AppendRFC3339Time(b []byte, t time.Time) []byte {
+	var buf [RFC3339TimeSize - StringPrefixSize]byte
+	return AppendStringFromBytes(b, t.UTC().AppendFormat(buf[:0], time.RFC3339Nano))
+}
+
+// ReadRFC3339TimeBytes reads a time.Time encoded by
+// AppendRFC3339Time from 'b' and returns the value
+// and the remaining bytes. Any offset from UTC is
+// accepted.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not a 'str')
+// - *time.ParseError (not in RFC 3339 format)
+func ReadRFC3339TimeBytes(b []byte) (t time.Time, o []byte, err error) {
+	if IsNil(b) {
+		return time.Time{}, b[1:], nil
+	}
+	s, o, err := ReadStringZC(b)
+	if err != nil {
+		return
+	}
+	t, err = time.Parse(time.RFC3339Nano, string(s))
+	if err != nil {
+		return time.Time{}, b, err
+	}
+	return t.Local(), o, nil
+}
+
+// TimestampExtension is the extension number of the
+// timestamps of the MessagePack spec
+const TimestampExtension = -1
+
+// timestampExt is the byte of TimestampExtension
+const timestampExt = 0xff
+
+// AppendTimestamp appends a time.Time to the slice as a
+// MessagePack timestamp extension, in the smallest of its
+// forms that holds it: 32 bits of seconds since the Unix
+// epoch, for times from 1970 to 2106 in whole seconds; 30
+// bits of nanoseconds and 34 of seconds, for times from
+// 1970 to 2514; and otherwise 32 bits of nanoseconds and
+// 64 of seconds.
+func AppendTimestamp(b []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	if data := uint64(nsec)<<34 | uint64(sec); sec>>34 == 0 && data>>32 == 0 {
+		o, n := ensure(b, 6)
+		o[n], o[n+1] = mfixext4, timestampExt
+		big.PutUint32(o[n+2:], uint32(data))
+		return o
+	} else if sec>>34 == 0 {
+		o, n := ensure(b, 10)
+		o[n], o[n+1] = mfixext8, timestampExt
+		big.PutUint64(o[n+2:], data)
+		return o
+	}
+	o, n := ensure(b, TimestampSize)
+	o[n], o[n+1], o[n+2] = mext8, 12, timestampExt
+	big.PutUint32(o[n+3:], nsec)
+	big.PutUint64(o[n+7:], uint64(sec))
+	return o
+}
+
+// ReadTimestampBytes reads a time.Time encoded by
+// AppendTimestamp, in any of the forms of the spec,
+// from 'b' and returns the value and the remaining
+// bytes.
+// Possible errors:
+// - ErrShortBytes (too few bytes)
+// - TypeError{} (not a timestamp of one of the three sizes)
+// - ExtensionTypeError{} (an extension of one of the sizes, but not a timestamp)
+// - ErrInvalidTimestamp (over 999999999 nanoseconds)
+func ReadTimestampBytes(b []byte) (t time.Time, o []byte, err error) {
+	if IsNil(b) {
+		return time.Time{}, b[1:], nil
+	}
+	var sec int64
+	var nsec uint32
+	var n int
+	switch {
+	case len(b) >= 2 && b[0] == mfixext4:
+		n = 6
+	case len(b) >= 2 && b[0] == mfixext8:
+		n = 10
+	case len(b) >= 3 && b[0] == mext8 && b[1] == 12:
+		n = TimestampSize
+	case len(b) < 3:
+		return time.Time{}, b, ErrShortBytes
+	default:
+		return time.Time{}, b, badPrefix(TimeType, b[0])
+	}
+	if len(b) < n {
+		return time.Time{}, b, ErrShortBytes
+	}
+	typ := int8(b[1])
+	if n == TimestampSize {
+		typ = int8(b[2])
+	}
+	if typ != TimestampExtension {
+		return time.Time{}, b, errExt(typ, TimestampExtension)
+	}
+	switch n {
+	case 6:
+		sec = int64(big.Uint32(b[2:]))
+	case 10:
+		data := big.Uint64(b[2:])
+		sec, nsec = int64(data&(1<<34-1)), uint32(data>>34)
+	default:
+		nsec, sec = big.Uint32(b[3:]), int64(big.Uint64(b[7:]))
+	}
+	if nsec > 999999999 {
+		return time.Time{}, b, ErrInvalidTimestamp
+	}
+	return time.Unix(sec, int64(nsec)).Local(), b[n:], nil
+}
+
+// isTimestamp returns whether the object in 'b' is a
+// timestamp extension, of any of the sizes of the spec
+func isTimestamp(b []byte) bool {
+	switch {
+	case len(b) < 3:
+		return false
+	case b[0] == mfixext4, b[0] == mfixext8:
+		return b[1] == timestampExt
+	default:
+		return b[0] == mext8 && b[1] == 12 && b[2] == timestampExt
+	}
+}
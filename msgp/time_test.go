@@ -0,0 +1,150 @@
+package msgp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAppendReadTimeForms(t *testing.T) {
+	forms := []struct {
+		name   string
+		size   int
+		append func([]byte, time.Time) []byte
+		read   func([]byte) (time.Time, []byte, error)
+		trunc  time.Duration // precision kept by the form
+	}{
+		{"unixsec", UnixTimeSize, AppendUnixTime, ReadUnixTimeBytes, time.Second},
+		{"unixnano", UnixNanoTimeSize, AppendUnixNanoTime, ReadUnixNanoTimeBytes, time.Nanosecond},
+		{"rfc3339", RFC3339TimeSize, AppendRFC3339Time, ReadRFC3339TimeBytes, time.Nanosecond},
+		{"timestamp", TimestampSize, AppendTimestamp, ReadTimestampBytes, time.Nanosecond},
+	}
+	times := []time.Time{
+		{},
+		time.Unix(0, 0),
+		time.Date(2023, 4, 5, 6, 7, 8, 123456789, time.UTC),
+		time.Date(1969, 12, 31, 23, 59, 59, 5, time.FixedZone("x", -3600)),
+		time.Now(),
+	}
+	for _, f := range forms {
+		for _, in := range times {
+			bts := f.append(nil, in)
+			if len(bts) > f.size {
+				t.Errorf("%s: %v encoded to %d bytes; more than %d", f.name, in, len(bts), f.size)
+			}
+			out, left, err := f.read(bts)
+			if err != nil {
+				t.Fatalf("%s: %v: %s", f.name, in, err)
+			}
+			if len(left) > 0 {
+				t.Errorf("%s: %d bytes left over", f.name, len(left))
+			}
+			if in.IsZero() != out.IsZero() || !out.Equal(in.Truncate(f.trunc)) {
+				t.Errorf("%s: wanted %v; got %v", f.name, in.Truncate(f.trunc), out)
+			}
+		}
+	}
+}
+
+func TestTimestamp(t *testing.T) {
+	for _, c := range []struct {
+		bts  []byte
+		want time.Time
+	}{
+		// 32-bit seconds
+		{[]byte{0xd6, 0xff, 0x64, 0x2d, 0x0c, 0x74}, time.Unix(1680673908, 0)},
+		// 30-bit nanoseconds and 34-bit seconds
+		{[]byte{0xd7, 0xff, 0x1d, 0x6f, 0x34, 0x54, 0x64, 0x2d, 0x0c, 0x74}, time.Unix(1680673908, 123456789)},
+		// 32-bit nanoseconds and 64-bit seconds, before 1970
+		{[]byte{0xc7, 0x0c, 0xff, 0x00, 0x00, 0x00, 0x05, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, time.Unix(-1, 5)},
+	} {
+		for name, read := range map[string]func([]byte) (time.Time, []byte, error){
+			"ReadTimestampBytes": ReadTimestampBytes,
+			"ReadTimeBytes":      ReadTimeBytes,
+		} {
+			got, left, err := read(append(c.bts, 0xc0))
+			if err != nil || !got.Equal(c.want) || len(left) != 1 {
+				t.Errorf("%s(%x): %v, %d bytes left, %v; want %v", name, c.bts, got, len(left), err, c.want)
+			}
+		}
+		if typ := NextType(c.bts); typ != TimeType {
+			t.Errorf("NextType(%x) = %v", c.bts, typ)
+		}
+		if b := AppendTimestamp(nil, c.want); string(b) != string(c.bts) {
+			t.Errorf("AppendTimestamp(%v) = %x; want %x", c.want, b, c.bts)
+		}
+	}
+
+	// a time with nanoseconds after 1970 takes the 64-bit form
+	if b := AppendTimestamp(nil, time.Date(2023, 4, 5, 6, 7, 8, 9, time.UTC)); len(b) != 10 || b[0] != 0xd7 {
+		t.Errorf("64-bit form: %x", b)
+	}
+	if _, _, err := ReadTimestampBytes([]byte{0xd7, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0}); err != ErrInvalidTimestamp {
+		t.Errorf("too many nanoseconds: %v", err)
+	}
+	if _, _, err := ReadTimestampBytes([]byte{0xd6, 0x05, 0, 0, 0, 0}); err == nil {
+		t.Error("read extension 5 as a timestamp")
+	}
+	if _, _, err := ReadTimestampBytes(AppendTime(nil, time.Now())); err == nil {
+		t.Error("read our time extension as a timestamp")
+	}
+	if _, _, err := ReadTimestampBytes([]byte{0xd7, 0xff, 0}); err != ErrShortBytes {
+		t.Errorf("short: %v", err)
+	}
+}
+
+func TestReadTimeFormMismatch(t *testing.T) {
+	now := time.Now()
+	if _, _, err := ReadUnixTimeBytes(AppendTime(nil, now)); err == nil {
+		t.Error("read a time extension as unixsec")
+	}
+	if _, _, err := ReadRFC3339TimeBytes(AppendUnixTime(nil, now)); err == nil {
+		t.Error("read unixsec as rfc3339")
+	}
+	if _, _, err := ReadRFC3339TimeBytes(AppendString(nil, "yesterday")); err == nil {
+		t.Error("read a malformed rfc3339 string")
+	}
+	if _, _, err := ReadUnixNanoTimeBytes(AppendRFC3339Time(nil, now)); err == nil {
+		t.Error("read rfc3339 as unixnano")
+	}
+}
+
+func TestRegisterTimeExt(t *testing.T) {
+	defer func() { timeExtension = TimeExtension }()
+	RegisterTimeExt(42)
+
+	in := time.Date(2023, 4, 5, 6, 7, 8, 123456789, time.UTC)
+	bts := AppendTime(nil, in)
+	if len(bts) != TimeSize || int8(bts[2]) != 42 {
+		t.Fatalf("encoded %x", bts)
+	}
+	if NextType(bts) != TimeType {
+		t.Errorf("NextType is %s", NextType(bts))
+	}
+	out, _, err := ReadTimeBytes(bts)
+	if err != nil || !out.Equal(in) {
+		t.Fatalf("wanted %v; got %v: %v", in, out, err)
+	}
+	if v, _, err := ReadIntfBytes(bts); err != nil || !v.(time.Time).Equal(in) {
+		t.Errorf("as an interface: %v, %v", v, err)
+	}
+
+	// the default number is rejected, but can be read explicitly
+	old := AppendTimeExt(nil, in, TimeExtension)
+	if _, _, err := ReadTimeBytes(old); err != (ExtensionTypeError{Got: TimeExtension, Want: 42}) {
+		t.Errorf("read extension %d: %v", TimeExtension, err)
+	}
+	if out, _, err := ReadTimeExtBytes(old, TimeExtension); err != nil || !out.Equal(in) {
+		t.Errorf("ReadTimeExtBytes: %v, %v", out, err)
+	}
+
+	for _, typ := range []int8{Complex64Extension, AddrExtension} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registered reserved extension %d", typ)
+				}
+			}()
+			RegisterTimeExt(typ)
+		}()
+	}
+}
@@ -0,0 +1,80 @@
+package msgp
+
+import "sort"
+
+// The generated methods of a struct named by the msgp:preserveunknown
+// directive keep the fields of a message that the struct doesn't
+// declare in a map[string]Raw of the struct, keyed by field name, and
+// re-encode them byte-for-byte, in canonical order among the fields
+// that it does declare.
+
+// UnknownKeys returns the keys of 'fields' in sorted order, for
+// AppendUnknownBefore, leaving out the keys of the declared fields
+// 'known', which are encoded from the fields themselves.
+func UnknownKeys(fields map[string]Raw, known ...string) []string {
+	if len(fields) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range known {
+		if i := sort.SearchStrings(keys, k); i < len(keys) && keys[i] == k {
+			keys = append(keys[:i], keys[i+1:]...)
+		}
+	}
+	return keys
+}
+
+// AppendUnknownBefore appends the fields of 'fields' named by the
+// keys that sort before 'before', the key of the next declared field,
+// and returns the keys left to append.
+func AppendUnknownBefore(b []byte, fields map[string]Raw, keys []string, before string) ([]byte, []string) {
+	for len(keys) > 0 && keys[0] < before {
+		b = fields[keys[0]].MarshalMsg(AppendString(b, keys[0]))
+		keys = keys[1:]
+	}
+	return b, keys
+}
+
+// AppendUnknown appends the fields of 'fields' named by
+// the keys left after the last declared field.
+func AppendUnknown(b []byte, fields map[string]Raw, keys []string) []byte {
+	for _, k := range keys {
+		b = fields[k].MarshalMsg(AppendString(b, k))
+	}
+	return b
+}
+
+// UnknownSize returns an upper bound of the encoded size of 'fields'.
+func UnknownSize(fields map[string]Raw) int {
+	var s int
+	for k, v := range fields {
+		s += StringPrefixSize + len(k) + v.Msgsize()
+	}
+	return s
+}
+
+// ReadUnknownBytes reads the next object in 'b', the value of the
+// field 'key' that isn't declared, into (*fields)[key], making the
+// map if it is nil, and returns the remaining bytes. It counts the
+// bytes it consumes and copies against 'budget', and fails
+// without copying if the object is nested too deeply or is
+// longer than 'budget' has remaining.
+func ReadUnknownBytes(b []byte, key []byte, fields *map[string]Raw, budget *Budget) ([]byte, error) {
+	o, err := SkipBudget(budget, b)
+	if err != nil {
+		return b, err
+	}
+	n := len(b) - len(o)
+	if err := budget.Spend(o, len(key)+n); err != nil {
+		return b, err
+	}
+	if *fields == nil {
+		*fields = make(map[string]Raw)
+	}
+	(*fields)[string(key)] = append(Raw(nil), b[:n]...)
+	return o, nil
+}
@@ -0,0 +1,77 @@
+package msgp
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUnknownFields(t *testing.T) {
+	// {"a": [1, 2], "b": 3, "c": nil, "d": "x"}, of which
+	// only "b" and "d" are declared
+	msg := AppendMapHeader(nil, 4)
+	msg = AppendArrayHeader(AppendString(msg, "a"), 2)
+	msg = AppendInt64(AppendInt64(msg, 1), 2)
+	msg = AppendUint64(AppendString(msg, "b"), 3)
+	msg = AppendNil(AppendString(msg, "c"))
+	msg = AppendString(AppendString(msg, "d"), "x")
+
+	var unknown map[string]Raw
+	var b uint64
+	var d string
+	sz, _, o, err := ReadMapHeaderBytes(msg)
+	for ; err == nil && sz > 0; sz-- {
+		var key []byte
+		if key, o, err = ReadMapKeyZC(o); err != nil {
+			break
+		}
+		switch string(key) {
+		case "b":
+			b, o, err = ReadUint64Bytes(o)
+		case "d":
+			d, o, err = ReadStringBytes(o)
+		default:
+			o, err = ReadUnknownBytes(o, key, &unknown, nil)
+		}
+	}
+	if err != nil || len(o) != 0 || b != 3 || d != "x" || len(unknown) != 2 {
+		t.Fatalf("b %d, d %q, unknown %v: %v", b, d, unknown, err)
+	}
+
+	// re-encoded in order, the message is as it was
+	keys := UnknownKeys(unknown, "b", "d")
+	out := AppendMapHeader(nil, uint32(2+len(keys)))
+	out, keys = AppendUnknownBefore(out, unknown, keys, "b")
+	out = AppendUint64(AppendString(out, "b"), b)
+	out, keys = AppendUnknownBefore(out, unknown, keys, "d")
+	out = AppendString(AppendString(out, "d"), d)
+	out = AppendUnknown(out, unknown, keys)
+	if !bytes.Equal(out, msg) {
+		t.Errorf("re-encoded\n%x; want\n%x", out, msg)
+	}
+	if len(out) > MapHeaderSize+UnknownSize(unknown)+2*StringPrefixSize+2+Uint64Size+1 {
+		t.Errorf("UnknownSize %d is too small", UnknownSize(unknown))
+	}
+
+	// the keys of declared fields are left to the fields
+	unknown["b"] = Raw{0x01}
+	if keys := UnknownKeys(unknown, "b", "d"); len(keys) != 2 || keys[0] != "a" || keys[1] != "c" {
+		t.Errorf("keys %q", keys)
+	}
+	if keys := UnknownKeys(nil, "b"); keys != nil {
+		t.Errorf("keys of nil: %q", keys)
+	}
+
+	var none *Budget
+	if _, err := ReadUnknownBytes(AppendString(nil, "toolong"), []byte("e"), &unknown, none.Limit(nil, 4)); err != ErrMaxBytesExceeded {
+		t.Errorf("exceeded the budget: %v", err)
+	}
+
+	// a value nested too deeply is not copied either
+	deep := bytes.Repeat([]byte{0x91}, SkipDepth+1)
+	if _, err := ReadUnknownBytes(append(deep, 0xc0), []byte("f"), &unknown, nil); err != ErrRecursionLimit {
+		t.Errorf("nested %d deep: %v", SkipDepth+1, err)
+	}
+	if _, ok := unknown["f"]; ok {
+		t.Error("copied a value nested too deeply")
+	}
+}
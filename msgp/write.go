@@ -1,5 +1,10 @@
 package msgp
 
+import (
+	"io"
+	"sync"
+)
+
 // Sizer is an interface implemented
 // by types that can estimate their
 // size when MessagePack encoded.
@@ -63,3 +68,31 @@ type Marshaler interface {
 	MarshalMsg([]byte) []byte
 	CanMarshalMsg(o interface{}) bool
 }
+
+// writeBufs holds the buffers that WriteMsgTo marshals into
+var writeBufs = sync.Pool{New: func() interface{} { return new([]byte) }}
+
+// maxPooledWriteBuf is the largest buffer that
+// WriteMsgTo keeps for later calls
+const maxPooledWriteBuf = 64 << 10
+
+// WriteMsgTo writes the MessagePack encoding of 'm' to
+// 'w', and returns the number of bytes written. It is
+// like writing the result of m.MarshalMsg(nil), but it
+// marshals into a pooled buffer, sized by Msgsize if
+// 'm' is a Sizer, rather than allocating a slice each
+// time. The error is that of w.Write.
+func WriteMsgTo(w io.Writer, m Marshaler) (int, error) {
+	bp := writeBufs.Get().(*[]byte)
+	b := (*bp)[:0]
+	if s, ok := m.(Sizer); ok {
+		b = Require(b, s.Msgsize())
+	}
+	b = m.MarshalMsg(b)
+	n, err := w.Write(b)
+	if cap(b) <= maxPooledWriteBuf {
+		*bp = b
+		writeBufs.Put(bp)
+	}
+	return n, err
+}
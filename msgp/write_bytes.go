@@ -61,6 +61,26 @@ func AppendArrayHeader(b []byte, sz uint32) []byte {
 // AppendNil appends a 'nil' byte to the slice
 func AppendNil(b []byte) []byte { return append(b, mnil) }
 
+// AppendMapHeaderNil appends 'nil' to the slice if m is
+// nil, and otherwise the header of a map of len(m) entries,
+// so that nil and empty maps are encoded differently, as
+// generated code encodes them unless nil=collapse is set.
+func AppendMapHeaderNil[K comparable, V any](b []byte, m map[K]V) []byte {
+	if m == nil {
+		return AppendNil(b)
+	}
+	return AppendMapHeader(b, uint32(len(m)))
+}
+
+// AppendArrayHeaderNil is like AppendMapHeaderNil, for
+// the array header of the slice s.
+func AppendArrayHeaderNil[T any](b []byte, s []T) []byte {
+	if s == nil {
+		return AppendNil(b)
+	}
+	return AppendArrayHeader(b, uint32(len(s)))
+}
+
 // AppendFloat64 appends a float64 to the slice
 func AppendFloat64(b []byte, f float64) []byte {
 	o, n := ensure(b, Float64Size)
@@ -157,6 +177,68 @@ func AppendUint16(b []byte, u uint16) []byte { return AppendUint64(b, uint64(u))
 // AppendUint32 appends a uint32 to the slice
 func AppendUint32(b []byte, u uint32) []byte { return AppendUint64(b, uint64(u)) }
 
+// AppendFixedUint8 appends a uint8 to the slice as
+// a 'uint 8', even if it would fit in a 'positive
+// fixint'. The AppendFixed functions encode integers
+// in one width, regardless of their value, for peers
+// that expect it; any of the Read functions of wide
+// enough integers decode them, but they are not in
+// the canonical form that IsCanonical accepts.
+func AppendFixedUint8(b []byte, u uint8) []byte {
+	o, n := ensure(b, Uint8Size)
+	putMuint8(o[n:], u)
+	return o
+}
+
+// AppendFixedUint16 appends a uint16 to the slice as a 'uint 16'
+func AppendFixedUint16(b []byte, u uint16) []byte {
+	o, n := ensure(b, Uint16Size)
+	putMuint16(o[n:], u)
+	return o
+}
+
+// AppendFixedUint32 appends a uint32 to the slice as a 'uint 32'
+func AppendFixedUint32(b []byte, u uint32) []byte {
+	o, n := ensure(b, Uint32Size)
+	putMuint32(o[n:], u)
+	return o
+}
+
+// AppendFixedUint64 appends a uint64 to the slice as a 'uint 64'
+func AppendFixedUint64(b []byte, u uint64) []byte {
+	o, n := ensure(b, Uint64Size)
+	putMuint64(o[n:], u)
+	return o
+}
+
+// AppendFixedInt8 appends an int8 to the slice as an 'int 8'
+func AppendFixedInt8(b []byte, i int8) []byte {
+	o, n := ensure(b, Int8Size)
+	putMint8(o[n:], i)
+	return o
+}
+
+// AppendFixedInt16 appends an int16 to the slice as an 'int 16'
+func AppendFixedInt16(b []byte, i int16) []byte {
+	o, n := ensure(b, Int16Size)
+	putMint16(o[n:], i)
+	return o
+}
+
+// AppendFixedInt32 appends an int32 to the slice as an 'int 32'
+func AppendFixedInt32(b []byte, i int32) []byte {
+	o, n := ensure(b, Int32Size)
+	putMint32(o[n:], i)
+	return o
+}
+
+// AppendFixedInt64 appends an int64 to the slice as an 'int 64'
+func AppendFixedInt64(b []byte, i int64) []byte {
+	o, n := ensure(b, Int64Size)
+	putMint64(o[n:], i)
+	return o
+}
+
 // AppendBytes appends bytes to the slice as MessagePack 'bin' data
 func AppendBytes(b []byte, bts []byte) []byte {
 	sz := len(bts)
@@ -183,6 +265,13 @@ func AppendBytes(b []byte, bts []byte) []byte {
 	return o[:n+copy(o[n:], bts)]
 }
 
+// AppendRaw appends 'r', one already-encoded object, to the
+// slice as it is, or 'nil' if 'r' is empty, as ReadRawBytes
+// reads it.
+func AppendRaw(b []byte, r Raw) []byte {
+	return r.MarshalMsg(b)
+}
+
 // AppendBool appends a bool to the slice
 func AppendBool(b []byte, t bool) []byte {
 	if t {
@@ -265,18 +354,24 @@ func AppendComplex128(b []byte, c complex128) []byte {
 }
 
 // AppendTime appends a time.Time to the slice as a MessagePack extension
-func AppendTime(b []byte, t time.Time) []byte {
+// numbered TimeExtension, or the number set by RegisterTimeExt
+func AppendTime(b []byte, t time.Time) []byte { return AppendTimeExt(b, t, timeExtension) }
+
+// AppendTimeExt is like AppendTime, but numbers the extension 'typ'
+func AppendTimeExt(b []byte, t time.Time, typ int8) []byte {
 	o, n := ensure(b, TimeSize)
 	t = t.UTC()
 	o[n] = mext8
 	o[n+1] = 12
-	o[n+2] = TimeExtension
+	o[n+2] = byte(typ)
 	putUnix(o[n+3:], t.Unix(), int32(t.Nanosecond()))
 	return o
 }
 
 // AppendMapStrStr appends a map[string]string to the slice
-// as a MessagePack map with 'str'-type keys and values
+// as a MessagePack map with 'str'-type keys and values.
+// The keys are written in map iteration order, so the
+// encoding is not canonical; generated code sorts them.
 func AppendMapStrStr(b []byte, m map[string]string) []byte {
 	sz := uint32(len(m))
 	b = AppendMapHeader(b, sz)
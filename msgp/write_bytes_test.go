@@ -1,6 +1,7 @@
 package msgp
 
 import (
+	"math"
 	"testing"
 	"time"
 )
@@ -39,6 +40,29 @@ func TestAppendNil(t *testing.T) {
 	}
 }
 
+func TestAppendHeaderNil(t *testing.T) {
+	type names map[string]int
+	for _, c := range []struct {
+		name string
+		got  []byte
+		want byte
+	}{
+		{"nil map", AppendMapHeaderNil(nil, map[string]int(nil)), mnil},
+		{"empty map", AppendMapHeaderNil(nil, map[string]int{}), wfixmap(0)},
+		{"named map", AppendMapHeaderNil(nil, names{"a": 1}), wfixmap(1)},
+		{"nil slice", AppendArrayHeaderNil(nil, []int(nil)), mnil},
+		{"empty slice", AppendArrayHeaderNil(nil, []int{}), wfixarray(0)},
+		{"nil []interface{}", AppendIntf(nil, []interface{}(nil)), mnil},
+		{"empty []interface{}", AppendIntf(nil, []interface{}{}), wfixarray(0)},
+		{"nil map[string]interface{}", AppendIntf(nil, map[string]interface{}(nil)), mnil},
+		{"empty map[string]interface{}", AppendIntf(nil, map[string]interface{}{}), wfixmap(0)},
+	} {
+		if len(c.got) != 1 || c.got[0] != c.want {
+			t.Errorf("%s: got %x; want %x", c.name, c.got, c.want)
+		}
+	}
+}
+
 func BenchmarkAppendFloat64(b *testing.B) {
 	f := float64(3.14159)
 	buf := make([]byte, 0, 9)
@@ -138,3 +162,60 @@ func BenchmarkAppendTime(b *testing.B) {
 		AppendTime(buf[0:0], t)
 	}
 }
+
+func TestAppendReadDuration(t *testing.T) {
+	ds := []time.Duration{0, 1, -1, time.Second, -time.Hour, math.MaxInt64, math.MinInt64}
+	for _, d := range ds {
+		bts := AppendDuration(nil, d)
+		if len(bts) > DurationSize {
+			t.Errorf("duration %v encoded to %d bytes; more than DurationSize", d, len(bts))
+		}
+		out, left, err := ReadDurationBytes(bts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(left) > 0 {
+			t.Errorf("%d bytes left over after ReadDurationBytes()", len(left))
+		}
+		if out != d {
+			t.Errorf("wanted %v; got %v", d, out)
+		}
+	}
+}
+
+func TestAppendFixed(t *testing.T) {
+	for _, tc := range []struct {
+		bts  []byte
+		lead byte
+		size int
+	}{
+		{AppendFixedUint8(nil, 1), muint8, 2},
+		{AppendFixedUint16(nil, 1), muint16, 3},
+		{AppendFixedUint32(nil, 1), muint32, 5},
+		{AppendFixedUint64(nil, 1), muint64, 9},
+		{AppendFixedInt8(nil, 1), mint8, 2},
+		{AppendFixedInt16(nil, 1), mint16, 3},
+		{AppendFixedInt32(nil, 1), mint32, 5},
+		{AppendFixedInt64(nil, 1), mint64, 9},
+	} {
+		if len(tc.bts) != tc.size || tc.bts[0] != tc.lead {
+			t.Errorf("%x is not %d bytes led by %x", tc.bts, tc.size, tc.lead)
+		}
+		// any integer wide enough decodes it
+		if i, o, err := ReadInt8Bytes(tc.bts); err != nil || len(o) != 0 || i != 1 {
+			t.Errorf("%x decoded to %d: %v", tc.bts, i, err)
+		}
+		if ok, _ := IsCanonical(tc.bts); ok {
+			t.Errorf("%x is canonical", tc.bts)
+		}
+	}
+	if u, _, err := ReadUint64Bytes(AppendFixedUint64(nil, math.MaxUint64)); err != nil || u != math.MaxUint64 {
+		t.Errorf("max uint64: %d, %v", u, err)
+	}
+	if i, _, err := ReadInt64Bytes(AppendFixedInt64(nil, math.MinInt64)); err != nil || i != math.MinInt64 {
+		t.Errorf("min int64: %d, %v", i, err)
+	}
+	if _, _, err := ReadInt8Bytes(AppendFixedInt16(nil, math.MaxInt16)); err == nil {
+		t.Error("decoded a wide value into an int8")
+	}
+}
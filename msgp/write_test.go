@@ -1,8 +1,12 @@
 package msgp
 
 import (
+	"bytes"
+	"crypto/md5"
+	"errors"
 	"math"
 	"math/rand"
+	"testing"
 )
 
 var (
@@ -22,3 +26,35 @@ func RandBytes(sz int) []byte {
 	}
 	return out
 }
+
+// errWriter fails every write
+type errWriter struct{}
+
+func (errWriter) Write([]byte) (int, error) { return 0, errors.New("closed") }
+
+func TestWriteMsgTo(t *testing.T) {
+	for _, m := range []Marshaler{&circle{r: 1.5}, &square{side: -3}, Raw(RandBytes(100 << 10))} {
+		h := md5.New()
+		n, err := WriteMsgTo(h, m)
+		b := m.MarshalMsg(nil)
+		if err != nil || n != len(b) {
+			t.Errorf("%T: wrote %d of %d bytes: %v", m, n, len(b), err)
+		}
+		if want := md5.Sum(b); !bytes.Equal(h.Sum(nil), want[:]) {
+			t.Errorf("%T: md5 %x; want %x", m, h.Sum(nil), want)
+		}
+	}
+
+	// a pooled buffer doesn't leak into the next write
+	var buf bytes.Buffer
+	WriteMsgTo(&buf, &square{side: 1 << 40})
+	WriteMsgTo(&buf, &circle{r: 2})
+	want := (&circle{r: 2}).MarshalMsg((&square{side: 1 << 40}).MarshalMsg(nil))
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("wrote %x; want %x", buf.Bytes(), want)
+	}
+
+	if _, err := WriteMsgTo(errWriter{}, &circle{r: 1}); err == nil {
+		t.Error("no error from a failed write")
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/algorand/msgp/gen"
@@ -22,11 +26,30 @@ type passDirective func(gen.Method, []string, *gen.Printer) error
 // to add a directive, define a func([]string, *FileSet) error
 // and then add it to this list.
 var directives = map[string]directive{
-	"shim":       applyShim,
-	"ignore":     ignore,
-	"tuple":      astuple,
-	"sort":       sortintf,
-	"allocbound": allocbound,
+	"shim":            applyShim,
+	"convert":         convert,
+	"ignore":          ignore,
+	"tuple":           astuple,
+	"sort":            sortintf,
+	"allocbound":      allocbound,
+	"maxtotalbytes":   maxtotalbytes,
+	"pool":            aspool,
+	"nosizehint":      nosizehint,
+	"text":            astext,
+	"replace":         replace,
+	"iface":           asiface,
+	"receiver":        receiver,
+	"stringer":        asstringer,
+	"enum":            asenum,
+	"zerocopy":        zerocopy,
+	"jsonnames":       jsonnames,
+	"securetype":      securetype,
+	"stringkey":       stringkey,
+	"preserveunknown": preserveunknown,
+	"since":           since,
+	"presence":        presence,
+	// instantiate isn't listed, since it is applied before the
+	// specs are processed, by (*FileSet).instantiate
 	// _postunmarshalcheck is used to add callbacks to the end of un-marshalling that are tied to a specific Element.
 	_postunmarshalcheck: postunmarshalcheck,
 }
@@ -149,6 +172,88 @@ func applyShim(text []string, f *FileSet) error {
 	return nil
 }
 
+// convert encodes Type as the msgp type Base, as the shim
+// directive does in convert mode: the generated code calls
+// toFunc, a func(Type) Base, before encoding the value, and
+// fromFunc, a func(Base) (Type, error), after decoding it.
+// Base must be a type that msgp encodes itself, and the
+// funcs declared in the package must have those signatures.
+//
+//msgp:convert {Type} to {Base} using {toFunc}, {fromFunc}
+func convert(text []string, f *FileSet) error {
+	if len(text) < 6 || text[2] != "to" || text[4] != "using" {
+		// fatal, since the type would be encoded as itself
+		err := fmt.Errorf("convert directive should have the form 'convert {Type} to {Base} using {toFunc}, {fromFunc}'; found %q", strings.Join(text[1:], " "))
+		f.errs = append(f.errs, err)
+		return err
+	}
+	name, base := text[1], text[3]
+	fail := func(format string, args ...interface{}) error {
+		err := fmt.Errorf("convert %s: "+format, append([]interface{}{name}, args...)...)
+		f.errs = append(f.errs, err)
+		return err
+	}
+	funcs := strings.Split(strings.Join(text[5:], ""), ",")
+	if len(funcs) != 2 || funcs[0] == "" || funcs[1] == "" {
+		return fail("expected two funcs, to and from %s; found %q", base, strings.Join(text[5:], " "))
+	}
+	to, from := funcs[0], funcs[1]
+
+	be := gen.Ident("", base)
+	if be.Value == gen.IDENT {
+		return fail("%s is not a type that msgp encodes", base)
+	}
+	if err := f.checkFunc(to, name, base); err != nil {
+		return fail("%s", err)
+	}
+	if err := f.checkFunc(from, base, name, "error"); err != nil {
+		return fail("%s", err)
+	}
+	be.Alias(name)
+	be.ShimToBase, be.ShimFromBase = to, from
+	be.ShimMode = gen.Convert
+
+	infof("%s -> %s\n", name, be.Value.String())
+	f.findShim(name, be)
+	return nil
+}
+
+// checkFunc returns an error if the func name is declared
+// in the package, but not as a func(param) (results...).
+// Funcs of other packages, and of the files of the package
+// that aren't parsed, are left for the compiler to check.
+func (f *FileSet) checkFunc(name string, param string, results ...string) error {
+	ft, ok := f.funcs[name]
+	if !ok {
+		return nil
+	}
+	want := fmt.Sprintf("func(%s) %s", param, strings.Join(results, ", "))
+	if len(results) > 1 {
+		want = fmt.Sprintf("func(%s) (%s)", param, strings.Join(results, ", "))
+	}
+	typesOf := func(fl *ast.FieldList) []string {
+		var out []string
+		if fl == nil {
+			return out
+		}
+		for _, field := range fl.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				out = append(out, stringify(field.Type))
+			}
+		}
+		return out
+	}
+	if ft.TypeParams != nil || strings.Join(typesOf(ft.Params), ",") != param ||
+		strings.Join(typesOf(ft.Results), ",") != strings.Join(results, ",") {
+		return fmt.Errorf("%s is not a %s", name, want)
+	}
+	return nil
+}
+
 //msgp:ignore {TypeA} {TypeB}...
 func ignore(text []string, f *FileSet) error {
 	if len(text) < 2 {
@@ -158,12 +263,552 @@ func ignore(text []string, f *FileSet) error {
 		name := strings.TrimSpace(item)
 		if _, ok := f.Identities[name]; ok {
 			delete(f.Identities, name)
+			f.Skipped[name] = "msgp:ignore"
 			infof("ignoring %s\n", name)
 		}
 	}
 	return nil
 }
 
+//msgp:text {TypeA} {TypeB}...
+func astext(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		be := &gen.BaseElem{Value: gen.Text}
+		be.Alias(name)
+		infof("%s -> text\n", name)
+		f.findShim(name, be)
+		// no methods are generated for the type itself,
+		// since MarshalText and UnmarshalText encode it
+		if _, ok := f.Identities[name]; ok {
+			delete(f.Identities, name)
+			f.Skipped[name] = "msgp:text"
+		}
+	}
+	return nil
+}
+
+//msgp:iface {Type}...
+func asiface(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if _, ok := f.Identities[name]; ok {
+			warnf("iface: %s is not an interface type\n", name)
+			continue
+		}
+		be := &gen.BaseElem{Value: gen.Iface}
+		be.Alias(name)
+		infof("%s -> iface\n", name)
+		f.findShim(name, be)
+		// the values held by the interface are
+		// encoded by the methods of their types
+		delete(f.Identities, name)
+	}
+	return nil
+}
+
+//msgp:replace {Type} with {Newtype}
+func replace(text []string, f *FileSet) error {
+	if len(text) != 4 || text[2] != "with" {
+		return fmt.Errorf("replace directive should have the form 'replace {Type} with {Newtype}'; found %q", strings.Join(text[1:], " "))
+	}
+	name, replacement := text[1], text[3]
+
+	// values of type name are encoded by the methods
+	// of replacement, through a pointer conversion, so
+	// the compiler checks that the two types have the
+	// same underlying type
+	if !f.hasMethods(replacement) {
+		// fatal, since the fields would be left
+		// without methods to encode them
+		err := fmt.Errorf("replace: no methods are generated for %s", replacement)
+		f.errs = append(f.errs, err)
+		return err
+	}
+	be := gen.Ident("", name)
+	be.Replacement = replacement
+
+	infof("%s -> %s\n", name, replacement)
+	_, local := f.Identities[name]
+	f.findShim(name, be)
+	// no methods are generated for the type itself,
+	// since those of replacement encode it
+	delete(f.Identities, name)
+	if local {
+		f.Skipped[name] = "msgp:replace"
+	}
+	return nil
+}
+
+// hasMethods returns whether msgp methods are generated for the
+// named type, either in f or in the package it is imported from.
+func (f *FileSet) hasMethods(name string) bool {
+	fs := f
+	if pkg, typ, ok := strings.Cut(name, "."); ok {
+		fs, name = f.ImportSet[f.ImportName[pkg]], typ
+		if fs == nil {
+			return false
+		}
+	}
+	el, ok := fs.Identities[name]
+	return ok && gen.SkipReason(el) == ""
+}
+
+//msgp:pool {TypeA} {TypeB}...
+func aspool(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if _, ok := f.Identities[name]; ok {
+			gen.SetPool(name)
+			infof("pooling %s\n", name)
+		} else {
+			warnf("pool: cannot find type %s\n", name)
+		}
+	}
+	return nil
+}
+
+//msgp:nosizehint {TypeA} {TypeB}...
+func nosizehint(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if el, ok := f.Identities[name]; ok {
+			el.SetNoSizeHint()
+			infof("nosizehint %s\n", name)
+		} else {
+			warnf("nosizehint: cannot find type %s\n", name)
+		}
+	}
+	return nil
+}
+
+// reservedReceivers are the names used by the generated
+// methods for their arguments, results and locals, which
+// a receiver can't shadow
+var reservedReceivers = map[string]bool{
+	"b": true, "o": true, "s": true, "bts": true, "err": true,
+	"ok": true, "field": true, "budget": true, "validate": true,
+	"msgp": true, "cbor": true, "reflect": true, "bytes": true,
+}
+
+//msgp:receiver {Type} [name={ident}] [value|pointer]
+func receiver(text []string, f *FileSet) error {
+	if len(text) < 3 {
+		return nil
+	}
+	name := strings.TrimSpace(text[1])
+	el, ok := f.Identities[name]
+	if !ok {
+		warnf("receiver: cannot find type %s\n", name)
+		return nil
+	}
+	var recv, typ string
+	for _, opt := range text[2:] {
+		opt = strings.TrimSpace(opt)
+		switch {
+		case opt == "value" || opt == "pointer":
+			typ = opt
+		case strings.HasPrefix(opt, "name="):
+			recv = strings.TrimPrefix(opt, "name=")
+			if !token.IsIdentifier(recv) || recv == "_" || recv == name ||
+				reservedReceivers[recv] || types.Universe.Lookup(recv) != nil ||
+				strings.HasPrefix(recv, "za") || strings.HasPrefix(recv, "zb") {
+				err := fmt.Errorf("receiver %s: %q can't be the name of the receiver", name, recv)
+				f.errs = append(f.errs, err)
+				return err
+			}
+		default:
+			err := fmt.Errorf("receiver %s: unknown option %q", name, opt)
+			f.errs = append(f.errs, err)
+			return err
+		}
+	}
+	el.SetReceiver(recv, typ)
+	infof("receiver %s: %s %s\n", name, recv, typ)
+	return nil
+}
+
+//msgp:stringer {TypeA} {TypeB}...
+func asstringer(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if el, ok := f.Identities[name]; ok {
+			if st, ok := el.(*gen.Struct); ok {
+				st.Stringer = true
+				infof("stringer %s\n", name)
+			} else {
+				warnf("stringer: %s is not a struct\n", name)
+			}
+		} else {
+			warnf("stringer: cannot find type %s\n", name)
+		}
+	}
+	return nil
+}
+
+//msgp:zerocopy {TypeA} {TypeB}...
+func zerocopy(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	// the []byte values of the types are decoded by UnmarshalMsg
+	// as sub-slices of the input, rather than as copies, so they
+	// share its memory: the input must not be modified or reused
+	// while the decoded value is in use
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		el, ok := f.Identities[name]
+		if !ok {
+			warnf("cannot find type %s\n", name)
+			continue
+		}
+		if n := setZeroCopy(el); n == 0 {
+			warnf("%s has no []byte values\n", name)
+		} else {
+			infof("zerocopy %s\n", name)
+		}
+	}
+	return nil
+}
+
+// setZeroCopy marks the []byte values of e, other than
+// those of the named types that it holds, to be decoded
+// without copying, and returns how many there are
+func setZeroCopy(e gen.Elem) int {
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		if e.Value == gen.Bytes {
+			e.ZeroCopy = true
+			return 1
+		}
+	case *gen.Ptr:
+		return setZeroCopy(e.Value)
+	case *gen.Slice:
+		return setZeroCopy(e.Els)
+	case *gen.Array:
+		return setZeroCopy(e.Els)
+	case *gen.Map:
+		return setZeroCopy(e.Value)
+	case *gen.Struct:
+		n := 0
+		for i := range e.Fields {
+			n += setZeroCopy(e.Fields[i].FieldElem)
+		}
+		return n
+	}
+	return 0
+}
+
+//msgp:jsonnames
+func jsonnames(text []string, f *FileSet) error {
+	// the key of a field is the name in its codec tag, then
+	// the name in its json tag, and then the name of the field
+	n := 0
+	for _, el := range f.Identities {
+		n += jsonNames(el)
+	}
+	infof("%d fields keyed by json tags\n", n)
+	return nil
+}
+
+// jsonNames keys the fields of the structs in e without
+// a codec tag by the names in their json tags, and
+// returns how many fields it keyed
+func jsonNames(e gen.Elem) int {
+	switch e := e.(type) {
+	case *gen.Ptr:
+		return jsonNames(e.Value)
+	case *gen.Slice:
+		return jsonNames(e.Els)
+	case *gen.Array:
+		return jsonNames(e.Els)
+	case *gen.Map:
+		return jsonNames(e.Value)
+	case *gen.Struct:
+		n := 0
+		for i := range e.Fields {
+			sf := &e.Fields[i]
+			n += jsonNames(sf.FieldElem)
+			if sf.HasCodecTag || sf.RawTag == "" {
+				continue
+			}
+			tag, _ := reflect.StructTag(strings.Trim(sf.RawTag, "`")).Lookup("json")
+			// json:"-" has no name, but it doesn't drop the field
+			if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+				sf.FieldTag = name
+				sf.FieldTagParts[0] = name
+				n++
+			}
+		}
+		return n
+	}
+	return 0
+}
+
+//msgp:securetype {TypeA} {TypeB}...
+func securetype(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	// the types are checked by Unbounded, for the -lint flag
+	for _, item := range text[1:] {
+		name := strings.TrimSpace(item)
+		if _, ok := f.Identities[name]; ok {
+			if f.secure == nil {
+				f.secure = make(map[string]token.Position)
+			}
+			f.secure[name] = f.fset.Position(f.Specs[name].Pos())
+			infof("securetype %s\n", name)
+		} else {
+			warnf("cannot find type %s\n", name)
+		}
+	}
+	return nil
+}
+
+//msgp:stringkey {Type} {parseFunc}
+func stringkey(text []string, f *FileSet) error {
+	if len(text) != 3 {
+		return fmt.Errorf("stringkey directive should have 2 arguments; found %d", len(text)-1)
+	}
+	// the map keys of the type are encoded as their String(),
+	// and decoded by parseFunc, a func(string) (Type, error)
+	name, parse := strings.TrimSpace(text[1]), strings.TrimSpace(text[2])
+	n := 0
+	for _, el := range f.Identities {
+		n += setStringKey(el, name, parse)
+	}
+	if n == 0 {
+		warnf("no maps are keyed by %s\n", name)
+	} else {
+		infof("%s keys of %d maps\n", name, n)
+	}
+	return nil
+}
+
+// setStringKey sets the keys of type name of the maps in
+// e, other than those of the named types that it holds,
+// to be encoded as strings, and returns how many there are
+func setStringKey(e gen.Elem, name string, parse string) int {
+	switch e := e.(type) {
+	case *gen.Ptr:
+		return setStringKey(e.Value, name, parse)
+	case *gen.Slice:
+		return setStringKey(e.Els, name, parse)
+	case *gen.Array:
+		return setStringKey(e.Els, name, parse)
+	case *gen.Map:
+		n := setStringKey(e.Value, name, parse)
+		if e.Key.TypeName() == name {
+			key := gen.StringKeyElem(name, parse)
+			key.SetAllocBound(e.Key.AllocBound())
+			e.Key = key
+			n++
+		}
+		return n
+	case *gen.Struct:
+		n := 0
+		for i := range e.Fields {
+			n += setStringKey(e.Fields[i].FieldElem, name, parse)
+		}
+		return n
+	}
+	return 0
+}
+
+//msgp:preserveunknown {Type} [{field}]
+func preserveunknown(text []string, f *FileSet) error {
+	if len(text) < 2 || len(text) > 3 {
+		return fmt.Errorf("preserveunknown directive should have the form 'preserveunknown {Type} [{field}]'; found %q", strings.Join(text[1:], " "))
+	}
+	// the struct declares the field that keeps the fields
+	// it doesn't, since the generated code can't add one;
+	// being unexported, the field isn't encoded itself
+	name, field := text[1], "unknownFields"
+	if len(text) == 3 {
+		field = text[2]
+	}
+	st, ok := f.Identities[name].(*gen.Struct)
+	if !ok || st.AsTuple {
+		err := fmt.Errorf("preserveunknown %s: not a struct encoded as a map", name)
+		f.errs = append(f.errs, err)
+		return err
+	}
+	for _, sf := range st.Fields {
+		if sf.FieldName != field {
+			continue
+		}
+		m, ok := sf.FieldElem.(*gen.Map)
+		if ast.IsExported(field) || !ok || m.Key.TypeName() != "string" || m.Value.TypeName() != "msgp.Raw" {
+			break
+		}
+		st.Unknown = field
+		infof("%s: unknown fields in %s\n", name, field)
+		return nil
+	}
+	err := fmt.Errorf("preserveunknown %s: no unexported field %s map[string]msgp.Raw is declared to keep the unknown fields", name, field)
+	f.errs = append(f.errs, err)
+	return err
+}
+
+// records, in an unexported field of the struct of type
+// {Type}Present, which the generated code declares, which of
+// its omitempty fields the message it was decoded from had,
+// as WhichPresent returns.
+//
+//msgp:presence {Type} [{field}]
+func presence(text []string, f *FileSet) error {
+	if len(text) < 2 || len(text) > 3 {
+		return fmt.Errorf("presence directive should have the form 'presence {Type} [{field}]'; found %q", strings.Join(text[1:], " "))
+	}
+	name, field := text[1], "present"
+	if len(text) == 3 {
+		field = text[2]
+	}
+	st, ok := f.Identities[name].(*gen.Struct)
+	if !ok || st.AsTuple {
+		err := fmt.Errorf("presence %s: not a struct encoded as a map", name)
+		f.errs = append(f.errs, err)
+		return err
+	}
+	for _, sf := range st.Fields {
+		if sf.FieldName != field {
+			continue
+		}
+		if ast.IsExported(field) || sf.FieldElem.TypeName() != name+"Present" {
+			break
+		}
+		st.Presence = field
+		infof("%s: field presence in %s\n", name, field)
+		return nil
+	}
+	err := fmt.Errorf("presence %s: no unexported field %s %sPresent is declared to record the fields present", name, field, name)
+	f.errs = append(f.errs, err)
+	return err
+}
+
+// marks the fields as present only in the messages whose
+// VersionField is at least N: they aren't encoded in older
+// ones, and it's an error to decode them from one. Since a
+// tuple is decoded in order, the version field must be
+// declared before the fields, and a struct has only one.
+//
+//msgp:since {Type} {VersionField} {N} {field} ...
+func since(text []string, f *FileSet) error {
+	if len(text) < 5 {
+		return fmt.Errorf("since directive should have the form 'since {Type} {VersionField} {N} {field} ...'; found %q", strings.Join(text[1:], " "))
+	}
+	name, version, n := text[1], text[2], text[3]
+	fail := func(format string, args ...interface{}) error {
+		err := fmt.Errorf("since %s: "+format, append([]interface{}{name}, args...)...)
+		f.errs = append(f.errs, err)
+		return err
+	}
+	st, ok := f.Identities[name].(*gen.Struct)
+	if !ok {
+		return fail("not a struct")
+	}
+	if _, err := strconv.ParseUint(n, 10, 64); err != nil {
+		return fail("version %q is not an unsigned integer", n)
+	}
+	index := func(field string) int {
+		for i, sf := range st.Fields {
+			if sf.FieldName == field && ast.IsExported(field) {
+				return i
+			}
+		}
+		return -1
+	}
+	vi := index(version)
+	if vi < 0 {
+		return fail("no exported field %s is declared to hold the version", version)
+	}
+	if be, ok := st.Fields[vi].FieldElem.(*gen.BaseElem); !ok || !gen.IsInteger(be.Value) || be.ShimToBase != "" {
+		return fail("version field %s is not an integer", version)
+	}
+	for _, sf := range st.Fields {
+		if sf.Version != "" && sf.Version != version {
+			return fail("the version is already held by %s, not %s", sf.Version, version)
+		}
+	}
+	if st.Fields[vi].Version != "" {
+		return fail("version field %s is itself present only since version %s", version, st.Fields[vi].Since)
+	}
+	for _, field := range text[4:] {
+		i := index(field)
+		if i < 0 {
+			return fail("no exported field %s is declared", field)
+		}
+		if i == vi {
+			return fail("field %s holds the version", field)
+		}
+		if i < vi {
+			return fail("field %s is declared before the version field %s", field, version)
+		}
+		st.Fields[i].Version, st.Fields[i].Since = version, n
+		infof("%s: %s since %s %s\n", name, field, version, n)
+	}
+	return nil
+}
+
+//msgp:enum {Type} [tolerant]
+func asenum(text []string, f *FileSet) error {
+	if len(text) < 2 {
+		return nil
+	}
+	name := strings.TrimSpace(text[1])
+	enum := &gen.Enum{}
+	for _, opt := range text[2:] {
+		if opt = strings.TrimSpace(opt); opt != "tolerant" {
+			err := fmt.Errorf("enum %s: unknown option %q", name, opt)
+			f.errs = append(f.errs, err)
+			return err
+		}
+		enum.Tolerant = true
+	}
+	el, ok := f.Identities[name]
+	if !ok {
+		warnf("cannot find type %s\n", name)
+		return nil
+	}
+	be, ok := el.(*gen.BaseElem)
+	if !ok || !gen.IsInteger(be.Value) || be.ShimToBase != "" {
+		warnf("%s is not an integer type\n", name)
+		return nil
+	}
+	// each value is encoded by the name of its first
+	// const, and consts for the same value are left out
+	seen := make(map[string]bool)
+	for _, c := range f.typedConsts(name) {
+		if v := c.Val().ExactString(); !seen[v] {
+			seen[v] = true
+			enum.Names = append(enum.Names, c.Name())
+		}
+	}
+	if len(enum.Names) == 0 {
+		warnf("%s has no consts\n", name)
+		return nil
+	}
+	be.Enum = enum
+	infof("enum %s: %s\n", name, strings.Join(enum.Names, ", "))
+	return nil
+}
+
 //msgp:tuple {TypeA} {TypeB}...
 func astuple(text []string, f *FileSet) error {
 	if len(text) < 2 {
@@ -173,6 +818,13 @@ func astuple(text []string, f *FileSet) error {
 		name := strings.TrimSpace(item)
 		if el, ok := f.Identities[name]; ok {
 			if st, ok := el.(*gen.Struct); ok {
+				if err := tupleFields(st); err != nil {
+					// fatal, since the fields would be
+					// decoded at the wrong positions
+					err = fmt.Errorf("tuple %s: %w", name, err)
+					f.errs = append(f.errs, err)
+					return err
+				}
 				st.AsTuple = true
 				infoln(name)
 			} else {
@@ -183,6 +835,42 @@ func astuple(text []string, f *FileSet) error {
 	return nil
 }
 
+// tupleOmits are the tag options that leave a
+// field out of the encoding when it is empty
+var tupleOmits = []string{"omitempty", "omitemptyarray", "omitzero"}
+
+// tupleFields prepares the fields of st to be encoded
+// by position, in the order in which they are declared
+// (with the fields of embedded structs in place of the
+// struct). As in a map, only exported fields are
+// encoded, which is also the order in which a map
+// struct is decoded from an array. Fields can't be
+// omitted, since the positions of the fields after
+// them would shift.
+func tupleFields(st *gen.Struct) error {
+	fields := st.Fields[:0]
+	for _, sf := range st.Fields {
+		// the _struct annotations of embedded structs
+		// are flattened too, but apply to their maps
+		if sf.FieldName == "_struct" && len(sf.FieldPath) > 0 {
+			continue
+		}
+		for _, opt := range tupleOmits {
+			if sf.HasTagPart(opt) {
+				if sf.FieldName == "_struct" {
+					return fmt.Errorf("the %s option of _struct applies to every field, and tuples cannot omit fields", opt)
+				}
+				return fmt.Errorf("field %s is %s, and tuples cannot omit fields", sf.FieldName, opt)
+			}
+		}
+		if ast.IsExported(sf.FieldName) {
+			fields = append(fields, sf)
+		}
+	}
+	st.Fields = fields
+	return nil
+}
+
 //msgp:sort {Type} {SortInterface} {LessFunction}
 func sortintf(text []string, f *FileSet) error {
 	if len(text) != 4 && len(text) != 3 {
@@ -221,3 +909,20 @@ func allocbound(text []string, f *FileSet) error {
 	}
 	return nil
 }
+
+//msgp:maxtotalbytes {Type} {Bound}
+func maxtotalbytes(text []string, f *FileSet) error {
+	if len(text) != 3 {
+		return nil
+	}
+	limitType := strings.TrimSpace(text[1])
+	limit := strings.TrimSpace(text[2])
+	t, ok := f.Identities[limitType]
+	if !ok {
+		warnf("maxtotalbytes: cannot find type %s\n", limitType)
+	} else {
+		t.SetMaxTotalBytes(limit)
+		infof("maxtotalbytes(%s): setting to %s\n", limitType, limit)
+	}
+	return nil
+}
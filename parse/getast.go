@@ -1,11 +1,18 @@
 package parse
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/build"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
 	"reflect"
 	"sort"
 	"strings"
+	"unicode"
 
 	"github.com/algorand/msgp/gen"
 	"github.com/ttacon/chalk"
@@ -26,24 +33,102 @@ type FileSet struct {
 	Imports    []*ast.ImportSpec   // imports
 	ImportSet  ImportSet
 	ImportName map[string]string
+	Unexported bool                      // include unexported type declarations
+	Skipped    map[string]string         // types left out of Identities, and why
+	MovedFrom  *ast.ImportSpec           // the package that declares the types, after MoveTo
+	errs       []error                   // directive errors that stop code generation
+	secure     map[string]token.Position // the msgp:securetype types, and where they are declared
+	fset       *token.FileSet            // the positions of Specs and of struct fields
+	generics   map[string]*ast.TypeSpec  // the generic types, for msgp:instantiate
+	instances  map[string]ast.Expr       // the types declared as instantiations of generic types
+	embedded   map[token.Position]string // the embedded interface fields, by position, and their types
+	funcs      map[string]*ast.FuncType  // the funcs declared in the files, for msgp:convert
+
+	// the type and const declarations of each file, for
+	// typing the consts of the msgp:enum directive
+	declFiles []*ast.File
 }
 
 // An ImportSet describes the FileSets for a group of imported packages
 type ImportSet map[string]*FileSet
 
+// Build is the set of build constraints that files are
+// parsed under, as with go build: a file whose //go:build
+// line or _GOOS/_GOARCH name suffix doesn't hold is left
+// out, along with the types it declares. An empty GOOS or
+// GOARCH is the one go build would use.
+type Build struct {
+	Tags   []string
+	GOOS   string
+	GOARCH string
+}
+
+func (b Build) config(cfg *packages.Config) {
+	if len(b.Tags) > 0 {
+		cfg.BuildFlags = append(cfg.BuildFlags, "-tags="+strings.Join(b.Tags, ","))
+	}
+	if b.GOOS != "" || b.GOARCH != "" {
+		cfg.Env = os.Environ()
+		if b.GOOS != "" {
+			cfg.Env = append(cfg.Env, "GOOS="+b.GOOS)
+		}
+		if b.GOARCH != "" {
+			cfg.Env = append(cfg.Env, "GOARCH="+b.GOARCH)
+		}
+	}
+}
+
+// matches returns whether the file at name builds under b. go
+// list ignores the constraints of the files it is given by name,
+// so they are checked here, if b sets any.
+func (b Build) matches(name string) (bool, error) {
+	ctxt := build.Default
+	if b.GOOS != "" {
+		ctxt.GOOS = b.GOOS
+	}
+	if b.GOARCH != "" {
+		ctxt.GOARCH = b.GOARCH
+	}
+	ctxt.BuildTags = b.Tags
+	return ctxt.MatchFile(filepath.Split(name))
+}
+
 // File parses a file at the relative path
 // provided and produces a new *FileSet.
 // If you pass in a path to a directory, the entire
 // directory will be parsed.
-// If unexport is false, only exported identifiers are included in the FileSet.
+// If unexported is false, only exported type declarations are included in the FileSet.
 // If the resulting FileSet would be empty, an error is returned.
 func File(name string, unexported bool, warnPkgMask string) (*FileSet, error) {
+	return BuildFile(name, unexported, warnPkgMask, Build{})
+}
+
+// BuildFile is like File, but only parses the files
+// that build under the constraints in b.
+func BuildFile(name string, unexported bool, warnPkgMask string, b Build) (*FileSet, error) {
 	pushstate(name)
 	defer popstate()
 
 	cfg := &packages.Config{
 		Mode: packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedFiles | packages.NeedExportsFile | packages.NeedTypesInfo,
 	}
+	b.config(cfg)
+	// the packages are loaded without their types, for which
+	// packages.Load would otherwise make the FileSet
+	cfg.Fset = token.NewFileSet()
+
+	// a file named on its own is parsed whatever its
+	// constraints, unless some are set to check it under
+	constrained := len(b.Tags) > 0 || b.GOOS != "" || b.GOARCH != ""
+	if fi, err := os.Stat(name); err == nil && !fi.IsDir() && constrained {
+		ok, err := b.matches(name)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("build constraints exclude %s", name)
+		}
+	}
 
 	pkgs, err := packages.Load(cfg, name)
 	if err != nil {
@@ -63,6 +148,20 @@ func File(name string, unexported bool, warnPkgMask string) (*FileSet, error) {
 	imps := make(map[string]*FileSet)
 
 	fs := packageToFileSet(one, imps, unexported)
+	fs.fset = cfg.Fset
+	if fs.PkgPath == "command-line-arguments" {
+		// go list names the package of files given by name
+		// after the command line; its path is that of the
+		// package of their directory
+		dir := &packages.Config{Mode: packages.NeedName, Dir: filepath.Dir(name)}
+		b.config(dir)
+		if dpkgs, err := packages.Load(dir, "."); err == nil && len(dpkgs) == 1 && dpkgs[0].Name == fs.Package {
+			fs.PkgPath = dpkgs[0].PkgPath
+		}
+	}
+	for _, ifs := range imps {
+		ifs.fset = cfg.Fset
+	}
 	for _, ifs := range imps {
 		ifs.process(warnPkgMask)
 		ifs.applyDirectives()
@@ -70,10 +169,82 @@ func File(name string, unexported bool, warnPkgMask string) (*FileSet, error) {
 	}
 	fs.process(warnPkgMask)
 	fs.applyDirectives()
+	fs.checkEmbedded()
 	fs.propInline()
 	return fs, nil
 }
 
+// Merge returns a FileSet holding the types of all of files,
+// which must be of the same package, so that their code can be
+// printed to one file, in the order of the type names. It is
+// an error for more than one of them to declare a type.
+func Merge(files ...*FileSet) (*FileSet, error) {
+	if len(files) == 0 {
+		return nil, errors.New("no files to merge")
+	}
+	m := &FileSet{
+		Package:    files[0].Package,
+		PkgPath:    files[0].PkgPath,
+		Specs:      make(map[string]ast.Expr),
+		Aliases:    make(map[string]ast.Expr),
+		Interfaces: make(map[string]ast.Expr),
+		Consts:     make(map[string]ast.Expr),
+		Identities: make(map[string]gen.Elem),
+		ImportSet:  make(ImportSet),
+		ImportName: make(map[string]string),
+		Unexported: files[0].Unexported,
+		Skipped:    make(map[string]string),
+	}
+	for _, f := range files {
+		if f.Package != m.Package {
+			return nil, fmt.Errorf("cannot merge package %s into package %s", f.Package, m.Package)
+		}
+		for name, el := range f.Identities {
+			if _, ok := m.Identities[name]; ok {
+				return nil, fmt.Errorf("type %s is declared in more than one file", name)
+			}
+			m.Identities[name] = el
+		}
+		for _, maps := range [][2]map[string]ast.Expr{
+			{m.Specs, f.Specs}, {m.Aliases, f.Aliases}, {m.Interfaces, f.Interfaces}, {m.Consts, f.Consts},
+		} {
+			for name, e := range maps[1] {
+				maps[0][name] = e
+			}
+		}
+		for name, ifs := range f.ImportSet {
+			m.ImportSet[name] = ifs
+		}
+		for name, path := range f.ImportName {
+			m.ImportName[name] = path
+		}
+		for name, reason := range f.Skipped {
+			m.Skipped[name] = reason
+		}
+		for name, ft := range f.funcs {
+			if m.funcs == nil {
+				m.funcs = make(map[string]*ast.FuncType)
+			}
+			m.funcs[name] = ft
+		}
+		for name, pos := range f.secure {
+			if m.secure == nil {
+				m.secure = make(map[string]token.Position)
+			}
+			m.secure[name] = pos
+		}
+		m.Directives = append(m.Directives, f.Directives...)
+		m.Imports = append(m.Imports, f.Imports...)
+		m.errs = append(m.errs, f.errs...)
+		m.declFiles = append(m.declFiles, f.declFiles...)
+	}
+	// a type skipped in one file may be declared in another
+	for name := range m.Identities {
+		delete(m.Skipped, name)
+	}
+	return m, nil
+}
+
 func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported bool) *FileSet {
 	fs := &FileSet{
 		Package:    p.Name,
@@ -85,6 +256,8 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 		Identities: make(map[string]gen.Elem),
 		ImportSet:  imps,
 		ImportName: make(map[string]string),
+		Unexported: unexported,
+		Skipped:    make(map[string]string),
 	}
 
 	for name, importpkg := range p.Imports {
@@ -99,9 +272,6 @@ func packageToFileSet(p *packages.Package, imps map[string]*FileSet, unexported
 	for _, fl := range p.Syntax {
 		pushstate(fl.Name.Name)
 		fs.Directives = append(fs.Directives, yieldComments(fl.Comments)...)
-		if !unexported {
-			ast.FileExports(fl)
-		}
 
 		for _, importspec := range fl.Imports {
 			pkgpath := importspec.Path.Value[1 : len(importspec.Path.Value)-1]
@@ -212,6 +382,7 @@ func (f *FileSet) process(warnPkgMask string) {
 		increasePrintLevel()
 		defer decreasePrintLevel()
 	}
+	f.instantiate()
 	deferred := make(linkset)
 parse:
 	for name, def := range f.Specs {
@@ -295,7 +466,11 @@ loop:
 func (f *FileSet) PrintTo(p *gen.Printer) error {
 	var msgs []string
 
+	if len(f.errs) > 0 {
+		return errors.Join(f.errs...)
+	}
 	f.applyDirs(p)
+	p.SetIdentities(f.Identities)
 	names := make([]string, 0, len(f.Identities))
 	for name := range f.Identities {
 		names = append(names, name)
@@ -303,9 +478,16 @@ func (f *FileSet) PrintTo(p *gen.Printer) error {
 	sort.Strings(names)
 	for _, name := range names {
 		el := f.Identities[name]
-		el.SetVarname("z")
+		if recv, _ := el.Receiver(); recv != "" {
+			el.SetVarname(recv)
+		} else {
+			el.SetVarname("z")
+		}
 		pushstate(el.TypeName())
 		m, err := p.Print(el)
+		for _, info := range p.Infos() {
+			infoln(info)
+		}
 		popstate()
 		if err != nil {
 			return err
@@ -321,6 +503,30 @@ func (f *FileSet) PrintTo(p *gen.Printer) error {
 	return nil
 }
 
+// A Decision records whether code is generated for
+// a type declaration, and if not, why not.
+type Decision struct {
+	Name     string
+	Generate bool
+	Reason   string // why the type is skipped
+}
+
+// Plan returns the decisions that PrintTo would make for
+// each type declared in f, sorted by type name, without
+// generating any code.
+func (f *FileSet) Plan() []Decision {
+	ds := make([]Decision, 0, len(f.Identities)+len(f.Skipped))
+	for name, el := range f.Identities {
+		reason := gen.SkipReason(el)
+		ds = append(ds, Decision{Name: name, Generate: reason == "", Reason: reason})
+	}
+	for name, reason := range f.Skipped {
+		ds = append(ds, Decision{Name: name, Reason: reason})
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i].Name < ds[j].Name })
+	return ds
+}
+
 // getTypeSpecs extracts all of the *ast.TypeSpecs in the file
 // into fs.Identities, but does not set the actual element
 func (fs *FileSet) getTypeSpecs(f *ast.File) {
@@ -328,11 +534,24 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 	// collect all imports...
 	fs.Imports = append(fs.Imports, f.Imports...)
 
+	decls := &ast.File{Name: f.Name}
+	fs.declFiles = append(fs.declFiles, decls)
+
 	// check all declarations...
 	for i := range f.Decls {
+		if fd, ok := f.Decls[i].(*ast.FuncDecl); ok && fd.Recv == nil {
+			if fs.funcs == nil {
+				fs.funcs = make(map[string]*ast.FuncType)
+			}
+			fs.funcs[fd.Name.Name] = fd.Type
+			continue
+		}
 
 		// for GenDecls...
 		if g, ok := f.Decls[i].(*ast.GenDecl); ok {
+			if g.Tok == token.TYPE || g.Tok == token.CONST {
+				decls.Decls = append(decls.Decls, g)
+			}
 
 			// and check the specs...
 			for _, s := range g.Specs {
@@ -340,6 +559,14 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 				// for ast.TypeSpecs....
 				switch s := s.(type) {
 				case *ast.TypeSpec:
+					if s.TypeParams != nil {
+						if fs.generics == nil {
+							fs.generics = make(map[string]*ast.TypeSpec)
+						}
+						fs.generics[s.Name.Name] = s
+						fs.Skipped[s.Name.Name] = "generic; see msgp:instantiate"
+						continue
+					}
 					switch s.Type.(type) {
 
 					// this is the list of parse-able
@@ -354,6 +581,12 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 						if strings.HasPrefix(s.Name.Name, "_Ctype_") || s.Name.Name == "_" {
 							continue
 						}
+						// unexported fields (such as _struct) and consts
+						// are kept either way, since exported types use them
+						if !fs.Unexported && !ast.IsExported(s.Name.Name) {
+							fs.Skipped[s.Name.Name] = "unexported"
+							continue
+						}
 
 						if s.Assign == 0 {
 							fs.Specs[s.Name.Name] = s.Type
@@ -362,6 +595,15 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 						}
 					case *ast.InterfaceType:
 						fs.Interfaces[s.Name.Name] = s.Type
+					case *ast.IndexExpr, *ast.IndexListExpr:
+						if s.Assign != 0 || (!fs.Unexported && !ast.IsExported(s.Name.Name)) {
+							continue
+						}
+						if fs.instances == nil {
+							fs.instances = make(map[string]ast.Expr)
+						}
+						fs.instances[s.Name.Name] = s.Type
+						fs.Skipped[s.Name.Name] = "instantiation of a generic type; see msgp:instantiate"
 					}
 
 				case *ast.ValueSpec:
@@ -374,6 +616,38 @@ func (fs *FileSet) getTypeSpecs(f *ast.File) {
 	}
 }
 
+// typedConsts returns the consts of the named type, in the
+// order in which they are declared. Only the type and const
+// declarations of the package are type checked, since the
+// package may not compile before its code is generated, so
+// consts that depend on anything else, such as the consts
+// of other packages, are left out.
+func (fs *FileSet) typedConsts(name string) []*types.Const {
+	info := &types.Info{Defs: make(map[*ast.Ident]types.Object)}
+	conf := types.Config{Error: func(error) {}}
+	conf.Check(fs.PkgPath, token.NewFileSet(), fs.declFiles, info)
+
+	var consts []*types.Const
+	for _, fl := range fs.declFiles {
+		for _, decl := range fl.Decls {
+			if g := decl.(*ast.GenDecl); g.Tok == token.CONST {
+				for _, spec := range g.Specs {
+					for _, id := range spec.(*ast.ValueSpec).Names {
+						c, ok := info.Defs[id].(*types.Const)
+						if !ok {
+							continue
+						}
+						if named, ok := c.Type().(*types.Named); ok && named.Obj().Name() == name {
+							consts = append(consts, c)
+						}
+					}
+				}
+			}
+		}
+	}
+	return consts
+}
+
 func fieldName(f *ast.Field) string {
 	switch len(f.Names) {
 	case 0:
@@ -393,6 +667,19 @@ func (fs *FileSet) parseFieldList(importPrefix string, fl *ast.FieldList) []gen.
 	for _, field := range fl.List {
 		pushstate(fieldName(field))
 		fds := fs.getField(importPrefix, field)
+		for i := range fds {
+			// fields flattened from an embedded struct
+			// are where that struct declares them
+			if !fds[i].Pos.IsValid() {
+				fds[i].Pos = fs.fset.Position(field.Pos())
+			}
+		}
+		if len(field.Names) == 0 && len(fds) == 1 && fs.isInterface(field.Type) {
+			if fs.embedded == nil {
+				fs.embedded = make(map[token.Position]string)
+			}
+			fs.embedded[fds[0].Pos] = stringify(field.Type)
+		}
 		if len(fds) > 0 {
 			out = append(out, fds...)
 		} else {
@@ -403,6 +690,284 @@ func (fs *FileSet) parseFieldList(importPrefix string, fl *ast.FieldList) []gen.
 	return out
 }
 
+// isInterface returns whether e names an interface type
+// declared in the package of fs, or in one it imports.
+func (fs *FileSet) isInterface(e ast.Expr) bool {
+	switch e := e.(type) {
+	case *ast.Ident:
+		_, ok := fs.Interfaces[e.Name]
+		return ok
+	case *ast.SelectorExpr:
+		if x, ok := e.X.(*ast.Ident); ok {
+			if pkg := fs.ImportSet[fs.ImportName[x.Name]]; pkg != nil {
+				_, ok := pkg.Interfaces[e.Sel.Name]
+				return ok
+			}
+		}
+	}
+	return false
+}
+
+// checkEmbedded reports the embedded interface fields that
+// no msgp:shim or msgp:iface directive says how to encode,
+// since the generated code can't compile otherwise. A field
+// tagged codec:"-" is left out, and so isn't reported.
+func (fs *FileSet) checkEmbedded() {
+	if len(fs.embedded) == 0 {
+		return
+	}
+	names := make([]string, 0, len(fs.Identities))
+	for name := range fs.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		st, ok := fs.Identities[name].(*gen.Struct)
+		if !ok {
+			continue
+		}
+		for _, sf := range st.Fields {
+			typ, ok := fs.embedded[sf.Pos]
+			if be, isBase := sf.FieldElem.(*gen.BaseElem); !ok || !isBase || be.Value != gen.IDENT || be.ShimToBase != "" {
+				continue
+			}
+			err := fmt.Errorf("%s: %s embeds the interface %s, which can't be encoded; tag it `codec:\"-\"` to leave it out, or say how to encode it with msgp:shim or msgp:iface", sf.Pos, name, typ)
+			warnln(err.Error())
+			fs.errs = append(fs.errs, err)
+		}
+	}
+}
+
+// ignoredFields returns the names of the fields in fl
+// that are tagged codec:"-", which getField leaves out,
+// including those of the structs it embeds, whose fields
+// it flattens, as paths like "Embedded.Name"
+func (fs *FileSet) ignoredFields(fl *ast.FieldList) []string {
+	var names []string
+	for _, f := range fl.List {
+		var tag string
+		if f.Tag != nil {
+			body, _ := reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Lookup("codec")
+			tag, _, _ = strings.Cut(body, ",")
+		}
+		if tag != "-" {
+			if len(f.Names) > 0 {
+				continue
+			}
+			if efs, st := fs.embeddedStruct(f.Type); st != nil {
+				for _, nm := range efs.ignoredFields(st.Fields) {
+					names = append(names, embedded(f.Type)+"."+nm)
+				}
+			}
+			continue
+		}
+		for _, nm := range f.Names {
+			names = append(names, nm.Name)
+		}
+		if len(f.Names) == 0 {
+			names = append(names, embedded(f.Type))
+		}
+	}
+	return names
+}
+
+// embeddedStruct returns the struct type of an embedded
+// field of type f, which getFieldsFromEmbeddedStruct
+// flattens, and the FileSet that declares it
+func (fs *FileSet) embeddedStruct(f ast.Expr) (*FileSet, *ast.StructType) {
+	switch f := f.(type) {
+	case *ast.Ident:
+		s, ok := fs.Specs[f.Name]
+		if !ok {
+			s = fs.Aliases[f.Name]
+		}
+		st, _ := s.(*ast.StructType)
+		return fs, st
+	case *ast.SelectorExpr:
+		pkgid, ok := f.X.(*ast.Ident)
+		if !ok {
+			return nil, nil
+		}
+		pkgfs, ok := fs.ImportSet[fs.ImportName[pkgid.Name]]
+		if !ok {
+			return nil, nil
+		}
+		return pkgfs.embeddedStruct(f.Sel)
+	}
+	return nil, nil
+}
+
+// tagOptions are the codec tag options that are
+// not key=value pairs
+var tagOptions = map[string]bool{
+	"omitempty":      true,
+	"omitemptyarray": true,
+	"omitzero":       true,
+	"extension":      true,
+	"utf8":           true,
+	"sortslice":      true,
+}
+
+// isBoundExpr returns whether a codec tag part continues
+// a list of allocbounds: a number, "-", or a (possibly
+// package-qualified) constant name that is not a tag option.
+func isBoundExpr(tag string) bool {
+	if tag == "-" {
+		return true
+	}
+	if tag == "" || tagOptions[tag] {
+		return false
+	}
+	for _, part := range strings.Split(tag, ".") {
+		if part == "" {
+			return false
+		}
+		for _, r := range part {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// setTimeForm applies the time= tag option to the
+// time.Time of a field, or of the values of a field
+// of pointers, slices, arrays or maps of them.
+func setTimeForm(e gen.Elem, form string) bool {
+	return setBase(e, func(b *gen.BaseElem) bool { return b.SetTimeForm(form) })
+}
+
+// setComplexForm applies the complex= tag option
+// to a field, as setTimeForm does the time= option.
+func setComplexForm(e gen.Elem, form string) bool {
+	return setBase(e, func(b *gen.BaseElem) bool { return b.SetComplexForm(form) })
+}
+
+// setIntForm applies the int= tag option
+// to a field, as setTimeForm does the time= option.
+func setIntForm(e gen.Elem, form string) bool {
+	return setBase(e, func(b *gen.BaseElem) bool { return b.SetIntForm(form) })
+}
+
+// setUTF8 applies the utf8 tag option
+// to a field, as setTimeForm does the time= option.
+func setUTF8(e gen.Elem) bool {
+	return setBase(e, func(b *gen.BaseElem) bool { return b.SetUTF8() })
+}
+
+// setBase calls set on the BaseElem that e is, or
+// that its pointers, slices, arrays or maps hold.
+func setBase(e gen.Elem, set func(*gen.BaseElem) bool) bool {
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		return set(e)
+	case *gen.Ptr:
+		return setBase(e.Value, set)
+	case *gen.Slice:
+		return setBase(e.Els, set)
+	case *gen.Array:
+		return setBase(e.Els, set)
+	case *gen.Map:
+		return setBase(e.Value, set)
+	default:
+		return false
+	}
+}
+
+// SetNilPolicy sets the policy for encoding nil slices, maps
+// and []byte, gen.NilDistinguish or gen.NilCollapse, of e and
+// of the elements nested in it that have none yet, and
+// returns false if the policy is unknown. This is how the
+// nil= tag option applies to a field; the generator's
+// -nil-policy flag applies it to every type in a FileSet.
+func SetNilPolicy(e gen.Elem, policy string) bool {
+	if policy != gen.NilDistinguish && policy != gen.NilCollapse {
+		return false
+	}
+	if e.NilPolicy() == "" {
+		e.SetNilPolicy(policy)
+	}
+	switch e := e.(type) {
+	case *gen.Ptr:
+		SetNilPolicy(e.Value, policy)
+	case *gen.Slice:
+		SetNilPolicy(e.Els, policy)
+	case *gen.Array:
+		SetNilPolicy(e.Els, policy)
+	case *gen.Map:
+		SetNilPolicy(e.Value, policy)
+	case *gen.Struct:
+		for i := range e.Fields {
+			SetNilPolicy(e.Fields[i].FieldElem, policy)
+		}
+	}
+	return true
+}
+
+// SetNilPolicy applies SetNilPolicy to the types in fs.
+func (fs *FileSet) SetNilPolicy(policy string) error {
+	if policy != gen.NilDistinguish && policy != gen.NilCollapse {
+		return fmt.Errorf("unknown nil policy %q; want %s or %s", policy, gen.NilDistinguish, gen.NilCollapse)
+	}
+	for _, el := range fs.Identities {
+		SetNilPolicy(el, policy)
+	}
+	return nil
+}
+
+// Only keeps in fs.Identities just the types named, and the
+// ones they use, directly or not, so that no methods are
+// generated for the others, which are recorded in fs.Skipped.
+func (fs *FileSet) Only(names []string) error {
+	keep := make(map[string]bool)
+	var use func(e gen.Elem)
+	use = func(e gen.Elem) {
+		switch e := e.(type) {
+		case *gen.BaseElem:
+			name := e.TypeName()
+			if el, ok := fs.Identities[name]; ok && e.Value == gen.IDENT && !keep[name] {
+				keep[name] = true
+				use(el)
+			}
+		case *gen.Struct:
+			for i := range e.Fields {
+				use(e.Fields[i].FieldElem)
+			}
+		case *gen.Ptr:
+			use(e.Value)
+		case *gen.Slice:
+			use(e.Els)
+		case *gen.Array:
+			use(e.Els)
+		case *gen.Map:
+			use(e.Key)
+			use(e.Value)
+		}
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		el, ok := fs.Identities[name]
+		if !ok {
+			if reason, skipped := fs.Skipped[name]; skipped {
+				return fmt.Errorf("type %s is not generated: %s", name, reason)
+			}
+			return fmt.Errorf("no type %s to generate", name)
+		}
+		if !keep[name] {
+			keep[name] = true
+			use(el)
+		}
+	}
+	for name := range fs.Identities {
+		if !keep[name] {
+			delete(fs.Identities, name)
+			fs.Skipped[name] = "not in -types"
+		}
+	}
+	return nil
+}
+
 // translate *ast.Field into []gen.StructField
 func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField {
 	sf := make([]gen.StructField, 1)
@@ -410,8 +975,15 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 	var allocbound string
 	var allocbounds []string
 	var maxtotalbytes string
-
-	// always flatten embedded structs
+	var timeForm string
+	var complexForm string
+	var intForm string
+	var nilPolicy string
+	var utf8 bool
+	var sortSlice bool
+
+	// always flatten embedded structs, as encoding/json
+	// does; the generator rejects keys that collide
 	flatten = true
 
 	// parse tag; otherwise field name is field tag
@@ -419,16 +991,44 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 		var body string
 		body, sf[0].HasCodecTag = reflect.StructTag(strings.Trim(f.Tag.Value, "`")).Lookup("codec")
 		tags := strings.Split(body, ",")
+		inBounds := false
 		for _, tag := range tags[1:] {
 			if tag == "extension" {
 				extension = true
 			}
+			if tag == "utf8" {
+				utf8 = true
+			}
+			if tag == "sortslice" {
+				sortSlice = true
+			}
+			// "allocbound=1024,64" bounds nested dimensions: 1024
+			// for the outer slice and 64 for each inner one. This
+			// is the same as "allocbound=1024,allocbound=64".
+			if inBounds && isBoundExpr(tag) {
+				allocbounds = append(allocbounds, tag)
+				continue
+			}
+			inBounds = false
 			if strings.HasPrefix(tag, "allocbound=") {
 				allocbounds = append(allocbounds, strings.Split(tag, "=")[1])
+				inBounds = true
 			}
 			if strings.HasPrefix(tag, "maxtotalbytes=") {
 				maxtotalbytes = strings.Split(tag, "=")[1]
 			}
+			if strings.HasPrefix(tag, "time=") {
+				timeForm = strings.Split(tag, "=")[1]
+			}
+			if strings.HasPrefix(tag, "complex=") {
+				complexForm = strings.Split(tag, "=")[1]
+			}
+			if strings.HasPrefix(tag, "int=") {
+				intForm = strings.Split(tag, "=")[1]
+			}
+			if strings.HasPrefix(tag, "nil=") {
+				nilPolicy = strings.Split(tag, "=")[1]
+			}
 		}
 		// ignore "-" fields
 		if tags[0] == "-" {
@@ -512,6 +1112,28 @@ func (fs *FileSet) getField(importPrefix string, f *ast.Field) []gen.StructField
 	}
 	sf[0].FieldElem.SetAllocBound(allocbound)
 	sf[0].FieldElem.SetMaxTotalBytes(maxtotalbytes)
+	if timeForm != "" && !setTimeForm(sf[0].FieldElem, timeForm) {
+		warnf("%s: ignoring time=%s; it applies to time.Time fields, as unixsec, unixnano, rfc3339 or timestamp\n", sf[0].FieldName, timeForm)
+	}
+	if complexForm != "" && !setComplexForm(sf[0].FieldElem, complexForm) {
+		warnf("%s: ignoring complex=%s; it applies to complex64 and complex128 fields, as array\n", sf[0].FieldName, complexForm)
+	}
+	if intForm != "" && !setIntForm(sf[0].FieldElem, intForm) {
+		warnf("%s: ignoring int=%s; it applies to integer fields, as fixed8, fixed16, fixed32 or fixed64, at least as wide as the integer\n", sf[0].FieldName, intForm)
+	}
+	if utf8 && !setUTF8(sf[0].FieldElem) {
+		warnf("%s: ignoring utf8; it applies to string fields\n", sf[0].FieldName)
+	}
+	if sortSlice {
+		if sl, ok := sf[0].FieldElem.(*gen.Slice); ok {
+			sl.SetSortSlice()
+		} else {
+			warnf("%s: ignoring sortslice; it applies to slice fields\n", sf[0].FieldName)
+		}
+	}
+	if nilPolicy != "" && !SetNilPolicy(sf[0].FieldElem, nilPolicy) {
+		warnf("%s: ignoring nil=%s; it is %s or %s\n", sf[0].FieldName, nilPolicy, gen.NilDistinguish, gen.NilCollapse)
+	}
 
 	// validate extension
 	if extension {
@@ -659,9 +1281,9 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 
 	case *ast.ArrayType:
 
-		// special case for []byte
+		// special case for []byte, which is []uint8
 		if e.Len == nil {
-			if i, ok := e.Elt.(*ast.Ident); ok && i.Name == "byte" {
+			if i, ok := e.Elt.(*ast.Ident); ok && (i.Name == "byte" || i.Name == "uint8") {
 				return &gen.BaseElem{Value: gen.Bytes}
 			}
 		}
@@ -735,7 +1357,7 @@ func (fs *FileSet) parseExpr(importPrefix string, e ast.Expr) gen.Elem {
 		return nil
 
 	case *ast.StructType:
-		return &gen.Struct{Fields: fs.parseFieldList(importPrefix, e.Fields)}
+		return &gen.Struct{Fields: fs.parseFieldList(importPrefix, e.Fields), Ignored: fs.ignoredFields(e.Fields)}
 
 	case *ast.SelectorExpr:
 		return gen.Ident("", stringify(e))
@@ -0,0 +1,1386 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/algorand/msgp/gen"
+)
+
+func TestAllocBoundList(t *testing.T) {
+	for tag, want := range map[string]string{
+		`codec:"a,allocbound=16"`:                      "16",
+		`codec:"a,allocbound=16,8"`:                    "16,8",
+		`codec:"a,allocbound=16,allocbound=8"`:         "16,8",
+		`codec:"a,allocbound=maxTxns,pkg.MaxLen,-"`:    "maxTxns,pkg.MaxLen,-",
+		`codec:"a,allocbound=16,8,omitempty"`:          "16,8",
+		`codec:"a,omitempty,allocbound=16,omitzero,8"`: "16",
+	} {
+		expr, err := parser.ParseExpr("struct{ A [][][]byte `" + tag + "` }")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", tag, len(sf))
+		}
+		if got := sf[0].FieldElem.AllocBound(); got != want {
+			t.Errorf("%s: allocbound %q; want %q", tag, got, want)
+		}
+	}
+}
+
+func TestTimeForm(t *testing.T) {
+	for src, want := range map[string]string{
+		"struct{ A time.Time `codec:\"a,time=unixsec\"` }":                 "unixsec",
+		"struct{ A *time.Time `codec:\"a,omitempty,time=rfc3339\"` }":      "rfc3339",
+		"struct{ A []time.Time `codec:\"a,allocbound=4,time=unixnano\"` }": "unixnano",
+		"struct{ A time.Time `codec:\"a,time=timestamp\"` }":               "timestamp",
+		"struct{ A time.Time `codec:\"a,time=julian\"` }":                  "",
+		"struct{ A time.Time `codec:\"a\"` }":                              "",
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", src, len(sf))
+		}
+		e := sf[0].FieldElem
+		switch el := e.(type) {
+		case *gen.Ptr:
+			e = el.Value
+		case *gen.Slice:
+			e = el.Els
+		}
+		if got := e.(*gen.BaseElem).TimeForm; got != want {
+			t.Errorf("%s: time form %q; want %q", src, got, want)
+		}
+	}
+}
+
+func TestComplexForm(t *testing.T) {
+	for src, want := range map[string]string{
+		"struct{ A complex128 `codec:\"a,complex=array\"` }":               "array",
+		"struct{ A []complex64 `codec:\"a,allocbound=4,complex=array\"` }": "array",
+		"struct{ A complex64 `codec:\"a,complex=pair\"` }":                 "",
+		"struct{ A complex128 `codec:\"a\"` }":                             "",
+		"struct{ A float64 `codec:\"a,complex=array\"` }":                  "",
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", src, len(sf))
+		}
+		e := sf[0].FieldElem
+		if s, ok := e.(*gen.Slice); ok {
+			e = s.Els
+		}
+		if got := e.(*gen.BaseElem).ComplexForm; got != want {
+			t.Errorf("%s: complex form %q; want %q", src, got, want)
+		}
+	}
+}
+
+func TestIntForm(t *testing.T) {
+	for src, want := range map[string]int{
+		"struct{ A int8 `codec:\"a,int=fixed32\"` }":                  32,
+		"struct{ A []uint64 `codec:\"a,allocbound=4,int=fixed64\"` }": 64,
+		"struct{ A int64 `codec:\"a,int=fixed32\"` }":                 0,
+		"struct{ A uint16 `codec:\"a,int=compact\"` }":                0,
+		"struct{ A string `codec:\"a,int=fixed8\"` }":                 0,
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", src, len(sf))
+		}
+		e := sf[0].FieldElem
+		if s, ok := e.(*gen.Slice); ok {
+			e = s.Els
+		}
+		if got := e.(*gen.BaseElem).FixedInt; got != want {
+			t.Errorf("%s: fixed width %d; want %d", src, got, want)
+		}
+	}
+}
+
+func TestUTF8Option(t *testing.T) {
+	for src, want := range map[string]bool{
+		"struct{ A string `codec:\"a,utf8\"` }":                true,
+		"struct{ A []string `codec:\"a,allocbound=4,utf8\"` }": true,
+		"struct{ A string `codec:\"a,allocbound=16\"` }":       false,
+		"struct{ A []byte `codec:\"a,utf8\"` }":                false,
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", src, len(sf))
+		}
+		e := sf[0].FieldElem
+		if s, ok := e.(*gen.Slice); ok {
+			e = s.Els
+		}
+		if got := e.(*gen.BaseElem).UTF8; got != want {
+			t.Errorf("%s: utf8 %v; want %v", src, got, want)
+		}
+		// "allocbound=4,utf8" doesn't take utf8 for a bound
+		if ab := e.AllocBound() + sf[0].FieldElem.AllocBound(); strings.Contains(ab, "utf8") {
+			t.Errorf("%s: allocbound %q", src, ab)
+		}
+	}
+}
+
+func TestRuneByte(t *testing.T) {
+	for src, want := range map[string]string{
+		"rune":     "Int32",
+		"byte":     "Byte",
+		"uint8":    "Uint8",
+		"[]byte":   "Bytes",
+		"[]uint8":  "Bytes",
+		"[]rune":   "[]Int32",
+		"[]int32":  "[]Int32",
+		"[4]byte":  "[4]Byte",
+		"[4]rune":  "[4]Int32",
+		"[][]byte": "[]Bytes",
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		var got string
+		switch e := fs.parseExpr("", expr).(type) {
+		case *gen.BaseElem:
+			got = e.Value.String()
+		case *gen.Slice:
+			got = "[]" + e.Els.(*gen.BaseElem).Value.String()
+		case *gen.Array:
+			got = "[" + e.Size + "]" + e.Els.(*gen.BaseElem).Value.String()
+		}
+		if got != want {
+			t.Errorf("%s: parsed as %s; want %s", src, got, want)
+		}
+	}
+}
+
+func TestSortSliceOption(t *testing.T) {
+	for src, want := range map[string]bool{
+		"struct{ A []string `codec:\"a,allocbound=4,sortslice\"` }": true,
+		"struct{ A []uint64 `codec:\"a,sortslice,allocbound=4\"` }": true,
+		"struct{ A []string `codec:\"a,allocbound=4\"` }":           false,
+		"struct{ A string `codec:\"a,sortslice\"` }":                false,
+	} {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fs FileSet
+		sf := fs.getField("", expr.(*ast.StructType).Fields.List[0])
+		if len(sf) != 1 {
+			t.Fatalf("%s: got %d fields", src, len(sf))
+		}
+		s, ok := sf[0].FieldElem.(*gen.Slice)
+		if got := ok && s.SortSlice; got != want {
+			t.Errorf("%s: sortslice %v; want %v", src, got, want)
+		}
+		if ab := sf[0].FieldElem.AllocBound(); strings.Contains(ab, "sortslice") {
+			t.Errorf("%s: allocbound %q", src, ab)
+		}
+	}
+}
+
+func TestFileUnexported(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"type E struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tX int64 `codec:\"x\"`\n}\n\n" +
+		"type e struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tX int64 `codec:\"x\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, unexported := range []bool{false, true} {
+		fs, err := File(file, unexported, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := fs.Identities["e"]; ok != unexported {
+			t.Errorf("unexported=%v: unexported type included: %v", unexported, ok)
+		}
+		st, ok := fs.Identities["E"].(*gen.Struct)
+		if !ok {
+			t.Fatalf("unexported=%v: exported struct missing", unexported)
+		}
+		if len(st.Fields) == 0 || st.Fields[0].FieldName != "_struct" {
+			t.Errorf("unexported=%v: _struct annotation dropped", unexported)
+		}
+	}
+}
+
+func TestTextDirective(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"//msgp:text U\n\n" +
+		"type U [16]byte\n\n" +
+		"type S struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tID U `codec:\"id,allocbound=32\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Identities["U"]; ok {
+		t.Error("methods would be generated for a text type")
+	}
+	st := fs.Identities["S"].(*gen.Struct)
+	be, ok := st.Fields[1].FieldElem.(*gen.BaseElem)
+	if !ok || be.Value != gen.Text {
+		t.Fatalf("field is not encoded as text: %#v", st.Fields[1].FieldElem)
+	}
+	if be.AllocBound() != "32" {
+		t.Errorf("allocbound %q; want %q", be.AllocBound(), "32")
+	}
+}
+
+func TestIfaceDirective(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"//msgp:iface Shape\n\n" +
+		"type Shape interface {\n\tArea() float64\n}\n\n" +
+		"type S struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tMain Shape `codec:\"main\"`\n" +
+		"\tAll []Shape `codec:\"all,allocbound=8\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fs.Identities["Shape"]; ok {
+		t.Error("methods would be generated for an interface type")
+	}
+	st := fs.Identities["S"].(*gen.Struct)
+	if be, ok := st.Fields[1].FieldElem.(*gen.BaseElem); !ok || be.Value != gen.Iface || be.TypeName() != "Shape" {
+		t.Errorf("field is not encoded as an interface: %#v", st.Fields[1].FieldElem)
+	}
+	sl, ok := st.Fields[2].FieldElem.(*gen.Slice)
+	if !ok {
+		t.Fatalf("slice field is %#v", st.Fields[2].FieldElem)
+	}
+	if be, ok := sl.Els.(*gen.BaseElem); !ok || be.Value != gen.Iface {
+		t.Errorf("slice elements are not encoded as interfaces: %#v", sl.Els)
+	}
+	if sl.AllocBound() != "8" {
+		t.Errorf("allocbound %q; want %q", sl.AllocBound(), "8")
+	}
+}
+
+func TestIgnoredFields(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\nimport \"sync\"\n\n" +
+		"type G struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tMu sync.Mutex `codec:\"-\"`\n" +
+		"\tCache map[string]func() `codec:\"-,omitempty\"`\n" +
+		"\tN int64 `codec:\"n\"`\n" +
+		// flattened along with the field it ignores
+		"\tLocked\n}\n\n" +
+		"type Locked struct {\n" +
+		"\tMu sync.Mutex `codec:\"-\"`\n" +
+		"\tL int64 `codec:\"l\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fs.Identities["G"].(*gen.Struct)
+	var names []string
+	for _, f := range st.Fields {
+		names = append(names, f.FieldName)
+	}
+	if !reflect.DeepEqual(names, []string{"_struct", "N", "L"}) {
+		t.Errorf("fields %q", names)
+	}
+	if !reflect.DeepEqual(st.Ignored, []string{"Mu", "Cache", "Locked.Mu"}) {
+		t.Errorf("ignored fields %q", st.Ignored)
+	}
+}
+
+func TestNilPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"type N struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tD [][]byte `codec:\"d,allocbound=4,allocbound=4\"`\n" +
+		"\tK [][]byte `codec:\"k,allocbound=4,allocbound=4,nil=distinguish\"`\n" +
+		"\tC map[string][]byte `codec:\"c,allocbound=4,nil=collapse\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SetNilPolicy("never"); err == nil {
+		t.Error("set an unknown nil policy")
+	}
+	if err := fs.SetNilPolicy(gen.NilCollapse); err != nil {
+		t.Fatal(err)
+	}
+	st := fs.Identities["N"].(*gen.Struct)
+	// the tag option applies to the values nested in a
+	// field, and wins over the package's policy
+	for _, f := range st.Fields[1:] {
+		want := gen.NilCollapse
+		if f.FieldName == "K" {
+			want = gen.NilDistinguish
+		}
+		var nested gen.Elem
+		switch e := f.FieldElem.(type) {
+		case *gen.Slice:
+			nested = e.Els
+		case *gen.Map:
+			nested = e.Value
+		}
+		if f.FieldElem.NilPolicy() != want || nested.NilPolicy() != want {
+			t.Errorf("%s: nil policy %q, %q; want %q", f.FieldName, f.FieldElem.NilPolicy(), nested.NilPolicy(), want)
+		}
+	}
+}
+
+func TestPlan(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"//msgp:ignore I\n" +
+		"//msgp:text U\n\n" +
+		"type E struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tX int64 `codec:\"x\"`\n}\n\n" +
+		"type I struct {\n" +
+		"\tX int64 `codec:\"x\"`\n}\n\n" +
+		"type N struct {\n" +
+		"\tX int64\n}\n\n" +
+		"type U [16]byte\n\n" +
+		"type e struct {\n" +
+		"\tX int64 `codec:\"x\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, false, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Decision{
+		{Name: "E", Generate: true},
+		{Name: "I", Reason: "msgp:ignore"},
+		{Name: "N", Reason: "no codec tags"},
+		{Name: "U", Reason: "msgp:text"},
+		{Name: "e", Reason: "unexported"},
+	}
+	if got := fs.Plan(); !reflect.DeepEqual(got, want) {
+		t.Errorf("plan %v; want %v", got, want)
+	}
+}
+
+func TestReplaceDirective(t *testing.T) {
+	// os.FileMode is an alias of fs.FileMode
+	src := "package foo\n\n" +
+		"import \"os\"\n\n" +
+		"//msgp:replace os.FileMode with %s\n\n" +
+		"type Mode uint32\n\n" +
+		"type S struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tM os.FileMode `codec:\"m\"`\n" +
+		"\tP *os.FileMode `codec:\"p\"`\n}\n"
+
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(fmt.Sprintf(src, "Mode")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := fs.Identities["S"].(*gen.Struct)
+	be, ok := st.Fields[1].FieldElem.(*gen.BaseElem)
+	if !ok || be.Replacement != "Mode" || be.TypeName() != "os.FileMode" {
+		t.Errorf("field not replaced: %#v", st.Fields[1].FieldElem)
+	}
+	ptr, ok := st.Fields[2].FieldElem.(*gen.Ptr)
+	if !ok {
+		t.Fatalf("pointer field is %#v", st.Fields[2].FieldElem)
+	}
+	if be, ok := ptr.Value.(*gen.BaseElem); !ok || be.Replacement != "Mode" {
+		t.Errorf("pointed-to value not replaced: %#v", ptr.Value)
+	}
+	if _, ok := fs.Identities["os.FileMode"]; ok {
+		t.Error("methods would be generated for the replaced type")
+	}
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, io.Discard, nil)); err != nil {
+		t.Error(err)
+	}
+
+	// the replacement must have methods
+	if err := os.WriteFile(file, []byte(fmt.Sprintf(src, "Missing")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err = File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, io.Discard, nil)); err == nil {
+		t.Error("replaced a type with one without methods")
+	}
+}
+
+func TestTupleDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:tuple T\n\n" +
+		"type Common struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tID uint64 `codec:\"id\"`\n}\n\n" +
+		"type T struct {\n" +
+		"\t_struct struct{} `codec:\"%s\"`\n" +
+		"\tA int64 `codec:\"a\"`\n" +
+		"\tCommon\n" +
+		"\tb int64\n" +
+		"\tC string `codec:\"c%s\"`\n}\n"
+	write := func(structOpts, fieldOpts string) *FileSet {
+		t.Helper()
+		file := filepath.Join(t.TempDir(), "foo.go")
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(src, structOpts, fieldOpts)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+
+	fs := write("", "")
+	st := fs.Identities["T"].(*gen.Struct)
+	if !st.AsTuple {
+		t.Fatal("struct is not a tuple")
+	}
+	var names []string
+	for _, sf := range st.Fields {
+		names = append(names, sf.FieldName)
+	}
+	if want := []string{"A", "ID", "C"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("tuple fields %v; want %v", names, want)
+	}
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size, &gen.Topics{}, io.Discard, nil)); err != nil {
+		t.Error(err)
+	}
+
+	// fields can't be omitted from a tuple
+	for _, opts := range [][2]string{{",omitempty", ""}, {"", ",omitempty"}, {"", ",omitzero"}} {
+		fs := write(opts[0], opts[1])
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, io.Discard, nil)); err == nil {
+			t.Errorf("tuple with %q and %q options", opts[0], opts[1])
+		}
+	}
+}
+
+func TestReceiverDirective(t *testing.T) {
+	write := func(directive string) *FileSet {
+		t.Helper()
+		src := "package foo\n\n" + directive + "\n\n" +
+			"type T struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tA int64 `codec:\"a\"`\n}\n"
+		file := filepath.Join(t.TempDir(), "foo.go")
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return fs
+	}
+
+	fs := write("//msgp:receiver T name=h pointer")
+	if name, typ := fs.Identities["T"].Receiver(); name != "h" || typ != "pointer" {
+		t.Errorf("receiver %q, %q; want \"h\", \"pointer\"", name, typ)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Size, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"func (h *T) MarshalMsg(", "func (h *T) Msgsize("} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q in:\n%s", want, buf.String())
+		}
+	}
+
+	for _, bad := range []string{"name=o", "name=err", "name=za0001", "name=len", "name=T", "name=1h", "by=value"} {
+		fs := write("//msgp:receiver T " + bad)
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, io.Discard, nil)); err == nil {
+			t.Errorf("receiver with %s", bad)
+		}
+	}
+}
+
+func TestBuildFile(t *testing.T) {
+	for _, c := range []struct {
+		b    Build
+		want []string
+	}{
+		{Build{GOOS: "linux"}, []string{"Linux"}},
+		{Build{GOOS: "windows", GOARCH: "arm64"}, []string{"Windows"}},
+		{Build{GOOS: "windows", Tags: []string{"msgp_extra"}}, []string{"Extra", "Windows"}},
+	} {
+		fs, err := BuildFile("./testdata/build", true, "", c.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for name := range fs.Identities {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%+v: types %v; want %v", c.b, got, c.want)
+		}
+	}
+
+	// a file named on its own is checked as well
+	if _, err := BuildFile("./testdata/build/linux.go", true, "", Build{GOOS: "windows"}); err == nil {
+		t.Error("parsed a linux file for windows")
+	}
+	if _, err := BuildFile("./testdata/build/linux.go", true, "", Build{GOOS: "linux"}); err != nil {
+		t.Error(err)
+	}
+	// but only under constraints that are set
+	if _, err := BuildFile("./testdata/build/extra.go", true, "", Build{}); err != nil {
+		t.Errorf("no constraints: %v", err)
+	}
+}
+
+func TestNamedPrimitives(t *testing.T) {
+	src := "package foo\n\n" +
+		"type MyID uint64\n\n" +
+		"type Name string\n\n" +
+		"type Hash [20]byte\n\n" +
+		"type T struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tI MyID `codec:\"i\"`\n" +
+		"\tN Name `codec:\"n\"`\n" +
+		"\tH Hash `codec:\"h\"`\n" +
+		"\tM map[Name]MyID `codec:\"m,allocbound=4\"`\n" +
+		"\tU uint64 `codec:\"u\"`\n" +
+		"\tS string `codec:\"s\"`\n" +
+		"\tA [20]byte `codec:\"a\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each named field is encoded as the field of
+	// its underlying type is, through a conversion
+	fields := make(map[string]gen.Elem)
+	for _, sf := range fs.Identities["T"].(*gen.Struct).Fields {
+		fields[sf.FieldName] = sf.FieldElem
+	}
+	for named, plain := range map[string]string{"I": "U", "N": "S"} {
+		n, p := fields[named].(*gen.BaseElem), fields[plain].(*gen.BaseElem)
+		if n.Value != p.Value || !n.Convert || n.TypeName() == p.TypeName() {
+			t.Errorf("%s is a %s %s; %s is a %s", named, n.TypeName(), n.BaseType(), plain, p.BaseType())
+		}
+	}
+	h, ok := fields["H"].(*gen.Array)
+	if !ok || h.Size != fields["A"].(*gen.Array).Size || h.Els.TypeName() != "byte" {
+		t.Errorf("H is a %T", fields["H"])
+	}
+	if k := fields["M"].(*gen.Map).Key.(*gen.BaseElem); k.Value != gen.String || k.TypeName() != "Name" {
+		t.Errorf("map key is a %s %s", k.TypeName(), k.BaseType())
+	}
+
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size|gen.Equal, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"msgp.AppendUint64(o, uint64((*z).I))",
+		"msgp.AppendUint64(o, (*z).U)",
+		"(*z).I = MyID(",
+		"msgp.AppendString(o, string((*z).N))",
+		"(*z).N = Name(",
+		"msgp.AppendBytes(o, ((*z).H)[:])",
+		"msgp.AppendBytes(o, ((*z).A)[:])",
+		"msgp.AppendUint64(o, uint64(z))",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q in:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "unsafe") {
+		t.Errorf("unsafe conversion in:\n%s", buf.String())
+	}
+}
+
+func TestEnumDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:enum State\n" +
+		"//msgp:enum Level tolerant\n" +
+		"//msgp:enum Label\n\n" +
+		"type State uint8\n\n" +
+		"const (\n\tStateIdle State = iota\n\tStateRunning\n\tStateDone\n\tStateDefault = StateIdle\n)\n\n" +
+		"type Level int32\n\n" +
+		"const (\n\tLevelLow Level = -1\n\tLevelHigh Level = 100\n)\n\n" +
+		"type Label string\n\n" +
+		"const LabelA Label = \"a\"\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first name of each value, in the order of the consts
+	state := fs.Identities["State"].(*gen.BaseElem).Enum
+	if state == nil || !reflect.DeepEqual(state.Names, []string{"StateIdle", "StateRunning", "StateDone"}) || state.Tolerant {
+		t.Errorf("State enum: %+v", state)
+	}
+	if level := fs.Identities["Level"].(*gen.BaseElem).Enum; level == nil || !level.Tolerant {
+		t.Errorf("Level enum: %+v", level)
+	}
+	if label := fs.Identities["Label"].(*gen.BaseElem).Enum; label != nil {
+		t.Errorf("a string type is an enum: %+v", label)
+	}
+
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		// known values are encoded by name, and others as numbers
+		"case StateIdle:\no = msgp.AppendString(o, \"StateIdle\")",
+		"default:\no = msgp.AppendUint8(o, uint8(z))",
+		"case LevelLow:\no = msgp.AppendString(o, \"LevelLow\")",
+		// and decoded from either
+		"case \"StateDone\":\n(*z) = StateDone",
+		"msgp.ReadUint8Bytes(bts)",
+		"err = &msgp.ErrUnknownEnum{Type: \"State\"",
+		"(*z) = 0",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q in:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "StateDefault") || strings.Contains(buf.String(), "ErrUnknownEnum{Type: \"Level\"") {
+		t.Errorf("unexpected enum code in:\n%s", buf.String())
+	}
+
+	bad := filepath.Join(t.TempDir(), "bad.go")
+	if err := os.WriteFile(bad, []byte("package foo\n\n//msgp:enum State lenient\n\ntype State uint8\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err = File(bad, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, io.Discard, nil)); err == nil {
+		t.Error("no error for an unknown option")
+	}
+}
+
+func TestAllocBoundConst(t *testing.T) {
+	src := "package foo\n\n" +
+		"const MaxTxnBytes = 1 << 20\n\n" +
+		"const maxTxns = 64\n\n" +
+		"type Block struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tTxns [][]byte `codec:\"txns,allocbound=maxTxns,MaxTxnBytes\"`\n" +
+		"\tNote string `codec:\"note,allocbound=MaxTxnBytes\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Unmarshal|gen.Size|gen.MaxSize, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	// the checks name the constants, rather than their values
+	for _, want := range []string{
+		"msgp.ReadArrayHeaderBytesMax(bts, uint64(maxTxns))",
+		" > MaxTxnBytes {",
+		"((maxTxns) * (msgp.BytesPrefixSize + MaxTxnBytes))",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("no %q in:\n%s", want, buf.String())
+		}
+	}
+	if strings.Contains(buf.String(), "1048576") || strings.Contains(buf.String(), "(64)") {
+		t.Errorf("a bound is inlined in:\n%s", buf.String())
+	}
+}
+
+func TestZeroCopyDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:zerocopy Block Count\n\n" +
+		"type Sig []byte\n\n" +
+		"type Count int\n\n" +
+		"type Block struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tData []byte `codec:\"data,allocbound=64\"`\n" +
+		"\tSigs [][]byte `codec:\"sigs,allocbound=4\"`\n" +
+		"\tKey Sig `codec:\"key\"`\n" +
+		"\tNote string `codec:\"note\"`\n}\n\n" +
+		"type Copied struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tData []byte `codec:\"data\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Unmarshal, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"(*z).Data, bts, err = msgp.ReadBytesZC(bts)",
+		"(*z).Sigs[zb0001], bts, err = msgp.ReadBytesZC(bts)",
+		// named types are decoded as their own directives say
+		"msgp.ReadBytesBytes(bts, []byte((*z).Key))",
+		"(*z).Data, bts, err = msgp.ReadBytesBytes(bts, (*z).Data)",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in:\n%s", want, out)
+		}
+	}
+	if _, copied, _ := strings.Cut(out, "func (z *Copied)"); strings.Contains(copied, "ReadBytesZC") {
+		t.Errorf("Copied is decoded without copying:\n%s", out)
+	}
+}
+
+func TestJSONNamesDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"%s\n\n" +
+		"type T struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tA int `json:\"alpha,omitempty\"`\n" +
+		"\tB int `codec:\"b\" json:\"beta\"`\n" +
+		"\tC int `json:\"-\"`\n" +
+		"\tD int `json:\",string\"`\n" +
+		"\tE int\n" +
+		"\tIn struct {\n\t\t_struct struct{} `codec:\"\"`\n\t\tX int `json:\"x\"`\n\t} `json:\"in\"`\n}\n"
+	keys := func(directive string) []string {
+		file := filepath.Join(t.TempDir(), "foo.go")
+		if err := os.WriteFile(file, []byte(fmt.Sprintf(src, directive)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, &buf, nil)); err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, sf := range fs.Identities["T"].(*gen.Struct).Fields[1:] {
+			if !strings.Contains(buf.String(), fmt.Sprintf("// string %q", sf.FieldTag)) {
+				t.Errorf("%s is not keyed %q in:\n%s", sf.FieldName, sf.FieldTag, buf.String())
+			}
+			keys = append(keys, sf.FieldTag)
+			if in, ok := sf.FieldElem.(*gen.Struct); ok {
+				keys = append(keys, in.Fields[1].FieldTag)
+			}
+		}
+		return keys
+	}
+
+	// codec, then json, then the field name
+	if got, want := keys("//msgp:jsonnames"), []string{"alpha", "b", "C", "D", "E", "in", "x"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys %v; want %v", got, want)
+	}
+	if got, want := keys("// no directive"), []string{"A", "b", "C", "D", "E", "In", "X"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("keys without the directive %v; want %v", got, want)
+	}
+}
+
+func TestSecureTypeDirective(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "foo.go")
+	src := "package foo\n\n" +
+		"//msgp:securetype Bad Good\n\n" +
+		"type Inner struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tNote []byte `codec:\"n\"`\n}\n\n" +
+		"type Bad struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tName string `codec:\"name,allocbound=32\"`\n" +
+		"\tTags []string `codec:\"tags,allocbound=8\"`\n" +
+		"\tIn []Inner `codec:\"in,allocbound=4\"`\n" +
+		"\tM map[int64]uint64 `codec:\"m,allocbound=-\"`\n" +
+		"\tN int64 `codec:\"k\"`\n}\n\n" +
+		"type Good struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tTags [][]byte `codec:\"tags,allocbound=8,16\"`\n" +
+		"\tM map[int64]string `codec:\"m,allocbound=4\"`\n" +
+		"\tP *string `codec:\"p,allocbound=16\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := func(field string) int {
+		for i, l := range strings.Split(src, "\n") {
+			if strings.HasPrefix(l, "\t"+field+" ") {
+				return i + 1
+			}
+		}
+		t.Fatalf("no field %s", field)
+		return 0
+	}
+
+	type finding struct {
+		Line int
+		Path string
+		Type string
+	}
+	var got []finding
+	for _, u := range fs.Unbounded() {
+		if u.Pos.Filename != file {
+			t.Errorf("%s is in %s", u.Path, u.Pos.Filename)
+		}
+		got = append(got, finding{u.Pos.Line, u.Path, u.Type})
+	}
+	want := []finding{
+		{line("Note"), "Bad.In[].Note", "[]byte"},
+		{line("Tags"), "Bad.Tags[]", "string"},
+		// allocbound=- is unbounded
+		{line("M"), "Bad.M", "map[int64]uint64"},
+		{line("M map[int64]string"), "Good.M[]", "string"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unbounded values %v; want %v", got, want)
+	}
+}
+
+func TestStringKeyDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:stringkey Color ParseColor\n" +
+		"//msgp:ignore Color\n\n" +
+		"type Color struct {\n\tR, G uint8\n}\n\n" +
+		"func (c Color) String() string { return \"\" }\n\n" +
+		"func ParseColor(s string) (Color, error) { return Color{}, nil }\n\n" +
+		"type Palette struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tCounts map[Color]uint64 `codec:\"c,allocbound=16\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		// keys are sorted and encoded by their strings
+		`sort.Slice\((\w+)_keys, func\(i, j int\) bool { return (\w+)_keys\[i\]\.String\(\) < (\w+)_keys\[j\]\.String\(\) }\)`,
+		`(\w+) = Color\.String\((\w+)\)\s+o = msgp\.AppendString\(o, (\w+)\)`,
+		`msgp\.StringPrefixSize \+ len\(Color\.String\((\w+)\)\)`,
+		// a key that doesn't parse is in the context of the error
+		`(\w+), err = ParseColor\((\w+)\)\s+if err != nil {\s+err = msgp\.WrapError\(err, "Counts", (\w+)\)`,
+		`if (\w+) && (\w+)\.String\(\) < (\w+)\.String\(\) {\s+err = &msgp\.ErrNonCanonical{}`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+}
+
+func TestInstantiateDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:instantiate Container[TxnID] Pair[uint64, TxnID]\n\n" +
+		"type TxnID [4]byte\n\n" +
+		"type Container[T any] struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tItems []T `codec:\"items,allocbound=16\"`\n" +
+		"\tLast *T `codec:\"last\"`\n}\n\n" +
+		"type Pair[K comparable, V any] struct {\n" +
+		"\t_struct struct{} `codec:\"\"`\n" +
+		"\tM map[K]V `codec:\"m,allocbound=4\"`\n}\n\n" +
+		"type TxnIDs Container[TxnID]\n\n" +
+		"type Counts Pair[uint64, TxnID]\n\n" +
+		"type Unused Container[int64]\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, reason := range map[string]string{
+		"Container": "generic; see msgp:instantiate",
+		"Unused":    "instantiation of a generic type; see msgp:instantiate",
+	} {
+		if fs.Skipped[name] != reason {
+			t.Errorf("%s skipped for %q", name, fs.Skipped[name])
+		}
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`func \(z \*TxnIDs\) MarshalMsg\(b \[\]byte\) \(o \[\]byte\)`,
+		`o = msgp\.AppendBytes\(o, \(\(\*z\)\.Items\[(\w+)\]\)\[:\]\)`,
+		`msgp\.ReadArrayHeaderBytesMax\(bts, uint64\(16\)\)`,
+		`\(\*z\)\.Last = new\(TxnID\)`,
+		`func \(z \*Counts\) UnmarshalMsg\(bts \[\]byte\) \(o \[\]byte, err error\)`,
+		`(\w+) = make\(map\[uint64\]TxnID, (\w+)\)`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "Unused") || strings.Contains(out, "func (z *Container)") {
+		t.Errorf("generated code for a type not instantiated:\n%s", out)
+	}
+
+	for _, bad := range []string{"Container[int32]", "Pair[uint64]", "TxnID[int]", "Container"} {
+		src := "package foo\n\n//msgp:instantiate " + bad + "\n\n" +
+			"type TxnID [4]byte\n\n" +
+			"type Container[T any] struct{ Items []T }\n\n" +
+			"type Pair[K comparable, V any] struct{ M map[K]V }\n"
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, &buf, nil)); err == nil {
+			t.Errorf("msgp:instantiate %s: no error", bad)
+		}
+	}
+}
+
+func TestPreserveUnknownDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"import \"github.com/algorand/msgp/msgp\"\n\n" +
+		"//msgp:preserveunknown Msg\n\n" +
+		"type Msg struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tB uint64 `codec:\"b\"`\n" +
+		"\tD uint64 `codec:\"d\"`\n" +
+		"\tunknownFields map[string]msgp.Raw\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		// the unknown fields are merged into the declared ones by key
+		`(\w+) := msgp\.UnknownKeys\(\(\*z\)\.unknownFields, "b", "d"\)`,
+		`(\w+)Len \+= uint32\(len\((\w+)\)\)\s+// variable map header, size (\w+)\s+o = msgp\.AppendMapHeader\(o, (\w+)\)`,
+		`o, (\w+) = msgp\.AppendUnknownBefore\(o, \(\*z\)\.unknownFields, (\w+), "b"\)\s+if`,
+		`o, (\w+) = msgp\.AppendUnknownBefore\(o, \(\*z\)\.unknownFields, (\w+), "d"\)\s+if`,
+		`o = msgp\.AppendUnknown\(o, \(\*z\)\.unknownFields, (\w+)\)`,
+		`default:\s+if validate && (\w+) && string\(field\) < (\w+) {\s+err = &msgp\.ErrNonCanonical{}`,
+		`bts, err = msgp\.ReadUnknownBytes\(bts, field, &\(\*z\)\.unknownFields, budget\)`,
+		`msgp\.MapHeaderSize \+ msgp\.UnknownSize\(\(\*z\)\.unknownFields\)`,
+		`&& \(len\(\(\*z\)\.unknownFields\) == 0\)`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+
+	for _, bad := range []string{"Msg B", "Msg other", "Nope"} {
+		src := strings.Replace(src, "preserveunknown Msg", "preserveunknown "+bad, 1)
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, &buf, nil)); err == nil {
+			t.Errorf("msgp:preserveunknown %s: no error", bad)
+		}
+	}
+}
+
+func TestSinceDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:since Tx V 2 Fee\n" +
+		"//msgp:tuple Tup\n" +
+		"//msgp:since Tup V 3 Extra\n\n" +
+		"type Tx struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tV uint8 `codec:\"v\"`\n" +
+		"\tFee uint64 `codec:\"a\"`\n}\n\n" +
+		"type Tup struct {\n" +
+		"\tV uint16 `codec:\"v\"`\n" +
+		"\tExtra uint64 `codec:\"x\"`\n" +
+		"\tB bool `codec:\"b\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		// a map leaves the field out of version 1, and rejects it
+		`if \(\*z\)\.V < 2 \|\| \(\*z\)\.Fee == 0 {`,
+		`if (\w+) && \(\*z\)\.V < 2 {\s+err = msgp\.ErrVersionField\("a", \(\*z\)\.V, 2\)`,
+		// a tuple has 2 elements in version 2 and 3 in version 3
+		`(\w+) := uint32\(3\)\s+if z\.V < 3 {\s+(\w+)--\s+}\s+// array header, size (\w+)`,
+		`if !\(z\.V < 3\) {\s+o = msgp\.AppendUint64\(o, z\.Extra\)\s+}`,
+		`if (\w+) < 2 \|\| (\w+) > 3 {`,
+		`(\w+) := 3\s+if \(\*z\)\.V < 3 {\s+(\w+)--\s+}\s+if (\w+) != (\w+) {`,
+		`if !\(\(\*z\)\.V < 3\) {\s+\(\*z\)\.Extra, bts, err = msgp\.ReadUint64Bytes\(bts\)`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+
+	for _, bad := range []string{"Tx V 2 Nope", "Tx Fee 2 V", "Tx V two Fee", "Tx V 2 V", "Nope V 2 Fee"} {
+		src := strings.Replace(src, "since Tx V 2 Fee", "since "+bad, 1)
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, &buf, nil)); err == nil {
+			t.Errorf("msgp:since %s: no error", bad)
+		}
+	}
+}
+
+func TestConvertDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:convert Micros to string using MicrosToString, StringToMicros\n\n" +
+		"// Micros is a fixed-point amount in millionths\n" +
+		"type Micros int64\n\n" +
+		"func MicrosToString(m Micros) string { return \"\" }\n\n" +
+		"func StringToMicros(s string) (Micros, error) { return 0, nil }\n\n" +
+		"type Account struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tBalance Micros `codec:\"b\"`\n" +
+		"\tHistory []Micros `codec:\"h,allocbound=8\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size|gen.IsZero, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`(\w+) = MicrosToString\(\(\*z\)\.Balance\)\s+o = msgp\.AppendString\(o, (\w+)\)`,
+		`(\w+), bts, err = msgp\.ReadStringBytes\(bts\)`,
+		`\(\*z\)\.Balance, err = StringToMicros\((\w+)\)`,
+		`\(\*z\)\.History\[(\w+)\], err = StringToMicros\((\w+)\)`,
+		// the zero value is that of the string it is encoded as
+		`if MicrosToString\(\(\*z\)\.Balance\) == "" {`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+
+	for _, bad := range []string{
+		"Micros to string using MicrosToString",
+		"Micros as string using MicrosToString, StringToMicros",
+		"Micros to Account using MicrosToString, StringToMicros",
+		// the funcs are the wrong way around
+		"Micros to string using StringToMicros, MicrosToString",
+		"Micros to uint64 using MicrosToString, StringToMicros",
+	} {
+		src := strings.Replace(src, "convert Micros to string using MicrosToString, StringToMicros", "convert "+bad, 1)
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.PrintTo(gen.NewPrinter(gen.Marshal, &gen.Topics{}, &buf, nil)); err == nil {
+			t.Errorf("msgp:convert %s: no error", bad)
+		}
+	}
+}
+
+func TestEmbeddedInterface(t *testing.T) {
+	src := "package foo\n\n" +
+		"import \"io\"\n\n" +
+		"type Local interface{ M() }\n\n" +
+		"type A struct {\n\tio.Reader\n\tN int\n}\n\n" +
+		"type B struct {\n\tLocal\n\tN int\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	err = fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal, &gen.Topics{}, &buf, nil))
+	if err == nil {
+		t.Fatal("no error for the embedded interfaces")
+	}
+	for _, want := range []string{"foo.go:8:2: A embeds the interface io.Reader", "foo.go:13:2: B embeds the interface Local"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("no %q in %v", want, err)
+		}
+	}
+
+	// a field that is left out is fine
+	src = strings.NewReplacer("io.Reader\n", "io.Reader `codec:\"-\"`\n", "Local\n", "Local `codec:\"-\"`\n").Replace(src)
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fs, err = File(file, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "Reader") || strings.Contains(buf.String(), "Local") {
+		t.Errorf("ignored field encoded:\n%s", buf.String())
+	}
+}
+
+func TestPresenceDirective(t *testing.T) {
+	src := "package foo\n\n" +
+		"//msgp:presence Opt\n\n" +
+		"type Opt struct {\n" +
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+		"\tA int64 `codec:\"a\"`\n" +
+		"\tB string `codec:\"b\"`\n\n" +
+		"\tpresent OptPresent\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`\(\*z\)\.present = OptPresent{}`,
+		`case "a":(?s:.*?)\(\*z\)\.present\.A = true`,
+		`case "b":(?s:.*?)\(\*z\)\.present\.B = true`,
+		`type OptPresent struct {\s+A\s+bool\s+B\s+bool\s+}`,
+		`func \(z \*Opt\) WhichPresent\(\) OptPresent {\s+return z\.present\s+}`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out) {
+			t.Errorf("no %s in:\n%s", want, out)
+		}
+	}
+	// the field isn't encoded
+	if strings.Contains(out, `"present"`) {
+		t.Errorf("presence field encoded:\n%s", out)
+	}
+
+	for _, bad := range []string{"Opt A", "Opt nope", "Nope"} {
+		src := strings.Replace(src, "presence Opt", "presence "+bad, 1)
+		if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+			t.Fatal(err)
+		}
+		fs, err := File(file, true, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := fs.PrintTo(gen.NewPrinter(gen.Unmarshal, &gen.Topics{}, &buf, nil)); err == nil {
+			t.Errorf("msgp:presence %s: no error", bad)
+		}
+	}
+}
+
+func TestOnly(t *testing.T) {
+	src := "package foo\n\n" +
+		"type A struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tB B\n\tL []*C `codec:\"l,allocbound=4\"`\n}\n\n" +
+		"type B struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64\n\tY string\n\tZ []byte\n\tW map[string]D `codec:\"w,allocbound=4\"`\n}\n\n" +
+		"type C struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64\n\tY string\n\tZ []byte\n\tW []float64 `codec:\"w,allocbound=4\"`\n}\n\n" +
+		"type D struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64\n\tY string\n\tZ []byte\n\tW []float64 `codec:\"w,allocbound=4\"`\n}\n\n" +
+		"type Unrelated struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64\n\tY string\n\tZ []byte\n\tW []float64 `codec:\"w,allocbound=4\"`\n}\n"
+	file := filepath.Join(t.TempDir(), "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Only([]string{"A"}); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Skipped["Unrelated"] != "not in -types" {
+		t.Errorf("Unrelated skipped for %q", fs.Skipped["Unrelated"])
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, name := range []string{"A", "B", "C", "D"} {
+		if !strings.Contains(out, "func (z *"+name+") MarshalMsg(") {
+			t.Errorf("no methods for %s, which A uses:\n%s", name, out)
+		}
+	}
+	if strings.Contains(out, "Unrelated") {
+		t.Errorf("methods for Unrelated:\n%s", out)
+	}
+
+	if err := fs.Only([]string{"Nope"}); err == nil || !strings.Contains(err.Error(), "no type Nope") {
+		t.Errorf("unknown type: got %v", err)
+	}
+	if err := fs.Only([]string{"Unrelated"}); err == nil || !strings.Contains(err.Error(), "not in -types") {
+		t.Errorf("type left out: got %v", err)
+	}
+}
+
+func TestMoveTo(t *testing.T) {
+	src := "package foo\n\n" +
+		"const N = 4\n\n" +
+		"type A struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tB B `codec:\"b\"`\n\tL []*A `codec:\"l,allocbound=N\"`\n\tR [N]byte `codec:\"r\"`\n\thidden int64\n}\n\n" +
+		"type B struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64 `codec:\"x\"`\n}\n"
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n\ngo 1.20\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "foo.go")
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.MoveTo("bar"); err != nil {
+		t.Fatal(err)
+	}
+	if fs.Package != "bar" || fs.MovedFrom.Name.Name != "foo" || fs.MovedFrom.Path.Value != `"example.com/foo"` {
+		t.Fatalf("moved to %s from %s %s", fs.Package, fs.MovedFrom.Name, fs.MovedFrom.Path.Value)
+	}
+	var buf bytes.Buffer
+	if err := fs.PrintTo(gen.NewPrinter(gen.Marshal|gen.Unmarshal|gen.Size, &gen.Topics{}, &buf, nil)); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"func (z *A) MarshalMsg(",
+		"(*A)((*z).L[zb0001]).MarshalMsg(o)",
+		"make([]*foo.A, zb",
+		"uint64(foo.N)",
+		"[foo.N]byte{}",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("no %q in:\n%s", want, out)
+		}
+	}
+
+	src = "package foo\n\n" +
+		"const n = 4\n\n" +
+		"type A struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tB b `codec:\"b\"`\n\tR [n]byte `codec:\"r\"`\n}\n\n" +
+		"type b struct {\n\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n\tX int64 `codec:\"x\"`\n}\n"
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if fs, err = File(file, true, ""); err != nil {
+		t.Fatal(err)
+	}
+	err = fs.MoveTo("bar")
+	for _, want := range []string{"b is not exported", "n is not exported"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("got %v; want %q", err, want)
+		}
+	}
+}
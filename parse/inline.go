@@ -58,8 +58,16 @@ func (f *FileSet) findShim(id string, be *gen.BaseElem) {
 func (f *FileSet) nextShim(ref *gen.Elem, id string, be *gen.BaseElem) {
 	if (*ref).TypeName() == id {
 		vn := (*ref).Varname()
+		// keep the bounds given by the field's tag
+		bound, total := (*ref).AllocBound(), (*ref).MaxTotalBytes()
 		*ref = be.Copy()
 		(*ref).SetVarname(vn)
+		if bound != "" {
+			(*ref).SetAllocBound(bound)
+		}
+		if total != "" {
+			(*ref).SetMaxTotalBytes(total)
+		}
 	} else {
 		switch el := (*ref).(type) {
 		case *gen.Struct:
@@ -113,6 +121,7 @@ func (f *FileSet) propInline() {
 		case *gen.Slice:
 			f.nextInline(&el.Els, name)
 		case *gen.Map:
+			f.inlineKey(el)
 			f.nextInline(&el.Value, name)
 		case *gen.Ptr:
 			f.nextInline(&el.Value, name)
@@ -121,6 +130,26 @@ func (f *FileSet) propInline() {
 	}
 }
 
+// inlineKey replaces the key of m with the primitive that
+// its named type is defined as, so that the keys of a
+// map[MyID]T are encoded, and sorted, as the underlying
+// type is, rather than through the methods of MyID
+func (f *FileSet) inlineKey(m *gen.Map) {
+	if el, ok := m.Key.(*gen.BaseElem); ok && el.Value == gen.IDENT {
+		if node, ok := f.Identities[el.TypeName()].(*gen.BaseElem); ok && !isEnum(node) {
+			m.Key = node.Copy()
+		}
+	}
+}
+
+// isEnum returns whether e is a type named by the msgp:enum
+// directive, which is encoded through its own methods, so
+// that the names of its values are only written there
+func isEnum(e gen.Elem) bool {
+	be, ok := e.(*gen.BaseElem)
+	return ok && be.Enum != nil
+}
+
 const fatalloop = `detected infinite recursion in inlining loop!
 Please file a bug at github.com/tinylib/msgp/issues!
 Thanks!
@@ -133,7 +162,7 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 		// a type into itself
 		typ := el.TypeName()
 		if el.Value == gen.IDENT && typ != root {
-			if node, ok := f.Identities[typ]; ok && node.Complexity() < maxComplex {
+			if node, ok := f.Identities[typ]; ok && node.Complexity() < maxComplex && !isEnum(node) {
 				// infof("inlining %s\n", typ)
 
 				// This should never happen; it will cause
@@ -166,6 +195,7 @@ func (f *FileSet) nextInline(ref *gen.Elem, root string) {
 	case *gen.Slice:
 		f.nextInline(&el.Els, root)
 	case *gen.Map:
+		f.inlineKey(el)
 		f.nextInline(&el.Value, root)
 	case *gen.Ptr:
 		f.nextInline(&el.Value, root)
@@ -0,0 +1,165 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"strings"
+)
+
+const instantiateDirective = "instantiate"
+
+// instantiate applies the msgp:instantiate directives of f,
+//
+//	//msgp:instantiate {Generic[Arg, ...]} ...
+//
+// which name the instantiations of the generic types of f
+// that code is generated for. Go has no methods of one
+// instantiation, so the methods are those of the types
+// declared as it, as in
+//
+//	type Container[T any] struct { Items []T }
+//	type TxnIDs Container[TxnID]
+//
+// whose spec becomes the generic type's, with each type
+// parameter replaced by its argument. Neither the generic
+// types nor the types declared as their instantiations
+// are otherwise generated for. It runs before f.Specs
+// are processed, so that the other directives apply to
+// the instantiations as to any other type.
+func (f *FileSet) instantiate() {
+	newdirs := make([]string, 0, len(f.Directives))
+	for _, d := range f.Directives {
+		chunks := strings.Split(d, " ")
+		if chunks[0] != instantiateDirective {
+			newdirs = append(newdirs, d)
+			continue
+		}
+		pushstate(instantiateDirective)
+		for _, inst := range splitInstances(strings.Join(chunks[1:], " ")) {
+			if err := f.instantiateOne(inst); err != nil {
+				warnln(err.Error())
+				f.errs = append(f.errs, err)
+			}
+		}
+		popstate()
+	}
+	f.Directives = newdirs
+}
+
+// splitInstances splits the arguments of msgp:instantiate
+// at the spaces that aren't between brackets, so that an
+// argument may be written "Pair[K, V]".
+func splitInstances(s string) []string {
+	var out []string
+	depth, start := 0, 0
+	for i, r := range s + " " {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ' ', '\t':
+			if depth == 0 {
+				if arg := strings.TrimSpace(s[start:i]); arg != "" {
+					out = append(out, arg)
+				}
+				start = i
+			}
+		}
+	}
+	return out
+}
+
+func (f *FileSet) instantiateOne(inst string) error {
+	e, err := parser.ParseExpr(inst)
+	if err != nil {
+		return fmt.Errorf("instantiate %s: %v", inst, err)
+	}
+	var fn ast.Expr
+	var args []ast.Expr
+	switch e := e.(type) {
+	case *ast.IndexExpr:
+		fn, args = e.X, []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		fn, args = e.X, e.Indices
+	default:
+		return fmt.Errorf("instantiate %s: not an instantiation of a generic type", inst)
+	}
+	id, ok := fn.(*ast.Ident)
+	if !ok || f.generics[id.Name] == nil {
+		return fmt.Errorf("instantiate %s: no generic type %s is declared in the package", inst, types.ExprString(fn))
+	}
+	generic := f.generics[id.Name]
+
+	// the type parameters, in order, as in [K comparable, V any]
+	var params []string
+	for _, field := range generic.TypeParams.List {
+		for _, name := range field.Names {
+			params = append(params, name.Name)
+		}
+	}
+	if len(params) != len(args) {
+		return fmt.Errorf("instantiate %s: %s has %d type parameters, not %d", inst, id.Name, len(params), len(args))
+	}
+	subst := make(map[string]ast.Expr, len(params))
+	for i, name := range params {
+		subst[name] = args[i]
+	}
+
+	want := types.ExprString(e)
+	var found bool
+	for name, typ := range f.instances {
+		if types.ExprString(typ) != want {
+			continue
+		}
+		found = true
+		delete(f.Skipped, name)
+		f.Specs[name] = substitute(generic.Type, subst)
+		infof("%s = %s\n", name, want)
+	}
+	if !found {
+		return fmt.Errorf("instantiate %s: no type is declared as %s, for its methods, as in 'type X %s'", inst, want, want)
+	}
+	return nil
+}
+
+// substitute returns a copy of the type expression e, with
+// the identifiers named in subst replaced by their values.
+// Field names, tags and array lengths are kept as they are.
+func substitute(e ast.Expr, subst map[string]ast.Expr) ast.Expr {
+	switch e := e.(type) {
+	case *ast.Ident:
+		if arg, ok := subst[e.Name]; ok {
+			return arg
+		}
+		return e
+	case *ast.StarExpr:
+		c := *e
+		c.X = substitute(e.X, subst)
+		return &c
+	case *ast.ArrayType:
+		c := *e
+		c.Elt = substitute(e.Elt, subst)
+		return &c
+	case *ast.MapType:
+		c := *e
+		c.Key = substitute(e.Key, subst)
+		c.Value = substitute(e.Value, subst)
+		return &c
+	case *ast.StructType:
+		c := *e
+		fields := *e.Fields
+		fields.List = make([]*ast.Field, len(e.Fields.List))
+		for i, field := range e.Fields.List {
+			fc := *field
+			fc.Type = substitute(field.Type, subst)
+			fields.List[i] = &fc
+		}
+		c.Fields = &fields
+		return &c
+	default:
+		return e
+	}
+}
@@ -0,0 +1,104 @@
+package parse
+
+import (
+	"go/token"
+	"sort"
+	"strings"
+
+	"github.com/algorand/msgp/gen"
+)
+
+// An Unbounded is a value within a msgp:securetype type
+// that has no allocbound, and so may be decoded into an
+// allocation as large as the message: a slice, a map, or
+// a string, []byte or other variable-length base type.
+type Unbounded struct {
+	Pos  token.Position // where the field holding it is declared
+	Path string         // e.g. "Block.Txns[].Note", or "Block.M[key]" for map keys
+	Type string         // the type of the value
+}
+
+// Unbounded returns the values without an allocbound in
+// the msgp:securetype types of f, sorted by position. An
+// allocbound of "-" doesn't bound the value either. The
+// named types that a secure type holds are checked as part
+// of it, if they are declared in the package of f.
+func (f *FileSet) Unbounded() []Unbounded {
+	names := make([]string, 0, len(f.secure))
+	for name := range f.secure {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var out []Unbounded
+	for _, name := range names {
+		l := &linter{f: f, seen: map[string]bool{name: true}}
+		l.check(f.Identities[name], name, f.secure[name])
+		out = append(out, l.out...)
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i].Pos, out[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Line < b.Line
+	})
+	return out
+}
+
+// linter walks the elements of one secure type
+type linter struct {
+	f    *FileSet
+	seen map[string]bool // the named types walked so far
+	out  []Unbounded
+}
+
+func (l *linter) report(e gen.Elem, path string, pos token.Position) {
+	if bound := strings.Split(e.AllocBound(), ",")[0]; bound == "" || bound == "-" {
+		l.out = append(l.out, Unbounded{Pos: pos, Path: path, Type: e.TypeName()})
+	}
+}
+
+// check walks e, which is at path, in the field declared at pos
+func (l *linter) check(e gen.Elem, path string, pos token.Position) {
+	switch e := e.(type) {
+	case *gen.Struct:
+		for _, sf := range e.Fields {
+			fpos := sf.Pos
+			if !fpos.IsValid() {
+				fpos = pos
+			}
+			l.check(sf.FieldElem, path+"."+sf.FieldName, fpos)
+		}
+	case *gen.Ptr:
+		l.check(e.Value, path, pos)
+	case *gen.Array:
+		l.check(e.Els, path+"[]", pos)
+	case *gen.Slice:
+		l.report(e, path, pos)
+		// "allocbound=10,4" bounds the elements to 4,
+		// as the generated decoders do
+		els := e.Els
+		if bounds := strings.SplitN(e.AllocBound(), ",", 2); els.AllocBound() == "" && len(bounds) > 1 {
+			els = els.Copy()
+			els.SetAllocBound(bounds[1])
+		}
+		l.check(els, path+"[]", pos)
+	case *gen.Map:
+		l.report(e, path, pos)
+		l.check(e.Key, path+"[key]", pos)
+		l.check(e.Value, path+"[]", pos)
+	case *gen.BaseElem:
+		switch e.Value {
+		case gen.String, gen.Bytes, gen.NullString, gen.BigInt, gen.Text:
+			l.report(e, path, pos)
+		case gen.IDENT:
+			// a named type that isn't inlined is checked
+			// once, wherever it is first held
+			name := e.TypeName()
+			if el, ok := l.f.Identities[name]; ok && !l.seen[name] {
+				l.seen[name] = true
+				l.check(el, path, pos)
+			}
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package parse
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/algorand/msgp/gen"
+)
+
+// MoveTo makes the methods of the types in fs be generated in
+// the package named pkg, rather than in the package that
+// declares them. Since Go only allows methods on the types of
+// a package, pkg declares each type in turn as the original,
+// as in "type T orig.T", and the methods are those of that
+// type. The original package is imported as fs.MovedFrom, and
+// the references to its types, consts and functions in the
+// generated code are qualified with its name.
+//
+// The generated code of pkg can't reach what orig doesn't
+// export, so it is an error for the types, for the embedded
+// structs and consts they are encoded through, or for the
+// fields that directives keep their state in, to be unexported.
+// The consts of a msgp:enum type, which are of the original
+// type, can't be used for the one that pkg declares either.
+func (fs *FileSet) MoveTo(pkg string) error {
+	if fs.PkgPath == "" || fs.PkgPath == "command-line-arguments" {
+		return fmt.Errorf("the import path of package %s is not known", fs.Package)
+	}
+	m := &mover{fs: fs, errs: make(map[string]bool)}
+	names := make([]string, 0, len(fs.Identities))
+	for name := range fs.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !ast.IsExported(name) || strings.ContainsAny(name, "[]") {
+			m.errorf("%s is not exported by package %s", name, fs.Package)
+			continue
+		}
+		m.elem(fs.Identities[name], true)
+	}
+	if len(m.errs) > 0 {
+		errs := make([]string, 0, len(m.errs))
+		for err := range m.errs {
+			errs = append(errs, err)
+		}
+		sort.Strings(errs)
+		return fmt.Errorf("can't generate methods in package %s: %s", pkg, strings.Join(errs, "; "))
+	}
+	fs.MovedFrom = &ast.ImportSpec{
+		Name: ast.NewIdent(fs.Package),
+		Path: &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(fs.PkgPath)},
+	}
+	fs.Package = pkg
+	return nil
+}
+
+// A mover qualifies the references to the declarations of
+// the package of fs in the elements of its types
+type mover struct {
+	fs   *FileSet
+	errs map[string]bool
+}
+
+func (m *mover) errorf(format string, args ...interface{}) {
+	m.errs[fmt.Sprintf(format, args...)] = true
+}
+
+// isLocal returns whether name is a type declared in the package
+func (m *mover) isLocal(name string) bool {
+	_, spec := m.fs.Specs[name]
+	_, ident := m.fs.Identities[name]
+	return spec || ident
+}
+
+// qualify returns the reference to the declaration name
+// of the original package, which must be exported
+func (m *mover) qualify(name string) string {
+	if !ast.IsExported(name) {
+		m.errorf("%s is not exported by package %s", name, m.fs.Package)
+	}
+	return m.fs.Package + "." + name
+}
+
+// qualifyExpr qualifies x, a const or function of the package,
+// or a method expression or const of one of its types; numbers,
+// the predeclared identifiers and those of imported packages
+// are left as they are.
+func (m *mover) qualifyExpr(x string) string {
+	if x == "" || x == "-" || !unicode.IsLetter([]rune(x)[0]) && x[0] != '_' {
+		return x
+	}
+	head, _, qualified := strings.Cut(x, ".")
+	switch {
+	case qualified && !m.isLocal(head):
+		return x
+	case !qualified && types.Universe.Lookup(x) != nil:
+		return x
+	}
+	return m.qualify(x)
+}
+
+// qualifyBounds qualifies the consts in a comma-separated
+// list of allocbounds
+func (m *mover) qualifyBounds(bounds string) string {
+	if bounds == "" {
+		return ""
+	}
+	parts := strings.Split(bounds, ",")
+	for i := range parts {
+		parts[i] = m.qualifyExpr(parts[i])
+	}
+	return strings.Join(parts, ",")
+}
+
+// elem qualifies the references in e; the types themselves,
+// at the top, keep their names, which pkg declares
+func (m *mover) elem(e gen.Elem, top bool) {
+	e.SetAllocBound(m.qualifyBounds(e.AllocBound()))
+	e.SetMaxTotalBytes(m.qualifyBounds(e.MaxTotalBytes()))
+	switch e := e.(type) {
+	case *gen.BaseElem:
+		m.base(e, top)
+		return
+	case *gen.Struct:
+		m.structFields(e)
+	case *gen.Slice:
+		m.elem(e.Els, false)
+	case *gen.Array:
+		e.Size = m.qualifyExpr(e.Size)
+		m.elem(e.Els, false)
+	case *gen.Map:
+		m.elem(e.Key, false)
+		m.elem(e.Value, false)
+	case *gen.Ptr:
+		m.elem(e.Value, false)
+	}
+	if top {
+		return
+	}
+	// a named type is qualified, and the name of a
+	// type literal is worked out again from the names
+	// of its qualified elements
+	switch name := e.TypeName(); {
+	case m.isLocal(name):
+		e.Alias(m.qualify(name))
+	case strings.HasPrefix(name, "[") || strings.HasPrefix(name, "map[") || strings.HasPrefix(name, "*"):
+		e.Alias("")
+	}
+}
+
+func (m *mover) base(e *gen.BaseElem, top bool) {
+	name := e.TypeName()
+	if e.Enum != nil {
+		m.errorf("the consts of msgp:enum type %s are not of the type declared for it", name)
+	}
+	e.ShimToBase = m.qualifyExpr(e.ShimToBase)
+	e.ShimFromBase = m.qualifyExpr(e.ShimFromBase)
+	if top || !m.isLocal(name) {
+		return
+	}
+	// values of the types whose methods are generated
+	// are encoded by those methods, through a pointer
+	// conversion to the type that pkg declares
+	if _, ok := m.fs.Identities[name]; ok && e.Value == gen.IDENT && e.Replacement == "" {
+		e.Replacement = name
+	}
+	e.Alias(m.qualify(name))
+}
+
+func (m *mover) structFields(s *gen.Struct) {
+	name := s.TypeName()
+	if s.Presence != "" {
+		m.errorf("the msgp:presence field %s.%s is not exported", name, s.Presence)
+	}
+	if s.Unknown != "" && !ast.IsExported(s.Unknown) {
+		m.errorf("the msgp:preserveunknown field %s.%s is not exported", name, s.Unknown)
+	}
+	for i := range s.Fields {
+		sf := &s.Fields[i]
+		if !ast.IsExported(sf.FieldName) {
+			// not encoded
+			continue
+		}
+		for _, embedded := range sf.FieldPath {
+			if !ast.IsExported(embedded) {
+				m.errorf("the embedded struct %s.%s is not exported", name, embedded)
+			}
+		}
+		if sf.Version != "" && !ast.IsExported(sf.Version) {
+			m.errorf("the msgp:since field %s.%s is not exported", name, sf.Version)
+		}
+		m.elem(sf.FieldElem, false)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build msgp_extra
+
+package build
+
+type Extra struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       int64    `codec:"x"`
+}
@@ -0,0 +1,8 @@
+//go:build linux
+
+package build
+
+type Linux struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       int64    `codec:"x"`
+}
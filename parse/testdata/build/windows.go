@@ -0,0 +1,8 @@
+//go:build windows
+
+package build
+
+type Windows struct {
+	_struct struct{} `codec:",omitempty,omitemptyarray"`
+	X       int64    `codec:"x"`
+}
@@ -3,9 +3,17 @@ package printer
 import (
 	"bytes"
 	"fmt"
+	"go/ast"
+	"go/build"
 	"io"
 	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"unicode"
 
 	"github.com/algorand/msgp/gen"
 	"github.com/algorand/msgp/parse"
@@ -15,15 +23,69 @@ import (
 	"golang.org/x/tools/imports"
 )
 
+// infoMu serializes progress output, so that lines
+// written by concurrent PrintFiles workers don't interleave.
+var infoMu sync.Mutex
+
 func infof(s string, v ...interface{}) {
+	infoMu.Lock()
+	defer infoMu.Unlock()
 	fmt.Printf(chalk.Magenta.Color(s), v...)
 }
 
+// genMu serializes code generation, which relies on
+// package-level state in gen and parse. Formatting, which
+// dominates the running time, is done outside of it.
+var genMu sync.Mutex
+
+// DefaultSuffix is the suffix that the files written by
+// PrintFile have, after the base name they are given.
+const DefaultSuffix = "_gen.go"
+
+// TestSuffix returns the suffix of the file that the tests
+// of a file with the given suffix are written to, so that
+// the tests of foo_gen.go are in foo_gen_test.go.
+func TestSuffix(suffix string) string {
+	return strings.TrimSuffix(suffix, ".go") + "_test.go"
+}
+
+// checkSuffix returns an error if the files named with
+// suffix wouldn't be built along with the package: the
+// suffix must end with .go, not with _test.go, and not
+// with a GOOS or GOARCH, as in _linux.go, which would
+// constrain the files to that system.
+func checkSuffix(suffix string) error {
+	switch {
+	case !strings.HasSuffix(suffix, ".go"):
+		return fmt.Errorf("output suffix %q doesn't end with .go", suffix)
+	case strings.HasSuffix(suffix, "_test.go"):
+		return fmt.Errorf("output suffix %q would name a test file", suffix)
+	case strings.ContainsRune(suffix, '/') || strings.ContainsRune(suffix, filepath.Separator):
+		return fmt.Errorf("output suffix %q has a path separator", suffix)
+	}
+	// build.Context.MatchFile only reads the file for a
+	// //go:build line, after it has matched the name
+	ctxt := build.Default
+	ctxt.GOOS, ctxt.GOARCH = "msgp", "msgp"
+	ctxt.OpenFile = func(string) (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("package p\n")), nil
+	}
+	if ok, err := ctxt.MatchFile(".", "x"+suffix); err != nil || !ok {
+		return fmt.Errorf("output suffix %q would only build for some GOOS or GOARCH", suffix)
+	}
+	return nil
+}
+
 // PrintFile prints the methods for the provided list
-// of elements to the given file name and canonical
-// package path.
-func PrintFile(file string, f *parse.FileSet, mode gen.Method, skipFormat bool) error {
+// of elements to the file named base+suffix, and their
+// tests to base+TestSuffix(suffix).
+func PrintFile(base, suffix string, f *parse.FileSet, mode gen.Method, skipFormat bool) error {
+	if err := checkSuffix(suffix); err != nil {
+		return err
+	}
+	genMu.Lock()
 	out, tests, err := generate(f, mode)
+	genMu.Unlock()
 	if err != nil {
 		return err
 	}
@@ -34,9 +96,9 @@ func PrintFile(file string, f *parse.FileSet, mode gen.Method, skipFormat bool)
 	// takes about the same amount of time as
 	// doing them in serial when GOMAXPROCS=1,
 	// and faster otherwise.
-	res := goformat(file, out.Bytes(), skipFormat)
+	res := goformat(base+suffix, out.Bytes(), skipFormat)
 	if tests != nil {
-		testfile := strings.TrimSuffix(file, ".go") + "_test.go"
+		testfile := base + TestSuffix(suffix)
 		err = format(testfile, tests.Bytes(), skipFormat)
 		if err != nil {
 			return err
@@ -50,6 +112,90 @@ func PrintFile(file string, f *parse.FileSet, mode gen.Method, skipFormat bool)
 	return nil
 }
 
+// PrintFiles is like PrintFile, but prints several files,
+// keyed by base name, using up to concurrency workers.
+// It returns the first error encountered, after all of the
+// workers have finished.
+func PrintFiles(files map[string]*parse.FileSet, suffix string, mode gen.Method, skipFormat bool, concurrency int) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	work := make(chan string)
+	errs := make(chan error, len(names))
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range work {
+				if err := PrintFile(name, suffix, files[name], mode, skipFormat); err != nil {
+					errs <- fmt.Errorf("%s: %w", name+suffix, err)
+				}
+			}
+		}()
+	}
+	for _, name := range names {
+		work <- name
+	}
+	close(work)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// PrintCombined is like PrintFile, but prints the methods
+// of several FileSets of one package, as parsed from its
+// separate files, to the one file named base+suffix, with
+// their imports deduplicated and their types in order, as if
+// the package had been parsed as a whole.
+func PrintCombined(base, suffix string, files []*parse.FileSet, mode gen.Method, skipFormat bool) error {
+	f, err := parse.Merge(files...)
+	if err != nil {
+		return err
+	}
+	return PrintFile(base, suffix, f, mode, skipFormat)
+}
+
+// PrintPlan writes a table of the types in f to w, with
+// whether or not code would be generated for each of
+// them, and why not. No files are written.
+func PrintPlan(w io.Writer, f *parse.FileSet) {
+	plan := f.Plan()
+	width := len("TYPE")
+	for _, d := range plan {
+		if len(d.Name) > width {
+			width = len(d.Name)
+		}
+	}
+	fmt.Fprintf(w, "%-*s  %-8s  REASON\n", width, "TYPE", "DECISION")
+	for _, d := range plan {
+		decision := chalk.Green.Color(fmt.Sprintf("%-8s", "generate"))
+		if !d.Generate {
+			decision = chalk.Yellow.Color(fmt.Sprintf("%-8s", "skip"))
+		}
+		line := fmt.Sprintf("%-*s  %s  %s", width, d.Name, decision, d.Reason)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// PrintLint writes the values without an allocbound in
+// the msgp:securetype types of f to w, one per line as
+// file:line: path: type, and returns how many there are.
+// No files are written.
+func PrintLint(w io.Writer, f *parse.FileSet) int {
+	unbounded := f.Unbounded()
+	for _, u := range unbounded {
+		fmt.Fprintf(w, "%s:%d: %s: %s has no allocbound\n", u.Pos.Filename, u.Pos.Line, u.Path, u.Type)
+	}
+	return len(unbounded)
+}
+
 func format(file string, data []byte, skipFormat bool) error {
 	if skipFormat {
 		return ioutil.WriteFile(file, data, 0600)
@@ -95,28 +241,46 @@ func dedupImports(imp []string) []string {
 	for k := range m {
 		r = append(r, k)
 	}
+	sort.Strings(r)
 	return r
 }
 
+// importName returns the name that an import is referred
+// to by: its alias, if it has one, or otherwise the name the
+// package itself is assumed to declare, following the same
+// conventions as goimports.
+func importName(imp *ast.ImportSpec) string {
+	if imp.Name != nil {
+		return imp.Name.Name
+	}
+	importPath, err := strconv.Unquote(imp.Path.Value)
+	if err != nil {
+		return ""
+	}
+	base := path.Base(importPath)
+	if strings.HasPrefix(base, "v") {
+		if _, err := strconv.Atoi(base[1:]); err == nil {
+			if dir := path.Dir(importPath); dir != "." {
+				base = path.Base(dir)
+			}
+		}
+	}
+	base = strings.TrimPrefix(base, "go-")
+	if i := strings.IndexFunc(base, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	}); i >= 0 {
+		base = base[:i]
+	}
+	return base
+}
+
 func generate(f *parse.FileSet, mode gen.Method) (*bytes.Buffer, *bytes.Buffer, error) {
 	outbuf := bytes.NewBuffer(make([]byte, 0, 4096))
 	writePkgHeader(outbuf, f.Package)
 
-	myImports := []string{"github.com/algorand/msgp/msgp"}
-	for _, imp := range f.Imports {
-		if imp.Name != nil {
-			// have an alias, include it.
-			myImports = append(myImports, imp.Name.Name+` `+imp.Path.Value)
-		} else {
-			myImports = append(myImports, imp.Path.Value)
-		}
-	}
-	dedup := dedupImports(myImports)
-	writeImportHeader(outbuf, dedup...)
-
 	var testbuf *bytes.Buffer
 	var testwr io.Writer
-	if mode&gen.Test == gen.Test {
+	if mode&gen.Test == gen.Test || mode&gen.Bench == gen.Bench {
 		testbuf = bytes.NewBuffer(make([]byte, 0, 4096))
 		writeBuildHeader(testbuf, []string{"!skip_msgp_testing"})
 		writePkgHeader(testbuf, f.Package)
@@ -131,12 +295,65 @@ func generate(f *parse.FileSet, mode gen.Method) (*bytes.Buffer, *bytes.Buffer,
 	funcbuf := bytes.NewBuffer(make([]byte, 0, 4096))
 	var topics gen.Topics
 
-	err := f.PrintTo(gen.NewPrinter(mode, &topics, funcbuf, testwr))
-	if err == nil {
-		outbuf.Write(topics.Bytes())
-		outbuf.Write(funcbuf.Bytes())
+	p := gen.NewPrinter(mode, &topics, funcbuf, testwr)
+	err := f.PrintTo(p)
+	if err != nil {
+		return outbuf, testbuf, err
+	}
+
+	// Only import the packages that the generated code
+	// actually refers to, so that the output compiles even
+	// when it is not run through goimports. If the code
+	// cannot be parsed, fall back to importing everything
+	// and let the formatter report the problem.
+	var used map[string]bool
+	if names := p.UsedImports(); names != nil {
+		used = make(map[string]bool, len(names))
+		for _, name := range names {
+			used[name] = true
+		}
+	}
+	var myImports []string
+	if used == nil || used["msgp"] {
+		myImports = append(myImports, `"github.com/algorand/msgp/msgp"`)
+	}
+	imported := make(map[string]bool)
+	for _, imp := range f.Imports {
+		name := importName(imp)
+		if name == "_" || name == "." || (used != nil && !used[name]) {
+			continue
+		}
+		imported[name] = true
+		if imp.Name != nil {
+			// have an alias, include it.
+			myImports = append(myImports, imp.Name.Name+` `+imp.Path.Value)
+		} else {
+			myImports = append(myImports, imp.Path.Value)
+		}
+	}
+	// the generated code may also refer to these
+	// packages on its own
+	for _, std := range []string{"bytes", "math", "reflect", "sort", "sync"} {
+		if used[std] && !imported[std] {
+			myImports = append(myImports, strconv.Quote(std))
+		}
+	}
+	if (used == nil && mode&gen.CBOR == gen.CBOR) || (used["cbor"] && !imported["cbor"]) {
+		myImports = append(myImports, `"github.com/algorand/msgp/msgp/cbor"`)
 	}
-	return outbuf, testbuf, err
+	if f.MovedFrom != nil {
+		myImports = append(myImports, f.MovedFrom.Name.Name+` `+f.MovedFrom.Path.Value)
+	}
+	if len(myImports) > 0 {
+		writeImportHeader(outbuf, dedupImports(myImports)...)
+	}
+	if f.MovedFrom != nil {
+		writeMovedTypes(outbuf, f)
+	}
+
+	outbuf.Write(topics.Bytes())
+	outbuf.Write(funcbuf.Bytes())
+	return outbuf, testbuf, nil
 }
 
 func writePkgHeader(b *bytes.Buffer, name string) {
@@ -162,6 +379,21 @@ func writeImportHeader(b *bytes.Buffer, imports ...string) {
 	b.WriteString(")\n\n")
 }
 
+// writeMovedTypes declares the types of f in the package
+// that their methods are generated in, as the types of the
+// package that f was moved from
+func writeMovedTypes(b *bytes.Buffer, f *parse.FileSet) {
+	names := make([]string, 0, len(f.Identities))
+	for name := range f.Identities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(b, "type %s %s.%s\n", name, f.MovedFrom.Name.Name, name)
+	}
+	b.WriteByte('\n')
+}
+
 func writeBuildHeader(b *bytes.Buffer, buildHeaders []string) {
 	headers := fmt.Sprintf("//go:build %s\n// +build %s\n\n", strings.Join(buildHeaders, " "), strings.Join(buildHeaders, " "))
 	b.WriteString(headers)
@@ -2,7 +2,18 @@ package printer
 
 import (
 	"bytes"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/algorand/msgp/gen"
+	"github.com/algorand/msgp/parse"
 )
 
 func TestWriteBuildHeader(t *testing.T) {
@@ -17,3 +28,253 @@ func TestWriteBuildHeader(t *testing.T) {
 		t.Errorf("testBuf:\n%s not equal to expectedBuf:\n%s", testBuf, expectedBuf)
 	}
 }
+
+// parseSource writes src to file and parses it.
+func parseSource(t *testing.T, file string, src string) *parse.FileSet {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := parse.File(file, true, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+func TestImportName(t *testing.T) {
+	for path, want := range map[string]string{
+		`"time"`:                      "time",
+		`"math/big"`:                  "big",
+		`"github.com/foo/go-bar"`:     "bar",
+		`"gopkg.in/yaml.v2"`:          "yaml",
+		`"github.com/foo/bar/v3"`:     "bar",
+		`"github.com/foo/bar-baz.go"`: "bar",
+	} {
+		imp := &ast.ImportSpec{Path: &ast.BasicLit{Kind: token.STRING, Value: path}}
+		if got := importName(imp); got != want {
+			t.Errorf("importName(%s) = %q; want %q", path, got, want)
+		}
+	}
+	imp := &ast.ImportSpec{Name: ast.NewIdent("alias"), Path: &ast.BasicLit{Kind: token.STRING, Value: `"time"`}}
+	if got := importName(imp); got != "alias" {
+		t.Errorf("importName of aliased import = %q; want %q", got, "alias")
+	}
+}
+
+func TestGenerateImportsOnlyReferencedPackages(t *testing.T) {
+	src := `package foo
+
+import (
+	"fmt"
+	"math/big"
+	nip "net/netip"
+	_ "embed"
+)
+
+type Foo struct {
+	_struct struct{} ` + "`codec:\",omitempty,omitemptyarray\"`" + `
+	A       *big.Int ` + "`codec:\"a\"`" + `
+	B       nip.Addr ` + "`codec:\"b\"`" + `
+}
+
+var _ = fmt.Sprint
+`
+	fs := parseSource(t, filepath.Join(t.TempDir(), "foo.go"), src)
+	out, _, err := generate(fs, gen.Marshal|gen.Unmarshal|gen.Size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := out.String()[:strings.Index(out.String(), ")")]
+	for _, want := range []string{`"github.com/algorand/msgp/msgp"`, `"math/big"`} {
+		if !strings.Contains(header, want) {
+			t.Errorf("missing import %s in:\n%s", want, header)
+		}
+	}
+	for _, unwanted := range []string{`"fmt"`, `"embed"`} {
+		if strings.Contains(header, unwanted) {
+			t.Errorf("unreferenced import %s in:\n%s", unwanted, header)
+		}
+	}
+}
+
+func TestPrintFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := make(map[string]*parse.FileSet)
+	for _, name := range []string{"a", "b", "c"} {
+		src := "package foo\n\ntype " + strings.ToUpper(name) + " struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tX int64 `codec:\"x\"`\n}\n"
+		fs := parseSource(t, filepath.Join(dir, name+".go"), src)
+		files[filepath.Join(dir, name)] = fs
+	}
+	if err := PrintFiles(files, DefaultSuffix, gen.Marshal|gen.Unmarshal|gen.Size, false, 2); err != nil {
+		t.Fatal(err)
+	}
+	for base := range files {
+		file := base + DefaultSuffix
+		out, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(out, []byte("MarshalMsg")) {
+			t.Errorf("%s has no generated code:\n%s", file, out)
+		}
+	}
+}
+
+func TestPrintCombined(t *testing.T) {
+	dir := t.TempDir()
+	srcs := map[string]string{
+		"a.go": "package foo\n\ntype A struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tB B `codec:\"b\"`\n}\n",
+		"b.go": "package foo\n\ntype B struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tX []int64 `codec:\"x,allocbound=4\"`\n}\n",
+	}
+	var files []*parse.FileSet
+	for _, name := range []string{"a.go", "b.go"} {
+		files = append(files, parseSource(t, filepath.Join(dir, name), srcs[name]))
+	}
+	base := filepath.Join(dir, "msgp")
+	if err := PrintCombined(base, DefaultSuffix, files, gen.Marshal|gen.Unmarshal|gen.Size|gen.MaxSize|gen.IsZero, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// the combined file compiles along with both inputs
+	fset := token.NewFileSet()
+	var asts []*ast.File
+	for _, name := range []string{"a.go", "b.go", "msgp_gen.go"} {
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		asts = append(asts, f)
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	if _, err := conf.Check("foo", fset, asts, nil); err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.ReadFile(base + DefaultSuffix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a, b := bytes.Index(out, []byte("func (z *A) MarshalMsg")), bytes.Index(out, []byte("func (z *B) MarshalMsg")); a < 0 || b < a {
+		t.Errorf("A and B not in order:\n%s", out)
+	}
+
+	if err := PrintCombined(base, DefaultSuffix, []*parse.FileSet{files[0], files[0]}, gen.Marshal, false); err == nil {
+		t.Error("no error for a type declared twice")
+	}
+	bar := parseSource(t, filepath.Join(t.TempDir(), "bar.go"), "package bar\n\ntype C struct{}\n")
+	if err := PrintCombined(base, DefaultSuffix, []*parse.FileSet{files[0], bar}, gen.Marshal, false); err == nil {
+		t.Error("no error for two packages")
+	}
+}
+
+func TestPrintPlan(t *testing.T) {
+	dir := t.TempDir()
+	fs := parseSource(t, filepath.Join(dir, "foo.go"), "package foo\n\n"+
+		"//msgp:ignore Ignored\n\n"+
+		"type Encoded struct {\n\tX int64 `codec:\"x\"`\n}\n\n"+
+		"type Ignored struct {\n\tX int64 `codec:\"x\"`\n}\n")
+
+	var buf bytes.Buffer
+	PrintPlan(&buf, fs)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected a header and 2 rows; got:\n%s", buf.String())
+	}
+	for i, want := range []string{"generate", "skip"} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("row %d: expected %q; got %q", i, want, lines[i+1])
+		}
+	}
+	if !strings.HasSuffix(lines[2], "msgp:ignore") {
+		t.Errorf("missing reason: %q", lines[2])
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("PrintPlan wrote files: %v", entries)
+	}
+}
+
+func TestPrintLint(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{"bad.go", "package bad\n\n" +
+			"//msgp:securetype Bad\n\n" +
+			"type Bad struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tIDs []uint64 `codec:\"ids,allocbound=64\"`\n" +
+			"\tName string `codec:\"name\"`\n}\n",
+			[]string{"bad.go:8: Bad.Name: string has no allocbound"}},
+		{"good.go", "package good\n\n" +
+			"//msgp:securetype Good\n\n" +
+			"type Good struct {\n" +
+			"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n" +
+			"\tIDs []uint64 `codec:\"ids,allocbound=64\"`\n" +
+			"\tName string `codec:\"name,allocbound=32\"`\n" +
+			"\tM map[uint64]uint64 `codec:\"m,allocbound=8\"`\n}\n",
+			nil},
+	} {
+		dir := t.TempDir()
+		fs := parseSource(t, filepath.Join(dir, tc.name), tc.src)
+		var buf bytes.Buffer
+		n := PrintLint(&buf, fs)
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if n != len(tc.want) || n == 0 && buf.Len() > 0 {
+			t.Fatalf("%s: %d unbounded values:\n%s", tc.name, n, buf.String())
+		}
+		for i, want := range tc.want {
+			if !strings.HasSuffix(lines[i], want) {
+				t.Errorf("%s: line %q; want %q", tc.name, lines[i], want)
+			}
+		}
+		if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+			t.Errorf("PrintLint wrote files: %v", entries)
+		}
+	}
+}
+
+func TestPrintFileSuffix(t *testing.T) {
+	dir := t.TempDir()
+	fs := parseSource(t, filepath.Join(dir, "foo.go"), "package foo\n\n"+
+		"type Foo struct {\n"+
+		"\t_struct struct{} `codec:\",omitempty,omitemptyarray\"`\n"+
+		"\tX int64 `codec:\"x\"`\n}\n")
+	base := filepath.Join(dir, "foo")
+	if err := PrintFile(base, "_msgp_gen.go", fs, gen.Marshal|gen.Unmarshal|gen.Size|gen.Test, false); err != nil {
+		t.Fatal(err)
+	}
+	for file, want := range map[string][]string{
+		"foo_msgp_gen.go":      {"// Code generated by github.com/algorand/msgp DO NOT EDIT.", "MarshalMsg"},
+		"foo_msgp_gen_test.go": {"//go:build !skip_msgp_testing", "// Code generated by github.com/algorand/msgp DO NOT EDIT."},
+	} {
+		out, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range want {
+			if !bytes.Contains(out, []byte(w)) {
+				t.Errorf("no %q in %s:\n%s", w, file, out)
+			}
+		}
+	}
+
+	for _, bad := range []string{"_gen", "_gen_test.go", "/gen.go", "_linux.go", "_gen_amd64.go", "_windows_arm64.go"} {
+		if err := PrintFile(base, bad, fs, gen.Marshal, false); err == nil {
+			t.Errorf("no error for suffix %q", bad)
+		}
+	}
+	if got := TestSuffix(DefaultSuffix); got != "_gen_test.go" {
+		t.Errorf("TestSuffix(%q) = %q", DefaultSuffix, got)
+	}
+}